@@ -0,0 +1,162 @@
+// Package clamd implements the client of the clamd INSTREAM scanning over TCP or Unix socket
+package clamd
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	// chunkSize is the size of the chunks sent to clamd,
+	// it must be less than StreamMaxLength of clamd
+	chunkSize = 64 * 1024
+
+	replyOK    = "OK"
+	replyFound = " FOUND"
+	replyError = " ERROR"
+)
+
+var ErrInvalidAddress = errors.New("invalid clamd address")
+
+// Result is the verdict of the scanned stream
+type Result struct {
+	Infected bool
+	// Signature is the name of the virus found
+	Signature string
+}
+
+type Client struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+// NewClient creates the client of clamd listening on the address,
+// which is 'tcp://host:port', 'unix:///path/to/clamd.sock' or 'host:port'.
+// timeout limits the whole scanning of a stream
+func NewClient(address string, timeout time.Duration) (*Client, error) {
+	network := "tcp"
+	if i := strings.Index(address, "://"); i >= 0 {
+		network, address = address[:i], address[i+3:]
+	}
+	if (network != "tcp" && network != "unix") || address == "" {
+		return nil, ErrInvalidAddress
+	}
+	return &Client{network: network, address: address, timeout: timeout}, nil
+}
+
+// Ping checks if clamd is available
+func (c *Client) Ping(ctx context.Context) error {
+	reply, e := c.command(ctx, "zPING\x00", nil)
+	if e != nil {
+		return e
+	}
+	if reply != "PONG" {
+		return fmt.Errorf("unexpected reply of clamd: %s", reply)
+	}
+	return nil
+}
+
+// Scan streams the content of reader to clamd by the INSTREAM command
+func (c *Client) Scan(ctx context.Context, reader io.Reader) (Result, error) {
+	reply, e := c.command(ctx, "zINSTREAM\x00", reader)
+	if e != nil {
+		return Result{}, e
+	}
+	return parseReply(reply)
+}
+
+// command sends the command and the stream if reader is not nil, returns the reply without the trailing NUL
+func (c *Client) command(ctx context.Context, command string, reader io.Reader) (string, error) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	dialer := net.Dialer{}
+	conn, e := dialer.DialContext(ctx, c.network, c.address)
+	if e != nil {
+		return "", e
+	}
+	defer func() { _ = conn.Close() }()
+
+	// interrupt the blocking io when ctx is done
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	if _, e := io.WriteString(conn, command); e != nil {
+		return "", c.wrapError(ctx, e)
+	}
+	if reader != nil {
+		if e := writeChunks(conn, reader); e != nil {
+			return "", c.wrapError(ctx, e)
+		}
+	}
+	reply, e := bufio.NewReader(conn).ReadString(0)
+	if e != nil && !(e == io.EOF && reply != "") {
+		return "", c.wrapError(ctx, e)
+	}
+	return strings.TrimRight(reply, "\x00\n"), nil
+}
+
+func (c *Client) wrapError(ctx context.Context, e error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return e
+}
+
+// writeChunks writes the content in chunks prefixed with the 4 bytes big-endian length,
+// then a zero-length chunk to end the stream
+func writeChunks(w io.Writer, reader io.Reader) error {
+	buf := make([]byte, 4+chunkSize)
+	for {
+		n, e := reader.Read(buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+			if _, we := w.Write(buf[:4+n]); we != nil {
+				return we
+			}
+		}
+		if e == io.EOF {
+			break
+		}
+		if e != nil {
+			return e
+		}
+	}
+	_, e := w.Write([]byte{0, 0, 0, 0})
+	return e
+}
+
+// parseReply parses the reply like 'stream: OK' or 'stream: Eicar-Signature FOUND'
+func parseReply(reply string) (Result, error) {
+	i := strings.Index(reply, ": ")
+	if i < 0 {
+		return Result{}, fmt.Errorf("unexpected reply of clamd: %s", reply)
+	}
+	verdict := reply[i+2:]
+	switch {
+	case verdict == replyOK:
+		return Result{}, nil
+	case strings.HasSuffix(verdict, replyFound):
+		return Result{Infected: true, Signature: strings.TrimSuffix(verdict, replyFound)}, nil
+	case strings.HasSuffix(verdict, replyError):
+		return Result{}, fmt.Errorf("clamd error: %s", strings.TrimSuffix(verdict, replyError))
+	}
+	return Result{}, fmt.Errorf("unexpected reply of clamd: %s", reply)
+}
@@ -0,0 +1,118 @@
+package clamd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// fakeClamd replies 'FOUND' if the stream contains the EICAR test string
+func fakeClamd(t *testing.T) net.Listener {
+	l, e := net.Listen("tcp", "127.0.0.1:0")
+	if e != nil {
+		t.Fatal(e)
+	}
+	go func() {
+		for {
+			conn, e := l.Accept()
+			if e != nil {
+				return
+			}
+			go serveFakeClamd(conn)
+		}
+	}()
+	return l
+}
+
+func serveFakeClamd(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	r := bufio.NewReader(conn)
+	command, e := r.ReadString(0)
+	if e != nil {
+		return
+	}
+	switch command {
+	case "zPING\x00":
+		_, _ = conn.Write([]byte("PONG\x00"))
+		return
+	case "zINSTREAM\x00":
+	default:
+		_, _ = conn.Write([]byte("UNKNOWN COMMAND\x00"))
+		return
+	}
+	content := bytes.Buffer{}
+	size := make([]byte, 4)
+	for {
+		if _, e := io.ReadFull(r, size); e != nil {
+			return
+		}
+		n := binary.BigEndian.Uint32(size)
+		if n == 0 {
+			break
+		}
+		if _, e := io.CopyN(&content, r, int64(n)); e != nil {
+			return
+		}
+	}
+	reply := "stream: OK\x00"
+	if strings.Contains(content.String(), eicar) {
+		reply = "stream: Eicar-Test-Signature FOUND\x00"
+	}
+	_, _ = conn.Write([]byte(reply))
+}
+
+func TestScan(t *testing.T) {
+	l := fakeClamd(t)
+	defer func() { _ = l.Close() }()
+	c, e := NewClient("tcp://"+l.Addr().String(), 5*time.Second)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if e := c.Ping(context.Background()); e != nil {
+		t.Errorf("expect ping succeeded, but it's %v", e)
+	}
+
+	// larger than a chunk
+	clean := strings.Repeat("hello world\n", chunkSize/6)
+	r, e := c.Scan(context.Background(), strings.NewReader(clean))
+	if e != nil || r.Infected {
+		t.Errorf("expect clean, but it's %v, %v", r, e)
+	}
+	r, e = c.Scan(context.Background(), strings.NewReader(clean+eicar))
+	if e != nil || !r.Infected || r.Signature != "Eicar-Test-Signature" {
+		t.Errorf("expect infected by 'Eicar-Test-Signature', but it's %v, %v", r, e)
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	for _, addr := range []string{"", "tcp://", "http://localhost:3310"} {
+		if _, e := NewClient(addr, 0); e != ErrInvalidAddress {
+			t.Errorf("'%s': expect ErrInvalidAddress, but it's %v", addr, e)
+		}
+	}
+	c, e := NewClient("unix:///var/run/clamd.sock", 0)
+	if e != nil || c.network != "unix" || c.address != "/var/run/clamd.sock" {
+		t.Errorf("expect unix socket '/var/run/clamd.sock', but it's %v, %v", c, e)
+	}
+	c, e = NewClient("localhost:3310", 0)
+	if e != nil || c.network != "tcp" || c.address != "localhost:3310" {
+		t.Errorf("expect tcp address 'localhost:3310', but it's %v, %v", c, e)
+	}
+}
+
+func TestParseReply(t *testing.T) {
+	if _, e := parseReply("stream: INSTREAM size limit exceeded. ERROR"); e == nil {
+		t.Errorf("expect error, but it's nil")
+	}
+	if _, e := parseReply("UNKNOWN COMMAND"); e == nil {
+		t.Errorf("expect error, but it's nil")
+	}
+}
@@ -4,7 +4,10 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"go-drive/common/logging"
 	"go-drive/common/registry"
+	"go-drive/common/utils"
+	"net"
 	"os"
 	"path"
 	"path/filepath"
@@ -18,23 +21,43 @@ var (
 )
 
 const (
-	DbType     = "sqlite3"
-	DbFilename = "data.db"
-	LocalFsDir = "local"
-	Listen     = ":8089"
+	DbTypeSqlite   = "sqlite3"
+	DbTypeMySQL    = "mysql"
+	DbTypePostgres = "postgres"
+	DbFilename     = "data.db"
+	LocalFsDir     = "local"
+	Listen         = ":8089"
+
+	TokenStoreFile = "file"
+	TokenStoreMem  = "mem"
+	TokenStoreJwt  = "jwt"
+	TokenStoreDb   = "db"
 )
 
 func InitConfig(ch *registry.ComponentsHolder) (Config, error) {
 	config := Config{}
 
-	var v bool
+	var v, printCfg bool
+	var configFile string
 	flag.BoolVar(&v, "v", false, "print version")
+	flag.StringVar(&configFile, "c", "", "path to the YAML or TOML(.toml) config file, "+
+		"the keys are the same as the flags, and can be overridden by the environment variables "+
+		"like "+EnvPrefix+"TOKEN_VALIDITY and the flags. Defaults to $"+EnvPrefix+"CONFIG")
+	flag.BoolVar(&printCfg, "print-config", false, "print the effective config with secrets masked and exit")
 
 	flag.StringVar(&config.Listen, "l", Listen, "address listen on")
 	flag.StringVar(&config.dataDir, "d", "./", "path to the data dir")
 	flag.StringVar(&config.resDir, "s", "./web", "path to the static files")
 	flag.BoolVar(&config.freeFs, "f", false, "enable unlimited local fs drive(absolute path)")
 
+	flag.StringVar(&config.dbType, "db-type", DbTypeSqlite, "database type: sqlite3, mysql or postgres")
+	flag.StringVar(&config.dbDSN, "db-dsn", "", "database DSN, defaults to dataDir/data.db for sqlite3.\n"+
+		"mysql: user:password@tcp(host:3306)/go_drive?charset=utf8mb4\n"+
+		"postgres: host=localhost port=5432 user=go_drive password=xxx dbname=go_drive sslmode=disable")
+
+	flag.BoolVar(&config.AutoMigrate, "auto-migrate", true, "apply database migrations on start")
+	flag.BoolVar(&config.MigrateOnly, "migrate", false, "apply database migrations and exit")
+
 	flag.StringVar(&config.langDir, "lang-dir", "./lang", "languages configuration folder")
 	flag.StringVar(&config.DefaultLang, "lang", "en-US", "default language code")
 
@@ -47,10 +70,36 @@ func InitConfig(ch *registry.ComponentsHolder) (Config, error) {
 	flag.IntVar(&config.ThumbnailConcurrent, "thumbnail-concurrent", 16, "maximum number of concurrent creation of thumbnails")
 	flag.DurationVar(&config.ThumbnailCacheTTl, "thumbnail-cache-ttl", 48*time.Hour, "thumbnail cache validity")
 
+	flag.DurationVar(&config.UploadTempTTL, "upload-temp-ttl", 24*time.Hour, "unfinished uploads idle longer than it are removed, 0 to keep forever")
+
 	flag.IntVar(&config.MaxConcurrentTask, "max-concurrent-task", 100, "maximum concurrent task(copy, move, upload, delete files)")
 
 	flag.DurationVar(&config.TokenValidity, "token-validity", 2*time.Hour, "token validity")
 	flag.BoolVar(&config.TokenRefresh, "token-refresh", true, "enable auto refresh token")
+	flag.DurationVar(&config.AccessKeyValidity, "access-key-validity", 12*time.Hour, "validity of the signed urls of files")
+	flag.DurationVar(&config.SignerKeyRotation, "signer-key-rotation", 30*24*time.Hour, "rotation interval of the url signing key, 0 to disable")
+	flag.DurationVar(&config.SignerKeyGrace, "signer-key-grace", 24*time.Hour, "duration that the rotated url signing key is still valid, at least access-key-validity")
+	flag.StringVar(&config.TokenStore, "token-store", TokenStoreFile, "session token store: file, mem, db or jwt")
+	flag.StringVar(&config.TokenSecret, "token-secret", "", "HMAC secret of the jwt token store, must be the same across instances")
+
+	flag.StringVar(&config.logFormat, "log-format", logging.FormatLogfmt, "log format: logfmt or json")
+	flag.StringVar(&config.logLevel, "log-level", "info", "default log level: debug, info, warn or error")
+	flag.StringVar(&config.logLevels, "log-levels", "", "log levels of subsystems, e.g. 'drive=debug,http=warn'")
+
+	flag.DurationVar(&config.AuditRetention, "audit-retention", 90*24*time.Hour, "retention of the audit logs, 0 to keep forever")
+
+	flag.BoolVar(&config.UploadHooks, "upload-hooks", false, "enable the upload hooks, which run the commands configured by admins on the uploaded files")
+
+	flag.StringVar(&config.ClamdAddress, "clamd", "", "address of clamd to scan the uploaded files, "+
+		"e.g. tcp://127.0.0.1:3310 or unix:///var/run/clamav/clamd.ctl, scanning is disabled if empty")
+	flag.DurationVar(&config.ClamdTimeout, "clamd-timeout", 2*time.Minute, "timeout of scanning a file by clamd")
+	flag.BoolVar(&config.ClamdQuarantine, "clamd-quarantine", false, "copy the infected files to the quarantine dir rather than only rejecting them")
+
+	flag.StringVar(&config.trustedProxies, "trusted-proxies", "", "comma separated IPs or CIDRs of the reverse proxies, "+
+		"the X-Forwarded-For header is used as the client ip only if the request comes from them")
+
+	flag.StringVar(&config.MetricsToken, "metrics-token", "", "bearer token required by the /metrics endpoint, "+
+		"the sessions or personal access tokens of administrators are required if empty")
 
 	flag.Parse()
 
@@ -59,9 +108,35 @@ func InitConfig(ch *registry.ComponentsHolder) (Config, error) {
 		os.Exit(0)
 	}
 
-	if _, e := os.Stat(config.dataDir); os.IsNotExist(e) {
-		return config, errors.New(fmt.Sprintf("dataDir '%s' does not exist", config.dataDir))
+	if configFile == "" {
+		configFile = os.Getenv(EnvPrefix + "CONFIG")
+	}
+	fileValues := make(map[string]string)
+	if configFile != "" {
+		values, e := loadConfigFile(configFile)
+		if e != nil {
+			return config, e
+		}
+		fileValues = values
+	}
+	if e := applyConfigSources(flag.CommandLine, fileValues); e != nil {
+		return config, e
+	}
+
+	if e := config.validate(); e != nil {
+		return config, e
+	}
+	if e := config.configureLogging(); e != nil {
+		return config, e
+	}
+
+	if printCfg {
+		if e := printConfig(flag.CommandLine); e != nil {
+			return config, e
+		}
+		os.Exit(0)
 	}
+
 	tempDir, e := config.GetDir("temp", true)
 	if e != nil {
 		return config, e
@@ -72,6 +147,69 @@ func InitConfig(ch *registry.ComponentsHolder) (Config, error) {
 	return config, nil
 }
 
+func (c Config) validate() error {
+	switch c.dbType {
+	case DbTypeSqlite:
+	case DbTypeMySQL, DbTypePostgres:
+		if c.dbDSN == "" {
+			return errors.New(fmt.Sprintf("db-dsn is required by database '%s'", c.dbType))
+		}
+	default:
+		return errors.New(fmt.Sprintf("unknown database type '%s'", c.dbType))
+	}
+
+	switch c.TokenStore {
+	case TokenStoreFile, TokenStoreMem, TokenStoreDb:
+	case TokenStoreJwt:
+		if c.TokenSecret == "" {
+			return errors.New("token-secret is required by the jwt token store")
+		}
+	default:
+		return errors.New(fmt.Sprintf("unknown token store '%s'", c.TokenStore))
+	}
+
+	if c.Listen == "" {
+		return errors.New("listen address is required")
+	}
+	if c.ThumbnailConcurrent <= 0 {
+		return errors.New("thumbnail-concurrent must be positive")
+	}
+	if c.MaxConcurrentTask <= 0 {
+		return errors.New("max-concurrent-task must be positive")
+	}
+
+	if _, e := utils.ParseCIDRs(c.trustedProxies); e != nil {
+		return errors.New(fmt.Sprintf("invalid trusted-proxies: %s", e.Error()))
+	}
+
+	if e := logging.CheckFormat(c.logFormat); e != nil {
+		return e
+	}
+	if _, e := logging.ParseLevel(c.logLevel); e != nil {
+		return e
+	}
+	if _, e := logging.ParseLevels(c.logLevels); e != nil {
+		return e
+	}
+
+	if _, e := os.Stat(c.dataDir); os.IsNotExist(e) {
+		return errors.New(fmt.Sprintf("dataDir '%s' does not exist", c.dataDir))
+	}
+	return nil
+}
+
+func (c Config) configureLogging() error {
+	level, e := logging.ParseLevel(c.logLevel)
+	if e != nil {
+		return e
+	}
+	levels, e := logging.ParseLevels(c.logLevels)
+	if e != nil {
+		return e
+	}
+	return logging.Configure(c.logFormat, level, levels)
+}
+
 type Config struct {
 	Listen  string
 	dataDir string
@@ -81,6 +219,13 @@ type Config struct {
 	// fs drive path will be limited in dataDir/local if freeFs is false
 	freeFs bool
 
+	dbType string
+	dbDSN  string
+	// AutoMigrate applies the pending migrations on start, or refuse to start if it's false
+	AutoMigrate bool
+	// MigrateOnly applies the pending migrations and exits
+	MigrateOnly bool
+
 	langDir string
 	// DefaultLang is the default language
 	DefaultLang string
@@ -101,14 +246,63 @@ type Config struct {
 	ThumbnailConcurrent int
 	ThumbnailMaxPixels  int
 
+	// UploadTempTTL is how long the unfinished chunk and tus uploads are kept after the last write, forever if it's 0
+	UploadTempTTL time.Duration
+
 	MaxConcurrentTask int
 
 	TokenValidity time.Duration
 	TokenRefresh  bool
+	// TokenStore is the type of the session token store
+	TokenStore  string
+	TokenSecret string
+
+	// AccessKeyValidity is the validity of the signed urls
+	AccessKeyValidity time.Duration
+	SignerKeyRotation time.Duration
+	SignerKeyGrace    time.Duration
+
+	// AuditRetention is how long the audit logs are kept, forever if it's 0
+	AuditRetention time.Duration
+
+	// UploadHooks enables running the commands of the upload hooks
+	UploadHooks bool
+
+	// ClamdAddress is the address of clamd, the uploaded files are not scanned if it's empty
+	ClamdAddress    string
+	ClamdTimeout    time.Duration
+	ClamdQuarantine bool
+
+	// MetricsToken is the bearer token of the Prometheus metrics endpoint
+	MetricsToken string
+
+	// trustedProxies is the comma separated networks of the reverse proxies
+	trustedProxies string
+
+	logFormat string
+	logLevel  string
+	// logLevels is the initial log levels of subsystems, which can be changed at runtime
+	logLevels string
+}
+
+// NewSqliteConfig creates the config with the sqlite database and the data in dataDir,
+// the other options are zero values. It's used by tests.
+func NewSqliteConfig(dataDir string) Config {
+	return Config{dataDir: dataDir, dbType: DbTypeSqlite, AutoMigrate: true}
 }
 
+// GetDB returns the dialect and DSN of the database
 func (c Config) GetDB() (string, string) {
-	return DbType, path.Join(c.dataDir, DbFilename)
+	if c.dbType == DbTypeSqlite && c.dbDSN == "" {
+		return DbTypeSqlite, path.Join(c.dataDir, DbFilename)
+	}
+	return c.dbType, c.dbDSN
+}
+
+// GetTrustedProxies returns the networks of the reverse proxies, whose X-Forwarded-For header is trusted
+func (c Config) GetTrustedProxies() []*net.IPNet {
+	nets, _ := utils.ParseCIDRs(c.trustedProxies)
+	return nets
 }
 
 func (c Config) GetDir(name string, create bool) (string, error) {
@@ -0,0 +1,159 @@
+package common
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// EnvPrefix is the prefix of the environment variables of configs,
+// e.g. GO_DRIVE_TOKEN_VALIDITY=4h for -token-validity
+const EnvPrefix = "GO_DRIVE_"
+
+const maskedValue = "******"
+
+// configKeys are the names in the config file and environment variables of the short flags
+var configKeys = map[string]string{
+	"l": "listen",
+	"d": "data-dir",
+	"s": "static-dir",
+	"f": "free-fs",
+}
+
+// commandFlags are not configs, they can only be set by the command line
+var commandFlags = map[string]bool{
+	"v":            true,
+	"c":            true,
+	"print-config": true,
+	"migrate":      true,
+}
+
+// secretConfigs will be masked when printing the config
+var secretConfigs = map[string]bool{
+	"db-dsn":        true,
+	"token-secret":  true,
+	"metrics-token": true,
+}
+
+func configKey(flagName string) string {
+	if k, ok := configKeys[flagName]; ok {
+		return k
+	}
+	return flagName
+}
+
+func envName(key string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+}
+
+// loadConfigFile reads the YAML or TOML(by the extension .toml) config file,
+// the keys are the same as the flags
+func loadConfigFile(file string) (map[string]string, error) {
+	bytes, e := ioutil.ReadFile(file)
+	if e != nil {
+		return nil, e
+	}
+	values := make(map[string]interface{})
+	if strings.ToLower(filepath.Ext(file)) == ".toml" {
+		e = toml.Unmarshal(bytes, &values)
+	} else {
+		e = yaml.Unmarshal(bytes, &values)
+	}
+	if e != nil {
+		return nil, errors.New(fmt.Sprintf("error when parsing config file '%s': %v", file, e))
+	}
+	result := make(map[string]string, len(values))
+	for k, v := range values {
+		switch v.(type) {
+		case map[interface{}]interface{}, map[string]interface{}, []interface{}:
+			return nil, errors.New(fmt.Sprintf("invalid value of '%s' in config file", k))
+		}
+		result[k] = fmt.Sprint(v)
+	}
+	return result, nil
+}
+
+// applyConfigSources sets the flags that are not set by the command line,
+// from environment variables first, then the config file.
+// The precedence is: flags > environment variables > config file > defaults
+func applyConfigSources(fs *flag.FlagSet, file map[string]string) error {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	known := make(map[string]bool)
+	var e error
+	fs.VisitAll(func(f *flag.Flag) {
+		if e != nil || commandFlags[f.Name] {
+			return
+		}
+		key := configKey(f.Name)
+		known[key] = true
+		if set[f.Name] {
+			return
+		}
+		source := envName(key)
+		value, ok := os.LookupEnv(source)
+		if !ok {
+			source = "config file"
+			value, ok = file[key]
+		}
+		if !ok {
+			return
+		}
+		if se := fs.Set(f.Name, value); se != nil {
+			e = errors.New(fmt.Sprintf("invalid value '%s' of '%s' from %s: %v", value, key, source, se))
+		}
+	})
+	if e != nil {
+		return e
+	}
+	for k := range file {
+		if !known[k] {
+			return errors.New(fmt.Sprintf("unknown config '%s' in config file", k))
+		}
+	}
+	return nil
+}
+
+// printConfig prints the effective config in YAML, which can be used as the config file
+func printConfig(fs *flag.FlagSet) error {
+	values := make(map[string]interface{})
+	fs.VisitAll(func(f *flag.Flag) {
+		if commandFlags[f.Name] {
+			return
+		}
+		key := configKey(f.Name)
+		var value interface{} = f.Value.String()
+		if secretConfigs[key] && value != "" {
+			value = maskedValue
+		}
+		// keep numbers and booleans unquoted
+		if g, ok := f.Value.(flag.Getter); ok {
+			switch v := g.Get().(type) {
+			case bool, int, int64:
+				value = v
+			}
+		}
+		values[key] = value
+	})
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v, e := yaml.Marshal(values[k])
+		if e != nil {
+			return e
+		}
+		fmt.Printf("%s: %s", k, v)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package common
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestFlagSet(args ...string) (*flag.FlagSet, *Config) {
+	c := &Config{}
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.StringVar(&c.Listen, "l", Listen, "")
+	fs.StringVar(&c.TokenStore, "token-store", TokenStoreFile, "")
+	fs.DurationVar(&c.TokenValidity, "token-validity", 2*time.Hour, "")
+	fs.IntVar(&c.MaxConcurrentTask, "max-concurrent-task", 100, "")
+	_ = fs.Parse(args)
+	return fs, c
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	fs, c := newTestFlagSet("-token-validity", "1h")
+	_ = os.Setenv(EnvPrefix+"TOKEN_VALIDITY", "3h")
+	_ = os.Setenv(EnvPrefix+"TOKEN_STORE", TokenStoreDb)
+	defer func() {
+		_ = os.Unsetenv(EnvPrefix + "TOKEN_VALIDITY")
+		_ = os.Unsetenv(EnvPrefix + "TOKEN_STORE")
+	}()
+
+	e := applyConfigSources(fs, map[string]string{
+		"token-validity":      "4h",
+		"token-store":         TokenStoreMem,
+		"listen":              ":9000",
+		"max-concurrent-task": "10",
+	})
+	if e != nil {
+		t.Fatal(e)
+	}
+	if c.TokenValidity != time.Hour {
+		t.Errorf("expect flag value 1h, but it's %s", c.TokenValidity)
+	}
+	if c.TokenStore != TokenStoreDb {
+		t.Errorf("expect env value %s, but it's %s", TokenStoreDb, c.TokenStore)
+	}
+	if c.Listen != ":9000" {
+		t.Errorf("expect file value :9000, but it's %s", c.Listen)
+	}
+	if c.MaxConcurrentTask != 10 {
+		t.Errorf("expect file value 10, but it's %d", c.MaxConcurrentTask)
+	}
+}
+
+func TestConfigSourcesInvalid(t *testing.T) {
+	fs, _ := newTestFlagSet()
+	if e := applyConfigSources(fs, map[string]string{"unknown": "1"}); e == nil {
+		t.Errorf("expect error of unknown config, but it's nil")
+	}
+	fs, _ = newTestFlagSet()
+	if e := applyConfigSources(fs, map[string]string{"max-concurrent-task": "x"}); e == nil {
+		t.Errorf("expect error of invalid value, but it's nil")
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	dir, e := ioutil.TempDir("", "go-drive-config")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	files := map[string]string{
+		"config.yml":  "listen: ':9000'\nmax-concurrent-task: 10\ntoken-refresh: false\n",
+		"config.toml": "listen = ':9000'\nmax-concurrent-task = 10\ntoken-refresh = false\n",
+	}
+	for name, content := range files {
+		file := filepath.Join(dir, name)
+		if e := ioutil.WriteFile(file, []byte(content), 0644); e != nil {
+			t.Fatal(e)
+		}
+		values, e := loadConfigFile(file)
+		if e != nil {
+			t.Fatal(e)
+		}
+		if values["listen"] != ":9000" || values["max-concurrent-task"] != "10" || values["token-refresh"] != "false" {
+			t.Errorf("expect values of %s, but it's %v", name, values)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package drive_util
+
+import (
+	"context"
+	"go-drive/common/errors"
+	"go-drive/common/i18n"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// offsetCursorPrefix is the prefix of cursors returned by PageEntries
+	offsetCursorPrefix = "o."
+	// tokenCursorPrefix is the prefix of cursors returned by the drives natively
+	tokenCursorPrefix = "t."
+)
+
+// CheckListOptions checks the sort field
+func CheckListOptions(opts types.ListOptions) error {
+	switch opts.Sort {
+	case "", types.SortByName, types.SortBySize, types.SortByModTime, types.SortByType:
+		return nil
+	}
+	return err.NewBadRequestError(i18n.T("drive.invalid_sort", opts.Sort))
+}
+
+// ListPage lists a page of the children of path,
+// the drive lists natively if it implements types.IPagedDrive
+func ListPage(ctx context.Context, drive types.IDrive, path string, opts types.ListOptions) (*types.EntryPage, error) {
+	if pd, ok := drive.(types.IPagedDrive); ok {
+		return pd.ListPage(ctx, path, opts)
+	}
+	entries, e := drive.List(ctx, path)
+	if e != nil {
+		return nil, e
+	}
+	return PageEntries(entries, opts)
+}
+
+// PageEntries filters, sorts and pages all the entries, the cursor is the offset of the next page
+func PageEntries(entries []types.IEntry, opts types.ListOptions) (*types.EntryPage, error) {
+	offset := 0
+	if opts.Cursor != "" {
+		if !strings.HasPrefix(opts.Cursor, offsetCursorPrefix) {
+			return nil, err.NewBadRequestError(i18n.T("drive.invalid_cursor"))
+		}
+		n, e := strconv.Atoi(opts.Cursor[len(offsetCursorPrefix):])
+		if e != nil || n < 0 {
+			return nil, err.NewBadRequestError(i18n.T("drive.invalid_cursor"))
+		}
+		offset = n
+	}
+	// entries may be shared with the cache, so sort a copy of them
+	entries = append([]types.IEntry(nil), FilterEntries(entries, opts.Filter)...)
+	SortEntries(entries, opts.Sort, opts.Desc)
+	if offset > len(entries) {
+		offset = len(entries)
+	}
+	end := len(entries)
+	if opts.Limit > 0 && offset+opts.Limit < end {
+		end = offset + opts.Limit
+	}
+	page := &types.EntryPage{Entries: entries[offset:end]}
+	if end < len(entries) {
+		page.Cursor = offsetCursorPrefix + strconv.Itoa(end)
+	}
+	return page, nil
+}
+
+// NativeListToken returns the page token of the native listing.
+// ok is false if the drive should fall back to PageEntries,
+// that is the order is not supported natively or the cursor is returned by PageEntries.
+func NativeListToken(opts types.ListOptions, sortSupported bool) (token string, ok bool, e error) {
+	if opts.Cursor == "" {
+		return "", sortSupported, nil
+	}
+	if strings.HasPrefix(opts.Cursor, offsetCursorPrefix) {
+		return "", false, nil
+	}
+	if !strings.HasPrefix(opts.Cursor, tokenCursorPrefix) || len(opts.Cursor) == len(tokenCursorPrefix) {
+		return "", false, err.NewBadRequestError(i18n.T("drive.invalid_cursor"))
+	}
+	return opts.Cursor[len(tokenCursorPrefix):], true, nil
+}
+
+// NewNativeListPage filters the entries of a native page, token is the native token of the next page
+func NewNativeListPage(entries []types.IEntry, opts types.ListOptions, token string) *types.EntryPage {
+	entries = FilterEntries(entries, opts.Filter)
+	page := &types.EntryPage{Entries: entries}
+	if token != "" {
+		page.Cursor = tokenCursorPrefix + token
+	}
+	return page
+}
+
+// FilterEntries returns the entries whose name contains filter, case-insensitive
+func FilterEntries(entries []types.IEntry, filter string) []types.IEntry {
+	if filter == "" {
+		return entries
+	}
+	filter = strings.ToLower(filter)
+	result := make([]types.IEntry, 0, len(entries))
+	for _, e := range entries {
+		if strings.Contains(strings.ToLower(utils.PathBase(e.Path())), filter) {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+// SortEntries sorts the entries by the field, entries with the same value are sorted by name
+func SortEntries(entries []types.IEntry, by string, desc bool) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if desc {
+			a, b = b, a
+		}
+		switch by {
+		case types.SortBySize:
+			if a.Size() != b.Size() {
+				return a.Size() < b.Size()
+			}
+		case types.SortByModTime:
+			if a.ModTime() != b.ModTime() {
+				return a.ModTime() < b.ModTime()
+			}
+		case types.SortByType:
+			if a.Type() != b.Type() {
+				return a.Type().IsDir()
+			}
+		}
+		return utils.PathBase(a.Path()) < utils.PathBase(b.Path())
+	})
+}
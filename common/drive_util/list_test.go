@@ -0,0 +1,107 @@
+package drive_util
+
+import (
+	"go-drive/common/types"
+	"strings"
+	"testing"
+)
+
+type testEntry struct {
+	path    string
+	isDir   bool
+	size    int64
+	modTime int64
+}
+
+func (t testEntry) Path() string { return t.path }
+
+func (t testEntry) Type() types.EntryType {
+	if t.isDir {
+		return types.TypeDir
+	}
+	return types.TypeFile
+}
+
+func (t testEntry) Size() int64           { return t.size }
+func (t testEntry) Meta() types.EntryMeta { return types.EntryMeta{} }
+func (t testEntry) ModTime() int64        { return t.modTime }
+func (t testEntry) Drive() types.IDrive   { return nil }
+
+func names(entries []types.IEntry) string {
+	s := make([]string, len(entries))
+	for i, e := range entries {
+		s[i] = e.Path()
+	}
+	return strings.Join(s, ",")
+}
+
+var testEntries = []types.IEntry{
+	testEntry{path: "d/c.txt", size: 1, modTime: 3},
+	testEntry{path: "d/a.txt", size: 3, modTime: 2},
+	testEntry{path: "d/B", isDir: true, size: -1, modTime: 1},
+	testEntry{path: "d/b.TXT", size: 2, modTime: 1},
+}
+
+func TestSortEntries(t *testing.T) {
+	cases := []struct {
+		by     string
+		desc   bool
+		expect string
+	}{
+		{"", false, "d/B,d/a.txt,d/b.TXT,d/c.txt"},
+		{types.SortByName, true, "d/c.txt,d/b.TXT,d/a.txt,d/B"},
+		{types.SortBySize, false, "d/B,d/c.txt,d/b.TXT,d/a.txt"},
+		{types.SortByModTime, true, "d/c.txt,d/a.txt,d/b.TXT,d/B"},
+		{types.SortByType, false, "d/B,d/a.txt,d/b.TXT,d/c.txt"},
+		{types.SortByType, true, "d/c.txt,d/b.TXT,d/a.txt,d/B"},
+	}
+	for _, c := range cases {
+		entries := append([]types.IEntry(nil), testEntries...)
+		SortEntries(entries, c.by, c.desc)
+		if r := names(entries); r != c.expect {
+			t.Errorf("sort by '%s' desc %v: expect '%s', but it's '%s'", c.by, c.desc, c.expect, r)
+		}
+	}
+}
+
+func TestPageEntries(t *testing.T) {
+	opts := types.ListOptions{Limit: 2, Filter: "TXT"}
+	page, e := PageEntries(testEntries, opts)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if r := names(page.Entries); r != "d/a.txt,d/b.TXT" || page.Cursor == "" {
+		t.Errorf("expect the first page 'd/a.txt,d/b.TXT', but it's '%s', cursor '%s'", r, page.Cursor)
+	}
+	opts.Cursor = page.Cursor
+	page, e = PageEntries(testEntries, opts)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if r := names(page.Entries); r != "d/c.txt" || page.Cursor != "" {
+		t.Errorf("expect the last page 'd/c.txt', but it's '%s', cursor '%s'", r, page.Cursor)
+	}
+	if testEntries[0].Path() != "d/c.txt" {
+		t.Errorf("expect entries not modified, but it's '%s'", names(testEntries))
+	}
+	if _, e := PageEntries(testEntries, types.ListOptions{Cursor: "t.abc"}); e == nil {
+		t.Errorf("expect error of invalid cursor, but it's nil")
+	}
+}
+
+func TestNativeListToken(t *testing.T) {
+	if _, ok, _ := NativeListToken(types.ListOptions{}, false); ok {
+		t.Errorf("expect not native if sort is not supported")
+	}
+	if _, ok, _ := NativeListToken(types.ListOptions{Cursor: "o.10"}, true); ok {
+		t.Errorf("expect not native for offset cursor")
+	}
+	page := NewNativeListPage(nil, types.ListOptions{}, "abc")
+	token, ok, e := NativeListToken(types.ListOptions{Cursor: page.Cursor}, true)
+	if e != nil || !ok || token != "abc" {
+		t.Errorf("expect token 'abc', but it's '%s', %v, %v", token, ok, e)
+	}
+	if _, _, e := NativeListToken(types.ListOptions{Cursor: "abc"}, true); e == nil {
+		t.Errorf("expect error of invalid cursor, but it's nil")
+	}
+}
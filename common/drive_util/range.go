@@ -0,0 +1,218 @@
+package drive_util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-drive/common/errors"
+	"go-drive/common/i18n"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errRangeNotSatisfiable = errors.New("range not satisfiable")
+
+const (
+	urlDialTimeout   = 30 * time.Second
+	urlHeaderTimeout = time.Minute
+)
+
+// urlClient requests the download urls of the drives.
+// Reading the body is not limited by time because it's streamed to the client,
+// it's canceled by the context when the client goes away.
+var urlClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: urlDialTimeout, KeepAlive: 30 * time.Second}).DialContext,
+		TLSHandshakeTimeout:   urlDialTimeout,
+		ResponseHeaderTimeout: urlHeaderTimeout,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+	},
+}
+
+// upstreamHeaders are the headers of the upstream response served with the content
+var upstreamHeaders = []string{"Content-Type", "Content-Disposition", "ETag"}
+
+// RangeHeader returns the value of the Range header requesting length bytes from offset, or to the end if length < 0
+func RangeHeader(offset, length int64) string {
+	if length < 0 {
+		return "bytes=" + strconv.FormatInt(offset, 10) + "-"
+	}
+	return "bytes=" + strconv.FormatInt(offset, 10) + "-" + strconv.FormatInt(offset+length-1, 10)
+}
+
+// RangeResponseReader returns the body of the response to a Range request.
+// If the server ignored the Range header and responded the whole content,
+// the content before offset is skipped.
+func RangeResponseReader(resp *http.Response, offset, length int64) (io.ReadCloser, error) {
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		return resp.Body, nil
+	case http.StatusOK:
+		if offset > 0 {
+			if _, e := io.CopyN(ioutil.Discard, resp.Body, offset); e != nil {
+				_ = resp.Body.Close()
+				return nil, e
+			}
+		}
+		if length < 0 {
+			return resp.Body, nil
+		}
+		return &limitedReadCloser{Reader: io.LimitReader(resp.Body, length), Closer: resp.Body}, nil
+	}
+	_ = resp.Body.Close()
+	return nil, err.NewRemoteApiError(resp.StatusCode,
+		i18n.T("util.request_failed", strconv.Itoa(resp.StatusCode)))
+}
+
+// GetURLRange requests length bytes from offset of the url
+func GetURLRange(ctx context.Context, u string, header types.SM, offset, length int64) (io.ReadCloser, error) {
+	req, e := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if e != nil {
+		return nil, e
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Range", RangeHeader(offset, length))
+	resp, e := urlClient.Do(req)
+	if e != nil {
+		return nil, e
+	}
+	reader, e := RangeResponseReader(resp, offset, length)
+	if e != nil {
+		return nil, e
+	}
+	return &responseReadCloser{ReadCloser: reader, header: resp.Header}, nil
+}
+
+type limitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// responseReadCloser is the body with the header of the upstream response
+type responseReadCloser struct {
+	io.ReadCloser
+	header http.Header
+}
+
+func (r *responseReadCloser) Header() http.Header {
+	return r.header
+}
+
+// parseRange parses the Range header of a single range.
+// ok is false if there's no range or there are multiple ranges, then the whole content should be served.
+func parseRange(s string, size int64) (offset, length int64, ok bool, e error) {
+	if !strings.HasPrefix(s, "bytes=") || strings.Contains(s, ",") {
+		return 0, 0, false, nil
+	}
+	spec := strings.TrimSpace(s[len("bytes="):])
+	i := strings.Index(spec, "-")
+	if i < 0 {
+		return 0, 0, false, nil
+	}
+	start, end := strings.TrimSpace(spec[:i]), strings.TrimSpace(spec[i+1:])
+	if start == "" {
+		// the last n bytes
+		n, e := strconv.ParseInt(end, 10, 64)
+		if e != nil || n < 0 {
+			return 0, 0, false, nil
+		}
+		if n == 0 || size == 0 {
+			return 0, 0, false, errRangeNotSatisfiable
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, n, true, nil
+	}
+	offset, e = strconv.ParseInt(start, 10, 64)
+	if e != nil || offset < 0 {
+		return 0, 0, false, nil
+	}
+	if offset >= size {
+		return 0, 0, false, errRangeNotSatisfiable
+	}
+	last := size - 1
+	if end != "" {
+		last, e = strconv.ParseInt(end, 10, 64)
+		if e != nil || last < offset {
+			return 0, 0, false, nil
+		}
+		if last >= size {
+			last = size - 1
+		}
+	}
+	return offset, last - offset + 1, true, nil
+}
+
+// serveRangeContent serves the content by IRangeContent, with 206 response if a single range is requested.
+// served is false if the content can't be read partially.
+func serveRangeContent(ctx context.Context, content types.IContent, rc types.IRangeContent,
+	w http.ResponseWriter, req *http.Request) (served bool, e error) {
+	size := content.Size()
+	if size < 0 {
+		return false, nil
+	}
+	offset, length, ranged := int64(0), size, false
+	// If-Range is not validated, the whole content is served for it
+	if r := req.Header.Get("Range"); r != "" && req.Header.Get("If-Range") == "" {
+		offset, length, ranged, e = parseRange(r, size)
+		if e == errRangeNotSatisfiable {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return true, nil
+		}
+		if !ranged {
+			offset, length = 0, size
+		}
+	}
+	readLength := length
+	if !ranged {
+		readLength = -1
+	}
+	reader, e := rc.GetRangeReader(ctx, offset, readLength)
+	if err.IsUnsupportedError(e) {
+		return false, nil
+	}
+	if e != nil {
+		return true, e
+	}
+	defer func() { _ = reader.Close() }()
+
+	header := w.Header()
+	if ct := mime.TypeByExtension(path.Ext(content.Name())); ct != "" {
+		header.Set("Content-Type", ct)
+	}
+	if resp, ok := reader.(*responseReadCloser); ok {
+		for _, k := range upstreamHeaders {
+			if v := resp.header.Get(k); v != "" {
+				header.Set(k, v)
+			}
+		}
+	}
+	header.Set("Accept-Ranges", "bytes")
+	header.Set("Last-Modified", utils.Time(content.ModTime()).UTC().Format(http.TimeFormat))
+	header.Set("Content-Length", strconv.FormatInt(length, 10))
+	status := http.StatusOK
+	if ranged {
+		header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, offset+length-1, size))
+		status = http.StatusPartialContent
+	}
+	w.WriteHeader(status)
+	if req.Method != http.MethodHead {
+		_, _ = io.CopyN(w, reader, length)
+	}
+	return true, nil
+}
@@ -0,0 +1,159 @@
+package drive_util
+
+import (
+	"context"
+	"go-drive/common/errors"
+	"go-drive/common/types"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testRangeContent struct {
+	content   string
+	supported bool
+}
+
+func (t testRangeContent) Name() string   { return "a.txt" }
+func (t testRangeContent) Size() int64    { return int64(len(t.content)) }
+func (t testRangeContent) ModTime() int64 { return 0 }
+
+func (t testRangeContent) GetReader(context.Context) (io.ReadCloser, error) {
+	return ioutil.NopCloser(strings.NewReader(t.content)), nil
+}
+
+func (t testRangeContent) GetURL(context.Context) (*types.ContentURL, error) {
+	return nil, err.NewUnsupportedError()
+}
+
+func (t testRangeContent) GetRangeReader(_ context.Context, offset, length int64) (io.ReadCloser, error) {
+	if !t.supported {
+		return nil, err.NewUnsupportedError()
+	}
+	s := t.content[offset:]
+	if length >= 0 {
+		s = s[:length]
+	}
+	return ioutil.NopCloser(strings.NewReader(s)), nil
+}
+
+func TestParseRange(t *testing.T) {
+	cases := []struct {
+		header         string
+		offset, length int64
+		ok             bool
+	}{
+		{"bytes=0-4", 0, 5, true},
+		{"bytes=5-", 5, 5, true},
+		{"bytes=-3", 7, 3, true},
+		{"bytes=-20", 0, 10, true},
+		{"bytes=8-20", 8, 2, true},
+		{"bytes=0-1,4-5", 0, 0, false},
+		{"bytes=5-4", 0, 0, false},
+		{"items=0-4", 0, 0, false},
+	}
+	for _, c := range cases {
+		offset, length, ok, e := parseRange(c.header, 10)
+		if e != nil || ok != c.ok || offset != c.offset || length != c.length {
+			t.Errorf("'%s': expect %d, %d, %v, but it's %d, %d, %v, %v",
+				c.header, c.offset, c.length, c.ok, offset, length, ok, e)
+		}
+	}
+	for _, h := range []string{"bytes=10-", "bytes=-0"} {
+		if _, _, _, e := parseRange(h, 10); e != errRangeNotSatisfiable {
+			t.Errorf("'%s': expect not satisfiable, but it's %v", h, e)
+		}
+	}
+}
+
+func TestDownloadIContentRange(t *testing.T) {
+	download := func(content types.IContent, r string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/content/a.txt", nil)
+		if r != "" {
+			req.Header.Set("Range", r)
+		}
+		w := httptest.NewRecorder()
+		if e := DownloadIContent(context.Background(), content, w, req, false); e != nil {
+			t.Fatal(e)
+		}
+		return w
+	}
+	content := testRangeContent{content: "0123456789", supported: true}
+
+	w := download(content, "bytes=2-5")
+	if w.Code != http.StatusPartialContent || w.Body.String() != "2345" ||
+		w.Header().Get("Content-Range") != "bytes 2-5/10" {
+		t.Errorf("expect 206 '2345', but it's %d '%s' '%s'", w.Code, w.Body.String(), w.Header().Get("Content-Range"))
+	}
+	w = download(content, "")
+	if w.Code != http.StatusOK || w.Body.String() != "0123456789" || w.Header().Get("Accept-Ranges") != "bytes" {
+		t.Errorf("expect 200 with the whole content, but it's %d '%s'", w.Code, w.Body.String())
+	}
+	w = download(content, "bytes=10-")
+	if w.Code != http.StatusRequestedRangeNotSatisfiable || w.Header().Get("Content-Range") != "bytes */10" {
+		t.Errorf("expect 416, but it's %d", w.Code)
+	}
+	// falls back to the reader
+	content.supported = false
+	w = download(content, "bytes=2-5")
+	if w.Code != http.StatusOK || w.Body.String() != "0123456789" {
+		t.Errorf("expect 200 with the whole content, but it's %d '%s'", w.Code, w.Body.String())
+	}
+}
+
+func TestRangeResponseReader(t *testing.T) {
+	resp := &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader("0123456789"))}
+	r, e := RangeResponseReader(resp, 3, 4)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if b, _ := ioutil.ReadAll(r); string(b) != "3456" {
+		t.Errorf("expect '3456', but it's '%s'", b)
+	}
+	if h := RangeHeader(3, 4); h != "bytes=3-6" {
+		t.Errorf("expect 'bytes=3-6', but it's '%s'", h)
+	}
+	if h := RangeHeader(3, -1); h != "bytes=3-" {
+		t.Errorf("expect 'bytes=3-', but it's '%s'", h)
+	}
+}
+
+type urlRangeContent struct {
+	testRangeContent
+	url string
+}
+
+func (u urlRangeContent) GetRangeReader(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+	return GetURLRange(ctx, u.url, nil, offset, length)
+}
+
+func TestDownloadIContentUpstreamHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Type", "text/x-upstream")
+		w.Header().Set("Content-Disposition", `attachment; filename="a.txt"`)
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader("0123456789"))
+	}))
+	defer server.Close()
+
+	content := urlRangeContent{testRangeContent: testRangeContent{content: "0123456789"}, url: server.URL}
+	req := httptest.NewRequest("GET", "/content/a.txt", nil)
+	req.Header.Set("Range", "bytes=2-5")
+	w := httptest.NewRecorder()
+	if e := DownloadIContent(context.Background(), content, w, req, false); e != nil {
+		t.Fatal(e)
+	}
+	if w.Code != http.StatusPartialContent || w.Body.String() != "2345" {
+		t.Errorf("expect 206 '2345', but it's %d '%s'", w.Code, w.Body.String())
+	}
+	for k, v := range map[string]string{"ETag": `"v1"`, "Content-Type": "text/x-upstream",
+		"Content-Disposition": `attachment; filename="a.txt"`} {
+		if h := w.Header().Get(k); h != v {
+			t.Errorf("expect %s '%s', but it's '%s'", k, v, h)
+		}
+	}
+}
@@ -45,7 +45,7 @@ func Copy(ctx types.TaskCtx, dst io.Writer, src io.Reader) (written int64, err e
 		}
 		w, ee := io.CopyBuffer(dst, src, buf)
 		if ee != nil {
-			break
+			return written + w, ee
 		}
 		if w == 0 {
 			break
@@ -95,41 +95,46 @@ func CopyIContentToTempFile(ctx types.TaskCtx, content types.IContent, tempDir s
 func DownloadIContent(ctx context.Context, content types.IContent,
 	w http.ResponseWriter, req *http.Request, forceProxy bool) error {
 	u, e := content.GetURL(ctx)
+	if e != nil && !err.IsUnsupportedError(e) {
+		return e
+	}
+	if e == nil && !u.Proxy && !forceProxy && u.Header == nil {
+		w.Header().Set("Location", u.URL)
+		w.WriteHeader(http.StatusFound)
+		return nil
+	}
+	// the content proxied or read by the server supports range requests if it's IRangeContent
+	if rc, ok := content.(types.IRangeContent); ok {
+		if served, e := serveRangeContent(ctx, content, rc, w, req); served {
+			return e
+		}
+	}
 	if e == nil {
-		if u.Proxy || forceProxy || u.Header != nil {
-			dest, e := url2.Parse(u.URL)
-			if e != nil {
-				return e
-			}
-			proxy := httputil.ReverseProxy{Director: func(r *http.Request) {
-				r.URL = dest
-				r.Host = dest.Host
-				r.Header.Del("Referer")
-				r.Header.Del("Authorization")
-				if u.Header != nil {
-					for k, v := range u.Header {
-						r.Header.Set(k, v)
-					}
+		dest, e := url2.Parse(u.URL)
+		if e != nil {
+			return e
+		}
+		proxy := httputil.ReverseProxy{Director: func(r *http.Request) {
+			r.URL = dest
+			r.Host = dest.Host
+			r.Header.Del("Referer")
+			r.Header.Del("Authorization")
+			if u.Header != nil {
+				for k, v := range u.Header {
+					r.Header.Set(k, v)
 				}
-			}}
+			}
+		}}
 
-			defer func() {
-				if i := recover(); i != nil && i != http.ErrAbortHandler {
-					panic(i)
-				}
-			}()
+		defer func() {
+			if i := recover(); i != nil && i != http.ErrAbortHandler {
+				panic(i)
+			}
+		}()
 
-			proxy.ServeHTTP(w, req)
-			return nil
-		} else {
-			w.WriteHeader(http.StatusFound)
-			w.Header().Set("Location", u.URL)
-		}
+		proxy.ServeHTTP(w, req)
 		return nil
 	}
-	if !err.IsUnsupportedError(e) {
-		return e
-	}
 	reader, e := content.GetReader(ctx)
 	if e != nil {
 		return e
@@ -345,7 +350,7 @@ func GetURL(ctx context.Context, u string, header types.SM) (io.ReadCloser, erro
 			req.Header.Set(k, v)
 		}
 	}
-	resp, e := http.DefaultClient.Do(req)
+	resp, e := urlClient.Do(req)
 	if e != nil {
 		return nil, e
 	}
@@ -122,6 +122,24 @@ func (t TimeoutError) Error() string {
 	return t.msg
 }
 
+// TooManyRequestsError 429
+type TooManyRequestsError struct {
+	msg        string
+	retryAfter int
+}
+
+func (t TooManyRequestsError) Code() int {
+	return http.StatusTooManyRequests
+}
+
+func (t TooManyRequestsError) Error() string {
+	return t.msg
+}
+
+func (t TooManyRequestsError) Data() types.M {
+	return types.M{"retry_after": t.retryAfter}
+}
+
 func IsUnsupportedError(e error) bool {
 	_, ok := e.(UnsupportedError)
 	return ok
@@ -180,3 +198,8 @@ func NewRemoteApiError(code int, msg string) RemoteApiError {
 func NewTimeoutError(msg string) TimeoutError {
 	return TimeoutError{msg}
 }
+
+// NewTooManyRequestsError creates error with retryAfter in seconds
+func NewTooManyRequestsError(msg string, retryAfter int) TooManyRequestsError {
+	return TooManyRequestsError{msg, retryAfter}
+}
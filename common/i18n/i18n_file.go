@@ -4,15 +4,17 @@ import (
 	"errors"
 	"fmt"
 	"go-drive/common"
+	"go-drive/common/logging"
 	"go-drive/common/utils"
 	"golang.org/x/text/language"
 	"gopkg.in/yaml.v2"
 	"io/ioutil"
-	"log"
 	"path/filepath"
 	"strings"
 )
 
+var logger = logging.For("i18n")
+
 type FileMessageSource struct {
 	defaultLang language.Tag
 	msgMap      map[language.Tag]map[string]string
@@ -32,20 +34,20 @@ func NewFileMessageSource(config common.Config) (*FileMessageSource, error) {
 		}
 		msg = temp
 	} else {
-		log.Println("[i18n] no languages configuration found.")
+		logger.Warn("no languages configuration found", "dir", config.GetLangDir())
 	}
 
 	lang := make([]language.Tag, 0, len(msg))
 	for lt := range msg {
 		lang = append(lang, lt)
 	}
-	log.Printf("[i18n] %d languages loaded: %v", len(lang), lang)
+	logger.Info("languages loaded", "count", len(lang), "languages", fmt.Sprint(lang))
 
 	def, e := language.Parse(config.DefaultLang)
 	if e != nil {
 		def = language.AmericanEnglish
 	}
-	log.Printf("[i18n] default language: %v", def)
+	logger.Info("default language", "language", def)
 
 	return &FileMessageSource{
 		defaultLang: def,
@@ -90,7 +92,7 @@ func readAllLang(path string) (map[language.Tag]map[string]string, error) {
 
 		langTag, e := language.Parse(lang)
 		if e != nil {
-			log.Printf("[i18n] ignore unknown language tag for file '%s': %v", file.Name(), e)
+			logger.Warn("ignore unknown language tag", "file", file.Name(), "error", e)
 			continue
 		}
 
@@ -0,0 +1,119 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"strings"
+)
+
+// Logger writes structured logs of a subsystem, the level of the subsystem can be changed at runtime
+type Logger struct {
+	subsystem string
+	fields    []interface{}
+}
+
+// For returns the logger of the subsystem
+func For(subsystem string) *Logger {
+	std.mux.Lock()
+	std.subsystems[subsystem] = true
+	std.mux.Unlock()
+	return &Logger{subsystem: subsystem}
+}
+
+// With returns a logger with the key-value pairs added to each log
+func (l *Logger) With(kv ...interface{}) *Logger {
+	if len(kv) == 0 {
+		return l
+	}
+	fields := make([]interface{}, 0, len(l.fields)+len(kv)+1)
+	fields = append(fields, l.fields...)
+	fields = append(fields, normalizeFields(kv)...)
+	return &Logger{subsystem: l.subsystem, fields: fields}
+}
+
+// Ctx returns a logger with the fields(request id, task id, etc.) in the context
+func (l *Logger) Ctx(ctx context.Context) *Logger {
+	if ctx == nil {
+		return l
+	}
+	fields, _ := ctx.Value(fieldsKey).([]interface{})
+	return l.With(fields...)
+}
+
+func (l *Logger) Enabled(level Level) bool {
+	return std.enabled(l.subsystem, level)
+}
+
+func (l *Logger) Log(level Level, msg string, kv ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	fields := l.fields
+	if len(kv) > 0 {
+		fields = make([]interface{}, 0, len(l.fields)+len(kv)+1)
+		fields = append(fields, l.fields...)
+		fields = append(fields, normalizeFields(kv)...)
+	}
+	std.write(level, l.subsystem, msg, fields)
+}
+
+func (l *Logger) Debug(msg string, kv ...interface{}) {
+	l.Log(LevelDebug, msg, kv...)
+}
+
+func (l *Logger) Info(msg string, kv ...interface{}) {
+	l.Log(LevelInfo, msg, kv...)
+}
+
+func (l *Logger) Warn(msg string, kv ...interface{}) {
+	l.Log(LevelWarn, msg, kv...)
+}
+
+func (l *Logger) Error(msg string, kv ...interface{}) {
+	l.Log(LevelError, msg, kv...)
+}
+
+// Writer returns a writer that writes each line as a log of the level,
+// it's used to redirect the standard logger
+func (l *Logger) Writer(level Level) io.Writer {
+	return &lineWriter{l: l, level: level}
+}
+
+type lineWriter struct {
+	l     *Logger
+	level Level
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		w.l.Log(w.level, line)
+	}
+	return len(p), nil
+}
+
+type contextKey int
+
+const (
+	fieldsKey contextKey = iota
+	requestIDKey
+)
+
+// WithFields returns a context carrying the log fields, which are added to the logs by Logger.Ctx
+func WithFields(ctx context.Context, kv ...interface{}) context.Context {
+	prev, _ := ctx.Value(fieldsKey).([]interface{})
+	fields := make([]interface{}, 0, len(prev)+len(kv)+1)
+	fields = append(fields, prev...)
+	fields = append(fields, normalizeFields(kv)...)
+	return context.WithValue(ctx, fieldsKey, fields)
+}
+
+// WithRequestID returns a context carrying the request id
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(WithFields(ctx, "request_id", id), requestIDKey, id)
+}
+
+// RequestID returns the request id of the context
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
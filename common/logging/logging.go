@@ -0,0 +1,253 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+const (
+	FormatLogfmt = "logfmt"
+	FormatJSON   = "json"
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelError {
+		return strconv.Itoa(int(l))
+	}
+	return levelNames[l]
+}
+
+func ParseLevel(s string) (Level, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for i, name := range levelNames {
+		if s == name {
+			return Level(i), nil
+		}
+	}
+	if s == "warning" {
+		return LevelWarn, nil
+	}
+	return 0, errors.New(fmt.Sprintf("unknown log level '%s'", s))
+}
+
+// ParseLevels parses the levels of subsystems in the form of 'subsystem=level,subsystem=level'
+func ParseLevels(s string) (map[string]Level, error) {
+	result := make(map[string]Level)
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, errors.New(fmt.Sprintf("invalid log level '%s', should be 'subsystem=level'", item))
+		}
+		level, e := ParseLevel(kv[1])
+		if e != nil {
+			return nil, e
+		}
+		result[strings.TrimSpace(kv[0])] = level
+	}
+	return result, nil
+}
+
+func CheckFormat(format string) error {
+	if format != FormatLogfmt && format != FormatJSON {
+		return errors.New(fmt.Sprintf("unknown log format '%s'", format))
+	}
+	return nil
+}
+
+type output struct {
+	out    io.Writer
+	format string
+	// defaultLevel is the level of the subsystems that are not configured
+	defaultLevel Level
+	levels       map[string]Level
+	subsystems   map[string]bool
+	mux          *sync.RWMutex
+}
+
+var std = &output{
+	out:          os.Stderr,
+	format:       FormatLogfmt,
+	defaultLevel: LevelInfo,
+	levels:       make(map[string]Level),
+	subsystems:   make(map[string]bool),
+	mux:          &sync.RWMutex{},
+}
+
+// Configure sets the format, the default level and the levels of subsystems
+func Configure(format string, defaultLevel Level, levels map[string]Level) error {
+	if e := CheckFormat(format); e != nil {
+		return e
+	}
+	std.mux.Lock()
+	defer std.mux.Unlock()
+	std.format = format
+	std.defaultLevel = defaultLevel
+	std.levels = make(map[string]Level, len(levels))
+	for k, v := range levels {
+		std.levels[k] = v
+	}
+	return nil
+}
+
+// SetOutput sets the writer of logs, returns the previous one
+func SetOutput(w io.Writer) io.Writer {
+	std.mux.Lock()
+	defer std.mux.Unlock()
+	prev := std.out
+	std.out = w
+	return prev
+}
+
+func SetDefaultLevel(level Level) {
+	std.mux.Lock()
+	defer std.mux.Unlock()
+	std.defaultLevel = level
+}
+
+// SetLevel sets the level of the subsystem, it will use the default level if level is nil
+func SetLevel(subsystem string, level *Level) {
+	std.mux.Lock()
+	defer std.mux.Unlock()
+	if level == nil {
+		delete(std.levels, subsystem)
+		return
+	}
+	std.levels[subsystem] = *level
+}
+
+// Levels returns the default level, the effective levels of the known subsystems,
+// and the levels that are explicitly set
+func Levels() (Level, map[string]Level, map[string]Level) {
+	std.mux.RLock()
+	defer std.mux.RUnlock()
+	effective := make(map[string]Level, len(std.subsystems))
+	for s := range std.subsystems {
+		effective[s] = std.level(s)
+	}
+	overrides := make(map[string]Level, len(std.levels))
+	for s, l := range std.levels {
+		overrides[s] = l
+		effective[s] = l
+	}
+	return std.defaultLevel, effective, overrides
+}
+
+func (o *output) level(subsystem string) Level {
+	if l, ok := o.levels[subsystem]; ok {
+		return l
+	}
+	return o.defaultLevel
+}
+
+func (o *output) enabled(subsystem string, level Level) bool {
+	o.mux.RLock()
+	defer o.mux.RUnlock()
+	return level >= o.level(subsystem)
+}
+
+func (o *output) write(level Level, subsystem, msg string, fields []interface{}) {
+	o.mux.RLock()
+	format := o.format
+	o.mux.RUnlock()
+
+	buf := &bytes.Buffer{}
+	kv := append([]interface{}{
+		"time", time.Now().Format("2006-01-02T15:04:05.000Z07:00"),
+		"level", level.String(),
+		"subsystem", subsystem,
+		"msg", msg,
+	}, fields...)
+	if format == FormatJSON {
+		writeJSON(buf, kv)
+	} else {
+		writeLogfmt(buf, kv)
+	}
+	buf.WriteByte('\n')
+
+	o.mux.Lock()
+	defer o.mux.Unlock()
+	_, _ = o.out.Write(buf.Bytes())
+}
+
+func writeLogfmt(buf *bytes.Buffer, kv []interface{}) {
+	for i := 0; i < len(kv); i += 2 {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(fmt.Sprint(kv[i]))
+		buf.WriteByte('=')
+		v := formatValue(kv[i+1])
+		if v == "" || strings.ContainsAny(v, " =\"\t\r\n") {
+			v = strconv.Quote(v)
+		}
+		buf.WriteString(v)
+	}
+}
+
+func writeJSON(buf *bytes.Buffer, kv []interface{}) {
+	buf.WriteByte('{')
+	for i := 0; i < len(kv); i += 2 {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, _ := json.Marshal(fmt.Sprint(kv[i]))
+		buf.Write(k)
+		buf.WriteByte(':')
+		var v []byte
+		var e error
+		switch val := kv[i+1].(type) {
+		case bool, int, int32, int64, uint, uint32, uint64, float32, float64:
+			v, e = json.Marshal(val)
+		default:
+			v, e = json.Marshal(formatValue(val))
+		}
+		if e != nil {
+			v, _ = json.Marshal(fmt.Sprint(kv[i+1]))
+		}
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+}
+
+func formatValue(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case error:
+		return val.Error()
+	case fmt.Stringer:
+		return val.String()
+	}
+	return fmt.Sprint(v)
+}
+
+// normalizeFields makes the fields key-value pairs
+func normalizeFields(kv []interface{}) []interface{} {
+	if len(kv)%2 != 0 {
+		kv = append(kv, "(MISSING)")
+	}
+	return kv
+}
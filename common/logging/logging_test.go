@@ -0,0 +1,98 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func captureOutput(t *testing.T, format string, levels map[string]Level) (*bytes.Buffer, func()) {
+	buf := &bytes.Buffer{}
+	if e := Configure(format, LevelInfo, levels); e != nil {
+		t.Fatal(e)
+	}
+	prev := SetOutput(buf)
+	return buf, func() {
+		SetOutput(prev)
+		_ = Configure(FormatLogfmt, LevelInfo, nil)
+	}
+}
+
+func TestLogfmt(t *testing.T) {
+	buf, restore := captureOutput(t, FormatLogfmt, nil)
+	defer restore()
+
+	ctx := WithRequestID(context.Background(), "req-1")
+	For("test").Ctx(ctx).With("drive", "d").Info("hello world", "n", 1, "error", errors.New("a=b"))
+	line := buf.String()
+	for _, s := range []string{
+		`level=info`, `subsystem=test`, `msg="hello world"`,
+		`request_id=req-1`, `drive=d`, `n=1`, `error="a=b"`,
+	} {
+		if !strings.Contains(line, s) {
+			t.Errorf("expect '%s' in log, but it's %s", s, line)
+		}
+	}
+	if RequestID(ctx) != "req-1" {
+		t.Errorf("expect request id req-1, but it's %s", RequestID(ctx))
+	}
+}
+
+func TestJSON(t *testing.T) {
+	buf, restore := captureOutput(t, FormatJSON, nil)
+	defer restore()
+
+	For("test").Warn("hello", "n", 1, "s", "x")
+	v := make(map[string]interface{})
+	if e := json.Unmarshal(buf.Bytes(), &v); e != nil {
+		t.Fatal(e)
+	}
+	if v["level"] != "warn" || v["msg"] != "hello" || v["n"] != float64(1) || v["s"] != "x" {
+		t.Errorf("unexpected log: %v", v)
+	}
+}
+
+func TestLevels(t *testing.T) {
+	buf, restore := captureOutput(t, FormatLogfmt, map[string]Level{"verbose": LevelDebug})
+	defer restore()
+
+	For("verbose").Debug("a")
+	For("quiet").Debug("b")
+	if !strings.Contains(buf.String(), "msg=a") || strings.Contains(buf.String(), "msg=b") {
+		t.Errorf("expect only the debug log of verbose, but it's %s", buf.String())
+	}
+
+	buf.Reset()
+	SetLevel("verbose", nil)
+	quiet := LevelError
+	SetLevel("quiet", &quiet)
+	For("verbose").Debug("a")
+	For("quiet").Warn("b")
+	if buf.Len() != 0 {
+		t.Errorf("expect no logs, but it's %s", buf.String())
+	}
+
+	def, effective, overrides := Levels()
+	if def != LevelInfo || effective["verbose"] != LevelInfo || overrides["quiet"] != LevelError {
+		t.Errorf("unexpected levels: %v %v %v", def, effective, overrides)
+	}
+}
+
+func TestParseLevels(t *testing.T) {
+	levels, e := ParseLevels("drive=debug, http=warn")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if levels["drive"] != LevelDebug || levels["http"] != LevelWarn {
+		t.Errorf("unexpected levels: %v", levels)
+	}
+	if _, e := ParseLevels("drive"); e == nil {
+		t.Errorf("expect error, but it's nil")
+	}
+	if _, e := ParseLevels("drive=verbose"); e == nil {
+		t.Errorf("expect error, but it's nil")
+	}
+}
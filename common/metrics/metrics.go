@@ -0,0 +1,120 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const namespace = "go_drive"
+
+const (
+	CacheHit  = "hit"
+	CacheMiss = "miss"
+
+	DirectionUpload   = "upload"
+	DirectionDownload = "download"
+)
+
+// Registry contains all the metrics of go-drive
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "http", Name: "requests_total",
+		Help: "Total number of HTTP requests by route and status code.",
+	}, []string{"method", "route", "code"})
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace, Subsystem: "http", Name: "request_duration_seconds",
+		Help:    "Latencies of HTTP requests by route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+	httpBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "http", Name: "bytes_total",
+		Help: "Total bytes of HTTP request and response bodies by route.",
+	}, []string{"route", "direction"})
+
+	driveOperations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "drive", Name: "operations_total",
+		Help: "Total number of drive operations.",
+	}, []string{"drive", "operation"})
+	driveOperationErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "drive", Name: "operation_errors_total",
+		Help: "Total number of failed drive operations.",
+	}, []string{"drive", "operation"})
+	driveOperationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace, Subsystem: "drive", Name: "operation_duration_seconds",
+		Help:    "Latencies of drive operations.",
+		Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"drive", "operation"})
+	driveBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "drive", Name: "bytes_total",
+		Help: "Total bytes uploaded to or downloaded from drives.",
+	}, []string{"drive", "direction"})
+
+	cacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace, Subsystem: "cache", Name: "requests_total",
+		Help: "Total number of cache lookups by result(hit or miss).",
+	}, []string{"cache", "result"})
+)
+
+func init() {
+	Registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		httpRequests, httpRequestDuration, httpBytes,
+		driveOperations, driveOperationErrors, driveOperationDuration, driveBytes,
+		cacheRequests,
+	)
+}
+
+// Handler serves the metrics in Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+func ObserveHttpRequest(method, route string, code int, start time.Time, requestBytes, responseBytes int64) {
+	httpRequests.WithLabelValues(method, route, strconv.Itoa(code)).Inc()
+	httpRequestDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+	if requestBytes > 0 {
+		httpBytes.WithLabelValues(route, DirectionUpload).Add(float64(requestBytes))
+	}
+	if responseBytes > 0 {
+		httpBytes.WithLabelValues(route, DirectionDownload).Add(float64(responseBytes))
+	}
+}
+
+func ObserveDriveOperation(drive, operation string, start time.Time, e error) {
+	driveOperations.WithLabelValues(drive, operation).Inc()
+	driveOperationDuration.WithLabelValues(drive, operation).Observe(time.Since(start).Seconds())
+	if e != nil {
+		driveOperationErrors.WithLabelValues(drive, operation).Inc()
+	}
+}
+
+func AddDriveBytes(drive, direction string, n int64) {
+	if n > 0 {
+		driveBytes.WithLabelValues(drive, direction).Add(float64(n))
+	}
+}
+
+// ObserveCache records a cache lookup, the hit ratio is hit / (hit + miss)
+func ObserveCache(cache string, hit bool) {
+	result := CacheMiss
+	if hit {
+		result = CacheHit
+	}
+	cacheRequests.WithLabelValues(cache, result).Inc()
+}
+
+// RegisterGaugeFunc registers a gauge whose value is collected by fn when scraping,
+// returns the function to unregister it
+func RegisterGaugeFunc(subsystem, name, help string, fn func() float64) func() {
+	g := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace, Subsystem: subsystem, Name: name, Help: help,
+	}, fn)
+	Registry.MustRegister(g)
+	return func() { Registry.Unregister(g) }
+}
@@ -0,0 +1,281 @@
+// Package oidc implements the OpenID Connect authorization code flow with PKCE
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-drive/common/utils"
+	"golang.org/x/oauth2"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	discoveryPath = "/.well-known/openid-configuration"
+
+	// clockSkew is the allowed clock skew when validating the id token
+	clockSkew = time.Minute
+)
+
+var (
+	ErrInvalidIDToken = errors.New("invalid id token")
+	ErrMissingIDToken = errors.New("id_token is missing in token response")
+)
+
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksURI               string `json:"jwks_uri"`
+}
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// Provider is an OpenID Connect provider discovered from the issuer
+type Provider struct {
+	config  Config
+	oauth   *oauth2.Config
+	issuer  string
+	jwksURI string
+	client  *http.Client
+
+	keys map[string]*rsa.PublicKey
+	mux  *sync.Mutex
+}
+
+// IDToken is a verified id token
+type IDToken struct {
+	Subject string
+	Claims  map[string]interface{}
+}
+
+func NewProvider(ctx context.Context, config Config, client *http.Client) (*Provider, error) {
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	d := discovery{}
+	if e := getJSON(ctx, client, strings.TrimSuffix(config.Issuer, "/")+discoveryPath, &d); e != nil {
+		return nil, e
+	}
+	if strings.TrimSuffix(d.Issuer, "/") != strings.TrimSuffix(config.Issuer, "/") {
+		return nil, fmt.Errorf("issuer mismatch: expected '%s', but got '%s'", config.Issuer, d.Issuer)
+	}
+	scopes := config.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid"}
+	}
+	return &Provider{
+		config: config,
+		oauth: &oauth2.Config{
+			ClientID:     config.ClientID,
+			ClientSecret: config.ClientSecret,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  d.AuthorizationEndpoint,
+				TokenURL: d.TokenEndpoint,
+			},
+			RedirectURL: config.RedirectURL,
+			Scopes:      scopes,
+		},
+		issuer:  d.Issuer,
+		jwksURI: d.JwksURI,
+		client:  client,
+		keys:    make(map[string]*rsa.PublicKey),
+		mux:     &sync.Mutex{},
+	}, nil
+}
+
+// AuthCodeURL returns the URL of the provider's login page
+func (p *Provider) AuthCodeURL(state, nonce, codeVerifier string) string {
+	return p.oauth.AuthCodeURL(state,
+		oauth2.SetAuthURLParam("nonce", nonce),
+		oauth2.SetAuthURLParam("code_challenge", CodeChallenge(codeVerifier)),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	)
+}
+
+// Exchange exchanges the authorization code and verifies the returned id token
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*IDToken, error) {
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, p.client)
+	token, e := p.oauth.Exchange(ctx, code, oauth2.SetAuthURLParam("code_verifier", codeVerifier))
+	if e != nil {
+		return nil, e
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, ErrMissingIDToken
+	}
+	return p.Verify(ctx, rawIDToken, nonce)
+}
+
+// Verify verifies the signature and claims of the id token
+func (p *Provider) Verify(ctx context.Context, rawIDToken, nonce string) (*IDToken, error) {
+	claims := make(map[string]interface{})
+	_, e := utils.ParseJwt(rawIDToken, func(header utils.JwtHeader) (interface{}, error) {
+		if header.Alg != utils.JwtRS256 {
+			return nil, utils.ErrJwtUnsupportedAlg
+		}
+		return p.getKey(ctx, header.Kid)
+	}, &claims)
+	if e != nil {
+		return nil, e
+	}
+	t := &IDToken{Subject: stringClaim(claims, "sub"), Claims: claims}
+	// the subject identifies the account, the tokens without it would be mapped to the same user
+	if t.Subject == "" {
+		return nil, ErrInvalidIDToken
+	}
+	if stringClaim(claims, "iss") != p.issuer {
+		return nil, ErrInvalidIDToken
+	}
+	if !t.hasAudience(p.config.ClientID) {
+		return nil, ErrInvalidIDToken
+	}
+	if nonce != "" && stringClaim(claims, "nonce") != nonce {
+		return nil, ErrInvalidIDToken
+	}
+	exp, _ := claims["exp"].(float64)
+	nbf, _ := claims["nbf"].(float64)
+	if exp == 0 {
+		return nil, ErrInvalidIDToken
+	}
+	if e := utils.ValidateJwtTime(int64(exp), int64(nbf), clockSkew); e != nil {
+		return nil, e
+	}
+	return t, nil
+}
+
+// StringClaim returns the claim if it's a string
+func (t *IDToken) StringClaim(name string) string {
+	return stringClaim(t.Claims, name)
+}
+
+// StringsClaim returns the claim as a string array, a single string claim is also accepted
+func (t *IDToken) StringsClaim(name string) []string {
+	switch v := t.Claims[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		r := make([]string, 0, len(v))
+		for _, s := range v {
+			if str, ok := s.(string); ok {
+				r = append(r, str)
+			}
+		}
+		return r
+	}
+	return nil
+}
+
+func (t *IDToken) hasAudience(aud string) bool {
+	for _, a := range t.StringsClaim("aud") {
+		if a == aud {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Provider) getKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	// the key may be rotated, refresh the key set
+	keys, e := p.fetchKeys(ctx)
+	if e != nil {
+		return nil, e
+	}
+	p.keys = keys
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("key '%s' not found", kid)
+}
+
+func (p *Provider) fetchKeys(ctx context.Context) (map[string]*rsa.PublicKey, error) {
+	jwks := struct {
+		Keys []jsonWebKey `json:"keys"`
+	}{}
+	if e := getJSON(ctx, p.client, p.jwksURI, &jwks); e != nil {
+		return nil, e
+	}
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, e := base64.RawURLEncoding.DecodeString(k.N)
+		if e != nil {
+			continue
+		}
+		exp, e := base64.RawURLEncoding.DecodeString(k.E)
+		if e != nil {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(exp).Int64()),
+		}
+	}
+	return keys, nil
+}
+
+// NewRandomValue generates a random url-safe string, used as state, nonce and code verifier
+func NewRandomValue() (string, error) {
+	b := make([]byte, 32)
+	if _, e := rand.Read(b); e != nil {
+		return "", e
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CodeChallenge creates the S256 code challenge of the PKCE code verifier
+func CodeChallenge(codeVerifier string) string {
+	h := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(h[:])
+}
+
+func stringClaim(claims map[string]interface{}, name string) string {
+	s, _ := claims[name].(string)
+	return s
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	req, e := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if e != nil {
+		return e
+	}
+	resp, e := client.Do(req)
+	if e != nil {
+		return e
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d of '%s'", resp.StatusCode, url)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
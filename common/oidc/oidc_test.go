@@ -0,0 +1,190 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+const (
+	testClientID     = "go-drive"
+	testClientSecret = "secret"
+	testRedirectURL  = "http://localhost/auth/oidc/callback"
+)
+
+// mockProvider is a minimal OpenID Connect provider
+type mockProvider struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	// codes maps authorization code to the code challenge and nonce
+	codes map[string][2]string
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	key, e := rsa.GenerateKey(rand.Reader, 2048)
+	if e != nil {
+		t.Fatal(e)
+	}
+	m := &mockProvider{t: t, key: key, codes: make(map[string][2]string)}
+	mux := http.NewServeMux()
+	mux.HandleFunc(discoveryPath, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, discovery{
+			Issuer:                m.server.URL,
+			AuthorizationEndpoint: m.server.URL + "/auth",
+			TokenEndpoint:         m.server.URL + "/token",
+			JwksURI:               m.server.URL + "/certs",
+		})
+	})
+	mux.HandleFunc("/certs", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{"keys": []jsonWebKey{{
+			Kid: "k1", Kty: "RSA", Use: "sig",
+			N: base64.RawURLEncoding.EncodeToString(key.PublicKey.N.Bytes()),
+			E: base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.PublicKey.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/auth", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("code_challenge_method") != "S256" || q.Get("client_id") != testClientID {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		code := "code-" + q.Get("state")
+		m.codes[code] = [2]string{q.Get("code_challenge"), q.Get("nonce")}
+		http.Redirect(w, r, q.Get("redirect_uri")+"?code="+code+"&state="+q.Get("state"), http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		c, ok := m.codes[r.PostForm.Get("code")]
+		if !ok || c[0] != CodeChallenge(r.PostForm.Get("code_verifier")) {
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, map[string]string{"error": "invalid_grant"})
+			return
+		}
+		writeJSON(w, map[string]interface{}{
+			"access_token": "at", "token_type": "Bearer", "expires_in": 300,
+			"id_token": m.sign(map[string]interface{}{
+				"iss": m.server.URL, "aud": testClientID, "sub": "u1",
+				"exp": time.Now().Add(time.Minute).Unix(), "nonce": c[1],
+				"preferred_username": "alice", "groups": []string{"/staff", "dev"},
+			}),
+		})
+	})
+	m.server = httptest.NewServer(mux)
+	return m
+}
+
+func (m *mockProvider) sign(claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "k1"})
+	payload, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." +
+		base64.RawURLEncoding.EncodeToString(payload)
+	h := sha256.Sum256([]byte(signingInput))
+	signature, e := rsa.SignPKCS1v15(rand.Reader, m.key, crypto.SHA256, h[:])
+	if e != nil {
+		m.t.Fatal(e)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	m := newMockProvider(t)
+	defer m.server.Close()
+	ctx := context.Background()
+
+	p, e := NewProvider(ctx, Config{
+		Issuer: m.server.URL, ClientID: testClientID, ClientSecret: testClientSecret,
+		RedirectURL: testRedirectURL, Scopes: []string{"openid", "profile"},
+	}, nil)
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	verifier, _ := NewRandomValue()
+	nonce, _ := NewRandomValue()
+	authURL := p.AuthCodeURL("state1", nonce, verifier)
+
+	// follow the authorization endpoint to get the code
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, e := client.Get(authURL)
+	if e != nil {
+		t.Fatal(e)
+	}
+	_ = resp.Body.Close()
+	location, e := url.Parse(resp.Header.Get("Location"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if location.Query().Get("state") != "state1" {
+		t.Errorf("expect state 'state1', but it's '%s'", location.Query().Get("state"))
+	}
+	code := location.Query().Get("code")
+
+	if _, e := p.Exchange(ctx, code, "wrong-verifier", nonce); e == nil {
+		t.Errorf("expect error of wrong code verifier")
+	}
+	if _, e := p.Exchange(ctx, code, verifier, "wrong-nonce"); e != ErrInvalidIDToken {
+		t.Errorf("expect ErrInvalidIDToken of wrong nonce, but it's %v", e)
+	}
+
+	token, e := p.Exchange(ctx, code, verifier, nonce)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if token.Subject != "u1" || token.StringClaim("preferred_username") != "alice" {
+		t.Errorf("expect subject u1 of alice, but it's %s of %s",
+			token.Subject, token.StringClaim("preferred_username"))
+	}
+	if groups := token.StringsClaim("groups"); len(groups) != 2 || groups[0] != "/staff" {
+		t.Errorf("expect groups [/staff dev], but it's %v", groups)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	m := newMockProvider(t)
+	defer m.server.Close()
+	ctx := context.Background()
+
+	p, e := NewProvider(ctx, Config{Issuer: m.server.URL, ClientID: testClientID}, nil)
+	if e != nil {
+		t.Fatal(e)
+	}
+	valid := map[string]interface{}{
+		"iss": m.server.URL, "aud": []string{"other", testClientID}, "sub": "u1",
+		"exp": time.Now().Add(time.Minute).Unix(),
+	}
+	if _, e := p.Verify(ctx, m.sign(valid), ""); e != nil {
+		t.Errorf("expect valid, but it's %v", e)
+	}
+
+	cases := map[string]map[string]interface{}{
+		"wrong issuer":   {"iss": "http://evil", "aud": testClientID, "sub": "u1", "exp": time.Now().Add(time.Minute).Unix()},
+		"wrong audience": {"iss": m.server.URL, "aud": "other", "sub": "u1", "exp": time.Now().Add(time.Minute).Unix()},
+		"expired":        {"iss": m.server.URL, "aud": testClientID, "sub": "u1", "exp": time.Now().Add(-time.Hour).Unix()},
+		"no exp":         {"iss": m.server.URL, "aud": testClientID, "sub": "u1"},
+		"no subject":     {"iss": m.server.URL, "aud": testClientID, "exp": time.Now().Add(time.Minute).Unix()},
+		"empty subject":  {"iss": m.server.URL, "aud": testClientID, "sub": "", "exp": time.Now().Add(time.Minute).Unix()},
+	}
+	for name, claims := range cases {
+		if _, e := p.Verify(ctx, m.sign(claims), ""); e == nil {
+			t.Errorf("expect error of %s", name)
+		}
+	}
+}
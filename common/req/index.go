@@ -5,19 +5,21 @@ import (
 	"context"
 	"encoding/json"
 	"encoding/xml"
+	"go-drive/common/logging"
 	"go-drive/common/types"
-	"go-drive/common/utils"
 	"io"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"net/url"
 	"path"
 	"sync"
+	"time"
 )
 
 const maxReadableBodySize int64 = 10 * 1024 * 1024 // 10MB
 
+var logger = logging.For("http_client")
+
 var defaultClient = &http.Client{
 	CheckRedirect: func(*http.Request, []*http.Request) error {
 		// dont follow redirects
@@ -122,18 +124,17 @@ func (h *Client) client() *http.Client {
 }
 
 func (h *Client) request(req *http.Request) (Response, error) {
-	if utils.IsDebugOn() {
-		log.Printf("[HttpClient  req] %s %s %v", req.Method, req.URL.String(), req.Header)
-	}
+	l := logger.Ctx(req.Context())
+	start := time.Now()
 	r, e := h.client().Do(req)
-	if utils.IsDebugOn() {
-		var v interface{} = nil
+	if l.Enabled(logging.LevelDebug) {
 		if e == nil {
-			v = r.StatusCode
+			l.Debug("request", "method", req.Method, "url", req.URL.String(),
+				"status", r.StatusCode, "duration", time.Since(start))
 		} else {
-			v = e
+			l.Debug("request", "method", req.Method, "url", req.URL.String(),
+				"duration", time.Since(start), "error", e)
 		}
-		log.Printf("[HttpClient resp] %s %s %v", req.Method, req.URL.String(), v)
 	}
 	if e != nil {
 		return nil, e
@@ -1,6 +1,7 @@
 package task
 
 import (
+	"context"
 	"errors"
 	"go-drive/common/types"
 	"time"
@@ -42,9 +43,12 @@ func (t Task) Finished() bool {
 
 type Runnable = func(ctx types.TaskCtx) (interface{}, error)
 
+// Runner runs the tasks in background.
+// The ctx of Execute only provides the values(e.g. the request id for logging) to the task,
+// the task will not be canceled with it.
 type Runner interface {
-	Execute(runnable Runnable) (Task, error)
-	ExecuteAndWait(runnable Runnable, timeout time.Duration) (Task, error)
+	Execute(ctx context.Context, runnable Runnable) (Task, error)
+	ExecuteAndWait(ctx context.Context, runnable Runnable, timeout time.Duration) (Task, error)
 	GetTask(id string) (Task, error)
 	StopTask(id string) (Task, error)
 	RemoveTask(id string) error
@@ -9,33 +9,43 @@ import (
 	cmap "github.com/orcaman/concurrent-map"
 	"go-drive/common"
 	"go-drive/common/i18n"
+	"go-drive/common/logging"
+	"go-drive/common/metrics"
 	"go-drive/common/registry"
 	"go-drive/common/types"
 	"go-drive/common/utils"
-	"log"
 	"sync"
 	"time"
 )
 
 type TunnyRunner struct {
-	pool       *tunny.Pool
-	store      cmap.ConcurrentMap
-	tickerStop func()
+	pool        *tunny.Pool
+	store       cmap.ConcurrentMap
+	tickerStop  func()
+	stopMetrics []func()
 }
 
 var cleanThreshold = 1 * time.Minute
 
+var logger = logging.For("task")
+
 func NewTunnyRunner(config common.Config, ch *registry.ComponentsHolder) *TunnyRunner {
 	tr := &TunnyRunner{
 		pool:  tunny.NewFunc(config.MaxConcurrentTask, executor),
 		store: cmap.New(),
 	}
 	tr.tickerStop = utils.TimeTick(tr.clean, 30*time.Second)
+	tr.stopMetrics = []func(){
+		metrics.RegisterGaugeFunc("task", "queue_length", "Number of the tasks waiting for a worker.",
+			func() float64 { return float64(tr.countTasks(Pending)) }),
+		metrics.RegisterGaugeFunc("task", "running", "Number of the running tasks.",
+			func() float64 { return float64(tr.countTasks(Running)) }),
+	}
 	ch.Add("taskRunner", tr)
 	return tr
 }
 
-func (t *TunnyRunner) createTask(runnable Runnable) *wrapper {
+func (t *TunnyRunner) createTask(ctx context.Context, runnable Runnable) *wrapper {
 	task := &Task{
 		Id:        uuid.New().String(),
 		Status:    Pending,
@@ -44,6 +54,7 @@ func (t *TunnyRunner) createTask(runnable Runnable) *wrapper {
 	}
 
 	w := &wrapper{
+		ctx:      logging.WithFields(ctx, "task_id", task.Id),
 		done:     make(chan struct{}),
 		runnable: runnable,
 		task:     task,
@@ -54,14 +65,14 @@ func (t *TunnyRunner) createTask(runnable Runnable) *wrapper {
 	return w
 }
 
-func (t *TunnyRunner) Execute(runnable Runnable) (Task, error) {
-	w := t.createTask(runnable)
+func (t *TunnyRunner) Execute(ctx context.Context, runnable Runnable) (Task, error) {
+	w := t.createTask(ctx, runnable)
 	go t.pool.Process(w)
-	return *w.task, nil
+	return w.snapshot(), nil
 }
 
-func (t *TunnyRunner) ExecuteAndWait(runnable Runnable, timeout time.Duration) (Task, error) {
-	w := t.createTask(runnable)
+func (t *TunnyRunner) ExecuteAndWait(ctx context.Context, runnable Runnable, timeout time.Duration) (Task, error) {
+	w := t.createTask(ctx, runnable)
 
 	timer := time.NewTimer(timeout)
 	done := make(chan int)
@@ -76,7 +87,7 @@ func (t *TunnyRunner) ExecuteAndWait(runnable Runnable, timeout time.Duration) (
 	case <-done:
 	}
 
-	return *w.task, nil
+	return w.snapshot(), nil
 }
 
 func (t *TunnyRunner) GetTask(id string) (Task, error) {
@@ -84,7 +95,7 @@ func (t *TunnyRunner) GetTask(id string) (Task, error) {
 	if !ok {
 		return Task{}, ErrorNotFound
 	}
-	return *w.(*wrapper).task, nil
+	return w.(*wrapper).snapshot(), nil
 }
 
 func (t *TunnyRunner) StopTask(id string) (Task, error) {
@@ -94,7 +105,7 @@ func (t *TunnyRunner) StopTask(id string) (Task, error) {
 	}
 	w := temp.(*wrapper)
 	w.cancel()
-	return *w.task, nil
+	return w.snapshot(), nil
 }
 
 func (t *TunnyRunner) RemoveTask(id string) error {
@@ -114,22 +125,35 @@ func (t *TunnyRunner) Dispose() error {
 	})
 	t.pool.Close()
 	t.tickerStop()
+	for _, stop := range t.stopMetrics {
+		stop()
+	}
 	return nil
 }
 
+func (t *TunnyRunner) countTasks(status string) int {
+	n := 0
+	t.store.IterCb(func(key string, v interface{}) {
+		if v.(*wrapper).snapshot().Status == status {
+			n++
+		}
+	})
+	return n
+}
+
 func (t *TunnyRunner) clean() {
 	ids := make([]string, 0)
 	t.store.IterCb(func(key string, v interface{}) {
-		t := v.(*wrapper)
-		if t.task.Finished() && (time.Now().Unix()-t.task.UpdatedAt.Unix() > int64(cleanThreshold.Seconds())) {
-			ids = append(ids, t.task.Id)
+		t := v.(*wrapper).snapshot()
+		if t.Finished() && (time.Now().Unix()-t.UpdatedAt.Unix() > int64(cleanThreshold.Seconds())) {
+			ids = append(ids, t.Id)
 		}
 	})
 	for _, id := range ids {
 		t.store.Remove(id)
 	}
 	if len(ids) > 0 {
-		log.Printf("%d tasks cleaned", len(ids))
+		logger.Debug("tasks cleaned", "count", len(ids))
 	}
 }
 
@@ -142,7 +166,7 @@ func (t *TunnyRunner) Status() (string, types.SM, error) {
 	canceled := 0
 
 	t.store.IterCb(func(key string, v interface{}) {
-		switch v.(*wrapper).task.Status {
+		switch v.(*wrapper).snapshot().Status {
 		case Pending:
 			pending++
 		case Running:
@@ -167,6 +191,8 @@ func (t *TunnyRunner) Status() (string, types.SM, error) {
 }
 
 type wrapper struct {
+	// ctx provides the values
+	ctx      context.Context
 	runnable Runnable
 	task     *Task
 	canceled bool
@@ -221,8 +247,23 @@ func (w *wrapper) Err() error {
 	return nil
 }
 
-func (w *wrapper) Value(interface{}) interface{} {
-	return nil
+func (w *wrapper) Value(key interface{}) interface{} {
+	return w.ctx.Value(key)
+}
+
+// snapshot copies the task, the task is updated by the worker concurrently
+func (w *wrapper) snapshot() Task {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	return *w.task
+}
+
+// update updates the task and its UpdatedAt
+func (w *wrapper) update(fn func(task *Task)) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	fn(w.task)
+	w.task.UpdatedAt = time.Now()
 }
 
 func (w *wrapper) cancel() {
@@ -241,21 +282,24 @@ func executor(arg interface{}) interface{} {
 	if w.Canceled() {
 		return nil
 	}
-	w.task.Status = Running
-	w.task.UpdatedAt = time.Now()
+	w.update(func(task *Task) { task.Status = Running })
 	r, e := w.runnable(w)
+	status := Done
+	var taskError interface{}
 	if e != nil {
+		r = nil
 		if e == ErrorCanceled || errors.Is(e, context.Canceled) {
-			w.task.Status = Canceled
+			status = Canceled
 		} else {
-			log.Printf("error when executing task: %s", e.Error())
-			w.task.Status = Error
-			w.task.Error = types.M{"message": e.Error()}
+			logger.Ctx(w).Warn("error when executing task", "error", e)
+			status = Error
+			taskError = types.M{"message": e.Error()}
 		}
-	} else {
-		w.task.Status = Done
-		w.task.Result = r
 	}
-	w.task.UpdatedAt = time.Now()
+	w.update(func(task *Task) {
+		task.Status = status
+		task.Error = taskError
+		task.Result = r
+	})
 	return nil
 }
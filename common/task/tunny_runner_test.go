@@ -0,0 +1,77 @@
+package task
+
+import (
+	"context"
+	"go-drive/common"
+	"go-drive/common/metrics"
+	"go-drive/common/registry"
+	"go-drive/common/types"
+	"testing"
+	"time"
+)
+
+// gaugeValue gathers the value of the gauge without labels, -1 if not found
+func gaugeValue(t *testing.T, name string) float64 {
+	mfs, e := metrics.Registry.Gather()
+	if e != nil {
+		t.Fatal(e)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() == name && len(mf.GetMetric()) > 0 {
+			return mf.GetMetric()[0].GetGauge().GetValue()
+		}
+	}
+	return -1
+}
+
+func TestTunnyRunnerMetrics(t *testing.T) {
+	runner := NewTunnyRunner(common.Config{MaxConcurrentTask: 1}, registry.NewComponentHolder())
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	block := func(types.TaskCtx) (interface{}, error) {
+		started <- struct{}{}
+		<-release
+		return nil, nil
+	}
+	running, e := runner.Execute(context.Background(), block)
+	if e != nil {
+		t.Fatal(e)
+	}
+	<-started
+	if _, e := runner.Execute(context.Background(), block); e != nil {
+		t.Fatal(e)
+	}
+
+	// the gauges are collected while the tasks are updated by the workers
+	deadline := time.Now().Add(5 * time.Second)
+	for gaugeValue(t, "go_drive_task_queue_length") != 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if v := gaugeValue(t, "go_drive_task_running"); v != 1 {
+		t.Errorf("expect 1 running task, but it's %v", v)
+	}
+	if v := gaugeValue(t, "go_drive_task_queue_length"); v != 1 {
+		t.Errorf("expect 1 queued task, but it's %v", v)
+	}
+
+	close(release)
+	<-started
+	for !isFinished(runner, running.Id) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		_ = gaugeValue(t, "go_drive_task_running")
+	}
+	if !isFinished(runner, running.Id) {
+		t.Errorf("expect the task finished")
+	}
+
+	_ = runner.Dispose()
+	if v := gaugeValue(t, "go_drive_task_running"); v != -1 {
+		t.Errorf("expect the gauges unregistered after disposed, but it's %v", v)
+	}
+}
+
+func isFinished(runner *TunnyRunner, id string) bool {
+	task, e := runner.GetTask(id)
+	return e == nil && task.Finished()
+}
@@ -1,33 +1,41 @@
 package types
 
-import "strings"
+import (
+	"strings"
+	"time"
+)
 
 type User struct {
-	Username string  `gorm:"COLUMN:username;PRIMARY_KEY;NOT NULL;TYPE:VARCHAR;SIZE:32" json:"username" binding:"required"`
-	Password string  `gorm:"COLUMN:password;NOT NULL;TYPE:VARCHAR;SIZE:64" json:"password"`
+	Username string  `gorm:"COLUMN:username;PRIMARY_KEY;NOT NULL;SIZE:32" json:"username" binding:"required"`
+	Password string  `gorm:"COLUMN:password;NOT NULL;SIZE:64" json:"password"`
 	Groups   []Group `gorm:"MANY2MANY:user_groups;ASSOCIATION_JOINTABLE_FOREIGNKEY:group_name;JOINTABLE_FOREIGNKEY:username" json:"groups"`
 }
 
 type Group struct {
-	Name string `gorm:"COLUMN:name;PRIMARY_KEY;NOT NULL;TYPE:VARCHAR;SIZE:32" json:"name" binding:"required"`
+	Name string `gorm:"COLUMN:name;PRIMARY_KEY;NOT NULL;SIZE:32" json:"name" binding:"required"`
 }
 
 type UserGroup struct {
-	Username  string `gorm:"COLUMN:username;PRIMARY_KEY;NOT NULL;TYPE:VARCHAR;SIZE:32" binding:"required"`
-	GroupName string `gorm:"COLUMN:group_name;PRIMARY_KEY;NOT NULL;TYPE:VARCHAR;SIZE:32" binding:"required"`
+	Username  string `gorm:"COLUMN:username;PRIMARY_KEY;NOT NULL;SIZE:32" binding:"required"`
+	GroupName string `gorm:"COLUMN:group_name;PRIMARY_KEY;NOT NULL;SIZE:32" binding:"required"`
 }
 
 type Drive struct {
-	Name    string `gorm:"COLUMN:name;PRIMARY_KEY;NOT NULL;TYPE:VARCHAR;SIZE:255" json:"name" binding:"required"`
-	Enabled bool   `gorm:"COLUMN:enabled;NOT NULL;TYPE:INTEGER" json:"enabled"`
-	Type    string `gorm:"COLUMN:type;NOT NULL;TYPE:VARCHAR;SIZE:32" json:"type" binding:"required"`
-	Config  string `gorm:"COLUMN:config;NOT NULL;TYPE:VARCHAR;SIZE:4096" json:"config"`
+	Name    string `gorm:"COLUMN:name;PRIMARY_KEY;NOT NULL;SIZE:255" json:"name" binding:"required"`
+	Enabled bool   `gorm:"COLUMN:enabled;NOT NULL" json:"enabled"`
+	Type    string `gorm:"COLUMN:type;NOT NULL;SIZE:32" json:"type" binding:"required"`
+	Config  string `gorm:"COLUMN:config;NOT NULL;SIZE:4096" json:"config"`
 }
 
+// PathKeyMaxLength is the max length in characters of the paths in primary keys,
+// which are the paths of the path permissions, the dirs of the mounts and the paths of the entry scans.
+// It's limited by the max key length(3072 bytes) of MySQL, and must be the same as the SIZE of these columns.
+const PathKeyMaxLength = 512
+
 type PathMount struct {
-	Path    *string `gorm:"COLUMN:path;PRIMARY_KEY;NOT NULL;TYPE:VARCHAR;SIZE:4096" json:"path"`
-	Name    string  `gorm:"COLUMN:name;PRIMARY_KEY;NOT NULL;TYPE:VARCHAR;SIZE:255" json:"name"`
-	MountAt string  `gorm:"COLUMN:mount_at;NOT NULL;TYPE:VARCHAR;SIZE:4096" json:"mount_at"`
+	Path    *string `gorm:"COLUMN:path;PRIMARY_KEY;NOT NULL;SIZE:512" json:"path"`
+	Name    string  `gorm:"COLUMN:name;PRIMARY_KEY;NOT NULL;SIZE:255" json:"name"`
+	MountAt string  `gorm:"COLUMN:mount_at;NOT NULL;SIZE:4096" json:"mount_at"`
 }
 
 func (PathMount) TableName() string {
@@ -35,27 +43,36 @@ func (PathMount) TableName() string {
 }
 
 type DriveData struct {
-	Drive string `gorm:"COLUMN:drive;PRIMARY_KEY;NOT NULL;TYPE:VARCHAR;SIZE:255"`
-	Key   string `gorm:"COLUMN:data_key;PRIMARY_KEY;NOT NULL;TYPE:VARCHAR;SIZE:255"`
-	Value string `gorm:"COLUMN:data_value;NOT NULL;TYPE:VARCHAR;SIZE:4096"`
+	Drive string `gorm:"COLUMN:drive;PRIMARY_KEY;NOT NULL;SIZE:255"`
+	Key   string `gorm:"COLUMN:data_key;PRIMARY_KEY;NOT NULL;SIZE:255"`
+	Value string `gorm:"COLUMN:data_value;NOT NULL;SIZE:4096"`
 }
 
 func (DriveData) TableName() string {
 	return "drive_data"
 }
 
+type Option struct {
+	Key   string `gorm:"COLUMN:opt_key;PRIMARY_KEY;NOT NULL;SIZE:255"`
+	Value string `gorm:"COLUMN:opt_value;NOT NULL;SIZE:4096"`
+}
+
+func (Option) TableName() string {
+	return "options"
+}
+
 const (
 	CacheEntry    uint8 = 1
 	CacheChildren uint8 = 2
 )
 
 type DriveCache struct {
-	Drive     string `gorm:"COLUMN:drive;PRIMARY_KEY;NOT NULL;TYPE:VARCHAR;SIZE:255"`
-	Path      string `gorm:"COLUMN:path;PRIMARY_KEY;NOT NULL;TYPE:VARCHAR;SIZE:255"`
+	Drive     string `gorm:"COLUMN:drive;PRIMARY_KEY;NOT NULL;SIZE:255"`
+	Path      string `gorm:"COLUMN:path;PRIMARY_KEY;NOT NULL;SIZE:255"`
 	Depth     *uint8 `gorm:"COLUMN:depth;PRIMARY_KEY;NOT NULL;TYPE:INTEGER"`
 	Type      uint8  `gorm:"COLUMN:type;PRIMARY_KEY;NOT NULL;TYPE:INTEGER"`
-	Value     string `gorm:"COLUMN:cache_value;NOT NULL;TYPE:TEXT;"`
-	ExpiresAt int64  `gorm:"COLUMN:expires_at;NOT NULL;TYPE:INTEGER"`
+	Value     string `gorm:"COLUMN:cache_value;NOT NULL;TYPE:TEXT"`
+	ExpiresAt int64  `gorm:"COLUMN:expires_at;NOT NULL"`
 }
 
 func (DriveCache) TableName() string {
@@ -85,8 +102,8 @@ const (
 )
 
 type PathPermission struct {
-	Path    *string `gorm:"COLUMN:path;PRIMARY_KEY;NOT NULL;TYPE:VARCHAR;SIZE:4096" json:"path"`
-	Subject string  `gorm:"COLUMN:subject;PRIMARY_KEY;NOT NULL;TYPE:VARCHAR;SIZE:34" json:"subject"`
+	Path    *string `gorm:"COLUMN:path;PRIMARY_KEY;NOT NULL;SIZE:512" json:"path"`
+	Subject string  `gorm:"COLUMN:subject;PRIMARY_KEY;NOT NULL;SIZE:34" json:"subject"`
 	// Permission bits for the path which subject accessed: 1: read, 2: write
 	Permission Permission `gorm:"COLUMN:permission;NOT NULL;TYPE:INTEGER" json:"permission"`
 	// Policy to apply to the permission when subject access this path: 0: REJECT, 1: ACCEPT
@@ -123,3 +140,240 @@ func (p PathPermission) IsAccept() bool {
 func (p PathPermission) IsReject() bool {
 	return p.Policy == PolicyReject
 }
+
+type AccessToken struct {
+	Id        string `gorm:"COLUMN:id;PRIMARY_KEY;NOT NULL;SIZE:36" json:"id"`
+	Username  string `gorm:"COLUMN:username;NOT NULL;SIZE:32;INDEX" json:"username"`
+	Name      string `gorm:"COLUMN:name;NOT NULL;SIZE:255" json:"name" binding:"required"`
+	TokenHash string `gorm:"COLUMN:token_hash;NOT NULL;SIZE:64;UNIQUE_INDEX" json:"-"`
+	// ReadOnly tokens can only be used for reading
+	ReadOnly bool `gorm:"COLUMN:read_only;NOT NULL" json:"read_only"`
+	// PathPrefix limits the token to the path and its descendants, empty means no limitation
+	PathPrefix string `gorm:"COLUMN:path_prefix;NOT NULL;SIZE:4096" json:"path_prefix"`
+	// ExpiresAt is unix timestamp, the token never expires if it's 0
+	ExpiresAt  int64 `gorm:"COLUMN:expires_at;NOT NULL" json:"expires_at"`
+	CreatedAt  int64 `gorm:"COLUMN:created_at;NOT NULL" json:"created_at"`
+	LastUsedAt int64 `gorm:"COLUMN:last_used_at;NOT NULL" json:"last_used_at"`
+}
+
+func (AccessToken) TableName() string {
+	return "access_tokens"
+}
+
+func (t AccessToken) IsExpired() bool {
+	return t.ExpiresAt > 0 && t.ExpiresAt <= time.Now().Unix()
+}
+
+type UserTOTP struct {
+	Username string `gorm:"COLUMN:username;PRIMARY_KEY;NOT NULL;SIZE:32"`
+	Secret   string `gorm:"COLUMN:secret;NOT NULL;SIZE:64"`
+	// Enabled is false when the enrollment is not confirmed
+	Enabled bool `gorm:"COLUMN:enabled;NOT NULL"`
+	// RecoveryCodes are sha256 hashes of the unused recovery codes, separated by ','
+	RecoveryCodes string `gorm:"COLUMN:recovery_codes;NOT NULL;SIZE:1024"`
+	// LastCounter is the time step counter of the last used code
+	LastCounter int64 `gorm:"COLUMN:last_counter;NOT NULL"`
+}
+
+func (UserTOTP) TableName() string {
+	return "user_totp"
+}
+
+// UserIdentity binds the account of an external identity provider to the local user.
+// The external account can only login as the bound user.
+type UserIdentity struct {
+	// Issuer is the issuer of OpenID Connect, or 'ldap' for the LDAP directory
+	Issuer   string `gorm:"COLUMN:issuer;PRIMARY_KEY;NOT NULL;SIZE:255" json:"issuer" binding:"required"`
+	Subject  string `gorm:"COLUMN:subject;PRIMARY_KEY;NOT NULL;SIZE:255" json:"subject" binding:"required"`
+	Username string `gorm:"COLUMN:username;NOT NULL;SIZE:32;INDEX" json:"username"`
+	// Provisioned is true if the user is created by the provider, false if it's linked by admins
+	Provisioned bool `gorm:"COLUMN:provisioned;NOT NULL" json:"provisioned"`
+	// AssignedGroups are the groups assigned by the provider, separated by ','.
+	// Only these groups are removed when the provider doesn't assign them anymore.
+	AssignedGroups string `gorm:"COLUMN:assigned_groups;NOT NULL;SIZE:1024" json:"assigned_groups"`
+	CreatedAt      int64  `gorm:"COLUMN:created_at;NOT NULL" json:"created_at"`
+}
+
+func (UserIdentity) TableName() string {
+	return "user_identities"
+}
+
+// TokenRevocation revokes a stateless token by its id,
+// or all tokens of a user issued before RevokedAt if the Id is 'u:<username>'.
+// The Id 'x:<token id>' exempts the token from the user revocation with the same RevokedAt.
+type TokenRevocation struct {
+	Id string `gorm:"COLUMN:id;PRIMARY_KEY;NOT NULL;SIZE:64"`
+	// RevokedAt is unix timestamp in nanoseconds
+	RevokedAt int64 `gorm:"COLUMN:revoked_at;NOT NULL"`
+	// ExpiresAt is unix timestamp, the revocation can be removed after it's expired
+	ExpiresAt int64 `gorm:"COLUMN:expires_at;NOT NULL;INDEX"`
+	// ReplacedBy is the id of the new token when the token is revoked by updating the session
+	ReplacedBy string `gorm:"COLUMN:replaced_by;NOT NULL;SIZE:64"`
+	// Replacement is the JSON encoded claims of the new token.
+	// The new token is signed again from it, so the usable token is never stored.
+	Replacement string `gorm:"COLUMN:replacement;NOT NULL;TYPE:TEXT"`
+}
+
+func (TokenRevocation) TableName() string {
+	return "token_revocations"
+}
+
+// SessionRecord is the session stored by the database token store
+type SessionRecord struct {
+	Token string `gorm:"COLUMN:token;PRIMARY_KEY;NOT NULL;SIZE:36"`
+	// Username is the logged-in user or the user waiting for 2FA verification
+	Username string `gorm:"COLUMN:username;NOT NULL;SIZE:32;INDEX"`
+	// Data is the JSON encoded Session
+	Data       string `gorm:"COLUMN:data;NOT NULL;TYPE:TEXT"`
+	LastAccess int64  `gorm:"COLUMN:last_access;NOT NULL"`
+	// ExpiresAt is unix timestamp, the session never expires if it's 0
+	ExpiresAt int64 `gorm:"COLUMN:expires_at;NOT NULL;INDEX"`
+}
+
+func (SessionRecord) TableName() string {
+	return "sessions"
+}
+
+type SignerKey struct {
+	Id string `gorm:"COLUMN:id;PRIMARY_KEY;NOT NULL;SIZE:16"`
+	// Secret is hex encoded
+	Secret    string `gorm:"COLUMN:secret;NOT NULL;SIZE:64"`
+	CreatedAt int64  `gorm:"COLUMN:created_at;NOT NULL"`
+	// ExpiresAt is unix timestamp, the key is active if it's 0
+	ExpiresAt int64 `gorm:"COLUMN:expires_at;NOT NULL"`
+}
+
+func (SignerKey) TableName() string {
+	return "signer_keys"
+}
+
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+)
+
+// AuditLog records a mutating drive operation or admin API call
+type AuditLog struct {
+	Id uint `gorm:"COLUMN:id;PRIMARY_KEY;AUTO_INCREMENT" json:"id"`
+	// CreatedAt is unix timestamp
+	CreatedAt int64  `gorm:"COLUMN:created_at;NOT NULL;INDEX" json:"created_at"`
+	Username  string `gorm:"COLUMN:username;NOT NULL;SIZE:32;INDEX" json:"username"`
+	ClientIP  string `gorm:"COLUMN:client_ip;NOT NULL;SIZE:64" json:"client_ip"`
+	// Action is 'drive.<operation>' for drive operations, or 'METHOD /route' for admin API calls
+	Action string `gorm:"COLUMN:action;NOT NULL;SIZE:128;INDEX" json:"action"`
+	Path   string `gorm:"COLUMN:path;NOT NULL;SIZE:4096" json:"path"`
+	// Target is the destination path of copying or moving
+	Target    string `gorm:"COLUMN:target;NOT NULL;SIZE:4096" json:"target"`
+	Result    string `gorm:"COLUMN:result;NOT NULL;SIZE:16" json:"result"`
+	Error     string `gorm:"COLUMN:error;NOT NULL;SIZE:1024" json:"error" i18n:""`
+	RequestID string `gorm:"COLUMN:request_id;NOT NULL;SIZE:64" json:"request_id"`
+}
+
+func (AuditLog) TableName() string {
+	return "audit_logs"
+}
+
+const (
+	WebhookEventCreated = "created"
+	WebhookEventUpdated = "updated"
+	WebhookEventDeleted = "deleted"
+	WebhookEventMoved   = "moved"
+)
+
+// Webhook posts the signed events of the entries under PathPrefix to URL
+type Webhook struct {
+	Id      uint   `gorm:"COLUMN:id;PRIMARY_KEY;AUTO_INCREMENT" json:"id"`
+	Name    string `gorm:"COLUMN:name;NOT NULL;SIZE:255" json:"name" binding:"required"`
+	URL     string `gorm:"COLUMN:url;NOT NULL;SIZE:1024" json:"url" binding:"required"`
+	Secret  string `gorm:"COLUMN:secret;NOT NULL;SIZE:255" json:"secret"`
+	Enabled bool   `gorm:"COLUMN:enabled;NOT NULL" json:"enabled"`
+	// PathPrefix matches the path itself and its descendants, matches all if it's empty
+	PathPrefix string `gorm:"COLUMN:path_prefix;NOT NULL;SIZE:4096" json:"path_prefix"`
+	// Events are the comma separated WebhookEventXXX, matches all if it's empty
+	Events string `gorm:"COLUMN:events;NOT NULL;SIZE:255" json:"events"`
+	// CreatedAt is unix timestamp
+	CreatedAt int64 `gorm:"COLUMN:created_at;NOT NULL" json:"created_at"`
+}
+
+func (Webhook) TableName() string {
+	return "webhooks"
+}
+
+const (
+	DeliveryPending = "pending"
+	DeliverySuccess = "success"
+	DeliveryFailure = "failure"
+)
+
+// WebhookDelivery records the delivery of an event to a webhook
+type WebhookDelivery struct {
+	Id        uint   `gorm:"COLUMN:id;PRIMARY_KEY;AUTO_INCREMENT" json:"id"`
+	WebhookId uint   `gorm:"COLUMN:webhook_id;NOT NULL;INDEX" json:"webhook_id"`
+	Event     string `gorm:"COLUMN:event;NOT NULL;SIZE:32" json:"event"`
+	Path      string `gorm:"COLUMN:path;NOT NULL;SIZE:4096" json:"path"`
+	Payload   string `gorm:"COLUMN:payload;NOT NULL;TYPE:TEXT" json:"payload"`
+	Status    string `gorm:"COLUMN:status;NOT NULL;SIZE:16" json:"status"`
+	Attempts  int    `gorm:"COLUMN:attempts;NOT NULL" json:"attempts"`
+	// ResponseCode is the HTTP status code of the last attempt, 0 if no response
+	ResponseCode int    `gorm:"COLUMN:response_code;NOT NULL" json:"response_code"`
+	Error        string `gorm:"COLUMN:error;NOT NULL;SIZE:1024" json:"error"`
+	// CreatedAt and UpdatedAt are unix timestamps
+	CreatedAt int64 `gorm:"COLUMN:created_at;NOT NULL;INDEX" json:"created_at"`
+	UpdatedAt int64 `gorm:"COLUMN:updated_at;NOT NULL" json:"updated_at"`
+}
+
+func (WebhookDelivery) TableName() string {
+	return "webhook_deliveries"
+}
+
+// UploadHook runs Command on the uploaded files whose path matches Pattern before saving
+type UploadHook struct {
+	Id   uint   `gorm:"COLUMN:id;PRIMARY_KEY;AUTO_INCREMENT" json:"id"`
+	Name string `gorm:"COLUMN:name;NOT NULL;SIZE:255" json:"name" binding:"required"`
+	// Pattern is matched by utils.MatchPath
+	Pattern string `gorm:"COLUMN:pattern;NOT NULL;SIZE:4096" json:"pattern" binding:"required"`
+	// Command is the executable and its arguments separated by spaces,
+	// the entry path and the temp file of the content are appended to the arguments
+	Command string `gorm:"COLUMN:command;NOT NULL;SIZE:4096" json:"command" binding:"required"`
+	// Timeout is in seconds, the default timeout is used if it's 0
+	Timeout int  `gorm:"COLUMN:timeout;NOT NULL" json:"timeout"`
+	Enabled bool `gorm:"COLUMN:enabled;NOT NULL" json:"enabled"`
+	// CreatedAt is unix timestamp
+	CreatedAt int64 `gorm:"COLUMN:created_at;NOT NULL" json:"created_at"`
+}
+
+func (UploadHook) TableName() string {
+	return "upload_hooks"
+}
+
+const (
+	ScanClean = "clean"
+)
+
+// EntryScan is the antivirus verdict of the saved file, only the clean files are saved
+type EntryScan struct {
+	Path string `gorm:"COLUMN:path;PRIMARY_KEY;NOT NULL;SIZE:512" json:"-"`
+	// Dir is the parent of Path to query the children
+	Dir     string `gorm:"COLUMN:dir;NOT NULL;SIZE:512;INDEX" json:"-"`
+	Verdict string `gorm:"COLUMN:verdict;NOT NULL;SIZE:16" json:"verdict"`
+	// Size is the size of the scanned file, the verdict is outdated if the size of the entry changed
+	Size int64 `gorm:"COLUMN:size;NOT NULL" json:"-"`
+	// ScannedAt is unix timestamp
+	ScannedAt int64 `gorm:"COLUMN:scanned_at;NOT NULL" json:"scanned_at"`
+}
+
+func (EntryScan) TableName() string {
+	return "entry_scans"
+}
+
+// SchemaVersion records the applied migrations
+type SchemaVersion struct {
+	Version     int    `gorm:"COLUMN:version;PRIMARY_KEY;NOT NULL;AUTO_INCREMENT:false"`
+	Description string `gorm:"COLUMN:description;NOT NULL;SIZE:255"`
+	// AppliedAt is unix timestamp
+	AppliedAt int64 `gorm:"COLUMN:applied_at;NOT NULL"`
+}
+
+func (SchemaVersion) TableName() string {
+	return "schema_version"
+}
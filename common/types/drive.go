@@ -42,6 +42,13 @@ type IContent interface {
 	GetURL(context.Context) (*ContentURL, error)
 }
 
+// IRangeContent is the optional capability of IContent to read a part of the content,
+// it returns UnsupportedError if the content can't be read partially
+type IRangeContent interface {
+	// GetRangeReader returns the reader of length bytes from offset, or to the end if length < 0
+	GetRangeReader(ctx context.Context, offset, length int64) (io.ReadCloser, error)
+}
+
 type IEntry interface {
 	Path() string
 	Type() EntryType
@@ -75,6 +82,73 @@ type IDrive interface {
 	Upload(ctx context.Context, path string, size int64, override bool, config SM) (*DriveUploadConfig, error)
 }
 
+const (
+	SortByName    = "name"
+	SortBySize    = "size"
+	SortByModTime = "mod_time"
+	// SortByType sorts dirs before files, then by name
+	SortByType = "type"
+)
+
+// ListOptions is the options of paginated listing
+type ListOptions struct {
+	// Cursor is returned by the previous page, empty for the first page
+	Cursor string
+	// Limit is the max number of entries in a page
+	Limit int
+	// Sort is one of SortByXXX, it's SortByName if empty
+	Sort string
+	Desc bool
+	// Filter matches the entries whose name contains it, case-insensitive
+	Filter string
+}
+
+type EntryPage struct {
+	// Entries may be less than the limit even if it's not the last page
+	Entries []IEntry
+	// Cursor is used to get the next page, it's empty if this is the last page
+	Cursor string
+}
+
+// IPagedDrive is implemented by the drives that can list children page by page natively
+type IPagedDrive interface {
+	ListPage(ctx context.Context, path string, opts ListOptions) (*EntryPage, error)
+}
+
+const (
+	DriveEventCreate = "create"
+	DriveEventModify = "modify"
+	DriveEventDelete = "delete"
+	// DriveEventRename is emitted with the old path, the new path is emitted as DriveEventCreate
+	DriveEventRename = "rename"
+	// DriveEventMove is emitted with both the old path and the new path
+	DriveEventMove = "move"
+)
+
+type DriveEvent struct {
+	Type string `json:"type"`
+	Path string `json:"path"`
+	// From is the old path of DriveEventMove
+	From string `json:"from,omitempty"`
+	// Watched is true if the change is made outside go-drive and detected by IWatchableDrive
+	Watched bool `json:"-"`
+}
+
+// ISavedEntry is implemented by the entries returned by IDrive.Save of the drives
+// which know whether an existing file is overwritten.
+// The saving is emitted as DriveEventCreate if the entry doesn't implement it.
+type ISavedEntry interface {
+	// Overwritten returns true if the saved file existed before
+	Overwritten() bool
+}
+
+// IWatchableDrive is implemented by the drives that can notify the changes made outside go-drive
+type IWatchableDrive interface {
+	// Watch calls listener on every change until the returned function is called,
+	// returns UnsupportedError if watching is not enabled
+	Watch(listener func(DriveEvent)) (func(), error)
+}
+
 const (
 	LocalProvider      = "local"
 	LocalChunkProvider = "localChunk"
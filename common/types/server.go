@@ -1,7 +1,22 @@
 package types
 
+import "time"
+
 type Session struct {
 	User User
+	// AccessToken is not nil when the session is authenticated by a personal access token
+	AccessToken *AccessToken
+	// PendingUsername is the user who passed the password check and is waiting for the 2FA verification
+	PendingUsername string
+	// TwoFactorVerified is true when the user passed the 2FA verification in this session
+	TwoFactorVerified bool
+
+	// CreatedAt and LastAccess are unix timestamps in milliseconds, maintained by the TokenStore
+	CreatedAt  int64
+	LastAccess int64
+	// ClientIP and UserAgent are recorded when the session is created or logged in
+	ClientIP  string
+	UserAgent string
 }
 
 func (s *Session) IsAnonymous() bool {
@@ -24,4 +39,33 @@ type TokenStore interface {
 	Validate(token string) (Token, error)
 	// Revoke a token, return value is not nil only when an error occurred
 	Revoke(token string) error
+	// List valid tokens of the user, tokens of all users will be returned if username is empty.
+	// The sessions waiting for the 2FA verification of the user are included.
+	List(username string) ([]Token, error)
+}
+
+// UserTokenRevoker is implemented by the TokenStore which can revoke all tokens of a user without listing them
+type UserTokenRevoker interface {
+	RevokeUser(username, exceptToken string) error
+}
+
+// SessionTouchInterval is the minimum interval of updating Session.LastAccess
+const SessionTouchInterval = time.Minute
+
+// Touch updates LastAccess, returns false if it's updated within SessionTouchInterval
+func (s *Session) Touch(now time.Time) bool {
+	ms := now.UnixNano() / int64(time.Millisecond)
+	if s.CreatedAt == 0 {
+		s.CreatedAt = ms
+	}
+	if ms-s.LastAccess < int64(SessionTouchInterval/time.Millisecond) {
+		return false
+	}
+	s.LastAccess = ms
+	return true
+}
+
+// BelongsTo returns true if the session is logged in or waiting for 2FA verification by the user
+func (s *Session) BelongsTo(username string) bool {
+	return username == "" || s.User.Username == username || s.PendingUsername == username
 }
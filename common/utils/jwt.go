@@ -0,0 +1,120 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	JwtHS256 = "HS256"
+	JwtRS256 = "RS256"
+)
+
+var (
+	ErrJwtMalformed      = errors.New("malformed jwt")
+	ErrJwtUnsupportedAlg = errors.New("unsupported jwt algorithm")
+	ErrJwtSignature      = errors.New("invalid jwt signature")
+	ErrJwtExpired        = errors.New("jwt is expired or not valid yet")
+)
+
+type JwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid,omitempty"`
+	Typ string `json:"typ,omitempty"`
+}
+
+// JwtKeyFunc returns the key to verify the token: []byte for HS256, *rsa.PublicKey for RS256
+type JwtKeyFunc func(header JwtHeader) (interface{}, error)
+
+// SignJwtHS256 creates a HS256 signed token of the claims
+func SignJwtHS256(claims interface{}, secret []byte) (string, error) {
+	header, e := json.Marshal(JwtHeader{Alg: JwtHS256, Typ: "JWT"})
+	if e != nil {
+		return "", e
+	}
+	payload, e := json.Marshal(claims)
+	if e != nil {
+		return "", e
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." +
+		base64.RawURLEncoding.EncodeToString(payload)
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(hs256([]byte(signingInput), secret)), nil
+}
+
+// ParseJwt verifies the signature of the token and unmarshal the claims into v.
+// Time based claims are not validated here, see ValidateJwtTime
+func ParseJwt(token string, keyFunc JwtKeyFunc, v interface{}) (JwtHeader, error) {
+	header := JwtHeader{}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return header, ErrJwtMalformed
+	}
+	headerBytes, e := base64.RawURLEncoding.DecodeString(parts[0])
+	if e != nil {
+		return header, ErrJwtMalformed
+	}
+	if e := json.Unmarshal(headerBytes, &header); e != nil {
+		return header, ErrJwtMalformed
+	}
+	signature, e := base64.RawURLEncoding.DecodeString(parts[2])
+	if e != nil {
+		return header, ErrJwtMalformed
+	}
+	key, e := keyFunc(header)
+	if e != nil {
+		return header, e
+	}
+	signingInput := []byte(parts[0] + "." + parts[1])
+	switch header.Alg {
+	case JwtHS256:
+		secret, ok := key.([]byte)
+		if !ok {
+			return header, ErrJwtUnsupportedAlg
+		}
+		if !hmac.Equal(signature, hs256(signingInput, secret)) {
+			return header, ErrJwtSignature
+		}
+	case JwtRS256:
+		publicKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return header, ErrJwtUnsupportedAlg
+		}
+		if rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, sha256(signingInput), signature) != nil {
+			return header, ErrJwtSignature
+		}
+	default:
+		return header, ErrJwtUnsupportedAlg
+	}
+	payload, e := base64.RawURLEncoding.DecodeString(parts[1])
+	if e != nil {
+		return header, ErrJwtMalformed
+	}
+	if e := json.Unmarshal(payload, v); e != nil {
+		return header, ErrJwtMalformed
+	}
+	return header, nil
+}
+
+// ValidateJwtTime checks the 'exp' and 'nbf' claims(unix timestamp), 0 means absent
+func ValidateJwtTime(exp, nbf int64, leeway time.Duration) error {
+	now := time.Now()
+	if exp > 0 && now.Add(-leeway).Unix() >= exp {
+		return ErrJwtExpired
+	}
+	if nbf > 0 && now.Add(leeway).Unix() < nbf {
+		return ErrJwtExpired
+	}
+	return nil
+}
+
+func hs256(v, secret []byte) []byte {
+	mac := hmac.New(crypto.SHA256.New, secret)
+	mac.Write(v)
+	return mac.Sum(nil)
+}
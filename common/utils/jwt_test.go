@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+type testClaims struct {
+	Sub string `json:"sub"`
+	Exp int64  `json:"exp"`
+}
+
+func TestJwtHS256(t *testing.T) {
+	secret := []byte("secret")
+	token, e := SignJwtHS256(testClaims{Sub: "admin", Exp: 100}, secret)
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	claims := testClaims{}
+	_, e = ParseJwt(token, func(JwtHeader) (interface{}, error) { return secret, nil }, &claims)
+	if e != nil {
+		t.Errorf("expect token valid, but it's %v", e)
+	}
+	if claims.Sub != "admin" || claims.Exp != 100 {
+		t.Errorf("expect claims {admin 100}, but it's %v", claims)
+	}
+
+	_, e = ParseJwt(token, func(JwtHeader) (interface{}, error) { return []byte("other"), nil }, &claims)
+	if e != ErrJwtSignature {
+		t.Errorf("expect ErrJwtSignature, but it's %v", e)
+	}
+
+	_, e = ParseJwt(token[:len(token)-2], func(JwtHeader) (interface{}, error) { return secret, nil }, &claims)
+	if e == nil {
+		t.Errorf("expect error of tampered token")
+	}
+}
+
+func TestJwtRS256(t *testing.T) {
+	key, e := rsa.GenerateKey(rand.Reader, 2048)
+	if e != nil {
+		t.Fatal(e)
+	}
+	header, _ := json.Marshal(JwtHeader{Alg: JwtRS256, Kid: "k1"})
+	payload, _ := json.Marshal(testClaims{Sub: "user"})
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." +
+		base64.RawURLEncoding.EncodeToString(payload)
+	signature, e := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sha256([]byte(signingInput)))
+	if e != nil {
+		t.Fatal(e)
+	}
+	token := signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+
+	claims := testClaims{}
+	h, e := ParseJwt(token, func(JwtHeader) (interface{}, error) { return &key.PublicKey, nil }, &claims)
+	if e != nil {
+		t.Errorf("expect token valid, but it's %v", e)
+	}
+	if h.Kid != "k1" || claims.Sub != "user" {
+		t.Errorf("expect kid k1 and sub user, but it's %s and %s", h.Kid, claims.Sub)
+	}
+
+	// a RS256 token must not be verified as HS256
+	_, e = ParseJwt(token, func(JwtHeader) (interface{}, error) { return []byte("secret"), nil }, &claims)
+	if e != ErrJwtUnsupportedAlg {
+		t.Errorf("expect ErrJwtUnsupportedAlg, but it's %v", e)
+	}
+}
+
+func TestValidateJwtTime(t *testing.T) {
+	now := time.Now().Unix()
+	if e := ValidateJwtTime(now+60, 0, 0); e != nil {
+		t.Errorf("expect valid, but it's %v", e)
+	}
+	if e := ValidateJwtTime(now-60, 0, 0); e != ErrJwtExpired {
+		t.Errorf("expect ErrJwtExpired, but it's %v", e)
+	}
+	if e := ValidateJwtTime(now-60, 0, 2*time.Minute); e != nil {
+		t.Errorf("expect valid with leeway, but it's %v", e)
+	}
+	if e := ValidateJwtTime(0, now+60, 0); e != ErrJwtExpired {
+		t.Errorf("expect ErrJwtExpired, but it's %v", e)
+	}
+}
@@ -0,0 +1,141 @@
+package utils
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+)
+
+// ErrAddressNotAllowed is returned by the guarded dialer when the address is in the blocked networks
+var ErrAddressNotAllowed = errors.New("address not allowed")
+
+// blockedNetworks are the loopback, private, link-local and other special-purpose networks,
+// which should not be reached by the requests to the URLs supplied by users
+var blockedNetworks = mustParseCIDRs(
+	"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16", "172.16.0.0/12",
+	"192.0.0.0/24", "192.0.2.0/24", "192.168.0.0/16", "198.18.0.0/15", "198.51.100.0/24",
+	"203.0.113.0/24", "224.0.0.0/4", "240.0.0.0/4",
+	"::/128", "::1/128", "64:ff9b::/96", "100::/64", "2001:db8::/32", "fc00::/7", "fe80::/10", "ff00::/8",
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, n, e := net.ParseCIDR(cidr)
+		if e != nil {
+			panic(e)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+// ParseCIDRs parses the comma separated CIDRs, a single IP is treated as a /32 or /128 network
+func ParseCIDRs(s string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0)
+	for _, cidr := range strings.Split(s, ",") {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, &net.ParseError{Type: "IP address", Text: cidr}
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, e := net.ParseCIDR(cidr)
+		if e != nil {
+			return nil, e
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// IsPublicIP returns false if the ip is in the loopback, private or other special-purpose networks
+func IsPublicIP(ip net.IP) bool {
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+	return !ipInNetworks(ip, blockedNetworks)
+}
+
+// GuardedDialer returns the dialer refusing to connect to the non-public addresses except the allowed networks.
+// The address is checked after resolving, so the DNS rebinding can't bypass it.
+func GuardedDialer(dialer *net.Dialer, allowed []*net.IPNet) *net.Dialer {
+	d := *dialer
+	d.Control = func(_, address string, _ syscall.RawConn) error {
+		host, _, e := net.SplitHostPort(address)
+		if e != nil {
+			return e
+		}
+		ip := net.ParseIP(host)
+		if ip == nil {
+			return ErrAddressNotAllowed
+		}
+		if !IsPublicIP(ip) && !ipInNetworks(ip, allowed) {
+			return ErrAddressNotAllowed
+		}
+		return nil
+	}
+	return &d
+}
+
+// ClientIP returns the ip of the peer of the connection.
+// The X-Forwarded-For header is used only if the peer is one of the trusted proxies,
+// and the nearest address not in the trusted proxies is returned.
+func ClientIP(r *http.Request, trustedProxies []*net.IPNet) string {
+	host := peerHost(r)
+	if !IsFromTrustedProxy(r, trustedProxies) {
+		return host
+	}
+	forwarded := strings.Split(strings.Join(r.Header["X-Forwarded-For"], ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr := strings.TrimSpace(forwarded[i])
+		if addr == "" {
+			continue
+		}
+		forwardedIP := net.ParseIP(addr)
+		if forwardedIP == nil {
+			// the header is broken, the proxy is the nearest known address
+			return host
+		}
+		host = addr
+		if !ipInNetworks(forwardedIP, trustedProxies) {
+			break
+		}
+	}
+	return host
+}
+
+// IsFromTrustedProxy returns true if the peer of the connection is one of the trusted proxies
+func IsFromTrustedProxy(r *http.Request, trustedProxies []*net.IPNet) bool {
+	ip := net.ParseIP(peerHost(r))
+	return ip != nil && ipInNetworks(ip, trustedProxies)
+}
+
+func peerHost(r *http.Request) string {
+	host, _, e := net.SplitHostPort(r.RemoteAddr)
+	if e != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func ipInNetworks(ip net.IP, networks []*net.IPNet) bool {
+	for _, n := range networks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
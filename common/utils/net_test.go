@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	for _, ip := range []string{"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254",
+		"100.64.0.1", "0.0.0.0", "::1", "::", "fd00::1", "fe80::1", "::ffff:127.0.0.1", "::ffff:10.0.0.1"} {
+		if IsPublicIP(net.ParseIP(ip)) {
+			t.Errorf("'%s': expect not public, but it's public", ip)
+		}
+	}
+	for _, ip := range []string{"1.1.1.1", "8.8.8.8", "172.32.0.1", "2606:4700:4700::1111"} {
+		if !IsPublicIP(net.ParseIP(ip)) {
+			t.Errorf("'%s': expect public, but it's not", ip)
+		}
+	}
+}
+
+func TestParseCIDRs(t *testing.T) {
+	nets, e := ParseCIDRs(" 10.0.0.0/8, 192.168.1.10,,fd00::/8 ")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(nets) != 3 {
+		t.Fatalf("expect 3 networks, but it's %d", len(nets))
+	}
+	if !ipInNetworks(net.ParseIP("192.168.1.10"), nets) || ipInNetworks(net.ParseIP("192.168.1.11"), nets) {
+		t.Errorf("expect only 192.168.1.10 in 192.168.1.10/32")
+	}
+	for _, s := range []string{"10.0.0.0/33", "localhost"} {
+		if _, e := ParseCIDRs(s); e == nil {
+			t.Errorf("'%s': expect error, but it's nil", s)
+		}
+	}
+}
+
+func TestGuardedDialer(t *testing.T) {
+	l, e := net.Listen("tcp", "127.0.0.1:0")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() { _ = l.Close() }()
+	go func() {
+		for {
+			conn, e := l.Accept()
+			if e != nil {
+				return
+			}
+			_ = conn.Close()
+		}
+	}()
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+
+	_, e = GuardedDialer(dialer, nil).Dial("tcp", l.Addr().String())
+	if e == nil {
+		t.Errorf("expect loopback address not allowed, but it's connected")
+	}
+	allowed, _ := ParseCIDRs("127.0.0.0/8")
+	conn, e := GuardedDialer(dialer, allowed).Dial("tcp", l.Addr().String())
+	if e != nil {
+		t.Errorf("expect connected to the allowed network, but it's %v", e)
+	} else {
+		_ = conn.Close()
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	trusted, _ := ParseCIDRs("10.0.0.0/8")
+	for _, c := range []struct {
+		remote    string
+		forwarded string
+		expect    string
+	}{
+		{"1.2.3.4:5678", "", "1.2.3.4"},
+		// the header of untrusted peers is ignored
+		{"1.2.3.4:5678", "5.6.7.8", "1.2.3.4"},
+		{"10.0.0.1:5678", "5.6.7.8", "5.6.7.8"},
+		// the addresses prepended by the client are ignored
+		{"10.0.0.1:5678", "9.9.9.9, 5.6.7.8, 10.0.0.2", "5.6.7.8"},
+		{"10.0.0.1:5678", "10.0.0.3, 10.0.0.2", "10.0.0.3"},
+		{"10.0.0.1:5678", "invalid", "10.0.0.1"},
+		{"[::1]:5678", "", "::1"},
+	} {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.RemoteAddr = c.remote
+		if c.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", c.forwarded)
+		}
+		if ip := ClientIP(r, trusted); ip != c.expect {
+			t.Errorf("'%s' '%s': expect '%s', but it's '%s'", c.remote, c.forwarded, c.expect, ip)
+		}
+	}
+}
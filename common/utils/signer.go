@@ -2,14 +2,35 @@ package utils
 
 import (
 	"crypto"
+	"crypto/hmac"
+	cryptoRand "crypto/rand"
 	"encoding/base64"
 	"encoding/binary"
+	"encoding/hex"
 	"math/rand"
+	"strings"
+	"sync"
 	"time"
 )
 
+// SignerKey is a key of the Signer
+type SignerKey struct {
+	ID     string
+	Secret []byte
+	// ExpiresAt is unix timestamp, signatures of the key are invalid after it.
+	// The key is active(can be used to sign) if it's 0
+	ExpiresAt int64
+}
+
+// Signer signs values with the current key, and validates signatures with all unexpired keys.
+// The signature is in the form of 'keyID.base64(random|notAfter|hmac)'
 type Signer struct {
-	secret []byte
+	keys    map[string]SignerKey
+	current string
+	mux     *sync.RWMutex
+
+	// onKeyMissing is called when validating a signature of an unknown key
+	onKeyMissing func(id string)
 }
 
 func sha256(v []byte) []byte {
@@ -18,43 +39,117 @@ func sha256(v []byte) []byte {
 	return sha256.Sum(nil)
 }
 
+// NewSigner creates a Signer with a random key
 func NewSigner() *Signer {
-	return &Signer{[]byte(RandString(16))}
+	key, e := NewSignerKey()
+	if e != nil {
+		panic(e)
+	}
+	s := NewKeysSigner(nil)
+	s.SetKeys([]SignerKey{key})
+	return s
+}
+
+// NewKeysSigner creates a Signer without keys, keys should be set by SetKeys.
+// onKeyMissing is called when validating a signature of an unknown key,
+// the keys can be reloaded in it.
+func NewKeysSigner(onKeyMissing func(id string)) *Signer {
+	return &Signer{
+		keys:         make(map[string]SignerKey),
+		mux:          &sync.RWMutex{},
+		onKeyMissing: onKeyMissing,
+	}
+}
+
+// NewSignerKey generates an active key
+func NewSignerKey() (SignerKey, error) {
+	id := make([]byte, 4)
+	secret := make([]byte, 32)
+	if _, e := cryptoRand.Read(id); e != nil {
+		return SignerKey{}, e
+	}
+	if _, e := cryptoRand.Read(secret); e != nil {
+		return SignerKey{}, e
+	}
+	return SignerKey{ID: hex.EncodeToString(id), Secret: secret}, nil
 }
 
-func (s *Signer) sign(v string, notAfter int64, r uint32) string {
+// SetKeys replaces the keys, the last active key will be used to sign
+func (s *Signer) SetKeys(keys []SignerKey) {
+	m := make(map[string]SignerKey, len(keys))
+	current := ""
+	for _, k := range keys {
+		m[k.ID] = k
+		if k.ExpiresAt == 0 {
+			current = k.ID
+		}
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.keys = m
+	s.current = current
+}
+
+func (s *Signer) sign(key SignerKey, v string, notAfter int64, r uint32) string {
 	vByte := []byte(v)
-	buf := make([]byte, 4+8+len(vByte)+len(s.secret))
+	buf := make([]byte, 4+8+len(vByte))
 	binary.LittleEndian.PutUint32(buf, r)
 	binary.LittleEndian.PutUint64(buf[4:], uint64(notAfter))
 	copy(buf[4+8:], vByte)
-	copy(buf[4+8+len(vByte):], s.secret)
-	signature := sha256(buf)
+	signature := hs256(buf, key.Secret)
 
 	result := make([]byte, 4+8+32)
 	copy(result[:], buf[:12])
 	copy(result[12:], signature)
 
-	return base64.URLEncoding.EncodeToString(result)
+	return key.ID + "." + base64.URLEncoding.EncodeToString(result)
 }
 
 func (s *Signer) Sign(v string, notAfter time.Time) string {
+	s.mux.RLock()
+	key, ok := s.keys[s.current]
+	s.mux.RUnlock()
+	if !ok {
+		panic("no active key of signer")
+	}
 	r := rand.Uint32()
-	return s.sign(v, notAfter.Unix(), r)
+	return s.sign(key, v, notAfter.Unix(), r)
 }
 
 func (s *Signer) Validate(v string, signature string) bool {
-	buf, e := base64.URLEncoding.DecodeString(signature)
+	dot := strings.IndexByte(signature, '.')
+	if dot < 0 {
+		return false
+	}
+	key, ok := s.getKey(signature[:dot])
+	if !ok || (key.ExpiresAt > 0 && key.ExpiresAt <= time.Now().Unix()) {
+		return false
+	}
+	buf, e := base64.URLEncoding.DecodeString(signature[dot+1:])
 	if e != nil || len(buf) != (4+8+32) {
 		return false
 	}
 	r := binary.LittleEndian.Uint32(buf)
 	notAfter := int64(binary.LittleEndian.Uint64(buf[4:]))
 
-	actualSignature := s.sign(v, notAfter, r)
-	if actualSignature != signature {
+	actualSignature := s.sign(key, v, notAfter, r)
+	if !hmac.Equal([]byte(actualSignature), []byte(signature)) {
 		return false
 	}
 
 	return notAfter > time.Now().Unix()
 }
+
+func (s *Signer) getKey(id string) (SignerKey, bool) {
+	s.mux.RLock()
+	key, ok := s.keys[id]
+	s.mux.RUnlock()
+	if ok || s.onKeyMissing == nil {
+		return key, ok
+	}
+	s.onKeyMissing(id)
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	key, ok = s.keys[id]
+	return key, ok
+}
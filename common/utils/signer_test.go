@@ -28,3 +28,34 @@ func TestSigner(t *testing.T) {
 		t.Errorf("test failed")
 	}
 }
+
+func TestSignerKeyRotation(t *testing.T) {
+	k1, _ := NewSignerKey()
+	k2, _ := NewSignerKey()
+	s := NewKeysSigner(nil)
+	s.SetKeys([]SignerKey{k1})
+	signature := s.Sign("hello world", time.Now().Add(time.Hour))
+
+	// k1 is retired but still in the grace period
+	k1.ExpiresAt = time.Now().Add(time.Hour).Unix()
+	s.SetKeys([]SignerKey{k1, k2})
+	if !s.Validate("hello world", signature) {
+		t.Errorf("expect signature of retired key valid")
+	}
+	if s2 := s.Sign("hello world", time.Now().Add(time.Hour)); s2[:len(k2.ID)] != k2.ID {
+		t.Errorf("expect signed by %s, but it's %s", k2.ID, s2)
+	}
+
+	k1.ExpiresAt = time.Now().Add(-time.Second).Unix()
+	s.SetKeys([]SignerKey{k1, k2})
+	if s.Validate("hello world", signature) {
+		t.Errorf("expect signature of expired key invalid")
+	}
+
+	missing := ""
+	s = NewKeysSigner(func(id string) { missing = id })
+	s.SetKeys([]SignerKey{k2})
+	if s.Validate("hello world", signature) || missing != k1.ID {
+		t.Errorf("expect key missing %s, but it's '%s'", k1.ID, missing)
+	}
+}
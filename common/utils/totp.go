@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	totpPeriod = 30
+	totpDigits = 6
+	// totpSkew is the number of periods before and after the current period that are accepted
+	totpSkew = 1
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewTOTPSecret generates a base32 encoded secret for TOTP(RFC 6238)
+func NewTOTPSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, e := rand.Read(b); e != nil {
+		return "", e
+	}
+	return totpEncoding.EncodeToString(b), nil
+}
+
+// TOTPURI returns the key URI, which is the QR code payload for authenticator apps
+func TOTPURI(issuer, account, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	v.Set("period", fmt.Sprintf("%d", totpPeriod))
+	v.Set("digits", fmt.Sprintf("%d", totpDigits))
+	return "otpauth://totp/" + url.PathEscape(issuer+":"+account) + "?" + v.Encode()
+}
+
+// TOTPCounter returns the time step counter of t
+func TOTPCounter(t time.Time) int64 {
+	return t.Unix() / totpPeriod
+}
+
+// TOTPCode generates the code of the counter
+func TOTPCode(secret string, counter int64) (string, error) {
+	key, e := totpEncoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if e != nil {
+		return "", e
+	}
+	return hotp(key, uint64(counter), totpDigits), nil
+}
+
+// ValidateTOTP validates the code at time t,
+// returns the matched counter or -1 if the code is invalid.
+// Counters not greater than lastCounter are rejected to prevent replay.
+func ValidateTOTP(secret, code string, t time.Time, lastCounter int64) int64 {
+	if len(code) != totpDigits {
+		return -1
+	}
+	current := TOTPCounter(t)
+	for c := current - totpSkew; c <= current+totpSkew; c++ {
+		if c <= lastCounter {
+			continue
+		}
+		expected, e := TOTPCode(secret, c)
+		if e != nil {
+			return -1
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return c
+		}
+	}
+	return -1
+}
+
+// hotp implements RFC 4226
+func hotp(key []byte, counter uint64, digits int) string {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, counter)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(buf)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, value%mod)
+}
@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+// test vectors from RFC 6238 Appendix B (SHA1)
+var totpVectors = []struct {
+	time int64
+	code string
+}{
+	{59, "94287082"},
+	{1111111109, "07081804"},
+	{1111111111, "14050471"},
+	{1234567890, "89005924"},
+	{2000000000, "69279037"},
+	{20000000000, "65353130"},
+}
+
+func TestHOTP(t *testing.T) {
+	key := []byte("12345678901234567890")
+	for _, v := range totpVectors {
+		code := hotp(key, uint64(v.time/totpPeriod), 8)
+		if code != v.code {
+			t.Errorf("expect %s at %d, but it's %s", v.code, v.time, code)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(1111111111, 0)
+
+	// the last 6 digits of the 8 digits code
+	if c := ValidateTOTP(secret, "050471", now, 0); c != TOTPCounter(now) {
+		t.Errorf("expect counter %d, but it's %d", TOTPCounter(now), c)
+	}
+	// code of the previous period is accepted
+	if c := ValidateTOTP(secret, "050471", now.Add(totpPeriod*time.Second), 0); c != TOTPCounter(now) {
+		t.Errorf("expect code of previous period valid, but it's %d", c)
+	}
+	if c := ValidateTOTP(secret, "050471", now.Add(3*totpPeriod*time.Second), 0); c != -1 {
+		t.Errorf("expect code expired, but it's %d", c)
+	}
+	// replay
+	if c := ValidateTOTP(secret, "050471", now, TOTPCounter(now)); c != -1 {
+		t.Errorf("expect replayed code invalid, but it's %d", c)
+	}
+	if c := ValidateTOTP(secret, "000000", now, 0); c != -1 {
+		t.Errorf("expect invalid code, but it's %d", c)
+	}
+
+	s, e := NewTOTPSecret()
+	if e != nil {
+		t.Fatal(e)
+	}
+	code, e := TOTPCode(s, TOTPCounter(now))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if ValidateTOTP(s, code, now, 0) == -1 {
+		t.Errorf("expect generated code valid")
+	}
+}
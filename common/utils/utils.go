@@ -92,6 +92,32 @@ func PathDepth(path string) int {
 	return len(slashPattern.FindAll([]byte(path), -1)) + 1
 }
 
+// MatchPath reports whether the path matches the pattern.
+// The pattern is matched segment by segment with path.Match, and '**' matches zero or more segments.
+func MatchPath(pattern, path string) (bool, error) {
+	return matchSegments(strings.Split(CleanPath(pattern), "/"), strings.Split(CleanPath(path), "/"))
+}
+
+func matchSegments(patterns, segments []string) (bool, error) {
+	for i, p := range patterns {
+		if p == "**" {
+			for j := i; j <= len(segments); j++ {
+				if ok, e := matchSegments(patterns[i+1:], segments[j:]); ok || e != nil {
+					return ok, e
+				}
+			}
+			return false, nil
+		}
+		if i >= len(segments) {
+			return false, nil
+		}
+		if ok, e := path2.Match(p, segments[i]); !ok || e != nil {
+			return false, e
+		}
+	}
+	return len(patterns) == len(segments), nil
+}
+
 var letterRunes = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
 
 func RandString(n int) string {
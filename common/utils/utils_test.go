@@ -92,3 +92,30 @@ func TestBuildURL(t *testing.T) {
 		t.Errorf("expect '%s', but it's '%s'", "/a/%E4%BD%A0%E5%A5%BD/d/%E4%B8%96%E7%95%8C", v)
 	}
 }
+
+func TestMatchPath(t *testing.T) {
+	cases := []struct {
+		pattern string
+		path    string
+		expect  bool
+	}{
+		{"a/*.txt", "a/b.txt", true},
+		{"a/*.txt", "a/b/c.txt", false},
+		{"a/**", "a", true},
+		{"a/**", "a/b/c.txt", true},
+		{"a/**/*.txt", "a/c.txt", true},
+		{"a/**/*.txt", "a/b/c/d.txt", true},
+		{"a/**/*.txt", "a/b/c/d.jpg", false},
+		{"**", "a/b", true},
+		{"/a/b/", "a/b", true},
+		{"a/?", "a/bc", false},
+	}
+	for _, c := range cases {
+		if r, e := MatchPath(c.pattern, c.path); e != nil || r != c.expect {
+			t.Errorf("'%s' '%s': expect %v, but it's %v, %v", c.pattern, c.path, c.expect, r, e)
+		}
+	}
+	if _, e := MatchPath("a/[", "a/b"); e == nil {
+		t.Errorf("expect error of bad pattern, but it's nil")
+	}
+}
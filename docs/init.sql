@@ -66,6 +66,165 @@ CREATE TABLE drive_cache
     PRIMARY KEY (drive, path, depth, type)
 );
 
+CREATE TABLE access_tokens
+(
+    id           VARCHAR
+        PRIMARY KEY,
+    username     VARCHAR NOT NULL,
+    name         VARCHAR NOT NULL,
+    token_hash   VARCHAR NOT NULL
+        UNIQUE,
+    read_only    INTEGER NOT NULL,
+    path_prefix  VARCHAR NOT NULL,
+    expires_at   INTEGER NOT NULL,
+    created_at   INTEGER NOT NULL,
+    last_used_at INTEGER NOT NULL
+);
+
+CREATE INDEX idx_access_tokens_username ON access_tokens (username);
+
+CREATE TABLE options
+(
+    opt_key   VARCHAR
+        PRIMARY KEY,
+    opt_value VARCHAR NOT NULL
+);
+
+CREATE TABLE user_totp
+(
+    username       VARCHAR
+        PRIMARY KEY,
+    secret         VARCHAR NOT NULL,
+    enabled        INTEGER NOT NULL,
+    recovery_codes VARCHAR,
+    last_counter   INTEGER NOT NULL
+);
+
+CREATE TABLE token_revocations
+(
+    id          VARCHAR
+        PRIMARY KEY,
+    revoked_at  INTEGER NOT NULL,
+    expires_at  INTEGER NOT NULL,
+    replaced_by VARCHAR NOT NULL
+);
+
+CREATE INDEX idx_token_revocations_expires_at ON token_revocations (expires_at);
+
+CREATE TABLE sessions
+(
+    token       VARCHAR
+        PRIMARY KEY,
+    username    VARCHAR NOT NULL,
+    data        TEXT    NOT NULL,
+    last_access INTEGER NOT NULL,
+    expires_at  INTEGER NOT NULL
+);
+
+CREATE INDEX idx_sessions_username ON sessions (username);
+CREATE INDEX idx_sessions_expires_at ON sessions (expires_at);
+
+CREATE TABLE signer_keys
+(
+    id         VARCHAR
+        PRIMARY KEY,
+    secret     VARCHAR NOT NULL,
+    created_at INTEGER NOT NULL,
+    expires_at INTEGER NOT NULL
+);
+
+CREATE TABLE schema_version
+(
+    version     INTEGER
+        PRIMARY KEY,
+    description VARCHAR NOT NULL,
+    applied_at  INTEGER NOT NULL
+);
+
+CREATE TABLE audit_logs
+(
+    id         INTEGER
+        PRIMARY KEY AUTOINCREMENT,
+    created_at INTEGER NOT NULL,
+    username   VARCHAR(32) NOT NULL,
+    client_ip  VARCHAR(64) NOT NULL,
+    action     VARCHAR(128) NOT NULL,
+    path       VARCHAR(4096) NOT NULL,
+    target     VARCHAR(4096) NOT NULL,
+    result     VARCHAR(16) NOT NULL,
+    error      VARCHAR(1024) NOT NULL,
+    request_id VARCHAR(64) NOT NULL
+);
+CREATE INDEX idx_audit_logs_created_at ON audit_logs (created_at);
+CREATE INDEX idx_audit_logs_username ON audit_logs (username);
+CREATE INDEX idx_audit_logs_action ON audit_logs (action);
+
+CREATE TABLE webhooks
+(
+    id          INTEGER
+        PRIMARY KEY AUTOINCREMENT,
+    name        VARCHAR(255) NOT NULL,
+    url         VARCHAR(1024) NOT NULL,
+    secret      VARCHAR(255) NOT NULL,
+    enabled     BOOLEAN NOT NULL,
+    path_prefix VARCHAR(4096) NOT NULL,
+    events      VARCHAR(255) NOT NULL,
+    created_at  INTEGER NOT NULL
+);
+
+CREATE TABLE webhook_deliveries
+(
+    id            INTEGER
+        PRIMARY KEY AUTOINCREMENT,
+    webhook_id    INTEGER NOT NULL,
+    event         VARCHAR(32) NOT NULL,
+    path          VARCHAR(4096) NOT NULL,
+    payload       TEXT NOT NULL,
+    status        VARCHAR(16) NOT NULL,
+    attempts      INTEGER NOT NULL,
+    response_code INTEGER NOT NULL,
+    error         VARCHAR(1024) NOT NULL,
+    created_at    INTEGER NOT NULL,
+    updated_at    INTEGER NOT NULL
+);
+CREATE INDEX idx_webhook_deliveries_webhook_id ON webhook_deliveries (webhook_id);
+CREATE INDEX idx_webhook_deliveries_created_at ON webhook_deliveries (created_at);
+
+CREATE TABLE upload_hooks
+(
+    id         INTEGER
+        PRIMARY KEY AUTOINCREMENT,
+    name       VARCHAR(255) NOT NULL,
+    pattern    VARCHAR(4096) NOT NULL,
+    command    VARCHAR(4096) NOT NULL,
+    timeout    INTEGER NOT NULL,
+    enabled    BOOLEAN NOT NULL,
+    created_at INTEGER NOT NULL
+);
+
+CREATE TABLE entry_scans
+(
+    path       VARCHAR,
+    dir        VARCHAR NOT NULL,
+    verdict    VARCHAR(16) NOT NULL,
+    size       INTEGER NOT NULL,
+    scanned_at INTEGER NOT NULL,
+    PRIMARY KEY (path)
+);
+CREATE INDEX idx_entry_scans_dir ON entry_scans (dir);
+
+CREATE TABLE user_identities
+(
+    issuer          VARCHAR(255)  NOT NULL,
+    subject         VARCHAR(255)  NOT NULL,
+    username        VARCHAR(32)   NOT NULL,
+    provisioned     BOOLEAN       NOT NULL,
+    assigned_groups VARCHAR(1024) NOT NULL,
+    created_at      INTEGER       NOT NULL,
+    PRIMARY KEY (issuer, subject)
+);
+CREATE INDEX idx_user_identities_username ON user_identities (username);
+
 -- Init data
 
 INSERT INTO users(username, password)
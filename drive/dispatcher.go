@@ -6,6 +6,8 @@ import (
 	"go-drive/common/drive_util"
 	"go-drive/common/errors"
 	"go-drive/common/i18n"
+	"go-drive/common/logging"
+	"go-drive/common/metrics"
 	"go-drive/common/task"
 	"go-drive/common/types"
 	"go-drive/common/utils"
@@ -15,10 +17,13 @@ import (
 	"regexp"
 	"strings"
 	"sync"
+	"time"
 )
 
 var pathRegexp = regexp.MustCompile(`^/?([^/]+)(/(.*))?$`)
 
+var driveLogger = logging.For("drive")
+
 // DispatcherDrive splits drive name and key from the raw key.
 // Then dispatch request to the specified drive.
 type DispatcherDrive struct {
@@ -28,14 +33,18 @@ type DispatcherDrive struct {
 	tempDir string
 
 	mountStorage *storage.PathMountDAO
-	mux          *sync.Mutex
+	// events receives the changes made by the mutations
+	events *DriveEventBus
+	mux    *sync.Mutex
 }
 
-func NewDispatcherDrive(mountStorage *storage.PathMountDAO, config common.Config) *DispatcherDrive {
+func NewDispatcherDrive(mountStorage *storage.PathMountDAO, config common.Config,
+	events *DriveEventBus) *DispatcherDrive {
 	return &DispatcherDrive{
 		drives:       make(map[string]types.IDrive),
 		mountStorage: mountStorage,
 		tempDir:      config.TempDir,
+		events:       events,
 		mux:          &sync.Mutex{},
 	}
 }
@@ -76,6 +85,20 @@ func (d *DispatcherDrive) reloadMounts() error {
 	return nil
 }
 
+// getDrives returns the drives, the map is replaced rather than modified by setDrives
+func (d *DispatcherDrive) getDrives() map[string]types.IDrive {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	return d.drives
+}
+
+// getMounts returns the mounts by the parent dir, the map is replaced rather than modified by reloadMounts
+func (d *DispatcherDrive) getMounts() map[string]map[string]types.PathMount {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	return d.mounts
+}
+
 func (d *DispatcherDrive) Meta(context.Context) types.DriveMeta {
 	panic("not supported")
 }
@@ -91,20 +114,65 @@ func (d *DispatcherDrive) resolve(path string) (types.IDrive, string, error) {
 	}
 	driveName := paths[1]
 	entryPath := paths[3]
-	drive, ok := d.drives[driveName]
+	drive, ok := d.getDrives()[driveName]
 	if !ok {
 		return nil, "", err.NewNotFoundError()
 	}
 	return drive, entryPath, nil
 }
 
+// driveName returns the name of the drive that the path is dispatched to
+func (d *DispatcherDrive) driveName(path string) string {
+	if targetPath := d.resolveMount(path); targetPath != "" {
+		path = targetPath
+	}
+	paths := pathRegexp.FindStringSubmatch(path)
+	if paths == nil {
+		return ""
+	}
+	return paths[1]
+}
+
+// observe records the metrics and logs of the operation on path,
+// the returned function should be deferred with the error
+func (d *DispatcherDrive) observe(ctx context.Context, operation, path string) func(*error) {
+	start := time.Now()
+	return func(e *error) {
+		name := d.driveName(path)
+		metrics.ObserveDriveOperation(name, operation, start, *e)
+		l := driveLogger.Ctx(ctx).With("drive", name, "operation", operation, "path", path)
+		if *e != nil {
+			if _, ok := (*e).(err.RequestError); !ok {
+				l.Warn("drive operation failed", "duration", time.Since(start), "error", *e)
+				return
+			}
+		}
+		if l.Enabled(logging.LevelDebug) {
+			fields := []interface{}{"duration", time.Since(start)}
+			if *e != nil {
+				fields = append(fields, "error", *e)
+			}
+			l.Debug("drive operation", fields...)
+		}
+	}
+}
+
+func (d *DispatcherDrive) notify(eventType, path string) {
+	d.events.publish(types.DriveEvent{Type: eventType, Path: path})
+}
+
+func (d *DispatcherDrive) notifyMove(from, to string) {
+	d.events.publish(types.DriveEvent{Type: types.DriveEventMove, Path: to, From: from})
+}
+
 func (d *DispatcherDrive) resolveMount(path string) string {
+	mounts := d.getMounts()
 	tree := utils.PathParentTree(path)
 	var mountAt, prefix string
 	for _, p := range tree {
 		dir := utils.PathParent(p)
 		name := utils.PathBase(p)
-		temp := d.mounts[dir]
+		temp := mounts[dir]
 		if temp != nil {
 			mountAt = temp[name].MountAt
 			if mountAt != "" {
@@ -126,7 +194,7 @@ func (d *DispatcherDrive) resolveMount(path string) string {
 func (d *DispatcherDrive) resolveMountedChildren(path string) ([]types.PathMount, bool) {
 	result := make([]types.PathMount, 0)
 	isSelf := false
-	for mountParent, mounts := range d.mounts {
+	for mountParent, mounts := range d.getMounts() {
 		for mountName, m := range mounts {
 			if strings.HasPrefix(path2.Join(mountParent, mountName), path) {
 				result = append(result, m)
@@ -139,7 +207,8 @@ func (d *DispatcherDrive) resolveMountedChildren(path string) ([]types.PathMount
 	return result, isSelf
 }
 
-func (d *DispatcherDrive) Get(ctx context.Context, path string) (types.IEntry, error) {
+func (d *DispatcherDrive) Get(ctx context.Context, path string) (_ types.IEntry, e error) {
+	defer d.observe(ctx, "get", path)(&e)
 	if utils.IsRootPath(path) {
 		return &driveEntry{d: d, path: "", name: "", meta: types.DriveMeta{
 			CanWrite: false,
@@ -157,7 +226,8 @@ func (d *DispatcherDrive) Get(ctx context.Context, path string) (types.IEntry, e
 }
 
 func (d *DispatcherDrive) Save(ctx types.TaskCtx, path string, size int64,
-	override bool, reader io.Reader) (types.IEntry, error) {
+	override bool, reader io.Reader) (_ types.IEntry, e error) {
+	defer d.observe(ctx, "save", path)(&e)
 	drive, realPath, e := d.resolve(path)
 	if e != nil {
 		return nil, e
@@ -166,10 +236,17 @@ func (d *DispatcherDrive) Save(ctx types.TaskCtx, path string, size int64,
 	if e != nil {
 		return nil, e
 	}
+	eventType := types.DriveEventCreate
+	if saved, ok := save.(types.ISavedEntry); ok && saved.Overwritten() {
+		eventType = types.DriveEventModify
+	}
+	metrics.AddDriveBytes(d.driveName(path), metrics.DirectionUpload, size)
+	d.notify(eventType, path)
 	return d.mapDriveEntry(path, save), nil
 }
 
-func (d *DispatcherDrive) MakeDir(ctx context.Context, path string) (types.IEntry, error) {
+func (d *DispatcherDrive) MakeDir(ctx context.Context, path string) (_ types.IEntry, e error) {
+	defer d.observe(ctx, "make_dir", path)(&e)
 	drive, realPath, e := d.resolve(path)
 	if e != nil {
 		return nil, e
@@ -178,11 +255,18 @@ func (d *DispatcherDrive) MakeDir(ctx context.Context, path string) (types.IEntr
 	if e != nil {
 		return nil, e
 	}
+	d.notify(types.DriveEventCreate, path)
 	return d.mapDriveEntry(path, dir), nil
 }
 
 func (d *DispatcherDrive) Copy(ctx types.TaskCtx, from types.IEntry, to string,
-	override bool) (types.IEntry, error) {
+	override bool) (_ types.IEntry, e error) {
+	defer d.observe(ctx, "copy", to)(&e)
+	defer func() {
+		if e == nil {
+			d.notify(types.DriveEventCreate, to)
+		}
+	}()
 	driveTo, pathTo, e := d.resolve(to)
 	if e != nil {
 		return nil, e
@@ -227,13 +311,19 @@ func (d *DispatcherDrive) Copy(ctx types.TaskCtx, from types.IEntry, to string,
 	return d.mapDriveEntry(to, copied), nil
 }
 
-func (d *DispatcherDrive) Move(ctx types.TaskCtx, from types.IEntry, to string, override bool) (types.IEntry, error) {
+func (d *DispatcherDrive) Move(ctx types.TaskCtx, from types.IEntry, to string, override bool) (_ types.IEntry, e error) {
+	defer d.observe(ctx, "move", to)(&e)
+	fromPath := from.Path()
+	defer func() {
+		if e == nil {
+			d.notifyMove(fromPath, to)
+		}
+	}()
 	driveTo, pathTo, e := d.resolve(to)
 	// if path depth is 1, move mounts
 	if e != nil && utils.PathDepth(to) != 1 {
 		return nil, e
 	}
-	fromPath := from.Path()
 	children, isSelf := d.resolveMountedChildren(fromPath)
 	if len(children) > 0 {
 		movedMounts := make([]types.PathMount, 0, len(children))
@@ -273,11 +363,13 @@ func (d *DispatcherDrive) Move(ctx types.TaskCtx, from types.IEntry, to string,
 	return d.Get(ctx, to)
 }
 
-func (d *DispatcherDrive) List(ctx context.Context, path string) ([]types.IEntry, error) {
+func (d *DispatcherDrive) List(ctx context.Context, path string) (_ []types.IEntry, e error) {
+	defer d.observe(ctx, "list", path)(&e)
 	var entries []types.IEntry
 	if utils.IsRootPath(path) {
-		drives := make([]types.IEntry, 0, len(d.drives))
-		for k, v := range d.drives {
+		all := d.getDrives()
+		drives := make([]types.IEntry, 0, len(all))
+		for k, v := range all {
 			drives = append(drives, &driveEntry{d: d, path: k, name: k, meta: v.Meta(ctx)})
 		}
 		entries = drives
@@ -293,7 +385,7 @@ func (d *DispatcherDrive) List(ctx context.Context, path string) ([]types.IEntry
 		entries = d.mapDriveEntries(path, list)
 	}
 
-	ms := d.mounts[path]
+	ms := d.getMounts()[path]
 	if ms != nil {
 		mountedMap := make(map[string]types.IEntry, len(entries))
 		for name, m := range ms {
@@ -325,7 +417,37 @@ func (d *DispatcherDrive) List(ctx context.Context, path string) ([]types.IEntry
 	return entries, nil
 }
 
-func (d *DispatcherDrive) Delete(ctx types.TaskCtx, path string) error {
+// ListPage lists natively by the dispatched drive,
+// except the root and the dirs having mounted children, which are paged after listing all
+func (d *DispatcherDrive) ListPage(ctx context.Context, path string,
+	opts types.ListOptions) (_ *types.EntryPage, e error) {
+	if utils.IsRootPath(path) || d.getMounts()[path] != nil {
+		entries, e := d.List(ctx, path)
+		if e != nil {
+			return nil, e
+		}
+		return drive_util.PageEntries(entries, opts)
+	}
+	defer d.observe(ctx, "list", path)(&e)
+	drive, realPath, e := d.resolve(path)
+	if e != nil {
+		return nil, e
+	}
+	page, e := drive_util.ListPage(ctx, drive, realPath, opts)
+	if e != nil {
+		return nil, e
+	}
+	page.Entries = d.mapDriveEntries(path, page.Entries)
+	return page, nil
+}
+
+func (d *DispatcherDrive) Delete(ctx types.TaskCtx, path string) (e error) {
+	defer d.observe(ctx, "delete", path)(&e)
+	defer func(path string) {
+		if e == nil {
+			d.notify(types.DriveEventDelete, path)
+		}
+	}(path)
 	children, isSelf := d.resolveMountedChildren(path)
 	if len(children) > 0 {
 		e := d.mountStorage.DeleteMounts(children)
@@ -348,7 +470,8 @@ func (d *DispatcherDrive) Delete(ctx types.TaskCtx, path string) error {
 }
 
 func (d *DispatcherDrive) Upload(ctx context.Context, path string, size int64,
-	override bool, config types.SM) (*types.DriveUploadConfig, error) {
+	override bool, config types.SM) (_ *types.DriveUploadConfig, e error) {
+	defer d.observe(ctx, "upload", path)(&e)
 	drive, path, e := d.resolve(path)
 	if e != nil {
 		return nil, e
@@ -410,11 +533,26 @@ func (d *entryWrapper) Name() string {
 
 func (d *entryWrapper) GetReader(ctx context.Context) (io.ReadCloser, error) {
 	if content, ok := d.entry.(types.IContent); ok {
-		return content.GetReader(ctx)
+		reader, e := content.GetReader(ctx)
+		if e != nil {
+			return nil, e
+		}
+		return newCountingReader(reader, d.d.driveName(d.path)), nil
 	}
 	return nil, err.NewNotAllowedError()
 }
 
+func (d *entryWrapper) GetRangeReader(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+	if content, ok := d.entry.(types.IRangeContent); ok {
+		reader, e := content.GetRangeReader(ctx, offset, length)
+		if e != nil {
+			return nil, e
+		}
+		return newCountingReader(reader, d.d.driveName(d.path)), nil
+	}
+	return nil, err.NewUnsupportedError()
+}
+
 func (d *entryWrapper) GetURL(ctx context.Context) (*types.ContentURL, error) {
 	if content, ok := d.entry.(types.IContent); ok {
 		return content.GetURL(ctx)
@@ -472,3 +610,40 @@ func (d *driveEntry) GetURL(context.Context) (*types.ContentURL, error) {
 func (d *driveEntry) Drive() types.IDrive {
 	return d.d
 }
+
+// countingReader records the downloaded bytes of the drive when closed
+type countingReader struct {
+	io.ReadCloser
+	drive string
+	n     int64
+}
+
+// countingReadSeeker keeps the reader seekable, so that it can still serve range requests
+type countingReadSeeker struct {
+	*countingReader
+	seeker io.Seeker
+}
+
+func (c *countingReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	return c.seeker.Seek(offset, whence)
+}
+
+func newCountingReader(reader io.ReadCloser, drive string) io.ReadCloser {
+	cr := &countingReader{ReadCloser: reader, drive: drive}
+	if seeker, ok := reader.(io.Seeker); ok {
+		return &countingReadSeeker{countingReader: cr, seeker: seeker}
+	}
+	return cr
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, e := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, e
+}
+
+func (c *countingReader) Close() error {
+	metrics.AddDriveBytes(c.drive, metrics.DirectionDownload, c.n)
+	c.n = 0
+	return c.ReadCloser.Close()
+}
@@ -0,0 +1,43 @@
+package drive
+
+import (
+	"go-drive/common/types"
+	"sync"
+)
+
+// DriveEventBus dispatches the drive events to the subscribers
+type DriveEventBus struct {
+	listeners map[int]func(types.DriveEvent)
+	seq       int
+	mux       *sync.RWMutex
+}
+
+func newDriveEventBus() *DriveEventBus {
+	return &DriveEventBus{
+		listeners: make(map[int]func(types.DriveEvent)),
+		mux:       &sync.RWMutex{},
+	}
+}
+
+// Subscribe adds the listener, returns the function to remove it.
+// The listener is called synchronously, it should not block.
+func (b *DriveEventBus) Subscribe(listener func(types.DriveEvent)) func() {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	b.seq++
+	id := b.seq
+	b.listeners[id] = listener
+	return func() {
+		b.mux.Lock()
+		defer b.mux.Unlock()
+		delete(b.listeners, id)
+	}
+}
+
+func (b *DriveEventBus) publish(event types.DriveEvent) {
+	b.mux.RLock()
+	defer b.mux.RUnlock()
+	for _, l := range b.listeners {
+		l(event)
+	}
+}
@@ -22,6 +22,7 @@ func init() {
 		README:      i18n.T("drive.fs.readme"),
 		ConfigForm: []types.FormItem{
 			{Field: "path", Label: i18n.T("drive.fs.form.path.label"), Type: "text", Required: true, Description: i18n.T("drive.fs.form.path.description")},
+			{Field: "watch", Label: i18n.T("drive.fs.form.watch.label"), Type: "checkbox", Description: i18n.T("drive.fs.form.watch.description")},
 		},
 		Factory: drive_util.DriveFactory{Create: NewFsDrive},
 	})
@@ -29,6 +30,8 @@ func init() {
 
 type FsDrive struct {
 	path string
+	// watch enables watching the changes made outside go-drive
+	watch bool
 }
 
 type fsFile struct {
@@ -39,6 +42,9 @@ type fsFile struct {
 	isDir bool
 
 	modTime int64
+
+	// overwritten is true if it's returned by Save and the file existed before
+	overwritten bool
 }
 
 // NewFsDrive creates a file system drive
@@ -61,7 +67,7 @@ func NewFsDrive(_ context.Context, config drive_util.DriveConfig,
 	if exists, _ := utils.FileExists(path); !exists {
 		return nil, err.NewNotFoundMessageError(i18n.T("drive.fs.root_path_not_exists"))
 	}
-	return &FsDrive{path}, nil
+	return &FsDrive{path: path, watch: config["watch"] != ""}, nil
 }
 
 func (f *FsDrive) newFsFile(path string, file os.FileInfo) (types.IEntry, error) {
@@ -109,10 +115,13 @@ func (f *FsDrive) Get(_ context.Context, path string) (types.IEntry, error) {
 
 func (f *FsDrive) Save(ctx types.TaskCtx, path string, _ int64, override bool, reader io.Reader) (types.IEntry, error) {
 	path = f.getPath(path)
+	overwritten := false
 	if !override {
 		if e := requireFile(path, false); e != nil {
 			return nil, e
 		}
+	} else {
+		overwritten, _ = utils.FileExists(path)
 	}
 	file, e := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
 	if e != nil {
@@ -121,13 +130,21 @@ func (f *FsDrive) Save(ctx types.TaskCtx, path string, _ int64, override bool, r
 	defer func() { _ = file.Close() }()
 	_, e = drive_util.Copy(task.NewProgressCtxWrapper(ctx), file, reader)
 	if e != nil {
+		// the file is truncated already, don't leave the incomplete content
+		_ = file.Close()
+		_ = os.Remove(path)
 		return nil, e
 	}
 	stat, e := file.Stat()
 	if e != nil {
 		return nil, e
 	}
-	return f.newFsFile(path, stat)
+	entry, e := f.newFsFile(path, stat)
+	if e != nil {
+		return nil, e
+	}
+	entry.(*fsFile).overwritten = overwritten
+	return entry, nil
 }
 
 func (f *FsDrive) MakeDir(ctx context.Context, path string) (types.IEntry, error) {
@@ -192,6 +209,19 @@ func (f *FsDrive) Move(_ types.TaskCtx, from types.IEntry, to string, override b
 }
 
 func (f *FsDrive) List(_ context.Context, path string) ([]types.IEntry, error) {
+	return f.list(path, "")
+}
+
+// ListPage skips the files not matching the filter before creating entries
+func (f *FsDrive) ListPage(_ context.Context, path string, opts types.ListOptions) (*types.EntryPage, error) {
+	entries, e := f.list(path, opts.Filter)
+	if e != nil {
+		return nil, e
+	}
+	return drive_util.PageEntries(entries, opts)
+}
+
+func (f *FsDrive) list(path string, filter string) ([]types.IEntry, error) {
 	path = f.getPath(path)
 	isDir, e := utils.IsDir(path)
 	if os.IsNotExist(e) {
@@ -204,13 +234,17 @@ func (f *FsDrive) List(_ context.Context, path string) ([]types.IEntry, error) {
 	if ee != nil {
 		return nil, ee
 	}
-	entries := make([]types.IEntry, len(files))
-	for i, file := range files {
+	filter = strings.ToLower(filter)
+	entries := make([]types.IEntry, 0, len(files))
+	for _, file := range files {
+		if filter != "" && !strings.Contains(strings.ToLower(file.Name()), filter) {
+			continue
+		}
 		entry, e := f.newFsFile(filepath.Join(path, file.Name()), file)
 		if e != nil {
 			return nil, e
 		}
-		entries[i] = entry
+		entries = append(entries, entry)
 	}
 	return entries, nil
 }
@@ -281,6 +315,10 @@ func (f *fsFile) ModTime() int64 {
 	return f.modTime
 }
 
+func (f *fsFile) Overwritten() bool {
+	return f.overwritten
+}
+
 func (f *fsFile) Drive() types.IDrive {
 	return f.drive
 }
@@ -0,0 +1,29 @@
+package drive
+
+import (
+	"go-drive/common/task"
+	"go-drive/common/types"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestFsSaveOverwritten(t *testing.T) {
+	root, e := ioutil.TempDir("", "go-drive-fs")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() { _ = os.RemoveAll(root) }()
+	f := &FsDrive{path: root}
+
+	for _, expect := range []bool{false, true} {
+		entry, e := f.Save(task.DummyContext(), "a.txt", 1, true, strings.NewReader("a"))
+		if e != nil {
+			t.Fatal(e)
+		}
+		if overwritten := entry.(types.ISavedEntry).Overwritten(); overwritten != expect {
+			t.Errorf("expect overwritten %v, but it's %v", expect, overwritten)
+		}
+	}
+}
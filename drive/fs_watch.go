@@ -0,0 +1,149 @@
+package drive
+
+import (
+	"github.com/fsnotify/fsnotify"
+	"go-drive/common/errors"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fsWatchDedupeWindow is the duration in which the same events are emitted once,
+// the parent dir and the dir itself emit the same event at almost the same time
+const fsWatchDedupeWindow = 100 * time.Millisecond
+
+// fsWatcher watches the dirs recursively, inotify only watches the direct children of a dir
+type fsWatcher struct {
+	f        *FsDrive
+	w        *fsnotify.Watcher
+	listener func(types.DriveEvent)
+	// dirs are the watched dirs
+	dirs map[string]bool
+	// last is the last emitted event, the same events are emitted by both the parent dir and itself
+	last   types.DriveEvent
+	lastAt time.Time
+	done   chan struct{}
+}
+
+// Watch watches the changes of all the files under the root
+func (f *FsDrive) Watch(listener func(types.DriveEvent)) (func(), error) {
+	if !f.watch {
+		return nil, err.NewUnsupportedError()
+	}
+	w, e := fsnotify.NewWatcher()
+	if e != nil {
+		return nil, e
+	}
+	fw := &fsWatcher{f: f, w: w, listener: listener, dirs: make(map[string]bool), done: make(chan struct{})}
+	if e := fw.add(f.path); e != nil {
+		_ = w.Close()
+		return nil, e
+	}
+	go fw.run()
+	once := sync.Once{}
+	return func() {
+		once.Do(func() {
+			_ = w.Close()
+			<-fw.done
+		})
+	}, nil
+}
+
+// add watches the dir and its descendant dirs
+func (fw *fsWatcher) add(dir string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, e error) error {
+		if e != nil {
+			if os.IsNotExist(e) {
+				// removed while walking
+				return nil
+			}
+			return e
+		}
+		if !info.IsDir() || fw.dirs[path] {
+			return nil
+		}
+		if e := fw.w.Add(path); e != nil {
+			return e
+		}
+		fw.dirs[path] = true
+		return nil
+	})
+}
+
+// remove stops watching the dir and its descendant dirs
+func (fw *fsWatcher) remove(dir string) {
+	prefix := dir + string(filepath.Separator)
+	for d := range fw.dirs {
+		if d == dir || strings.HasPrefix(d, prefix) {
+			_ = fw.w.Remove(d)
+			delete(fw.dirs, d)
+		}
+	}
+}
+
+func (fw *fsWatcher) run() {
+	defer close(fw.done)
+	for {
+		select {
+		case ev, ok := <-fw.w.Events:
+			if !ok {
+				return
+			}
+			fw.handle(ev)
+		case e, ok := <-fw.w.Errors:
+			if !ok {
+				return
+			}
+			driveLogger.Warn("error when watching fs drive", "root", fw.f.path, "error", e)
+		}
+	}
+}
+
+func (fw *fsWatcher) handle(ev fsnotify.Event) {
+	// the name is empty if the watch has been removed
+	path, ok := fw.f.relativePath(ev.Name)
+	if !ok || path == "" {
+		return
+	}
+	var eventType string
+	switch {
+	case ev.Op&fsnotify.Create != 0:
+		eventType = types.DriveEventCreate
+		if isDir, _ := utils.IsDir(ev.Name); isDir {
+			if e := fw.add(ev.Name); e != nil {
+				driveLogger.Warn("error when watching dir", "root", fw.f.path, "dir", ev.Name, "error", e)
+			}
+		}
+	case ev.Op&fsnotify.Write != 0:
+		eventType = types.DriveEventModify
+	case ev.Op&fsnotify.Remove != 0:
+		eventType = types.DriveEventDelete
+		fw.remove(ev.Name)
+	case ev.Op&fsnotify.Rename != 0:
+		eventType = types.DriveEventRename
+		// the watches are kept by inode, they will be added again by the create event of the new path
+		fw.remove(ev.Name)
+	default:
+		return
+	}
+	event := types.DriveEvent{Type: eventType, Path: path}
+	now := time.Now()
+	if event == fw.last && now.Sub(fw.lastAt) < fsWatchDedupeWindow {
+		return
+	}
+	fw.last, fw.lastAt = event, now
+	fw.listener(event)
+}
+
+// relativePath returns the path relative to the root, returns false if the path is not under the root
+func (f *FsDrive) relativePath(path string) (string, bool) {
+	if path != f.path && !strings.HasPrefix(path, f.path+string(filepath.Separator)) {
+		return "", false
+	}
+	path = strings.ReplaceAll(path[len(f.path):], "\\", "/")
+	return strings.TrimLeft(path, "/"), true
+}
@@ -0,0 +1,107 @@
+package drive
+
+import (
+	"github.com/fsnotify/fsnotify"
+	"go-drive/common/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFsRelativePath(t *testing.T) {
+	root := filepath.Join(os.TempDir(), "d")
+	f := &FsDrive{path: root}
+	for _, c := range []struct {
+		path   string
+		expect string
+		ok     bool
+	}{
+		{root, "", true},
+		{filepath.Join(root, "a.txt"), "a.txt", true},
+		{filepath.Join(root, "a", "b.txt"), "a/b.txt", true},
+		{root + "x", "", false},
+		{filepath.Join(root+"x", "a.txt"), "", false},
+		{os.TempDir(), "", false},
+	} {
+		path, ok := f.relativePath(c.path)
+		if ok != c.ok || path != c.expect {
+			t.Errorf("'%s': expect ('%s', %v), but it's ('%s', %v)", c.path, c.expect, c.ok, path, ok)
+		}
+	}
+}
+
+func TestFsWatcherDedupe(t *testing.T) {
+	root := os.TempDir()
+	events := make([]types.DriveEvent, 0)
+	fw := &fsWatcher{f: &FsDrive{path: root}, dirs: make(map[string]bool),
+		listener: func(event types.DriveEvent) { events = append(events, event) }}
+	name := filepath.Join(root, "a.txt")
+
+	fw.handle(fsnotify.Event{Name: name, Op: fsnotify.Write})
+	fw.handle(fsnotify.Event{Name: name, Op: fsnotify.Write})
+	if len(events) != 1 {
+		t.Fatalf("expect the same events in the window emitted once, but it's %d", len(events))
+	}
+	time.Sleep(fsWatchDedupeWindow)
+	fw.handle(fsnotify.Event{Name: name, Op: fsnotify.Write})
+	if len(events) != 2 {
+		t.Errorf("expect the same event after the window emitted, but it's %d", len(events))
+	}
+	fw.handle(fsnotify.Event{Name: filepath.Join(root+"x", "a.txt"), Op: fsnotify.Write})
+	if len(events) != 2 {
+		t.Errorf("expect the events outside the root ignored, but it's %v", events[len(events)-1])
+	}
+}
+
+func TestFsWatch(t *testing.T) {
+	root, e := ioutil.TempDir("", "go-drive-watch")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() { _ = os.RemoveAll(root) }()
+
+	events := make(chan types.DriveEvent, 64)
+	f := &FsDrive{path: root, watch: true}
+	stop, e := f.Watch(func(event types.DriveEvent) { events <- event })
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer stop()
+
+	expect := func(eventType, path string) {
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case event := <-events:
+				if event.Type == eventType && event.Path == path {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("expect event '%s' of '%s', but it's not received", eventType, path)
+			}
+		}
+	}
+
+	if e := os.Mkdir(filepath.Join(root, "sub"), 0755); e != nil {
+		t.Fatal(e)
+	}
+	expect(types.DriveEventCreate, "sub")
+	// the new dir is watched
+	if e := ioutil.WriteFile(filepath.Join(root, "sub", "a.txt"), []byte("a"), 0644); e != nil {
+		t.Fatal(e)
+	}
+	expect(types.DriveEventCreate, "sub/a.txt")
+
+	if e := os.RemoveAll(filepath.Join(root, "sub")); e != nil {
+		t.Fatal(e)
+	}
+	expect(types.DriveEventDelete, "sub")
+	time.Sleep(2 * fsWatchDedupeWindow)
+	for len(events) > 0 {
+		if event := <-events; event.Type == types.DriveEventDelete && event.Path == "sub" {
+			t.Errorf("expect the deletion of the dir emitted once")
+		}
+	}
+}
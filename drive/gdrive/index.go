@@ -242,6 +242,57 @@ func (g *GDrive) List(ctx context.Context, path string) ([]types.IEntry, error)
 	if cached, _ := g.cache.GetChildren(path); cached != nil {
 		return cached, nil
 	}
+	call, e := g.listCall(ctx, path)
+	if e != nil {
+		return nil, e
+	}
+	files := make([]*drive.File, 0)
+	e = call.Pages(ctx, func(resp *drive.FileList) error {
+		files = append(files, resp.Files...)
+		return nil
+	})
+	if e != nil {
+		return nil, e
+	}
+	entries := g.processEntries(path, files)
+	_ = g.cache.PutChildren(path, entries, g.cacheTTL)
+	return entries, nil
+}
+
+// ListPage lists by the page token natively when sorting by name or modified time.
+// Files with the same name in different pages will not be renamed.
+func (g *GDrive) ListPage(ctx context.Context, path string, opts types.ListOptions) (*types.EntryPage, error) {
+	orderBy, sortSupported := listOrderBy[opts.Sort]
+	token, native, e := drive_util.NativeListToken(opts, sortSupported)
+	if e != nil {
+		return nil, e
+	}
+	if !native {
+		entries, e := g.List(ctx, path)
+		if e != nil {
+			return nil, e
+		}
+		return drive_util.PageEntries(entries, opts)
+	}
+	call, e := g.listCall(ctx, path)
+	if e != nil {
+		return nil, e
+	}
+	if opts.Desc {
+		orderBy += " desc"
+	}
+	call = call.OrderBy(orderBy).PageToken(token)
+	if opts.Limit > 0 {
+		call = call.PageSize(int64(opts.Limit))
+	}
+	resp, e := call.Do()
+	if e != nil {
+		return nil, e
+	}
+	return drive_util.NewNativeListPage(g.processEntries(path, resp.Files), opts, resp.NextPageToken), nil
+}
+
+func (g *GDrive) listCall(ctx context.Context, path string) (*drive.FilesListCall, error) {
 	id := "root"
 	if !utils.IsRootPath(path) {
 		ge, e := g.getByPath(path, ctx)
@@ -250,17 +301,10 @@ func (g *GDrive) List(ctx context.Context, path string) ([]types.IEntry, error)
 		}
 		id = ge.fileId()
 	}
-	resp, e := g.s.Files.List().Context(ctx).
+	return g.s.Files.List().Context(ctx).
 		Q(fmt.Sprintf("'%s' in parents and trashed = false", id)).
-		Fields("files(id,name,mimeType,parents,hasThumbnail,thumbnailLink,modifiedTime,driveId,size," +
-			"shortcutDetails,capabilities(canDownload,canEdit,canDelete,canCopy))").
-		Do()
-	if e != nil {
-		return nil, e
-	}
-	entries := g.processEntries(path, resp.Files)
-	_ = g.cache.PutChildren(path, entries, g.cacheTTL)
-	return entries, nil
+		Fields("nextPageToken,files(id,name,mimeType,parents,hasThumbnail,thumbnailLink,modifiedTime,driveId,size," +
+			"shortcutDetails,capabilities(canDownload,canEdit,canDelete,canCopy))"), nil
 }
 
 func (g *GDrive) Delete(ctx types.TaskCtx, path string) error {
@@ -421,6 +465,14 @@ func (g *gdriveEntry) GetReader(ctx context.Context) (io.ReadCloser, error) {
 	return drive_util.GetURL(ctx, u.URL, u.Header)
 }
 
+func (g *gdriveEntry) GetRangeReader(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+	u, e := g.GetURL(ctx)
+	if e != nil {
+		return nil, e
+	}
+	return drive_util.GetURLRange(ctx, u.URL, u.Header, offset, length)
+}
+
 func (g *gdriveEntry) GetURL(context.Context) (*types.ContentURL, error) {
 	downloadUrl := ""
 
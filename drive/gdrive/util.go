@@ -37,6 +37,14 @@ var mimeTypeExtensionsMap = map[string]string{
 	"application/vnd.google-apps.script":       "json",
 }
 
+// listOrderBy is the orderBy of the sort fields supported by listing files,
+// see https://developers.google.com/drive/api/v3/reference/files/list
+var listOrderBy = map[string]string{
+	"":                  "name",
+	types.SortByName:    "name",
+	types.SortByModTime: "modifiedTime",
+}
+
 func oauthReq(c common.Config) *drive_util.OAuthRequest {
 	return &drive_util.OAuthRequest{
 		Endpoint:       google.Endpoint,
@@ -2,6 +2,7 @@ package onedrive
 
 import (
 	"fmt"
+	"go-drive/common/types"
 	"go-drive/common/utils"
 	"net/url"
 	path2 "path"
@@ -10,6 +11,14 @@ import (
 
 const uploadChunkSize = 4 * 1024 * 1024
 
+// listOrderBy is the $orderby of the sort fields supported by listing children
+var listOrderBy = map[string]string{
+	"":                  "name",
+	types.SortByName:    "name",
+	types.SortBySize:    "size",
+	types.SortByModTime: "lastModifiedDateTime",
+}
+
 // https://docs.microsoft.com/en-us/graph/api/resources/driveitem?view=graph-rest-1.0#instance-attributes
 const downloadUrlTTL = 40 * time.Minute
 
@@ -121,7 +130,8 @@ func (d driveItem) Path() string {
 }
 
 type driveItems struct {
-	Items []driveItem `json:"value"`
+	Items    []driveItem `json:"value"`
+	NextLink string      `json:"@odata.nextLink"`
 }
 
 type createUploadSessionResp struct {
@@ -12,6 +12,7 @@ import (
 	"go-drive/common/utils"
 	"io"
 	"net/http"
+	"net/url"
 	"strconv"
 	"time"
 )
@@ -237,24 +238,83 @@ func (o *OneDrive) List(ctx context.Context, path string) ([]types.IEntry, error
 	if cached, _ := o.cache.GetChildren(path); cached != nil {
 		return cached, nil
 	}
-	reqPath := pathURL(path) + "/children?$expand=thumbnails"
-	res := driveItems{}
-	resp, e := o.c.Get(ctx, reqPath, nil)
+	entries := make([]types.IEntry, 0)
+	token := ""
+	for {
+		items, next, e := o.listChildren(ctx, path, "", token, 0)
+		if e != nil {
+			return nil, e
+		}
+		entries = append(entries, items...)
+		if next == "" {
+			break
+		}
+		token = next
+	}
+	_ = o.cache.PutChildren(path, entries, o.cacheTTL)
+	return entries, nil
+}
+
+// ListPage lists by the skip token natively, except sorting by type
+func (o *OneDrive) ListPage(ctx context.Context, path string, opts types.ListOptions) (*types.EntryPage, error) {
+	orderBy, sortSupported := listOrderBy[opts.Sort]
+	token, native, e := drive_util.NativeListToken(opts, sortSupported)
 	if e != nil {
 		return nil, e
 	}
-	if e := resp.Json(&res); e != nil {
+	if !native {
+		entries, e := o.List(ctx, path)
+		if e != nil {
+			return nil, e
+		}
+		return drive_util.PageEntries(entries, opts)
+	}
+	if opts.Desc {
+		orderBy += " desc"
+	}
+	entries, next, e := o.listChildren(ctx, path, orderBy, token, opts.Limit)
+	if e != nil {
 		return nil, e
 	}
-	entries := make([]types.IEntry, 0)
+	return drive_util.NewNativeListPage(entries, opts, next), nil
+}
+
+// listChildren lists a page of children, returns the skip token of the next page
+func (o *OneDrive) listChildren(ctx context.Context, path, orderBy, token string,
+	limit int) ([]types.IEntry, string, error) {
+	query := url.Values{}
+	query.Set("$expand", "thumbnails")
+	if orderBy != "" {
+		query.Set("$orderby", orderBy)
+	}
+	if limit > 0 {
+		query.Set("$top", strconv.Itoa(limit))
+	}
+	if token != "" {
+		query.Set("$skiptoken", token)
+	}
+	res := driveItems{}
+	resp, e := o.c.Get(ctx, pathURL(path)+"/children?"+query.Encode(), nil)
+	if e != nil {
+		return nil, "", e
+	}
+	if e := resp.Json(&res); e != nil {
+		return nil, "", e
+	}
+	entries := make([]types.IEntry, 0, len(res.Items))
 	for _, v := range res.Items {
 		if v.Deleted != nil {
 			continue
 		}
 		entries = append(entries, o.newEntry(v))
 	}
-	_ = o.cache.PutChildren(path, entries, o.cacheTTL)
-	return entries, nil
+	next := ""
+	if res.NextLink != "" {
+		if u, e := url.Parse(res.NextLink); e == nil {
+			next = u.Query().Get("$skiptoken")
+		}
+	}
+	return entries, next, nil
 }
 
 func (o *OneDrive) Delete(ctx types.TaskCtx, path string) error {
@@ -382,6 +442,14 @@ func (o *oneDriveEntry) GetReader(ctx context.Context) (io.ReadCloser, error) {
 	return drive_util.GetURL(ctx, u.URL, nil)
 }
 
+func (o *oneDriveEntry) GetRangeReader(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+	u, e := o.GetURL(ctx)
+	if e != nil {
+		return nil, e
+	}
+	return drive_util.GetURLRange(ctx, u.URL, nil, offset, length)
+}
+
 func (o *oneDriveEntry) GetURL(ctx context.Context) (*types.ContentURL, error) {
 	if o.isDir {
 		return nil, err.NewNotAllowedError()
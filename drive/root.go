@@ -8,10 +8,11 @@ import (
 	"go-drive/common/errors"
 	"go-drive/common/i18n"
 	"go-drive/common/types"
+	"go-drive/common/utils"
 	_ "go-drive/drive/gdrive"
 	_ "go-drive/drive/onedrive"
 	"go-drive/storage"
-	"log"
+	path2 "path"
 	"sync"
 )
 
@@ -24,6 +25,10 @@ type RootDrive struct {
 
 	config common.Config
 
+	events *DriveEventBus
+	// stopWatches stops watching the drives
+	stopWatches []func()
+
 	mux *sync.Mutex
 }
 
@@ -34,7 +39,8 @@ func NewRootDrive(
 	mountStorage *storage.PathMountDAO,
 	dataStorage *storage.DriveDataDAO,
 	driveCacheStorage *storage.DriveCacheDAO) (*RootDrive, error) {
-	root := NewDispatcherDrive(mountStorage, config)
+	events := newDriveEventBus()
+	root := NewDispatcherDrive(mountStorage, config, events)
 	r := &RootDrive{
 		root:              root,
 		driveStorage:      driveStorage,
@@ -42,6 +48,7 @@ func NewRootDrive(
 		driveDataStorage:  dataStorage,
 		driveCacheStorage: driveCacheStorage,
 		config:            config,
+		events:            events,
 		mux:               &sync.Mutex{},
 	}
 	if e := r.ReloadMounts(); e != nil {
@@ -57,6 +64,11 @@ func (d *RootDrive) Get() types.IDrive {
 	return d.root
 }
 
+// Events returns the bus of the events of all drives, the paths of events are prefixed with the drive name
+func (d *RootDrive) Events() *DriveEventBus {
+	return d.events
+}
+
 func checkAndParseConfig(dc types.Drive) (*drive_util.DriveFactory, types.SM, error) {
 	f := drive_util.GetDrive(dc.Type)
 	if f == nil {
@@ -96,7 +108,7 @@ func (d *RootDrive) ReloadDrive(ctx context.Context, ignoreFailure bool) error {
 		factory, config, e := checkAndParseConfig(dc)
 		if e != nil {
 			if ignoreFailure {
-				log.Printf("[%s]: %v", dc.Name, e)
+				driveLogger.Ctx(ctx).Warn("error when parsing drive config", "drive", dc.Name, "error", e)
 				continue
 			}
 			return e
@@ -104,22 +116,75 @@ func (d *RootDrive) ReloadDrive(ctx context.Context, ignoreFailure bool) error {
 		iDrive, e := factory.Create(ctx, config, d.createDriveUtils(dc.Name))
 		if e != nil {
 			if ignoreFailure {
-				log.Printf("[%s]: %v", dc.Name, e)
+				driveLogger.Ctx(ctx).Warn("error when creating drive", "drive", dc.Name, "error", e)
 				continue
 			}
 			return err.NewBadRequestError(i18n.T("drive.root.error_create_drive", dc.Name, e.Error()))
 		}
 		drives[dc.Name] = iDrive
 	}
+	d.stopWatching()
 	d.root.setDrives(drives)
+	d.watchDrives(ctx, drives)
 	ok = true
 	return nil
 }
 
+func (d *RootDrive) watchDrives(ctx context.Context, drives map[string]types.IDrive) {
+	for name, drive := range drives {
+		wd, ok := drive.(types.IWatchableDrive)
+		if !ok {
+			continue
+		}
+		stop, e := wd.Watch(d.onDriveEvent(name))
+		if e != nil {
+			if !err.IsUnsupportedError(e) {
+				driveLogger.Ctx(ctx).Warn("error when watching drive", "drive", name, "error", e)
+			}
+			continue
+		}
+		d.stopWatches = append(d.stopWatches, stop)
+	}
+}
+
+func (d *RootDrive) stopWatching() {
+	for _, stop := range d.stopWatches {
+		stop()
+	}
+	d.stopWatches = nil
+}
+
+// onDriveEvent evicts the cache of the changed entry, then publishes the event
+func (d *RootDrive) onDriveEvent(name string) func(types.DriveEvent) {
+	cache := d.driveCacheStorage.GetCacheStore(name, drive_util.SerializeEntry, nil)
+	return func(event types.DriveEvent) {
+		driveLogger.Debug("drive changed", "drive", name, "event", event.Type, "path", event.Path)
+		_ = cache.Evict(event.Path, event.Type != types.DriveEventModify)
+		_ = cache.Evict(utils.PathParent(event.Path), false)
+		event.Path = path2.Join(name, event.Path)
+		event.Watched = true
+		d.events.publish(event)
+	}
+}
+
 func (d *RootDrive) ReloadMounts() error {
 	return d.root.reloadMounts()
 }
 
+// SaveMounts saves and reloads the mounts, then notifies the mounted entries
+func (d *RootDrive) SaveMounts(mounts []types.PathMount, override bool) error {
+	if e := d.mountStorage.SaveMounts(mounts, override); e != nil {
+		return e
+	}
+	if e := d.ReloadMounts(); e != nil {
+		return e
+	}
+	for _, m := range mounts {
+		d.root.notify(types.DriveEventCreate, path2.Join(*m.Path, m.Name))
+	}
+	return nil
+}
+
 func (d *RootDrive) DriveInitConfig(ctx context.Context, name string) (*drive_util.DriveInitConfig, error) {
 	dc, e := d.driveStorage.GetDrive(name)
 	if e != nil {
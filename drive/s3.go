@@ -281,20 +281,78 @@ func (s *S3Drive) List(ctx context.Context, path string) ([]types.IEntry, error)
 	if cached, _ := s.cache.GetChildren(path); cached != nil {
 		return cached, nil
 	}
-	s3Path := path
-	if !utils.IsRootPath(s3Path) {
-		s3Path = s3Path + "/"
+	entries := make([]types.IEntry, 0)
+	pathSet := make(map[string]bool, 0)
+	e := s.c.ListObjectsV2PagesWithContext(ctx, s.listInput(path, "", 0),
+		func(objs *s3.ListObjectsV2Output, _ bool) bool {
+			entries = s.appendListEntries(entries, objs, path, pathSet)
+			return true
+		})
+	if e != nil {
+		return nil, e
 	}
-	objs, e := s.c.ListObjectsWithContext(ctx, &s3.ListObjectsInput{
-		Bucket:    s.bucket,
-		Prefix:    aws.String(s3Path),
-		Delimiter: aws.String("/"),
-	})
+	_ = s.cache.PutChildren(path, entries, s.cacheTTL)
+	return entries, nil
+}
+
+// ListPage lists by the continuation token natively when sorting by name ascending
+func (s *S3Drive) ListPage(ctx context.Context, path string, opts types.ListOptions) (*types.EntryPage, error) {
+	token, native, e := drive_util.NativeListToken(opts,
+		(opts.Sort == "" || opts.Sort == types.SortByName) && !opts.Desc)
 	if e != nil {
 		return nil, e
 	}
-	entries := make([]types.IEntry, 0)
-	pathSet := make(map[string]bool, 0)
+	if !native {
+		entries, e := s.List(ctx, path)
+		if e != nil {
+			return nil, e
+		}
+		return drive_util.PageEntries(entries, opts)
+	}
+	if token == "" {
+		if cached, _ := s.cache.GetChildren(path); cached != nil {
+			return drive_util.PageEntries(cached, opts)
+		}
+	}
+	objs, e := s.c.ListObjectsV2WithContext(ctx, s.listInput(path, token, opts.Limit))
+	if e != nil {
+		return nil, e
+	}
+	entries := s.appendListEntries(make([]types.IEntry, 0), objs, path, make(map[string]bool))
+	// objects and common prefixes are returned separately
+	drive_util.SortEntries(entries, types.SortByName, false)
+	next := ""
+	if objs.IsTruncated != nil && *objs.IsTruncated && objs.NextContinuationToken != nil {
+		next = *objs.NextContinuationToken
+	}
+	return drive_util.NewNativeListPage(entries, opts, next), nil
+}
+
+func listPrefix(path string) string {
+	if utils.IsRootPath(path) {
+		return path
+	}
+	return path + "/"
+}
+
+func (s *S3Drive) listInput(path, token string, limit int) *s3.ListObjectsV2Input {
+	input := &s3.ListObjectsV2Input{
+		Bucket:    s.bucket,
+		Prefix:    aws.String(listPrefix(path)),
+		Delimiter: aws.String("/"),
+	}
+	if token != "" {
+		input.ContinuationToken = aws.String(token)
+	}
+	if limit > 0 {
+		input.MaxKeys = aws.Int64(int64(limit))
+	}
+	return input
+}
+
+func (s *S3Drive) appendListEntries(entries []types.IEntry, objs *s3.ListObjectsV2Output,
+	path string, pathSet map[string]bool) []types.IEntry {
+	s3Path := listPrefix(path)
 	for _, o := range objs.Contents {
 		if *o.Key == s3Path {
 			// fake dir
@@ -310,8 +368,7 @@ func (s *S3Drive) List(ctx context.Context, path string) ([]types.IEntry, error)
 		}
 		entries = append(entries, s.newS3DirEntry(*p.Prefix, nil))
 	}
-	_ = s.cache.PutChildren(path, entries, s.cacheTTL)
-	return entries, nil
+	return entries
 }
 
 func (s *S3Drive) delete(path string, ctx types.TaskCtx) error {
@@ -543,6 +600,18 @@ func (s *s3Entry) GetReader(ctx context.Context) (io.ReadCloser, error) {
 	return obj.Body, nil
 }
 
+func (s *s3Entry) GetRangeReader(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+	obj, e := s.c.c.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: s.c.bucket,
+		Key:    aws.String(s.key),
+		Range:  aws.String(drive_util.RangeHeader(offset, length)),
+	})
+	if e != nil {
+		return nil, e
+	}
+	return obj.Body, nil
+}
+
 func (s *s3Entry) GetURL(context.Context) (*types.ContentURL, error) {
 	req, _ := s.c.c.GetObjectRequest(&s3.GetObjectInput{
 		Bucket: s.c.bucket,
@@ -334,6 +334,17 @@ func (w *webDavEntry) GetReader(ctx context.Context) (io.ReadCloser, error) {
 	return resp.Response().Body, nil
 }
 
+func (w *webDavEntry) GetRangeReader(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+	if !w.Type().IsFile() {
+		return nil, err.NewNotAllowedError()
+	}
+	resp, e := w.d.c.Get(ctx, w.path, types.SM{"Range": drive_util.RangeHeader(offset, length)})
+	if e != nil {
+		return nil, e
+	}
+	return drive_util.RangeResponseReader(resp.Response(), offset, length)
+}
+
 func (w *webDavEntry) GetURL(context.Context) (*types.ContentURL, error) {
 	if !w.Type().IsFile() {
 		return nil, err.NewNotAllowedError()
@@ -3,9 +3,12 @@ module go-drive
 go 1.13
 
 require (
+	github.com/BurntSushi/toml v0.3.1
 	github.com/Jeffail/tunny v0.0.0-20190930221602-f13eb662a36a
 	github.com/aws/aws-sdk-go v1.34.25
+	github.com/fsnotify/fsnotify v1.4.9
 	github.com/gin-gonic/gin v1.6.2
+	github.com/go-ldap/ldap/v3 v3.2.4
 	github.com/golang/protobuf v1.4.3 // indirect
 	github.com/google/go-cmp v0.5.2 // indirect
 	github.com/google/uuid v1.1.2
@@ -14,6 +17,7 @@ require (
 	github.com/mattn/go-sqlite3 v2.0.3+incompatible
 	github.com/nfnt/resize v0.0.0-20180221191011-83c6a9932646
 	github.com/orcaman/concurrent-map v0.0.0-20190826125027-8c72a8bb44f6
+	github.com/prometheus/client_golang v1.8.0
 	golang.org/x/crypto v0.0.0-20200728195943-123391ffb6de
 	golang.org/x/net v0.0.0-20201110031124-69a78807bb2b // indirect
 	golang.org/x/oauth2 v0.0.0-20201109201403-9fd604954f58
@@ -21,5 +25,5 @@ require (
 	golang.org/x/text v0.3.4
 	google.golang.org/api v0.30.0
 	google.golang.org/appengine v1.6.7 // indirect
-	gopkg.in/yaml.v2 v2.2.8
+	gopkg.in/yaml.v2 v2.3.0
 )
@@ -3,24 +3,38 @@ package main
 import (
 	"context"
 	"go-drive/common"
+	"go-drive/common/logging"
 	"go-drive/common/registry"
+	"go-drive/storage"
 	"log"
 	"math/rand"
 	"net/http"
+	"os"
 	"time"
 )
 
 func init() {
 	rand.Seed(time.Now().UnixNano())
+	// logs of the standard logger(mostly from libraries)
+	log.SetFlags(0)
+	log.SetOutput(logging.For("std").Writer(logging.LevelInfo))
 }
 
 func main() {
+	logger := logging.For("main")
 	ch := registry.NewComponentHolder()
 
 	engine, e := Initialize(context.Background(), ch)
+	if e == storage.ErrMigrated {
+		os.Exit(0)
+	}
 	if e != nil {
-		log.Fatalln(e)
+		logger.Error("failed to initialize", "error", e)
+		os.Exit(1)
 	}
 
-	log.Fatalln(http.ListenAndServe(ch.Get("config").(common.Config).Listen, engine))
+	config := ch.Get("config").(common.Config)
+	logger.Info("server started", "listen", config.Listen)
+	logger.Error("server stopped", "error", http.ListenAndServe(config.Listen, engine))
+	os.Exit(1)
 }
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"go-drive/common/errors"
+	"go-drive/common/i18n"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"go-drive/storage"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	accessTokenPrefix = "gdp_"
+	accessTokenBytes  = 24
+
+	// accessTokenTouchInterval is the minimum interval of updating the last used time
+	accessTokenTouchInterval = time.Minute
+)
+
+func isAccessToken(token string) bool {
+	return strings.HasPrefix(token, accessTokenPrefix)
+}
+
+func newAccessTokenValue() (string, error) {
+	b := make([]byte, accessTokenBytes)
+	if _, e := rand.Read(b); e != nil {
+		return "", e
+	}
+	return accessTokenPrefix + hex.EncodeToString(b), nil
+}
+
+func hashAccessToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
+func validateAccessToken(accessTokenDAO *storage.AccessTokenDAO,
+	userDAO *storage.UserDAO, token string) (types.Session, error) {
+	t, e := accessTokenDAO.GetByHash(hashAccessToken(token))
+	if e != nil {
+		if err.IsNotFoundError(e) {
+			return types.Session{}, err.NewUnauthorizedError(i18n.T("api.access_token.invalid_token"))
+		}
+		return types.Session{}, e
+	}
+	if t.IsExpired() {
+		return types.Session{}, err.NewUnauthorizedError(i18n.T("api.access_token.invalid_token"))
+	}
+	user, e := userDAO.GetUser(t.Username)
+	if e != nil {
+		if err.IsNotFoundError(e) {
+			return types.Session{}, err.NewUnauthorizedError(i18n.T("api.access_token.invalid_token"))
+		}
+		return types.Session{}, e
+	}
+	now := time.Now()
+	if now.Sub(time.Unix(t.LastUsedAt, 0)) >= accessTokenTouchInterval {
+		if e := accessTokenDAO.UpdateLastUsed(t.Id, now.Unix()); e == nil {
+			t.LastUsedAt = now.Unix()
+		}
+	}
+	return types.Session{User: user, AccessToken: &t}, nil
+}
+
+func isReadOnlyMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// accessTokenScope is the limitation of the personal access token
+type accessTokenScope struct {
+	readOnly   bool
+	pathPrefix string
+}
+
+func newAccessTokenScope(session types.Session) *accessTokenScope {
+	if session.AccessToken == nil {
+		return nil
+	}
+	return &accessTokenScope{
+		readOnly:   session.AccessToken.ReadOnly,
+		pathPrefix: utils.CleanPath(session.AccessToken.PathPrefix),
+	}
+}
+
+// apply limits the permission to the scope.
+// The ancestors of the path prefix are readable, so that the path prefix can be navigated to.
+func (s *accessTokenScope) apply(path string, permission types.Permission) types.Permission {
+	if s == nil {
+		return permission
+	}
+	if s.readOnly {
+		permission &= types.PermissionRead
+	}
+	if s.pathPrefix == "" || path == s.pathPrefix || strings.HasPrefix(path, s.pathPrefix+"/") {
+		return permission
+	}
+	if utils.IsRootPath(path) || strings.HasPrefix(s.pathPrefix, path+"/") {
+		return permission & types.PermissionRead
+	}
+	return types.PermissionEmpty
+}
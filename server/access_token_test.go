@@ -0,0 +1,108 @@
+package server
+
+import (
+	"github.com/gin-gonic/gin"
+	"go-drive/common/types"
+	"go-drive/storage"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAccessTokenScope(t *testing.T) {
+	scope := newAccessTokenScope(types.Session{AccessToken: &types.AccessToken{ReadOnly: true, PathPrefix: "/d/pub/"}})
+	for _, c := range []struct {
+		path   string
+		expect types.Permission
+	}{
+		{"d/pub", types.PermissionRead},
+		{"d/pub/a", types.PermissionRead},
+		// the ancestors can be navigated to
+		{"", types.PermissionRead},
+		{"d", types.PermissionRead},
+		{"d/pubx", types.PermissionEmpty},
+		{"d/other/a", types.PermissionEmpty},
+	} {
+		if p := scope.apply(c.path, types.PermissionReadWrite); p != c.expect {
+			t.Errorf("'%s': expect permission %d, but it's %d", c.path, c.expect, p)
+		}
+	}
+
+	scope = newAccessTokenScope(types.Session{AccessToken: &types.AccessToken{PathPrefix: "d/pub"}})
+	if p := scope.apply("d/pub/a", types.PermissionReadWrite); p != types.PermissionReadWrite {
+		t.Errorf("expect the writable token writes in the prefix, but it's %d", p)
+	}
+	if p := scope.apply("d", types.PermissionReadWrite); p != types.PermissionRead {
+		t.Errorf("expect the ancestors of the prefix read-only, but it's %d", p)
+	}
+	if p := newAccessTokenScope(types.Session{}).apply("d", types.PermissionReadWrite); p != types.PermissionReadWrite {
+		t.Errorf("expect the session not limited, but it's %d", p)
+	}
+}
+
+func TestAccessTokenAuth(t *testing.T) {
+	db, _, cleanup := newTestDB(t)
+	defer cleanup()
+	userDAO := storage.NewUserDAO(db)
+	accessTokenDAO := storage.NewAccessTokenDAO(db)
+	tokenStore := NewMemTokenStore(time.Hour, false, time.Hour)
+	defer func() { _ = tokenStore.Dispose() }()
+
+	if _, e := userDAO.AddUser(types.User{Username: "alice", Password: "123456"}); e != nil {
+		t.Fatal(e)
+	}
+	tokens := make(map[string]string)
+	for name, token := range map[string]types.AccessToken{
+		"read-only": {ReadOnly: true},
+		"expired":   {ExpiresAt: time.Now().Add(-time.Minute).Unix()},
+	} {
+		value, e := newAccessTokenValue()
+		if e != nil {
+			t.Fatal(e)
+		}
+		token.Id, token.Name, token.Username, token.TokenHash = name, name, "alice", hashAccessToken(value)
+		if _, e := accessTokenDAO.AddToken(token); e != nil {
+			t.Fatal(e)
+		}
+		tokens[name] = value
+	}
+
+	// only the hash is stored
+	saved, e := accessTokenDAO.GetByHash(hashAccessToken(tokens["read-only"]))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if saved.Id != "read-only" || saved.TokenHash == tokens["read-only"] {
+		t.Errorf("expect the token found by its hash, but it's '%s'", saved.Id)
+	}
+
+	engine := gin.New()
+	engine.Use(apiResultHandler(keyMessageSource{}))
+	engine.Any("/test", Auth(tokenStore, accessTokenDAO, userDAO), func(c *gin.Context) {
+		SetResult(c, GetSession(c).User.Username)
+	})
+	request := func(method, token string) int {
+		req := httptest.NewRequest(method, "/test", nil)
+		req.Header.Set(headerAuth, token)
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		return w.Code
+	}
+	for _, c := range []struct {
+		method, token string
+		expect        int
+	}{
+		{http.MethodGet, tokens["read-only"], http.StatusOK},
+		{http.MethodHead, tokens["read-only"], http.StatusOK},
+		{http.MethodPost, tokens["read-only"], http.StatusForbidden},
+		{http.MethodDelete, tokens["read-only"], http.StatusForbidden},
+		{http.MethodGet, tokens["expired"], http.StatusUnauthorized},
+		// the hash can't be used as the token
+		{http.MethodGet, accessTokenPrefix + saved.TokenHash, http.StatusUnauthorized},
+	} {
+		if code := request(c.method, c.token); code != c.expect {
+			t.Errorf("%s with '%s': expect %d, but it's %d", c.method, c.token, c.expect, code)
+		}
+	}
+}
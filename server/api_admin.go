@@ -13,21 +13,38 @@ import (
 	"go-drive/storage"
 	"regexp"
 	"sort"
+	"strings"
+	"time"
 )
 
 func InitAdminRoutes(r gin.IRouter,
 	ch *registry.ComponentsHolder,
 	rootDrive *drive.RootDrive,
 	tokenStore types.TokenStore,
+	accessTokenDAO *storage.AccessTokenDAO,
+	optionsDAO *storage.OptionsDAO,
+	ldapAuth *LDAPAuth,
+	twoFactor *TwoFactorAuth,
+	loginLimiter *LoginLimiter,
+	signerKeys *SignerKeyManager,
 	userDAO *storage.UserDAO,
 	groupDAO *storage.GroupDAO,
+	identityDAO *storage.UserIdentityDAO,
 	driveDAO *storage.DriveDAO,
 	driveCacheDAO *storage.DriveCacheDAO,
 	driveDataDAO *storage.DriveDataDAO,
 	permissionDAO *storage.PathPermissionDAO,
-	pathMountDAO *storage.PathMountDAO) {
-
-	r = r.Group("/admin", Auth(tokenStore), UserGroupRequired("admin"))
+	pathMountDAO *storage.PathMountDAO,
+	auditor *Auditor,
+	auditLogDAO *storage.AuditLogDAO,
+	webhooks *Webhooks,
+	webhookDAO *storage.WebhookDAO,
+	uploadHooks *UploadHooks,
+	uploadHookDAO *storage.UploadHookDAO,
+	ms i18n.MessageSource) {
+
+	r = r.Group("/admin", Auth(tokenStore, accessTokenDAO, userDAO), AuditAdmin(auditor),
+		UserGroupRequired("admin"), AdminTwoFactorRequired(twoFactor))
 
 	// region user
 
@@ -84,6 +101,12 @@ func InitAdminRoutes(r gin.IRouter,
 			_ = c.Error(e)
 			return
 		}
+		if user.Password != "" {
+			// keep the current session if the admin changed their own password
+			if e := revokeUserSessions(tokenStore, username, GetToken(c)); e != nil {
+				_ = c.Error(e)
+			}
+		}
 	})
 
 	// delete user
@@ -94,6 +117,116 @@ func InitAdminRoutes(r gin.IRouter,
 			_ = c.Error(e)
 			return
 		}
+		if e := revokeUserSessions(tokenStore, username, ""); e != nil {
+			_ = c.Error(e)
+		}
+	})
+
+	// reset the 2FA of user
+	r.DELETE("/user/:username/2fa", func(c *gin.Context) {
+		if e := twoFactor.Reset(c.Param("username")); e != nil {
+			_ = c.Error(e)
+		}
+	})
+
+	// list the external identities bound to the user
+	r.GET("/user/:username/identities", func(c *gin.Context) {
+		identities, e := identityDAO.ListByUser(c.Param("username"))
+		if e != nil {
+			_ = c.Error(e)
+			return
+		}
+		SetResult(c, identities)
+	})
+
+	// link the external identity to the existing user, then the user can login via the identity provider
+	r.POST("/user/:username/identities", func(c *gin.Context) {
+		identity := types.UserIdentity{}
+		if e := c.Bind(&identity); e != nil {
+			_ = c.Error(e)
+			return
+		}
+		user, e := userDAO.GetUser(c.Param("username"))
+		if e != nil {
+			_ = c.Error(e)
+			return
+		}
+		added, e := identityDAO.Add(types.UserIdentity{
+			Issuer:   identity.Issuer,
+			Subject:  identity.Subject,
+			Username: user.Username,
+		})
+		if e != nil {
+			_ = c.Error(e)
+			return
+		}
+		SetResult(c, added)
+	})
+
+	// unlink the external identity, identified by the query 'issuer' and 'subject'
+	r.DELETE("/user/:username/identities", func(c *gin.Context) {
+		identity, e := identityDAO.Get(c.Query("issuer"), c.Query("subject"))
+		if e != nil {
+			_ = c.Error(e)
+			return
+		}
+		if identity == nil || identity.Username != c.Param("username") {
+			_ = c.Error(err.NewNotFoundError())
+			return
+		}
+		if e := identityDAO.Delete(identity.Issuer, identity.Subject); e != nil {
+			_ = c.Error(e)
+		}
+	})
+
+	// endregion
+
+	// region session
+
+	// list sessions, filtered by the query 'username'
+	r.GET("/sessions", func(c *gin.Context) {
+		sessions, e := listSessions(tokenStore, c.Query("username"), GetToken(c))
+		if e != nil {
+			_ = c.Error(e)
+			return
+		}
+		SetResult(c, sessions)
+	})
+
+	r.DELETE("/session/:id", func(c *gin.Context) {
+		if e := revokeSession(tokenStore, "", c.Param("id"), GetToken(c)); e != nil {
+			_ = c.Error(e)
+		}
+	})
+
+	// revoke all sessions of the user
+	r.DELETE("/user/:username/sessions", func(c *gin.Context) {
+		if e := revokeUserSessions(tokenStore, c.Param("username"), GetToken(c)); e != nil {
+			_ = c.Error(e)
+		}
+	})
+
+	// endregion
+
+	// region login lockout
+
+	r.GET("/lockouts", func(c *gin.Context) {
+		SetResult(c, loginLimiter.List())
+	})
+
+	// clear the lockout of the username or ip
+	r.DELETE("/lockout/:type/:value", func(c *gin.Context) {
+		t := c.Param("type")
+		if t != LockoutTypeUser && t != LockoutTypeIP {
+			_ = c.Error(err.NewNotFoundError())
+			return
+		}
+		loginLimiter.Clear(t, c.Param("value"))
+	})
+
+	// clear all lockouts
+	r.DELETE("/lockouts", func(c *gin.Context) {
+		loginLimiter.Clear("", "")
 	})
 
 	// endregion
@@ -325,17 +458,273 @@ func InitAdminRoutes(r gin.IRouter,
 		for i, p := range src {
 			mounts[i] = types.PathMount{Path: &to, Name: p.Name, MountAt: p.Path}
 		}
-		if e := pathMountDAO.SaveMounts(mounts, true); e != nil {
+		if e := rootDrive.SaveMounts(mounts, true); e != nil {
+			_ = c.Error(e)
+			return
+		}
+	})
+
+	// endregion
+
+	// region webhook
+
+	// get webhooks
+	r.GET("/webhooks", func(c *gin.Context) {
+		hooks, e := webhookDAO.GetWebhooks()
+		if e != nil {
+			_ = c.Error(e)
+			return
+		}
+		for i := range hooks {
+			hooks[i].Secret = escapedPassword
+		}
+		SetResult(c, hooks)
+	})
+
+	// add webhook, the secret is generated if it's empty
+	r.POST("/webhook", func(c *gin.Context) {
+		h := types.Webhook{}
+		if e := c.Bind(&h); e != nil {
+			_ = c.Error(e)
+			return
+		}
+		if e := checkWebhook(&h); e != nil {
+			_ = c.Error(e)
+			return
+		}
+		h.CreatedAt = time.Now().Unix()
+		h, e := webhookDAO.AddWebhook(h)
+		if e != nil {
+			_ = c.Error(e)
+			return
+		}
+		if e := webhooks.Reload(); e != nil {
+			_ = c.Error(e)
+			return
+		}
+		SetResult(c, h)
+	})
+
+	// update webhook
+	r.PUT("/webhook/:id", func(c *gin.Context) {
+		id, e := getIdParam(c)
+		if e != nil {
+			_ = c.Error(e)
+			return
+		}
+		h := types.Webhook{}
+		if e := c.Bind(&h); e != nil {
+			_ = c.Error(e)
+			return
+		}
+		saved, e := webhookDAO.GetWebhook(id)
+		if e != nil {
+			_ = c.Error(e)
+			return
+		}
+		if h.Secret == escapedPassword {
+			h.Secret = saved.Secret
+		}
+		h.CreatedAt = saved.CreatedAt
+		if e := checkWebhook(&h); e != nil {
+			_ = c.Error(e)
+			return
+		}
+		if e := webhookDAO.UpdateWebhook(id, h); e != nil {
+			_ = c.Error(e)
+			return
+		}
+		if e := webhooks.Reload(); e != nil {
+			_ = c.Error(e)
+		}
+	})
+
+	// delete webhook and its deliveries
+	r.DELETE("/webhook/:id", func(c *gin.Context) {
+		id, e := getIdParam(c)
+		if e != nil {
+			_ = c.Error(e)
+			return
+		}
+		if e := webhookDAO.DeleteWebhook(id); e != nil {
 			_ = c.Error(e)
 			return
 		}
-		_ = rootDrive.ReloadMounts()
+		if e := webhooks.Reload(); e != nil {
+			_ = c.Error(e)
+		}
+	})
+
+	// get delivery log of the webhook
+	r.GET("/webhook/:id/deliveries", func(c *gin.Context) {
+		id, e := getIdParam(c)
+		if e != nil {
+			_ = c.Error(e)
+			return
+		}
+		offset := int(utils.ToInt64(c.Query("offset"), 0))
+		limit := int(utils.ToInt64(c.Query("limit"), auditDefaultLimit))
+		if offset < 0 {
+			offset = 0
+		}
+		if limit <= 0 || limit > auditMaxLimit {
+			limit = auditDefaultLimit
+		}
+		deliveries, total, e := webhookDAO.GetDeliveries(id, offset, limit)
+		if e != nil {
+			_ = c.Error(e)
+			return
+		}
+		SetResult(c, types.M{"total": total, "items": deliveries})
+	})
+
+	// endregion
+
+	// region upload hook
+
+	// get upload hooks
+	r.GET("/upload-hooks", func(c *gin.Context) {
+		hooks, e := uploadHookDAO.GetHooks()
+		if e != nil {
+			_ = c.Error(e)
+			return
+		}
+		SetResult(c, types.M{"enabled": uploadHooks.Enabled(), "hooks": hooks})
+	})
+
+	// add upload hook
+	r.POST("/upload-hook", func(c *gin.Context) {
+		if !uploadHooks.Enabled() {
+			_ = c.Error(err.NewNotAllowedMessageError(i18n.T("api.admin.upload_hooks_disabled")))
+			return
+		}
+		h := types.UploadHook{}
+		if e := c.Bind(&h); e != nil {
+			_ = c.Error(e)
+			return
+		}
+		if e := checkUploadHook(&h); e != nil {
+			_ = c.Error(e)
+			return
+		}
+		h.CreatedAt = time.Now().Unix()
+		h, e := uploadHookDAO.AddHook(h)
+		if e != nil {
+			_ = c.Error(e)
+			return
+		}
+		if e := uploadHooks.Reload(); e != nil {
+			_ = c.Error(e)
+			return
+		}
+		SetResult(c, h)
+	})
+
+	// update upload hook
+	r.PUT("/upload-hook/:id", func(c *gin.Context) {
+		if !uploadHooks.Enabled() {
+			_ = c.Error(err.NewNotAllowedMessageError(i18n.T("api.admin.upload_hooks_disabled")))
+			return
+		}
+		id, e := getIdParam(c)
+		if e != nil {
+			_ = c.Error(e)
+			return
+		}
+		h := types.UploadHook{}
+		if e := c.Bind(&h); e != nil {
+			_ = c.Error(e)
+			return
+		}
+		if e := checkUploadHook(&h); e != nil {
+			_ = c.Error(e)
+			return
+		}
+		saved, e := uploadHookDAO.GetHook(id)
+		if e != nil {
+			_ = c.Error(e)
+			return
+		}
+		h.CreatedAt = saved.CreatedAt
+		if e := uploadHookDAO.UpdateHook(id, h); e != nil {
+			_ = c.Error(e)
+			return
+		}
+		if e := uploadHooks.Reload(); e != nil {
+			_ = c.Error(e)
+		}
+	})
+
+	// delete upload hook
+	r.DELETE("/upload-hook/:id", func(c *gin.Context) {
+		id, e := getIdParam(c)
+		if e != nil {
+			_ = c.Error(e)
+			return
+		}
+		if e := uploadHookDAO.DeleteHook(id); e != nil {
+			_ = c.Error(e)
+			return
+		}
+		if e := uploadHooks.Reload(); e != nil {
+			_ = c.Error(e)
+		}
+	})
+
+	// endregion
+
+	// region options
+
+	// get options, keys are separated by comma
+	r.GET("/options/:keys", func(c *gin.Context) {
+		opts, e := optionsDAO.Gets(strings.Split(c.Param("keys"), ",")...)
+		if e != nil {
+			_ = c.Error(e)
+			return
+		}
+		for k, v := range opts {
+			if secretOptions[k] && v != "" {
+				opts[k] = escapedPassword
+			}
+		}
+		SetResult(c, opts)
+	})
+
+	// save options
+	r.PUT("/options", func(c *gin.Context) {
+		opts := types.SM{}
+		if e := c.Bind(&opts); e != nil {
+			_ = c.Error(e)
+			return
+		}
+		for k, v := range opts {
+			if secretOptions[k] && v == escapedPassword {
+				delete(opts, k)
+			}
+		}
+		if e := optionsDAO.Sets(opts); e != nil {
+			_ = c.Error(e)
+		}
+	})
+
+	// sync group membership from LDAP directory
+	r.POST("/ldap/sync", func(c *gin.Context) {
+		if e := ldapAuth.Sync(); e != nil {
+			_ = c.Error(e)
+		}
 	})
 
 	// endregion
 
 	// region misc
 
+	// rotate the url signing key
+	r.POST("/signer/rotate", func(c *gin.Context) {
+		if e := signerKeys.Rotate(); e != nil {
+			_ = c.Error(e)
+		}
+	})
+
 	// clean all PathPermission and PathMount that is point to invalid path
 	r.POST("/clean-permissions-mounts", func(c *gin.Context) {
 		root := rootDrive.Get()
@@ -416,6 +805,35 @@ func InitAdminRoutes(r gin.IRouter,
 		}
 	})
 
+	// query audit logs
+	r.GET("/audit-logs", func(c *gin.Context) {
+		queryAuditLogs(c, auditLogDAO)
+	})
+
+	// export audit logs in CSV
+	r.GET("/audit-logs/export", func(c *gin.Context) {
+		exportAuditLogs(c, auditLogDAO, ms)
+	})
+
+	// get log levels of subsystems
+	r.GET("/log-levels", func(c *gin.Context) {
+		SetResult(c, getLogLevels())
+	})
+
+	// set log levels of subsystems at runtime
+	r.PUT("/log-levels", func(c *gin.Context) {
+		req := logLevelsRequest{}
+		if e := c.Bind(&req); e != nil {
+			_ = c.Error(e)
+			return
+		}
+		if e := setLogLevels(req); e != nil {
+			_ = c.Error(e)
+			return
+		}
+		SetResult(c, getLogLevels())
+	})
+
 	// endregion
 
 }
@@ -441,6 +859,12 @@ func checkDriveName(name string) error {
 
 const escapedPassword = "YOU CAN'T SEE ME"
 
+// secretOptions will be escaped when they are read by admin
+var secretOptions = map[string]bool{
+	optOIDCClientSecret: true,
+	optLDAPBindPassword: true,
+}
+
 func escapeDriveConfigSecrets(form []types.FormItem, config string) string {
 	val := types.SM{}
 	_ = json.Unmarshal([]byte(config), &val)
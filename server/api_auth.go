@@ -2,40 +2,87 @@ package server
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"go-drive/common/errors"
 	"go-drive/common/i18n"
+	"go-drive/common/logging"
 	"go-drive/common/types"
+	"go-drive/common/utils"
 	"go-drive/storage"
 	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"strings"
+	"time"
 )
 
 const (
 	headerAuth = "Authorization"
+	// headerRenewedToken is the new token of the session when the token store issued a new one
+	headerRenewedToken = "X-Renewed-Token"
 )
 
-func InitAuthRoutes(r gin.IRouter, tokenStore types.TokenStore, userDAO *storage.UserDAO) {
+var authLogger = logging.For("auth")
+
+func InitAuthRoutes(r gin.IRouter, tokenStore types.TokenStore,
+	userDAO *storage.UserDAO, accessTokenDAO *storage.AccessTokenDAO,
+	oidcLogin *OIDCLogin, ldapAuth *LDAPAuth, twoFactor *TwoFactorAuth, loginLimiter *LoginLimiter) {
 	ar := authRoute{
-		userDAO:    userDAO,
-		tokenStore: tokenStore,
+		userDAO:        userDAO,
+		tokenStore:     tokenStore,
+		accessTokenDAO: accessTokenDAO,
+		oidcLogin:      oidcLogin,
+		ldapAuth:       ldapAuth,
+		twoFactor:      twoFactor,
+		loginLimiter:   loginLimiter,
 	}
 
 	r.POST("/auth/init", ar.init)
+	r.GET("/auth/oidc", ar.oidcConfig)
+	r.GET("/auth/oidc/callback", ar.oidcCallback)
 
-	auth := r.Group("/auth", Auth(tokenStore))
+	auth := r.Group("/auth", Auth(tokenStore, accessTokenDAO, userDAO))
 	{
-		auth.POST("/login", ar.login)
-		auth.POST("/logout", ar.logout)
+		// the session of a personal access token is not stored, so it can't be changed
+		auth.POST("/login", TokenSessionRequired(), ar.login)
+		auth.POST("/logout", TokenSessionRequired(), ar.logout)
 		auth.GET("/user", ar.getUser)
+		auth.POST("/oidc/login", ar.oidcStart)
+		auth.GET("/2fa", ar.twoFactorStatus)
+		auth.POST("/2fa/verify", ar.twoFactorVerify)
+
+		// personal access tokens can only be managed by a logged-in session
+		tokens := auth.Group("/", LoginSessionRequired())
+		tokens.GET("/tokens", ar.listAccessTokens)
+		tokens.POST("/token", ar.createAccessToken)
+		tokens.DELETE("/token/:id", ar.deleteAccessToken)
+
+		tokens.GET("/sessions", ar.listSessions)
+		tokens.DELETE("/session/:id", ar.revokeSession)
+		// revoke all other sessions
+		tokens.DELETE("/sessions", ar.revokeOtherSessions)
+
+		twoFactor := auth.Group("/2fa", LoginSessionRequired())
+		twoFactor.POST("/enroll", ar.twoFactorEnroll)
+		twoFactor.POST("/enable", ar.twoFactorEnable)
+		twoFactor.POST("/disable", ar.twoFactorDisable)
+		twoFactor.POST("/recovery-codes", ar.twoFactorRecoveryCodes)
 	}
 }
 
 type authRoute struct {
-	userDAO    *storage.UserDAO
-	tokenStore types.TokenStore
+	userDAO        *storage.UserDAO
+	tokenStore     types.TokenStore
+	accessTokenDAO *storage.AccessTokenDAO
+	oidcLogin      *OIDCLogin
+	ldapAuth       *LDAPAuth
+	twoFactor      *TwoFactorAuth
+	loginLimiter   *LoginLimiter
 }
 
 func (a *authRoute) init(c *gin.Context) {
-	token, e := a.tokenStore.Create(types.Session{})
+	session := types.Session{}
+	recordSessionClient(c, &session)
+	token, e := a.tokenStore.Create(session)
 	if e != nil {
 		_ = c.Error(e)
 		return
@@ -49,19 +96,55 @@ func (a *authRoute) login(c *gin.Context) {
 		_ = c.Error(e)
 		return
 	}
-	getUser, e := a.userDAO.GetUser(user.Username)
-	if e != nil {
+	ip := GetClientIP(c.Request)
+	if e := a.loginLimiter.Check(user.Username, ip); e != nil {
 		_ = c.Error(e)
 		return
 	}
-	if e := bcrypt.CompareHashAndPassword([]byte(getUser.Password), []byte(user.Password)); e != nil {
-		_ = c.Error(err.NewBadRequestError(i18n.T("api.auth.invalid_username_or_password")))
+	getUser, e := a.authenticate(user.Username, user.Password)
+	if e != nil {
+		if _, ok := e.(err.BadRequestError); ok || err.IsNotFoundError(e) {
+			a.loginLimiter.Fail(user.Username, ip)
+		}
+		_ = c.Error(e)
 		return
 	}
-	e = UpdateSessionUser(c, a.tokenStore, getUser)
+	session := GetSession(c)
+	recordSessionClient(c, &session)
+	session, pending, e := loginSession(a.twoFactor, session, getUser)
 	if e != nil {
 		_ = c.Error(e)
+		return
 	}
+	if e := UpdateSession(c, a.tokenStore, session); e != nil {
+		_ = c.Error(e)
+		return
+	}
+	// the failures are kept until the second factor is verified,
+	// or they can be reset by the password while guessing the code
+	if !pending {
+		a.loginLimiter.Succeed(user.Username)
+	}
+	SetResult(c, types.M{"require_2fa": pending})
+}
+
+// authenticate checks the password by LDAP, or the local password if the user is not found in the directory
+func (a *authRoute) authenticate(username, password string) (types.User, error) {
+	ldapUser, e := a.ldapAuth.Login(username, password)
+	if e != nil {
+		return types.User{}, e
+	}
+	if ldapUser != nil {
+		return *ldapUser, nil
+	}
+	user, e := a.userDAO.GetUser(username)
+	if e != nil {
+		return user, e
+	}
+	if e := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); e != nil {
+		return user, err.NewBadRequestError(i18n.T("api.auth.invalid_username_or_password"))
+	}
+	return user, nil
 }
 
 func (a *authRoute) logout(c *gin.Context) {
@@ -77,9 +160,299 @@ func (a *authRoute) getUser(c *gin.Context) {
 	}
 }
 
-func Auth(tokenStore types.TokenStore) gin.HandlerFunc {
+func (a *authRoute) listSessions(c *gin.Context) {
+	sessions, e := listSessions(a.tokenStore, GetSession(c).User.Username, GetToken(c))
+	if e != nil {
+		_ = c.Error(e)
+		return
+	}
+	SetResult(c, sessions)
+}
+
+func (a *authRoute) revokeSession(c *gin.Context) {
+	if e := revokeSession(a.tokenStore, GetSession(c).User.Username, c.Param("id"), GetToken(c)); e != nil {
+		_ = c.Error(e)
+	}
+}
+
+func (a *authRoute) revokeOtherSessions(c *gin.Context) {
+	if e := revokeUserSessions(a.tokenStore, GetSession(c).User.Username, GetToken(c)); e != nil {
+		_ = c.Error(e)
+	}
+}
+
+type twoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+func (a *authRoute) twoFactorStatus(c *gin.Context) {
+	session := GetSession(c)
+	enabled := false
+	if !session.IsAnonymous() {
+		var e error
+		enabled, e = a.twoFactor.IsEnabled(session.User.Username)
+		if e != nil {
+			_ = c.Error(e)
+			return
+		}
+	}
+	requiredForAdmin, e := a.twoFactor.IsRequiredForAdmin()
+	if e != nil {
+		_ = c.Error(e)
+		return
+	}
+	SetResult(c, types.M{
+		"enabled":            enabled,
+		"pending":            session.PendingUsername != "",
+		"verified":           session.TwoFactorVerified,
+		"required_for_admin": requiredForAdmin,
+	})
+}
+
+// twoFactorVerify completes the login of the pending session
+func (a *authRoute) twoFactorVerify(c *gin.Context) {
+	req := twoFactorCodeRequest{}
+	if e := c.Bind(&req); e != nil {
+		_ = c.Error(e)
+		return
+	}
+	session := GetSession(c)
+	if session.PendingUsername == "" {
+		_ = c.Error(err.NewNotAllowedError())
+		return
+	}
+	ip := GetClientIP(c.Request)
+	if e := a.loginLimiter.Check(session.PendingUsername, ip); e != nil {
+		_ = c.Error(e)
+		return
+	}
+	if e := a.twoFactor.Verify(session.PendingUsername, req.Code); e != nil {
+		if _, ok := e.(err.BadRequestError); ok {
+			a.loginLimiter.Fail(session.PendingUsername, ip)
+		}
+		_ = c.Error(e)
+		return
+	}
+	a.loginLimiter.Succeed(session.PendingUsername)
+	user, e := a.userDAO.GetUser(session.PendingUsername)
+	if e != nil {
+		_ = c.Error(e)
+		return
+	}
+	session.User = user
+	session.PendingUsername = ""
+	session.TwoFactorVerified = true
+	if e := UpdateSession(c, a.tokenStore, session); e != nil {
+		_ = c.Error(e)
+	}
+}
+
+func (a *authRoute) twoFactorEnroll(c *gin.Context) {
+	secret, uri, e := a.twoFactor.Enroll(GetSession(c).User.Username)
+	if e != nil {
+		_ = c.Error(e)
+		return
+	}
+	SetResult(c, types.M{"secret": secret, "uri": uri})
+}
+
+func (a *authRoute) twoFactorEnable(c *gin.Context) {
+	req := twoFactorCodeRequest{}
+	if e := c.Bind(&req); e != nil {
+		_ = c.Error(e)
+		return
+	}
+	session := GetSession(c)
+	codes, e := a.twoFactor.Enable(session.User.Username, req.Code)
+	if e != nil {
+		_ = c.Error(e)
+		return
+	}
+	// the code has been verified
+	session.TwoFactorVerified = true
+	if e := UpdateSession(c, a.tokenStore, session); e != nil {
+		_ = c.Error(e)
+		return
+	}
+	SetResult(c, codes)
+}
+
+func (a *authRoute) twoFactorDisable(c *gin.Context) {
+	req := twoFactorCodeRequest{}
+	if e := c.Bind(&req); e != nil {
+		_ = c.Error(e)
+		return
+	}
+	session := GetSession(c)
+	if e := a.twoFactor.Disable(session.User.Username, req.Code); e != nil {
+		_ = c.Error(e)
+		return
+	}
+	session.TwoFactorVerified = false
+	if e := UpdateSession(c, a.tokenStore, session); e != nil {
+		_ = c.Error(e)
+	}
+}
+
+func (a *authRoute) twoFactorRecoveryCodes(c *gin.Context) {
+	req := twoFactorCodeRequest{}
+	if e := c.Bind(&req); e != nil {
+		_ = c.Error(e)
+		return
+	}
+	codes, e := a.twoFactor.RegenerateRecoveryCodes(GetSession(c).User.Username, req.Code)
+	if e != nil {
+		_ = c.Error(e)
+		return
+	}
+	SetResult(c, codes)
+}
+
+func (a *authRoute) oidcConfig(c *gin.Context) {
+	enabled, e := a.oidcLogin.Enabled()
+	if e != nil {
+		_ = c.Error(e)
+		return
+	}
+	SetResult(c, types.M{"enabled": enabled})
+}
+
+type oidcStartRequest struct {
+	// Redirect is the page to redirect to after logged in
+	Redirect string `json:"redirect"`
+}
+
+func (a *authRoute) oidcStart(c *gin.Context) {
+	req := oidcStartRequest{}
+	if e := c.Bind(&req); e != nil {
+		_ = c.Error(e)
+		return
+	}
+	if GetToken(c) == "" {
+		_ = c.Error(err.NewNotAllowedError())
+		return
+	}
+	if req.Redirect == "" || !isSameHostURL(req.Redirect, c.Request.Host) {
+		req.Redirect = "/"
+	}
+	u, e := a.oidcLogin.Start(c.Request.Context(), GetToken(c), oidcCallbackURL(c), req.Redirect)
+	if e != nil {
+		_ = c.Error(e)
+		return
+	}
+	SetResult(c, types.M{"url": u})
+}
+
+func (a *authRoute) oidcCallback(c *gin.Context) {
+	redirect, e := a.oidcLogin.Callback(c.Request.Context(),
+		c.Query("state"), c.Query("code"), oidcCallbackURL(c))
+	if e != nil {
+		_ = c.Error(e)
+		return
+	}
+	c.Redirect(http.StatusFound, redirect)
+}
+
+// oidcCallbackURL is the default redirect_uri,
+// the option 'oidc.redirect_uri' should be set if the server is behind a reverse proxy with path prefix.
+// The X-Forwarded-Proto header is used only if the request comes from the trusted proxies.
+func oidcCallbackURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); (proto == "http" || proto == "https") && isFromTrustedProxy(c.Request) {
+		scheme = proto
+	}
+	path := c.Request.URL.Path
+	path = path[:strings.LastIndex(path, "/oidc/")] + "/oidc/callback"
+	return scheme + "://" + c.Request.Host + path
+}
+
+type accessTokenRequest struct {
+	Name       string `json:"name" binding:"required"`
+	ReadOnly   bool   `json:"read_only"`
+	PathPrefix string `json:"path_prefix"`
+	// ExpiresAt is unix timestamp, 0 means never expires
+	ExpiresAt int64 `json:"expires_at"`
+}
+
+type accessTokenCreated struct {
+	types.AccessToken
+	// Token is the plain token value, it's only returned once on creation
+	Token string `json:"token"`
+}
+
+func (a *authRoute) listAccessTokens(c *gin.Context) {
+	tokens, e := a.accessTokenDAO.ListTokens(GetSession(c).User.Username)
+	if e != nil {
+		_ = c.Error(e)
+		return
+	}
+	SetResult(c, tokens)
+}
+
+func (a *authRoute) createAccessToken(c *gin.Context) {
+	tr := accessTokenRequest{}
+	if e := c.Bind(&tr); e != nil {
+		_ = c.Error(e)
+		return
+	}
+	now := time.Now().Unix()
+	if tr.ExpiresAt < 0 || (tr.ExpiresAt > 0 && tr.ExpiresAt <= now) {
+		_ = c.Error(err.NewBadRequestError(i18n.T("api.auth.invalid_expires_at")))
+		return
+	}
+	value, e := newAccessTokenValue()
+	if e != nil {
+		_ = c.Error(e)
+		return
+	}
+	token, e := a.accessTokenDAO.AddToken(types.AccessToken{
+		Id:         uuid.New().String(),
+		Username:   GetSession(c).User.Username,
+		Name:       tr.Name,
+		TokenHash:  hashAccessToken(value),
+		ReadOnly:   tr.ReadOnly,
+		PathPrefix: utils.CleanPath(tr.PathPrefix),
+		ExpiresAt:  tr.ExpiresAt,
+		CreatedAt:  now,
+	})
+	if e != nil {
+		_ = c.Error(e)
+		return
+	}
+	SetResult(c, accessTokenCreated{AccessToken: token, Token: value})
+}
+
+func (a *authRoute) deleteAccessToken(c *gin.Context) {
+	if e := a.accessTokenDAO.DeleteToken(GetSession(c).User.Username, c.Param("id")); e != nil {
+		_ = c.Error(e)
+	}
+}
+
+// Auth validates the token in the request header,
+// which can be a session token or a personal access token
+func Auth(tokenStore types.TokenStore,
+	accessTokenDAO *storage.AccessTokenDAO, userDAO *storage.UserDAO) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tokenKey := c.GetHeader(headerAuth)
+		if isAccessToken(tokenKey) {
+			session, e := validateAccessToken(accessTokenDAO, userDAO, tokenKey)
+			if e != nil {
+				_ = c.Error(e)
+				c.Abort()
+				return
+			}
+			if session.AccessToken.ReadOnly && !isReadOnlyMethod(c.Request.Method) {
+				_ = c.Error(err.NewPermissionDeniedError(i18n.T("api.auth.read_only_access_token")))
+				c.Abort()
+				return
+			}
+			SetSession(c, session)
+			c.Next()
+			return
+		}
 		token, e := tokenStore.Validate(tokenKey)
 		if e != nil {
 			_ = c.Error(e)
@@ -88,13 +461,97 @@ func Auth(tokenStore types.TokenStore) gin.HandlerFunc {
 		}
 		session := token.Value
 
-		SetToken(c, token.Token)
+		SetToken(c, tokenKey)
+		renewToken(c, token.Token)
 		SetSession(c, session)
 
 		c.Next()
 	}
 }
 
+// revalidateSession validates the token of a long-lived request again,
+// it fails if the session is revoked or expired, or the user is deleted.
+// The returned token is the token to validate next time, it's changed if the token is replaced.
+func revalidateSession(tokenStore types.TokenStore, accessTokenDAO *storage.AccessTokenDAO,
+	userDAO *storage.UserDAO, tokenKey string) (string, types.Session, error) {
+	if isAccessToken(tokenKey) {
+		session, e := validateAccessToken(accessTokenDAO, userDAO, tokenKey)
+		return tokenKey, session, e
+	}
+	token, e := tokenStore.Validate(tokenKey)
+	if e != nil {
+		return tokenKey, types.Session{}, e
+	}
+	session := token.Value
+	if !session.IsAnonymous() {
+		if _, e := userDAO.GetUser(session.User.Username); e != nil {
+			if err.IsNotFoundError(e) {
+				e = err.NewUnauthorizedError(i18n.T("api.auth.user_deleted"))
+			}
+			return tokenKey, types.Session{}, e
+		}
+	}
+	return token.Token, session, nil
+}
+
+// TokenSessionRequired rejects the sessions authenticated by personal access tokens
+func TokenSessionRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if GetSession(c).AccessToken != nil {
+			_ = c.Error(err.NewPermissionDeniedError(i18n.T("api.auth.token_session_required")))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// LoginSessionRequired rejects anonymous sessions and sessions authenticated by personal access tokens
+func LoginSessionRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		session := GetSession(c)
+		if session.IsAnonymous() || session.AccessToken != nil {
+			_ = c.Error(err.NewPermissionDeniedError(i18n.T("api.auth.login_session_required")))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// AdminTwoFactorRequired rejects the sessions not passed 2FA if the admin policy requires
+func AdminTwoFactorRequired(twoFactor *TwoFactorAuth) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		session := GetSession(c)
+		if session.TwoFactorVerified {
+			c.Next()
+			return
+		}
+		required, e := twoFactor.IsRequiredForAdmin()
+		if e != nil {
+			_ = c.Error(e)
+			c.Abort()
+			return
+		}
+		if required && session.AccessToken != nil {
+			// personal access tokens are allowed when the owner enabled 2FA
+			required, e = twoFactor.IsEnabled(session.User.Username)
+			required = !required
+		}
+		if e != nil {
+			_ = c.Error(e)
+			c.Abort()
+			return
+		}
+		if required {
+			_ = c.Error(err.NewPermissionDeniedError(i18n.T("api.auth.2fa_required")))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
 func UserGroupRequired(group string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		session := GetSession(c)
@@ -0,0 +1,230 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"go-drive/common/registry"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"go-drive/storage"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestOIDCCallbackURL(t *testing.T) {
+	trusted, e := utils.ParseCIDRs("10.0.0.1")
+	if e != nil {
+		t.Fatal(e)
+	}
+	engine := gin.New()
+	engine.Use(ClientIP(trusted))
+	engine.GET("/api/auth/oidc/start", func(c *gin.Context) {
+		c.String(http.StatusOK, oidcCallbackURL(c))
+	})
+	for _, c := range []struct {
+		remoteAddr, proto, expect string
+	}{
+		{"192.0.2.1:1234", "https", "http://example.com/api/auth/oidc/callback"},
+		{"10.0.0.1:1234", "https", "https://example.com/api/auth/oidc/callback"},
+		{"10.0.0.1:1234", "javascript", "http://example.com/api/auth/oidc/callback"},
+	} {
+		req := httptest.NewRequest("GET", "http://example.com/api/auth/oidc/start", nil)
+		req.RemoteAddr = c.remoteAddr
+		req.Header.Set("X-Forwarded-Proto", c.proto)
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		if w.Body.String() != c.expect {
+			t.Errorf("%s from %s: expect '%s', but it's '%s'", c.proto, c.remoteAddr, c.expect, w.Body.String())
+		}
+	}
+}
+
+// testAuthClient requests the auth routes with the token of its session
+type testAuthClient struct {
+	t      *testing.T
+	engine *gin.Engine
+	token  string
+}
+
+// newTestAuthClient creates the auth routes with the mem token store, and the user 'alice' with password '123456'
+func newTestAuthClient(t *testing.T) (*testAuthClient, *storage.DB, func()) {
+	db, _, cleanup := newTestDB(t)
+	ch := registry.NewComponentHolder()
+	userDAO := storage.NewUserDAO(db)
+	optionsDAO := storage.NewOptionsDAO(db)
+	if _, e := userDAO.AddUser(types.User{Username: "alice", Password: "123456"}); e != nil {
+		cleanup()
+		t.Fatal(e)
+	}
+	tokenStore := NewMemTokenStore(time.Hour, false, time.Hour)
+	ldapAuth := NewLDAPAuth(ch, optionsDAO, userDAO, storage.NewGroupDAO(db), storage.NewUserIdentityDAO(db))
+	loginLimiter := NewLoginLimiter(ch)
+	engine := gin.New()
+	engine.Use(apiResultHandler(keyMessageSource{}))
+	InitAuthRoutes(engine, tokenStore, userDAO, storage.NewAccessTokenDAO(db), nil, ldapAuth,
+		NewTwoFactorAuth(storage.NewUserTOTPDAO(db), optionsDAO), loginLimiter)
+
+	client := &testAuthClient{t: t, engine: engine}
+	client.token = client.request("POST", "/auth/init", nil, http.StatusOK)["token"].(string)
+	return client, db, func() {
+		_ = loginLimiter.Dispose()
+		_ = ldapAuth.Dispose()
+		_ = tokenStore.Dispose()
+		cleanup()
+	}
+}
+
+func (a *testAuthClient) do(method, path string, body interface{}) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != nil {
+		b, e := json.Marshal(body)
+		if e != nil {
+			a.t.Fatal(e)
+		}
+		reader = bytes.NewReader(b)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	if a.token != "" {
+		req.Header.Set(headerAuth, a.token)
+	}
+	w := httptest.NewRecorder()
+	a.engine.ServeHTTP(w, req)
+	if renewed := w.Header().Get(headerRenewedToken); renewed != "" {
+		a.token = renewed
+	}
+	return w
+}
+
+// request requires the status code, returns the JSON object of the response, nil if it's not an object
+func (a *testAuthClient) request(method, path string, body interface{}, code int) map[string]interface{} {
+	w := a.do(method, path, body)
+	if w.Code != code {
+		a.t.Fatalf("%s %s: expect %d, but it's %d: %s", method, path, code, w.Code, w.Body.String())
+	}
+	result := make(map[string]interface{})
+	if json.Unmarshal(w.Body.Bytes(), &result) != nil {
+		return nil
+	}
+	return result
+}
+
+func (a *testAuthClient) username() string {
+	u := a.request("GET", "/auth/user", nil, http.StatusOK)
+	if u == nil {
+		return ""
+	}
+	return u["username"].(string)
+}
+
+func TestTwoFactorAuthRoutes(t *testing.T) {
+	client, _, cleanup := newTestAuthClient(t)
+	defer cleanup()
+	login := map[string]string{"username": "alice", "password": "123456"}
+
+	// enroll
+	if r := client.request("POST", "/auth/login", login, http.StatusOK); r["require_2fa"] != false {
+		t.Errorf("expect 2FA not required before enabled, but it's %v", r)
+	}
+	secret := client.request("POST", "/auth/2fa/enroll", nil, http.StatusOK)["secret"].(string)
+	client.request("POST", "/auth/2fa/enable", map[string]string{"code": "000000x"}, http.StatusBadRequest)
+	counter := utils.TOTPCounter(time.Now())
+	code, e := utils.TOTPCode(secret, counter)
+	if e != nil {
+		t.Fatal(e)
+	}
+	w := client.do("POST", "/auth/2fa/enable", map[string]string{"code": code})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expect 2FA enabled, but it's %d: %s", w.Code, w.Body.String())
+	}
+	recoveryCodes := make([]string, 0)
+	if e := json.Unmarshal(w.Body.Bytes(), &recoveryCodes); e != nil || len(recoveryCodes) != recoveryCodesCount {
+		t.Fatalf("expect %d recovery codes, but it's %s", recoveryCodesCount, w.Body.String())
+	}
+	status := client.request("GET", "/auth/2fa", nil, http.StatusOK)
+	if status["enabled"] != true || status["verified"] != true {
+		t.Errorf("expect 2FA enabled and verified, but it's %v", status)
+	}
+
+	// the pending session
+	client.request("POST", "/auth/logout", nil, http.StatusOK)
+	if r := client.request("POST", "/auth/login", login, http.StatusOK); r["require_2fa"] != true {
+		t.Fatalf("expect 2FA required, but it's %v", r)
+	}
+	if u := client.username(); u != "" {
+		t.Errorf("expect the pending session not logged in, but it's '%s'", u)
+	}
+	if status := client.request("GET", "/auth/2fa", nil, http.StatusOK); status["pending"] != true {
+		t.Errorf("expect the session pending, but it's %v", status)
+	}
+	client.request("POST", "/auth/2fa/enroll", nil, http.StatusForbidden)
+	// the code used to enable can't be replayed
+	client.request("POST", "/auth/2fa/verify", map[string]string{"code": code}, http.StatusBadRequest)
+	next, e := utils.TOTPCode(secret, counter+1)
+	if e != nil {
+		t.Fatal(e)
+	}
+	client.request("POST", "/auth/2fa/verify", map[string]string{"code": next}, http.StatusOK)
+	if u := client.username(); u != "alice" {
+		t.Errorf("expect logged in as alice after verified, but it's '%s'", u)
+	}
+	if status := client.request("GET", "/auth/2fa", nil, http.StatusOK); status["verified"] != true {
+		t.Errorf("expect the session verified, but it's %v", status)
+	}
+	client.request("POST", "/auth/2fa/verify", map[string]string{"code": next}, http.StatusForbidden)
+
+	// recovery codes
+	client.request("POST", "/auth/logout", nil, http.StatusOK)
+	client.request("POST", "/auth/login", login, http.StatusOK)
+	client.request("POST", "/auth/2fa/verify", map[string]string{"code": recoveryCodes[0]}, http.StatusOK)
+	if u := client.username(); u != "alice" {
+		t.Errorf("expect logged in by the recovery code, but it's '%s'", u)
+	}
+	client.request("POST", "/auth/logout", nil, http.StatusOK)
+	client.request("POST", "/auth/login", login, http.StatusOK)
+	client.request("POST", "/auth/2fa/verify", map[string]string{"code": recoveryCodes[0]}, http.StatusBadRequest)
+	client.request("POST", "/auth/2fa/verify", map[string]string{"code": recoveryCodes[1]}, http.StatusOK)
+
+	w = client.do("POST", "/auth/2fa/recovery-codes", map[string]string{"code": recoveryCodes[2]})
+	if w.Code != http.StatusOK {
+		t.Fatalf("expect recovery codes regenerated, but it's %d: %s", w.Code, w.Body.String())
+	}
+	regenerated := make([]string, 0)
+	if e := json.Unmarshal(w.Body.Bytes(), &regenerated); e != nil || len(regenerated) != recoveryCodesCount {
+		t.Fatalf("expect %d recovery codes, but it's %s", recoveryCodesCount, w.Body.String())
+	}
+	client.request("POST", "/auth/2fa/disable", map[string]string{"code": recoveryCodes[3]}, http.StatusBadRequest)
+	client.request("POST", "/auth/2fa/disable", map[string]string{"code": regenerated[0]}, http.StatusOK)
+	client.request("POST", "/auth/logout", nil, http.StatusOK)
+	if r := client.request("POST", "/auth/login", login, http.StatusOK); r["require_2fa"] != false {
+		t.Errorf("expect 2FA not required after disabled, but it's %v", r)
+	}
+}
+
+func TestLoginAndLogoutByAccessToken(t *testing.T) {
+	client, _, cleanup := newTestAuthClient(t)
+	defer cleanup()
+	login := map[string]string{"username": "alice", "password": "123456"}
+	client.request("POST", "/auth/login", login, http.StatusOK)
+	created := client.request("POST", "/auth/token", map[string]string{"name": "test"}, http.StatusOK)
+	session := client.token
+
+	client.token = created["token"].(string)
+	if u := client.username(); u != "alice" {
+		t.Fatalf("expect authenticated as alice by the access token, but it's '%s'", u)
+	}
+	client.request("POST", "/auth/login", login, http.StatusForbidden)
+	client.request("POST", "/auth/logout", nil, http.StatusForbidden)
+	if u := client.username(); u != "alice" {
+		t.Errorf("expect the access token still valid, but it's '%s'", u)
+	}
+
+	client.token = session
+	if u := client.username(); u != "alice" {
+		t.Errorf("expect the session not changed by the access token, but it's '%s'", u)
+	}
+}
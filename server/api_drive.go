@@ -12,6 +12,7 @@ import (
 	"go-drive/common/utils"
 	"go-drive/drive"
 	"go-drive/storage"
+	"io"
 	"net/http"
 	"os"
 	"strconv"
@@ -19,6 +20,11 @@ import (
 	"time"
 )
 
+const (
+	listDefaultLimit = 100
+	listMaxLimit     = 1000
+)
+
 func InitDriveRoutes(router gin.IRouter,
 	config common.Config,
 	rootDrive *drive.RootDrive,
@@ -26,17 +32,32 @@ func InitDriveRoutes(router gin.IRouter,
 	thumbnail *Thumbnail,
 	signer *utils.Signer,
 	chunkUploader *ChunkUploader,
+	tusUploader *TusUploader,
+	offlineDownloader *OfflineDownloader,
 	runner task.Runner,
-	tokenStore types.TokenStore) {
+	tokenStore types.TokenStore,
+	accessTokenDAO *storage.AccessTokenDAO,
+	userDAO *storage.UserDAO,
+	auditor *Auditor,
+	uploadHooks *UploadHooks,
+	scanner *VirusScanner) {
 
 	dr := driveRoute{
-		config:        config,
-		rootDrive:     rootDrive,
-		permissionDAO: permissionDAO,
-		chunkUploader: chunkUploader,
-		thumbnail:     thumbnail,
-		runner:        runner,
-		signer:        signer,
+		config:            config,
+		rootDrive:         rootDrive,
+		permissionDAO:     permissionDAO,
+		chunkUploader:     chunkUploader,
+		tusUploader:       tusUploader,
+		offlineDownloader: offlineDownloader,
+		thumbnail:         thumbnail,
+		runner:            runner,
+		signer:            signer,
+		auditor:           auditor,
+		uploadHooks:       uploadHooks,
+		scanner:           scanner,
+		tokenStore:        tokenStore,
+		accessTokenDAO:    accessTokenDAO,
+		userDAO:           userDAO,
 	}
 
 	// get file content
@@ -44,10 +65,17 @@ func InitDriveRoutes(router gin.IRouter,
 	router.GET("/content/*path", dr.getContent)
 	router.GET("/thumbnail/*path", dr.getThumbnail)
 
-	r := router.Group("/", Auth(tokenStore))
+	// tus capabilities
+	router.OPTIONS("/tus", tusOptions)
+	router.OPTIONS("/tus/:id", tusOptions)
+
+	r := router.Group("/", Auth(tokenStore, accessTokenDAO, userDAO))
 
 	// list entries/drives
 	r.GET("/entries/*path", dr.list)
+
+	// subscribe the changes of the dir by SSE
+	r.GET("/events/*path", dr.subscribeEvents)
 	// get entry info
 	r.GET("/entry/*path", dr.get)
 	// mkdir
@@ -64,12 +92,25 @@ func InitDriveRoutes(router gin.IRouter,
 	r.PUT("/content/*path", dr.writeContent)
 	// chunk upload request
 	r.POST("/chunk", dr.chunkUploadRequest)
+	// chunk upload status
+	r.GET("/chunk/:id", dr.chunkUploadStatus)
 	// chunk upload
 	r.PUT("/chunk/:id/:seq", dr.chunkUpload)
 	// chunk upload complete
 	r.POST("/chunk-content/*path", dr.chunkUploadComplete)
 	// delete chunk upload
 	r.DELETE("/chunk/:id", dr.deleteChunkUpload)
+
+	// tus resumable upload
+	tus := r.Group("/tus", tusResumable)
+	tus.POST("", dr.tusCreate)
+	tus.HEAD("/:id", dr.tusHead)
+	tus.PATCH("/:id", dr.tusPatch)
+	tus.DELETE("/:id", dr.tusDelete)
+
+	// download the file from the url to the drive
+	r.POST("/offline-download", dr.offlineDownload)
+
 	// get task
 	r.GET("/task/:id", func(c *gin.Context) {
 		t, e := dr.runner.GetTask(c.Param("id"))
@@ -96,27 +137,43 @@ func InitDriveRoutes(router gin.IRouter,
 }
 
 type driveRoute struct {
-	config        common.Config
-	rootDrive     *drive.RootDrive
-	permissionDAO *storage.PathPermissionDAO
-	chunkUploader *ChunkUploader
-	thumbnail     *Thumbnail
-	runner        task.Runner
-	signer        *utils.Signer
+	config            common.Config
+	rootDrive         *drive.RootDrive
+	permissionDAO     *storage.PathPermissionDAO
+	chunkUploader     *ChunkUploader
+	tusUploader       *TusUploader
+	offlineDownloader *OfflineDownloader
+	thumbnail         *Thumbnail
+	runner            task.Runner
+	signer            *utils.Signer
+	auditor           *Auditor
+	uploadHooks       *UploadHooks
+	scanner           *VirusScanner
+
+	tokenStore     types.TokenStore
+	accessTokenDAO *storage.AccessTokenDAO
+	userDAO        *storage.UserDAO
 }
 
-func (dr *driveRoute) getDrive(c *gin.Context) types.IDrive {
+func (dr *driveRoute) getDrive(c *gin.Context) *PermissionWrapperDrive {
 	session := GetSession(c)
 	return NewPermissionWrapperDrive(
 		c.Request, session,
 		dr.rootDrive.Get(),
 		dr.permissionDAO,
 		dr.signer,
+		dr.config.AccessKeyValidity,
+		dr.auditor,
+		dr.scanner,
 	)
 }
 
 func (dr *driveRoute) list(c *gin.Context) {
 	path := utils.CleanPath(c.Param("path"))
+	if isPagedListRequest(c) {
+		dr.listPage(c, path)
+		return
+	}
 	entries, e := dr.getDrive(c).List(c.Request.Context(), path)
 	if e != nil {
 		_ = c.Error(e)
@@ -129,6 +186,44 @@ func (dr *driveRoute) list(c *gin.Context) {
 	SetResult(c, res)
 }
 
+// isPagedListRequest returns true if any of the paging, sorting or filtering parameters is present
+func isPagedListRequest(c *gin.Context) bool {
+	for _, k := range []string{"cursor", "limit", "sort", "order", "filter"} {
+		if _, ok := c.GetQuery(k); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (dr *driveRoute) listPage(c *gin.Context, path string) {
+	limit := int(utils.ToInt64(c.Query("limit"), listDefaultLimit))
+	if limit <= 0 || limit > listMaxLimit {
+		limit = listDefaultLimit
+	}
+	opts := types.ListOptions{
+		Cursor: c.Query("cursor"),
+		Limit:  limit,
+		Sort:   c.Query("sort"),
+		Desc:   c.Query("order") == "desc",
+		Filter: c.Query("filter"),
+	}
+	if e := drive_util.CheckListOptions(opts); e != nil {
+		_ = c.Error(e)
+		return
+	}
+	page, e := drive_util.ListPage(c.Request.Context(), dr.getDrive(c), path, opts)
+	if e != nil {
+		_ = c.Error(e)
+		return
+	}
+	res := make([]entryJson, 0, len(page.Entries))
+	for _, v := range page.Entries {
+		res = append(res, *newEntryJson(v))
+	}
+	SetResult(c, types.M{"entries": res, "next_cursor": page.Cursor})
+}
+
 func (dr *driveRoute) get(c *gin.Context) {
 	path := utils.CleanPath(c.Param("path"))
 	entry, e := dr.getDrive(c).Get(c.Request.Context(), path)
@@ -163,7 +258,7 @@ func (dr *driveRoute) copyEntry(c *gin.Context) {
 		return
 	}
 	override := c.Query("override")
-	t, e := dr.runner.ExecuteAndWait(func(ctx types.TaskCtx) (interface{}, error) {
+	t, e := dr.runner.ExecuteAndWait(c.Request.Context(), func(ctx types.TaskCtx) (interface{}, error) {
 		r, e := drive_.Copy(ctx, fromEntry, to, override != "")
 		if e != nil {
 			return nil, e
@@ -192,7 +287,7 @@ func (dr *driveRoute) move(c *gin.Context) {
 		return
 	}
 	override := c.Query("override")
-	t, e := dr.runner.ExecuteAndWait(func(ctx types.TaskCtx) (interface{}, error) {
+	t, e := dr.runner.ExecuteAndWait(c.Request.Context(), func(ctx types.TaskCtx) (interface{}, error) {
 		r, e := drive_.Move(ctx, fromEntry, to, override != "")
 		if e != nil {
 			return nil, e
@@ -219,8 +314,9 @@ func checkCopyOrMove(from, to string) error {
 
 func (dr *driveRoute) deleteEntry(c *gin.Context) {
 	path := utils.CleanPath(c.Param("path"))
-	t, e := dr.runner.ExecuteAndWait(func(ctx types.TaskCtx) (interface{}, error) {
-		return nil, dr.getDrive(c).Delete(ctx, path)
+	drive := dr.getDrive(c)
+	t, e := dr.runner.ExecuteAndWait(c.Request.Context(), func(ctx types.TaskCtx) (interface{}, error) {
+		return nil, drive.Delete(ctx, path)
 	}, 2*time.Second)
 	if e != nil {
 		_ = c.Error(e)
@@ -238,7 +334,15 @@ func (dr *driveRoute) upload(c *gin.Context) {
 		_ = c.Error(e)
 		return
 	}
-	config, e := dr.getDrive(c).Upload(c.Request.Context(), path, size, override != "", request)
+	drive := dr.getDrive(c)
+	var config *types.DriveUploadConfig
+	var e error
+	if dr.scanner.Enabled() || dr.uploadHooks.Matches(path) {
+		// the files uploaded to the remote drives directly can't be processed
+		config, e = drive.UploadLocally(c.Request.Context(), path, size)
+	} else {
+		config, e = drive.Upload(c.Request.Context(), path, size, override != "", request)
+	}
 	if e != nil {
 		_ = c.Error(e)
 		return
@@ -322,12 +426,91 @@ func (dr *driveRoute) writeContent(c *gin.Context) {
 		_ = c.Error(err.NewBadRequestError(i18n.T("api.drive.invalid_file_size")))
 		return
 	}
-	t, e := dr.runner.ExecuteAndWait(func(ctx types.TaskCtx) (interface{}, error) {
+	drive := dr.getDrive(c)
+	t, e := dr.runner.ExecuteAndWait(c.Request.Context(), func(ctx types.TaskCtx) (interface{}, error) {
 		defer func() {
 			_ = file.Close()
 			_ = os.Remove(file.Name())
 		}()
-		return dr.getDrive(c).Save(ctx, path, size, override != "", file)
+		return dr.saveUpload(ctx, drive, path, override != "", file)
+	}, 2*time.Second)
+	if e != nil {
+		_ = c.Error(e)
+		return
+	}
+	SetResult(c, t)
+}
+
+// saveUpload runs the upload hooks on the uploaded file, then saves it if it's accepted,
+// the file is scanned by the virus scanner when saving.
+// It runs in tasks, so the drive must be resolved by the handler, the gin.Context can't be used after the handler returns.
+func (dr *driveRoute) saveUpload(ctx types.TaskCtx, drive *PermissionWrapperDrive, path string,
+	override bool, file *os.File) (types.IEntry, error) {
+	if _, e := drive.requirePermission(path, types.PermissionReadWrite); e != nil {
+		return nil, e
+	}
+	if e := dr.uploadHooks.Run(ctx, path, file); e != nil {
+		drive.audit(ctx, "upload_hook", path, "", e)
+		return nil, e
+	}
+	// the hooks may modify the file
+	stat, e := file.Stat()
+	if e != nil {
+		return nil, e
+	}
+	if _, e := file.Seek(0, io.SeekStart); e != nil {
+		return nil, e
+	}
+	return drive.Save(ctx, path, stat.Size(), override, file)
+}
+
+func (dr *driveRoute) offlineDownload(c *gin.Context) {
+	req := offlineDownloadRequest{}
+	if e := c.Bind(&req); e != nil {
+		_ = c.Error(e)
+		return
+	}
+	path := utils.CleanPath(req.Path)
+	if path == "" || utils.PathParent(path) == "" {
+		_ = c.Error(err.NewBadRequestError(i18n.T("api.offline_download.invalid_path")))
+		return
+	}
+	if e := checkOfflineDownloadURL(req.URL); e != nil {
+		_ = c.Error(e)
+		return
+	}
+	drive := dr.getDrive(c)
+	if _, e := drive.requirePermission(path, types.PermissionReadWrite); e != nil {
+		_ = c.Error(e)
+		return
+	}
+	t, e := dr.runner.ExecuteAndWait(c.Request.Context(), func(ctx types.TaskCtx) (interface{}, error) {
+		resp, e := dr.offlineDownloader.Open(ctx, req.URL, req.Headers)
+		if e != nil {
+			return nil, e
+		}
+		defer func() { _ = resp.Close() }()
+		var entry types.IEntry
+		// the upload hooks run on files, and the drives require the size when saving
+		if resp.size < 0 || dr.uploadHooks.Matches(path) {
+			var file *os.File
+			file, e = dr.offlineDownloader.Download(ctx, resp)
+			if e != nil {
+				return nil, e
+			}
+			defer func() {
+				_ = file.Close()
+				_ = os.Remove(file.Name())
+			}()
+			ctx.Progress(0, true)
+			entry, e = dr.saveUpload(ctx, drive, path, req.Override, file)
+		} else {
+			entry, e = drive.Save(ctx, path, resp.size, req.Override, resp)
+		}
+		if e != nil {
+			return nil, e
+		}
+		return newEntryJson(entry), nil
 	}, 2*time.Second)
 	if e != nil {
 		_ = c.Error(e)
@@ -343,7 +526,7 @@ func (dr *driveRoute) chunkUploadRequest(c *gin.Context) {
 		_ = c.Error(err.NewBadRequestError(i18n.T("api.drive.invalid_size_or_chunk_size")))
 		return
 	}
-	upload, e := dr.chunkUploader.CreateUpload(size, chunkSize)
+	upload, e := dr.chunkUploader.CreateUpload(size, chunkSize, GetSession(c).User.Username)
 	if e != nil {
 		_ = c.Error(e)
 		return
@@ -358,32 +541,43 @@ func (dr *driveRoute) chunkUpload(c *gin.Context) {
 		_ = c.Error(e)
 		return
 	}
-	if e := dr.chunkUploader.ChunkUpload(id, seq, c.Request.Body); e != nil {
+	h, expected, e := parseChunkChecksum(c.GetHeader(headerContentMD5), c.GetHeader(headerContentSHA256))
+	if e != nil {
+		_ = c.Error(e)
+		return
+	}
+	if e := dr.chunkUploader.ChunkUpload(id, GetSession(c).User.Username, seq, c.Request.Body, h, expected); e != nil {
+		_ = c.Error(e)
+	}
+}
+
+func (dr *driveRoute) chunkUploadStatus(c *gin.Context) {
+	status, e := dr.chunkUploader.GetUploadStatus(c.Param("id"), GetSession(c).User.Username)
+	if e != nil {
 		_ = c.Error(e)
+		return
 	}
+	SetResult(c, status)
 }
 
 func (dr *driveRoute) chunkUploadComplete(c *gin.Context) {
 	path := utils.CleanPath(c.Param("path"))
 	id := c.Query("id")
-	t, e := dr.runner.ExecuteAndWait(func(ctx types.TaskCtx) (interface{}, error) {
-		file, e := dr.chunkUploader.CompleteUpload(id, ctx)
+	owner := GetSession(c).User.Username
+	drive := dr.getDrive(c)
+	t, e := dr.runner.ExecuteAndWait(c.Request.Context(), func(ctx types.TaskCtx) (interface{}, error) {
+		file, e := dr.chunkUploader.CompleteUpload(id, owner, ctx)
 		if e != nil {
 			return nil, e
 		}
-		stat, e := file.Stat()
-		if e != nil {
-			_ = file.Close()
-			return nil, e
-		}
 		ctx.Progress(0, true)
-		entry, e := dr.getDrive(c).Save(ctx, path, stat.Size(), true, file)
+		entry, e := dr.saveUpload(ctx, drive, path, true, file)
 		if e != nil {
 			_ = file.Close()
 			return nil, e
 		}
 		_ = file.Close()
-		e = dr.chunkUploader.DeleteUpload(id)
+		e = dr.chunkUploader.DeleteUpload(id, owner)
 		return newEntryJson(entry), nil
 	}, 2*time.Second)
 	if e != nil {
@@ -395,7 +589,7 @@ func (dr *driveRoute) chunkUploadComplete(c *gin.Context) {
 
 func (dr *driveRoute) deleteChunkUpload(c *gin.Context) {
 	id := c.Param("id")
-	if e := dr.chunkUploader.DeleteUpload(id); e != nil {
+	if e := dr.chunkUploader.DeleteUpload(id, GetSession(c).User.Username); e != nil {
 		_ = c.Error(e)
 	}
 }
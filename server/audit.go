@@ -0,0 +1,200 @@
+package server
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"go-drive/common"
+	"go-drive/common/i18n"
+	"go-drive/common/logging"
+	"go-drive/common/registry"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"go-drive/storage"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	auditCleanInterval = time.Hour
+	auditMaxErrorSize  = 1024
+	auditDefaultLimit  = 50
+	auditMaxLimit      = 1000
+	// page size when exporting
+	auditExportBatch = 1000
+)
+
+var auditLogger = logging.For("audit")
+
+// Auditor records the mutating drive operations and admin API calls,
+// the logs older than the retention will be removed
+type Auditor struct {
+	dao       *storage.AuditLogDAO
+	retention time.Duration
+
+	stopCleaner func()
+}
+
+// auditActor is who performs the operation
+type auditActor struct {
+	username string
+	clientIP string
+}
+
+func newAuditActor(request *http.Request, session types.Session) auditActor {
+	username := session.User.Username
+	if username == "" {
+		username = session.PendingUsername
+	}
+	return auditActor{username: username, clientIP: GetClientIP(request)}
+}
+
+func NewAuditor(config common.Config, ch *registry.ComponentsHolder, dao *storage.AuditLogDAO) *Auditor {
+	a := &Auditor{dao: dao, retention: config.AuditRetention}
+	if a.retention > 0 {
+		a.stopCleaner = utils.TimeTick(a.clean, auditCleanInterval)
+	}
+	ch.Add("auditor", a)
+	return a
+}
+
+// Record records the operation, errors of recording are logged but not returned,
+// so that the operation will not fail because of the audit log
+func (a *Auditor) Record(ctx context.Context, actor auditActor, action, path, target string, opErr error) {
+	l := types.AuditLog{
+		CreatedAt: time.Now().Unix(),
+		Username:  actor.username,
+		ClientIP:  actor.clientIP,
+		Action:    action,
+		Path:      path,
+		Target:    target,
+		Result:    types.AuditSuccess,
+		RequestID: logging.RequestID(ctx),
+	}
+	if opErr != nil {
+		l.Result = types.AuditFailure
+		l.Error = opErr.Error()
+		if len(l.Error) > auditMaxErrorSize {
+			l.Error = l.Error[:auditMaxErrorSize]
+		}
+	}
+	if e := a.dao.AddLog(l); e != nil {
+		auditLogger.Ctx(ctx).Error("error when recording audit log",
+			"action", action, "path", path, "username", actor.username, "error", e)
+	}
+}
+
+func (a *Auditor) clean() {
+	n, e := a.dao.CleanBefore(time.Now().Add(-a.retention).Unix())
+	if e != nil {
+		auditLogger.Warn("error when cleaning expired audit logs", "error", e)
+		return
+	}
+	if n > 0 {
+		auditLogger.Info("expired audit logs cleaned", "count", n)
+	}
+}
+
+func (a *Auditor) Dispose() error {
+	if a.stopCleaner != nil {
+		a.stopCleaner()
+	}
+	return nil
+}
+
+// AuditAdmin records the mutating admin API calls,
+// it should be used after Auth to get the user of the request
+func AuditAdmin(auditor *Auditor) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			return
+		}
+		var e error
+		if len(c.Errors) > 0 {
+			e = c.Errors[0].Err
+		} else if status := c.Writer.Status(); status >= http.StatusBadRequest {
+			e = errors.New(http.StatusText(status))
+		}
+		auditor.Record(c.Request.Context(), newAuditActor(c.Request, GetSession(c)),
+			c.Request.Method+" "+c.FullPath(), c.Request.URL.Path, "", e)
+	}
+}
+
+func parseAuditLogQuery(c *gin.Context) storage.AuditLogQuery {
+	return storage.AuditLogQuery{
+		Username: c.Query("username"),
+		Action:   c.Query("action"),
+		Path:     c.Query("path"),
+		Result:   c.Query("result"),
+		From:     utils.ToInt64(c.Query("from"), 0),
+		To:       utils.ToInt64(c.Query("to"), 0),
+	}
+}
+
+func queryAuditLogs(c *gin.Context, dao *storage.AuditLogDAO) {
+	offset := int(utils.ToInt64(c.Query("offset"), 0))
+	limit := int(utils.ToInt64(c.Query("limit"), auditDefaultLimit))
+	if offset < 0 {
+		offset = 0
+	}
+	if limit <= 0 || limit > auditMaxLimit {
+		limit = auditDefaultLimit
+	}
+	logs, total, e := dao.Query(parseAuditLogQuery(c), offset, limit)
+	if e != nil {
+		_ = c.Error(e)
+		return
+	}
+	SetResult(c, types.M{"total": total, "items": logs})
+}
+
+// exportAuditLogs writes the logs matching the query in CSV
+func exportAuditLogs(c *gin.Context, dao *storage.AuditLogDAO, ms i18n.MessageSource) {
+	q := parseAuditLogQuery(c)
+	logs, _, e := dao.Query(q, 0, auditExportBatch)
+	if e != nil {
+		_ = c.Error(e)
+		return
+	}
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"audit-logs-%s.csv\"",
+		time.Now().Format("20060102150405")))
+	w := csv.NewWriter(c.Writer)
+	_ = w.Write([]string{"id", "time", "username", "client_ip", "action",
+		"path", "target", "result", "error", "request_id"})
+	// new logs may be added while exporting, so paging by id instead of offset
+	for len(logs) > 0 {
+		for _, l := range TranslateV(c, ms, logs).([]types.AuditLog) {
+			_ = w.Write([]string{
+				strconv.FormatUint(uint64(l.Id), 10),
+				time.Unix(l.CreatedAt, 0).Format(time.RFC3339),
+				csvSafe(l.Username), l.ClientIP, l.Action, csvSafe(l.Path), csvSafe(l.Target),
+				l.Result, csvSafe(l.Error), l.RequestID,
+			})
+		}
+		w.Flush()
+		if w.Error() != nil || len(logs) < auditExportBatch {
+			break
+		}
+		logs, e = dao.QueryBefore(q, logs[len(logs)-1].Id, auditExportBatch)
+		if e != nil {
+			auditLogger.Ctx(c.Request.Context()).Warn("error when exporting audit logs", "error", e)
+			break
+		}
+	}
+	w.Flush()
+}
+
+// csvSafe prevents the value from being evaluated as a formula by spreadsheet applications
+func csvSafe(v string) string {
+	if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+		return "'" + v
+	}
+	return v
+}
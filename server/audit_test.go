@@ -0,0 +1,79 @@
+package server
+
+import (
+	"encoding/csv"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"go-drive/common/types"
+	"go-drive/storage"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+type keyMessageSource struct{}
+
+func (keyMessageSource) Translate(_, key string, _ ...string) string {
+	return key
+}
+
+func TestCsvSafe(t *testing.T) {
+	for v, expect := range map[string]string{
+		"":             "",
+		"a.txt":        "a.txt",
+		"=1+1":         "'=1+1",
+		"+1":           "'+1",
+		"-1":           "'-1",
+		"@SUM(A1)":     "'@SUM(A1)",
+		"\tcmd":        "'\tcmd",
+		"a=1":          "a=1",
+		"d/=HYPERLINK": "d/=HYPERLINK",
+	} {
+		if r := csvSafe(v); r != expect {
+			t.Errorf("'%s': expect '%s', but it's '%s'", v, expect, r)
+		}
+	}
+}
+
+func TestExportAuditLogs(t *testing.T) {
+	db, _, cleanup := newTestDB(t)
+	defer cleanup()
+	dao := storage.NewAuditLogDAO(db)
+	count := 2*auditExportBatch + 1
+	e := db.C().Transaction(func(tx *gorm.DB) error {
+		for i := 0; i < count; i++ {
+			l := types.AuditLog{CreatedAt: int64(i), Username: "alice", Action: "drive.save",
+				Path: fmt.Sprintf("d/%d", i), Result: types.AuditSuccess}
+			if e := tx.Create(&l).Error; e != nil {
+				return e
+			}
+		}
+		// not matched
+		return tx.Create(&types.AuditLog{Username: "bob", Action: "drive.save"}).Error
+	})
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/admin/audit-logs/export?username=alice", nil)
+	exportAuditLogs(c, dao, keyMessageSource{})
+
+	rows, e := csv.NewReader(w.Body).ReadAll()
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(rows) != count+1 {
+		t.Fatalf("expect %d rows with the header, but it's %d", count+1, len(rows))
+	}
+	last := uint64(0)
+	for i, row := range rows[1:] {
+		id, _ := strconv.ParseUint(row[0], 10, 32)
+		if i > 0 && id >= last {
+			t.Fatalf("expect the logs in reverse chronological order without duplicates, but %d follows %d", id, last)
+		}
+		last = id
+	}
+}
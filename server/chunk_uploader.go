@@ -1,14 +1,22 @@
 package server
 
 import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"github.com/google/uuid"
 	"go-drive/common"
 	"go-drive/common/errors"
 	"go-drive/common/i18n"
+	"go-drive/common/logging"
+	"go-drive/common/registry"
 	"go-drive/common/task"
 	"go-drive/common/types"
 	"go-drive/common/utils"
+	"hash"
 	"io"
 	"io/ioutil"
 	"math"
@@ -16,23 +24,48 @@ import (
 	path2 "path"
 	"strconv"
 	"strings"
+	"time"
 )
 
-const minChunkSize = 5 * 1024 * 1024
+const (
+	minChunkSize = 5 * 1024 * 1024
 
+	headerContentMD5    = "Content-MD5"
+	headerContentSHA256 = "X-Content-SHA256"
+
+	// uploadTempCleanInterval is the maximum interval of removing the idle uploads in upload_temp
+	uploadTempCleanInterval = time.Hour
+)
+
+var chunkLogger = logging.For("chunk_uploader")
+
+// ChunkUploader stores the chunks of the uploads in upload_temp, the chunks are merged when the upload is completed.
+// The uploads belong to the users who created them,
+// and are removed if they are idle longer than the UploadTempTTL.
+// The uploads created by the old versions have no owner, which can't be resumed by anyone,
+// they are removed on start.
 type ChunkUploader struct {
-	dir string
+	dir         string
+	ttl         time.Duration
+	stopCleaner func()
 }
 
-func NewChunkUploader(config common.Config) (*ChunkUploader, error) {
+func NewChunkUploader(config common.Config, ch *registry.ComponentsHolder) (*ChunkUploader, error) {
 	dir, e := config.GetDir("upload_temp", true)
 	if e != nil {
 		return nil, e
 	}
-	return &ChunkUploader{dir}, nil
+	c := &ChunkUploader{dir: dir, ttl: config.UploadTempTTL}
+	c.cleanOwnerless()
+	if c.ttl > 0 {
+		c.stopCleaner = utils.TimeTick(c.clean, uploadTempCleanIntervalOf(c.ttl))
+	}
+	ch.Add("chunkUploader", c)
+	return c, nil
 }
 
-func (c *ChunkUploader) CreateUpload(size, chunkSize int64) (ChunkUpload, error) {
+// CreateUpload creates the upload owned by the user, owner is empty for anonymous
+func (c *ChunkUploader) CreateUpload(size, chunkSize int64, owner string) (ChunkUpload, error) {
 	if chunkSize < minChunkSize {
 		return ChunkUpload{},
 			err.NewBadRequestError(i18n.T("api.chunk_uploader.chunk_size_cannot_less_than", strconv.Itoa(minChunkSize)))
@@ -52,19 +85,25 @@ func (c *ChunkUploader) CreateUpload(size, chunkSize int64) (ChunkUpload, error)
 	if e := os.Mkdir(dir, 0755); e != nil {
 		return ChunkUpload{}, e
 	}
-	upload, e := c.getUpload(id)
+	if e := ioutil.WriteFile(c.getOwnerFile(id), []byte(owner), 0644); e != nil {
+		_ = os.RemoveAll(dir)
+		return ChunkUpload{}, e
+	}
+	upload, e := c.getUpload(id, owner)
 	if e != nil {
 		panic(e)
 	}
 	return *upload, nil
 }
 
-func (c *ChunkUploader) ChunkUpload(id string, seq int, reader io.Reader) error {
-	upload, e := c.getUpload(id)
+// ChunkUpload writes the chunk, which is verified by the checksum if h is not nil.
+// The chunk is written to a temp file first, so that only the complete chunks are present.
+func (c *ChunkUploader) ChunkUpload(id, owner string, seq int, reader io.Reader, h hash.Hash, expected []byte) error {
+	upload, e := c.getUpload(id, owner)
 
 	defer func() {
-		if c.isMarkedDelete(upload) {
-			_ = c.DeleteUpload(upload.Id)
+		if upload != nil && c.isMarkedDelete(upload) {
+			_ = c.deleteUpload(upload)
 		}
 	}()
 
@@ -76,9 +115,10 @@ func (c *ChunkUploader) ChunkUpload(id string, seq int, reader io.Reader) error
 	}
 	chunkSize := upload.ChunkSize
 	if seq == upload.Chunks-1 {
-		chunkSize = upload.Size % upload.ChunkSize
+		chunkSize = upload.Size - int64(seq)*upload.ChunkSize
 	}
-	chunk, e := os.OpenFile(c.getChunk(upload, seq), os.O_TRUNC|os.O_CREATE|os.O_WRONLY, 0644)
+	chunkPath := c.getChunk(upload, seq)
+	chunk, e := os.OpenFile(chunkPath+".part", os.O_TRUNC|os.O_CREATE|os.O_WRONLY, 0644)
 	if e != nil {
 		return e
 	}
@@ -89,7 +129,11 @@ func (c *ChunkUploader) ChunkUpload(id string, seq int, reader io.Reader) error
 			_ = os.Remove(chunk.Name())
 		}
 	}()
-	written, e := io.Copy(chunk, reader)
+	var w io.Writer = chunk
+	if h != nil {
+		w = io.MultiWriter(chunk, h)
+	}
+	written, e := io.Copy(w, io.LimitReader(reader, chunkSize+1))
 	if e != nil {
 		return e
 	}
@@ -97,12 +141,40 @@ func (c *ChunkUploader) ChunkUpload(id string, seq int, reader io.Reader) error
 		return err.NewBadRequestError(i18n.T("api.chunk_uploader.expected__bytes_but__bytes",
 			strconv.FormatInt(chunkSize, 10), strconv.FormatInt(written, 10)))
 	}
+	if h != nil && !bytes.Equal(h.Sum(nil), expected) {
+		return err.NewBadRequestError(i18n.T("api.chunk_uploader.checksum_mismatch"))
+	}
+	if e := chunk.Close(); e != nil {
+		return e
+	}
+	if e := os.Rename(chunk.Name(), chunkPath); e != nil {
+		return e
+	}
 	success = true
 	return nil
 }
 
-func (c *ChunkUploader) CompleteUpload(id string, ctx types.TaskCtx) (*os.File, error) {
-	upload, e := c.getUpload(id)
+// GetUploadStatus returns the upload and the chunks already uploaded, so that the client can resume the upload
+func (c *ChunkUploader) GetUploadStatus(id, owner string) (ChunkUploadStatus, error) {
+	upload, e := c.getUpload(id, owner)
+	if e != nil {
+		return ChunkUploadStatus{}, e
+	}
+	uploaded := make([]int, 0)
+	for seq := 0; seq < upload.Chunks; seq++ {
+		exists, e := utils.FileExists(c.getChunk(upload, seq))
+		if e != nil {
+			return ChunkUploadStatus{}, e
+		}
+		if exists {
+			uploaded = append(uploaded, seq)
+		}
+	}
+	return ChunkUploadStatus{ChunkUpload: *upload, Uploaded: uploaded}, nil
+}
+
+func (c *ChunkUploader) CompleteUpload(id, owner string, ctx types.TaskCtx) (*os.File, error) {
+	upload, e := c.getUpload(id, owner)
 	if e != nil {
 		return nil, e
 	}
@@ -112,7 +184,7 @@ func (c *ChunkUploader) CompleteUpload(id string, ctx types.TaskCtx) (*os.File,
 			return nil, e
 		}
 		if !exists {
-			return nil, err.NewNotAllowedMessageError(i18n.T("missing_chunks"))
+			return nil, err.NewNotAllowedMessageError(i18n.T("api.chunk_uploader.missing_chunks"))
 		}
 	}
 	file, e := os.OpenFile(c.getFile(upload), os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0644)
@@ -126,7 +198,7 @@ func (c *ChunkUploader) CompleteUpload(id string, ctx types.TaskCtx) (*os.File,
 			_ = os.Remove(file.Name())
 		}
 		if c.isMarkedDelete(upload) {
-			_ = c.DeleteUpload(upload.Id)
+			_ = c.deleteUpload(upload)
 		}
 	}()
 	ctx.Total(upload.Size, true)
@@ -156,12 +228,16 @@ func (c *ChunkUploader) CompleteUpload(id string, ctx types.TaskCtx) (*os.File,
 	return os.Open(c.getFile(upload))
 }
 
-func (c *ChunkUploader) DeleteUpload(id string) error {
-	upload, e := c.getUpload(id)
+func (c *ChunkUploader) DeleteUpload(id, owner string) error {
+	upload, e := c.getUpload(id, owner)
 	if e != nil {
 		return e
 	}
-	e = os.RemoveAll(c.getDir(id))
+	return c.deleteUpload(upload)
+}
+
+func (c *ChunkUploader) deleteUpload(upload *ChunkUpload) error {
+	e := os.RemoveAll(c.getDir(upload.Id))
 	if e != nil {
 		if e = c.markDeleted(upload); e != nil {
 			return e
@@ -170,11 +246,81 @@ func (c *ChunkUploader) DeleteUpload(id string) error {
 	return nil
 }
 
+// clean removes the chunk uploads idle longer than the ttl, the tus uploads are cleaned by TusUploader
+func (c *ChunkUploader) clean() {
+	files, e := ioutil.ReadDir(c.dir)
+	if e != nil {
+		chunkLogger.Warn("error when cleaning idle uploads", "error", e)
+		return
+	}
+	n := 0
+	notBefore := time.Now().Add(-c.ttl)
+	for _, f := range files {
+		if !f.IsDir() || strings.HasSuffix(f.Name(), tusUploadSuffix) {
+			continue
+		}
+		dir := c.getDir(f.Name())
+		idle, e := uploadIdleSince(dir)
+		if e != nil {
+			chunkLogger.Warn("error when cleaning idle uploads", "dir", dir, "error", e)
+			continue
+		}
+		if idle.After(notBefore) {
+			continue
+		}
+		if e := os.RemoveAll(dir); e != nil {
+			chunkLogger.Warn("failed to delete upload", "dir", dir, "error", e)
+			continue
+		}
+		n++
+	}
+	if n > 0 {
+		chunkLogger.Info("idle uploads cleaned", "count", n)
+	}
+}
+
+// cleanOwnerless removes the chunk uploads without the owner file.
+// It's called before serving, so the owner file of the new uploads must be present.
+func (c *ChunkUploader) cleanOwnerless() {
+	files, e := ioutil.ReadDir(c.dir)
+	if e != nil {
+		chunkLogger.Warn("error when cleaning uploads without owner", "error", e)
+		return
+	}
+	n := 0
+	for _, f := range files {
+		if !f.IsDir() || strings.HasSuffix(f.Name(), tusUploadSuffix) {
+			continue
+		}
+		dir := c.getDir(f.Name())
+		exists, e := utils.FileExists(c.getOwnerFile(f.Name()))
+		if e != nil || exists {
+			continue
+		}
+		if e := os.RemoveAll(dir); e != nil {
+			chunkLogger.Warn("failed to delete upload", "dir", dir, "error", e)
+			continue
+		}
+		n++
+	}
+	if n > 0 {
+		chunkLogger.Info("uploads without owner cleaned", "count", n)
+	}
+}
+
+func (c *ChunkUploader) Dispose() error {
+	if c.stopCleaner != nil {
+		c.stopCleaner()
+	}
+	return nil
+}
+
 func (c ChunkUploader) generateUploadId(size, chunkSize int64) string {
 	return fmt.Sprintf("%s_%d_%d", uuid.New().String(), size, chunkSize)
 }
 
-func (c *ChunkUploader) getUpload(id string) (*ChunkUpload, error) {
+// getUpload returns NotFoundError if the upload doesn't exist or doesn't belong to the owner
+func (c *ChunkUploader) getUpload(id, owner string) (*ChunkUpload, error) {
 	temp := strings.Split(id, "_")
 	if len(temp) != 3 {
 		return nil, err.NewBadRequestError(i18n.T("api.chunk_uploader.invalid_upload_id"))
@@ -187,6 +333,13 @@ func (c *ChunkUploader) getUpload(id string) (*ChunkUpload, error) {
 	if !exists {
 		return nil, err.NewNotFoundError()
 	}
+	uploadOwner, e := ioutil.ReadFile(c.getOwnerFile(id))
+	if e != nil && !os.IsNotExist(e) {
+		return nil, e
+	}
+	if e != nil || string(uploadOwner) != owner {
+		return nil, err.NewNotFoundError()
+	}
 	size := utils.ToInt64(temp[1], -1)
 	chunkSize := utils.ToInt64(temp[2], -1)
 	if size <= 0 || chunkSize <= 0 {
@@ -227,6 +380,10 @@ func (c *ChunkUploader) getDeleteMark(upload *ChunkUpload) string {
 	return path2.Join(c.getDir(upload.Id), "deleted")
 }
 
+func (c *ChunkUploader) getOwnerFile(id string) string {
+	return path2.Join(c.getDir(id), "owner")
+}
+
 func (c *ChunkUploader) getDir(id string) string {
 	return path2.Join(c.dir, id)
 }
@@ -238,6 +395,59 @@ type ChunkUpload struct {
 	Chunks    int    `json:"chunks"`
 }
 
+type ChunkUploadStatus struct {
+	ChunkUpload
+	// Uploaded is the seq of the chunks uploaded
+	Uploaded []int `json:"uploaded"`
+}
+
+// parseChunkChecksum parses the checksum of the chunk, Content-MD5 is the base64 encoded MD5 digest,
+// X-Content-SHA256 is the hex encoded SHA-256 digest, which is preferred if both are supplied.
+// Returns nil hash if there's no checksum.
+func parseChunkChecksum(contentMD5, contentSHA256 string) (hash.Hash, []byte, error) {
+	if contentSHA256 != "" {
+		expected, e := hex.DecodeString(contentSHA256)
+		if e != nil || len(expected) != sha256.Size {
+			return nil, nil, err.NewBadRequestError(i18n.T("api.chunk_uploader.invalid_checksum"))
+		}
+		return sha256.New(), expected, nil
+	}
+	if contentMD5 != "" {
+		expected, e := base64.StdEncoding.DecodeString(contentMD5)
+		if e != nil || len(expected) != md5.Size {
+			return nil, nil, err.NewBadRequestError(i18n.T("api.chunk_uploader.invalid_checksum"))
+		}
+		return md5.New(), expected, nil
+	}
+	return nil, nil, nil
+}
+
+func uploadTempCleanIntervalOf(ttl time.Duration) time.Duration {
+	if ttl < uploadTempCleanInterval {
+		return ttl
+	}
+	return uploadTempCleanInterval
+}
+
+// uploadIdleSince returns the latest modification time of the upload dir and the files in it
+func uploadIdleSince(dir string) (time.Time, error) {
+	stat, e := os.Stat(dir)
+	if e != nil {
+		return time.Time{}, e
+	}
+	latest := stat.ModTime()
+	files, e := ioutil.ReadDir(dir)
+	if e != nil {
+		return time.Time{}, e
+	}
+	for _, f := range files {
+		if f.ModTime().After(latest) {
+			latest = f.ModTime()
+		}
+	}
+	return latest, nil
+}
+
 func newChunkUpload(id string, size, chunkSize int64) *ChunkUpload {
 	return &ChunkUpload{
 		Id:        id,
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"go-drive/common"
+	"go-drive/common/errors"
+	"go-drive/common/registry"
+	"go-drive/common/utils"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestChunkUploader(t *testing.T, ttl time.Duration) (*ChunkUploader, func()) {
+	dir, e := ioutil.TempDir("", "go-drive-chunk")
+	if e != nil {
+		t.Fatal(e)
+	}
+	config := common.NewSqliteConfig(dir)
+	config.UploadTempTTL = ttl
+	c, e := NewChunkUploader(config, registry.NewComponentHolder())
+	if e != nil {
+		_ = os.RemoveAll(dir)
+		t.Fatal(e)
+	}
+	return c, func() {
+		_ = c.Dispose()
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func TestChunkUploadChecksum(t *testing.T) {
+	c, cleanup := newTestChunkUploader(t, 0)
+	defer cleanup()
+	upload, e := c.CreateUpload(minChunkSize+4, minChunkSize, "alice")
+	if e != nil {
+		t.Fatal(e)
+	}
+	content := []byte("last")
+	sum := sha256.Sum256(content)
+
+	h, expected, e := parseChunkChecksum("", strings.Repeat("0", 64))
+	if e != nil {
+		t.Fatal(e)
+	}
+	e = c.ChunkUpload(upload.Id, "alice", 1, bytes.NewReader(content), h, expected)
+	if _, ok := e.(err.BadRequestError); !ok {
+		t.Errorf("expect BadRequestError of checksum mismatch, but it's %v", e)
+	}
+	status, e := c.GetUploadStatus(upload.Id, "alice")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(status.Uploaded) != 0 {
+		t.Errorf("expect the mismatched chunk discarded, but it's %v", status.Uploaded)
+	}
+
+	h, expected, _ = parseChunkChecksum("", hex.EncodeToString(sum[:]))
+	if e := c.ChunkUpload(upload.Id, "alice", 1, bytes.NewReader(content), h, expected); e != nil {
+		t.Fatal(e)
+	}
+	status, e = c.GetUploadStatus(upload.Id, "alice")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if status.Chunks != 2 || len(status.Uploaded) != 1 || status.Uploaded[0] != 1 {
+		t.Errorf("expect chunk 1 of 2 uploaded, but it's %v of %d", status.Uploaded, status.Chunks)
+	}
+
+	if _, _, e := parseChunkChecksum("invalid", ""); e == nil {
+		t.Errorf("expect error of the invalid Content-MD5")
+	}
+}
+
+func TestChunkUploadOwner(t *testing.T) {
+	c, cleanup := newTestChunkUploader(t, 0)
+	defer cleanup()
+	upload, e := c.CreateUpload(minChunkSize, minChunkSize, "alice")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if _, e := c.GetUploadStatus(upload.Id, "bob"); !err.IsNotFoundError(e) {
+		t.Errorf("expect NotFoundError of the upload of others, but it's %v", e)
+	}
+	if _, e := c.GetUploadStatus(upload.Id, ""); !err.IsNotFoundError(e) {
+		t.Errorf("expect NotFoundError of anonymous, but it's %v", e)
+	}
+	e = c.ChunkUpload(upload.Id, "bob", 0, bytes.NewReader([]byte("a")), nil, nil)
+	if !err.IsNotFoundError(e) {
+		t.Errorf("expect NotFoundError of uploading to others' upload, but it's %v", e)
+	}
+	if e := c.DeleteUpload(upload.Id, "bob"); !err.IsNotFoundError(e) {
+		t.Errorf("expect NotFoundError of deleting others' upload, but it's %v", e)
+	}
+	if e := c.DeleteUpload(upload.Id, "alice"); e != nil {
+		t.Errorf("expect the upload deleted by the owner, but it's %v", e)
+	}
+}
+
+func TestChunkUploaderClean(t *testing.T) {
+	c, cleanup := newTestChunkUploader(t, time.Hour)
+	defer cleanup()
+	idle, e := c.CreateUpload(minChunkSize, minChunkSize, "alice")
+	if e != nil {
+		t.Fatal(e)
+	}
+	active, e := c.CreateUpload(minChunkSize, minChunkSize, "alice")
+	if e != nil {
+		t.Fatal(e)
+	}
+	past := time.Now().Add(-2 * time.Hour)
+	for _, p := range []string{c.getOwnerFile(idle.Id), c.getDir(idle.Id)} {
+		if e := os.Chtimes(p, past, past); e != nil {
+			t.Fatal(e)
+		}
+	}
+	c.clean()
+	if exists, _ := utils.FileExists(c.getDir(idle.Id)); exists {
+		t.Errorf("expect the idle upload cleaned")
+	}
+	if exists, _ := utils.FileExists(c.getDir(active.Id)); !exists {
+		t.Errorf("expect the active upload kept")
+	}
+}
+
+func TestChunkUploaderCleanOwnerless(t *testing.T) {
+	c, cleanup := newTestChunkUploader(t, 0)
+	defer cleanup()
+	legacy := c.generateUploadId(minChunkSize, minChunkSize)
+	if e := os.Mkdir(c.getDir(legacy), 0755); e != nil {
+		t.Fatal(e)
+	}
+	owned, e := c.CreateUpload(minChunkSize, minChunkSize, "alice")
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	// restarted
+	c, e = NewChunkUploader(common.NewSqliteConfig(filepath.Dir(c.dir)), registry.NewComponentHolder())
+	if e != nil {
+		t.Fatal(e)
+	}
+	if exists, _ := utils.FileExists(c.getDir(legacy)); exists {
+		t.Errorf("expect the upload without owner cleaned")
+	}
+	if exists, _ := utils.FileExists(c.getDir(owned.Id)); !exists {
+		t.Errorf("expect the owned upload kept")
+	}
+}
@@ -0,0 +1,199 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"go-drive/common"
+	"go-drive/common/errors"
+	"go-drive/common/i18n"
+	"go-drive/common/registry"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"go-drive/storage"
+	"time"
+)
+
+const dbTokenCleanInterval = 10 * time.Minute
+
+// DbTokenStore stores sessions in the database, so that it can be shared by multiple instances.
+// The expiration time is refreshed at most once per types.SessionTouchInterval.
+type DbTokenStore struct {
+	sessionDAO  *storage.SessionDAO
+	validity    time.Duration
+	autoRefresh bool
+
+	stopCleaner func()
+}
+
+func NewDbTokenStore(config common.Config, ch *registry.ComponentsHolder,
+	sessionDAO *storage.SessionDAO) *DbTokenStore {
+	d := &DbTokenStore{
+		sessionDAO:  sessionDAO,
+		validity:    config.TokenValidity,
+		autoRefresh: config.TokenRefresh,
+	}
+	d.stopCleaner = utils.TimeTick(d.clean, dbTokenCleanInterval)
+	ch.Add("tokenStore", d)
+	return d
+}
+
+func (d *DbTokenStore) Create(value types.Session) (types.Token, error) {
+	now := time.Now()
+	value.Touch(now)
+	var expiresAt int64
+	if d.validity > 0 {
+		expiresAt = now.Add(d.validity).Unix()
+	}
+	r, e := d.toRecord(uuid.New().String(), value, expiresAt)
+	if e != nil {
+		return types.Token{}, e
+	}
+	if e := d.sessionDAO.AddSession(r); e != nil {
+		return types.Token{}, e
+	}
+	return types.Token{Token: r.Token, Value: value, ExpiredAt: d.expiredAt(r.ExpiresAt)}, nil
+}
+
+// Update replaces the session, the expiration time is kept unless the auto refresh is enabled
+func (d *DbTokenStore) Update(token string, value types.Session) (types.Token, error) {
+	now := time.Now()
+	var expiresAt int64
+	if d.refreshEnabled() {
+		expiresAt = now.Add(d.validity).Unix()
+	} else {
+		old, e := d.sessionDAO.GetSession(token, now.Unix())
+		if e != nil {
+			return types.Token{}, e
+		}
+		if old == nil {
+			return types.Token{}, err.NewUnauthorizedError(i18n.T("api.db_token.invalid_token"))
+		}
+		expiresAt = old.ExpiresAt
+	}
+	r, e := d.toRecord(token, value, expiresAt)
+	if e != nil {
+		return types.Token{}, e
+	}
+	ok, e := d.sessionDAO.UpdateSession(r, now.Unix())
+	if e != nil {
+		return types.Token{}, e
+	}
+	if !ok {
+		return types.Token{}, err.NewUnauthorizedError(i18n.T("api.db_token.invalid_token"))
+	}
+	return types.Token{Token: token, Value: value, ExpiredAt: d.expiredAt(r.ExpiresAt)}, nil
+}
+
+func (d *DbTokenStore) Validate(token string) (types.Token, error) {
+	now := time.Now()
+	r, e := d.sessionDAO.GetSession(token, now.Unix())
+	if e != nil {
+		return types.Token{}, e
+	}
+	if r == nil {
+		return types.Token{}, err.NewUnauthorizedError(i18n.T("api.db_token.invalid_token"))
+	}
+	t, e := d.fromRecord(*r)
+	if e != nil {
+		return types.Token{}, e
+	}
+	if t.Value.Touch(now) {
+		var expiresAt int64
+		if d.refreshEnabled() {
+			expiresAt = now.Add(d.validity).Unix()
+			t.ExpiredAt = expiresAt
+		}
+		if e := d.sessionDAO.TouchSession(token, t.Value.LastAccess, expiresAt); e != nil {
+			return types.Token{}, e
+		}
+	}
+	return t, nil
+}
+
+func (d *DbTokenStore) Revoke(token string) error {
+	return d.sessionDAO.DeleteSession(token)
+}
+
+func (d *DbTokenStore) List(username string) ([]types.Token, error) {
+	rs, e := d.sessionDAO.ListSessions(username, time.Now().Unix())
+	if e != nil {
+		return nil, e
+	}
+	tokens := make([]types.Token, 0, len(rs))
+	for _, r := range rs {
+		t, e := d.fromRecord(r)
+		if e != nil {
+			return nil, e
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, nil
+}
+
+func (d *DbTokenStore) toRecord(token string, value types.Session, expiresAt int64) (types.SessionRecord, error) {
+	data, e := json.Marshal(value)
+	if e != nil {
+		return types.SessionRecord{}, e
+	}
+	username := value.User.Username
+	if username == "" {
+		username = value.PendingUsername
+	}
+	return types.SessionRecord{
+		Token:      token,
+		Username:   username,
+		Data:       string(data),
+		LastAccess: value.LastAccess,
+		ExpiresAt:  expiresAt,
+	}, nil
+}
+
+func (d *DbTokenStore) fromRecord(r types.SessionRecord) (types.Token, error) {
+	s := types.Session{}
+	if e := json.Unmarshal([]byte(r.Data), &s); e != nil {
+		return types.Token{}, e
+	}
+	// last access may be updated without updating the data
+	s.LastAccess = r.LastAccess
+	return types.Token{Token: r.Token, Value: s, ExpiredAt: d.expiredAt(r.ExpiresAt)}, nil
+}
+
+// expiredAt converts to the ExpiredAt of types.Token, which is -1 if never expires
+func (d *DbTokenStore) expiredAt(expiresAt int64) int64 {
+	if expiresAt == 0 {
+		return -1
+	}
+	return expiresAt
+}
+
+func (d *DbTokenStore) refreshEnabled() bool {
+	return d.autoRefresh && d.validity > 0
+}
+
+func (d *DbTokenStore) clean() {
+	n, e := d.sessionDAO.CleanExpired(time.Now().Unix())
+	if e != nil {
+		tokenLogger.Warn("error when cleaning expired sessions", "error", e)
+		return
+	}
+	if n > 0 {
+		tokenLogger.Debug("expired sessions cleaned", "count", n)
+	}
+}
+
+func (d *DbTokenStore) Status() (string, types.SM, error) {
+	total, active, e := d.sessionDAO.CountSessions(time.Now().Unix())
+	if e != nil {
+		return "", nil, e
+	}
+	return "Session", types.SM{
+		"Total":  fmt.Sprintf("%d", total),
+		"Active": fmt.Sprintf("%d", active),
+	}, nil
+}
+
+func (d *DbTokenStore) Dispose() error {
+	d.stopCleaner()
+	return nil
+}
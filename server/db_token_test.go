@@ -0,0 +1,125 @@
+package server
+
+import (
+	"go-drive/common/registry"
+	"go-drive/common/types"
+	"go-drive/storage"
+	"testing"
+	"time"
+)
+
+func newTestDbTokenStore(t *testing.T, refresh bool) (*DbTokenStore, *storage.DB, func()) {
+	db, config, cleanup := newTestDB(t)
+	config.TokenValidity = time.Hour
+	config.TokenRefresh = refresh
+	store := NewDbTokenStore(config, registry.NewComponentHolder(), storage.NewSessionDAO(db))
+	return store, db, func() {
+		_ = store.Dispose()
+		cleanup()
+	}
+}
+
+// expireSessionAt changes the expiration time of the session as if it's created earlier
+func expireSessionAt(t *testing.T, db *storage.DB, token string, expiresAt int64) {
+	e := db.C().Model(&types.SessionRecord{}).Where("token = ?", token).
+		Update("expires_at", expiresAt).Error
+	if e != nil {
+		t.Fatal(e)
+	}
+}
+
+func TestDbTokenStore(t *testing.T) {
+	store, _, cleanup := newTestDbTokenStore(t, false)
+	defer cleanup()
+
+	token, e := store.Create(types.Session{User: types.User{Username: "alice"}})
+	if e != nil {
+		t.Fatal(e)
+	}
+	if token.ExpiredAt <= time.Now().Unix() {
+		t.Errorf("expect the token expires in the future, but it's %d", token.ExpiredAt)
+	}
+	validated, e := store.Validate(token.Token)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if validated.Value.User.Username != "alice" {
+		t.Errorf("expect the session of alice, but it's %v", validated.Value)
+	}
+
+	if _, e := store.Create(types.Session{PendingUsername: "alice"}); e != nil {
+		t.Fatal(e)
+	}
+	if _, e := store.Create(types.Session{User: types.User{Username: "bob"}}); e != nil {
+		t.Fatal(e)
+	}
+	tokens, e := store.List("alice")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(tokens) != 2 {
+		t.Errorf("expect 2 sessions of alice, but it's %d", len(tokens))
+	}
+
+	if e := store.Revoke(token.Token); e != nil {
+		t.Fatal(e)
+	}
+	if _, e := store.Validate(token.Token); !isUnauthorized(e) {
+		t.Errorf("expect the revoked token invalid, but it's %v", e)
+	}
+	if _, e := store.Update(token.Token, types.Session{}); !isUnauthorized(e) {
+		t.Errorf("expect updating the revoked token failed, but it's %v", e)
+	}
+}
+
+func TestDbTokenStoreUpdateKeepsExpiration(t *testing.T) {
+	store, db, cleanup := newTestDbTokenStore(t, false)
+	defer cleanup()
+
+	token, e := store.Create(types.Session{User: types.User{Username: "alice"}})
+	if e != nil {
+		t.Fatal(e)
+	}
+	expiresAt := time.Now().Add(time.Minute).Unix()
+	expireSessionAt(t, db, token.Token, expiresAt)
+
+	updated, e := store.Update(token.Token, types.Session{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	if updated.ExpiredAt != expiresAt {
+		t.Errorf("expect the expiration time %d kept, but it's %d", expiresAt, updated.ExpiredAt)
+	}
+	validated, e := store.Validate(token.Token)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if validated.ExpiredAt != expiresAt || !validated.Value.IsAnonymous() {
+		t.Errorf("expect the updated session expires at %d, but it's %v", expiresAt, validated)
+	}
+
+	expireSessionAt(t, db, token.Token, time.Now().Add(-time.Minute).Unix())
+	if _, e := store.Update(token.Token, types.Session{}); !isUnauthorized(e) {
+		t.Errorf("expect updating the expired token failed, but it's %v", e)
+	}
+}
+
+func TestDbTokenStoreUpdateRefreshesExpiration(t *testing.T) {
+	store, db, cleanup := newTestDbTokenStore(t, true)
+	defer cleanup()
+
+	token, e := store.Create(types.Session{User: types.User{Username: "alice"}})
+	if e != nil {
+		t.Fatal(e)
+	}
+	expiresAt := time.Now().Add(time.Minute).Unix()
+	expireSessionAt(t, db, token.Token, expiresAt)
+
+	updated, e := store.Update(token.Token, types.Session{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	if updated.ExpiredAt <= expiresAt {
+		t.Errorf("expect the expiration time refreshed, but it's %d", updated.ExpiredAt)
+	}
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"github.com/gin-gonic/gin"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"io"
+	"time"
+)
+
+const (
+	eventsBufferSize   = 64
+	eventsPingInterval = 30 * time.Second
+)
+
+// subscribeEvents pushes the changes of the dir and its children by SSE,
+// the changes of the entries that are not readable are skipped.
+// An 'overflow' event is sent when the events are dropped because the client is too slow,
+// the client should reload the dir.
+// The session is validated again on each ping, the stream is closed with an 'unauthorized' event
+// if the session is revoked or expired, or the user is deleted,
+// and with a 'session_changed' event if the user or the groups of the session are changed,
+// the client should subscribe again.
+func (dr *driveRoute) subscribeEvents(c *gin.Context) {
+	path := utils.CleanPath(c.Param("path"))
+	drive := dr.getDrive(c)
+	if _, e := drive.requireListable(path); e != nil {
+		_ = c.Error(e)
+		return
+	}
+
+	events := make(chan types.DriveEvent, eventsBufferSize)
+	overflow := make(chan struct{}, 1)
+	unsubscribe := dr.rootDrive.Events().Subscribe(func(event types.DriveEvent) {
+		if !isEventOfDir(event.Path, path) && (event.From == "" || !isEventOfDir(event.From, path)) {
+			return
+		}
+		select {
+		case events <- event:
+		default:
+			select {
+			case overflow <- struct{}{}:
+			default:
+			}
+		}
+	})
+	defer unsubscribe()
+
+	ping := time.NewTicker(eventsPingInterval)
+	defer ping.Stop()
+
+	c.Header("Cache-Control", "no-cache")
+	// disable the buffering of nginx
+	c.Header("X-Accel-Buffering", "no")
+	c.SSEvent("subscribed", types.M{"path": path})
+	c.Writer.Flush()
+	tokenKey, session := c.GetHeader(headerAuth), GetSession(c)
+	c.Stream(func(io.Writer) bool {
+		select {
+		case event := <-events:
+			if event, ok := readableEvent(drive, event); ok {
+				c.SSEvent("change", event)
+			}
+		case <-overflow:
+			c.SSEvent("overflow", types.M{"path": path})
+		case <-ping.C:
+			key, current, e := revalidateSession(dr.tokenStore, dr.accessTokenDAO, dr.userDAO, tokenKey)
+			if e != nil {
+				c.SSEvent("unauthorized", types.M{"message": e.Error()})
+				return false
+			}
+			if !isSameSessionUser(session, current) {
+				c.SSEvent("session_changed", types.M{"path": path})
+				return false
+			}
+			tokenKey = key
+			c.SSEvent("ping", "")
+		case <-c.Request.Context().Done():
+			return false
+		}
+		return true
+	})
+}
+
+// isSameSessionUser returns true if the sessions have the same user and groups,
+// which the permissions of the events are resolved by
+func isSameSessionUser(a, b types.Session) bool {
+	if a.User.Username != b.User.Username || len(a.User.Groups) != len(b.User.Groups) {
+		return false
+	}
+	groups := make(map[string]bool, len(a.User.Groups))
+	for _, g := range a.User.Groups {
+		groups[g.Name] = true
+	}
+	for _, g := range b.User.Groups {
+		if !groups[g.Name] {
+			return false
+		}
+	}
+	return true
+}
+
+// isEventOfDir returns true if the path is the dir or its direct child
+func isEventOfDir(path, dir string) bool {
+	return path == dir || utils.PathParent(path) == dir
+}
+
+// readableEvent hides the path that is not readable,
+// a move is sent as a delete or a create if only one side of it is readable
+func readableEvent(drive *PermissionWrapperDrive, event types.DriveEvent) (types.DriveEvent, bool) {
+	if event.From == "" {
+		return event, drive.canRead(event.Path)
+	}
+	canReadFrom, canReadTo := drive.canRead(event.From), drive.canRead(event.Path)
+	switch {
+	case canReadFrom && canReadTo:
+		return event, true
+	case canReadFrom:
+		return types.DriveEvent{Type: types.DriveEventDelete, Path: event.From}, true
+	case canReadTo:
+		return types.DriveEvent{Type: types.DriveEventCreate, Path: event.Path}, true
+	}
+	return event, false
+}
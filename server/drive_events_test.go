@@ -0,0 +1,125 @@
+package server
+
+import (
+	"go-drive/common/types"
+	"go-drive/storage"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIsEventOfDir(t *testing.T) {
+	for _, c := range []struct {
+		path, dir string
+		expect    bool
+	}{
+		{"d/a", "d", true},
+		{"d", "d", true},
+		{"d/a/b", "d", false},
+		{"d", "", true},
+		{"e/a", "d", false},
+	} {
+		if isEventOfDir(c.path, c.dir) != c.expect {
+			t.Errorf("'%s' of '%s': expect %v, but it's %v", c.path, c.dir, c.expect, !c.expect)
+		}
+	}
+}
+
+func TestReadableEvent(t *testing.T) {
+	db, _, cleanup := newTestDB(t)
+	defer cleanup()
+	permissionDAO := storage.NewPathPermissionDAO(db)
+	subject := types.UserSubject("alice")
+	for path, policy := range map[string]uint8{"d/pub": types.PolicyAccept, "d/priv": types.PolicyReject} {
+		e := permissionDAO.SavePathPermissions(path, []types.PathPermission{
+			{Subject: subject, Permission: types.PermissionRead, Policy: policy},
+		})
+		if e != nil {
+			t.Fatal(e)
+		}
+	}
+	session := types.Session{User: types.User{Username: "alice"}}
+	drive := NewPermissionWrapperDrive(httptest.NewRequest("GET", "/events/d", nil), session,
+		nil, permissionDAO, nil, time.Hour, nil, nil)
+
+	for _, c := range []struct {
+		event  types.DriveEvent
+		expect types.DriveEvent
+		ok     bool
+	}{
+		{types.DriveEvent{Type: types.DriveEventCreate, Path: "d/pub/a"},
+			types.DriveEvent{Type: types.DriveEventCreate, Path: "d/pub/a"}, true},
+		{types.DriveEvent{Type: types.DriveEventCreate, Path: "d/priv/a"}, types.DriveEvent{}, false},
+		{types.DriveEvent{Type: types.DriveEventMove, From: "d/pub/a", Path: "d/pub/b"},
+			types.DriveEvent{Type: types.DriveEventMove, From: "d/pub/a", Path: "d/pub/b"}, true},
+		// only the readable side of the move is sent
+		{types.DriveEvent{Type: types.DriveEventMove, From: "d/pub/a", Path: "d/priv/a"},
+			types.DriveEvent{Type: types.DriveEventDelete, Path: "d/pub/a"}, true},
+		{types.DriveEvent{Type: types.DriveEventMove, From: "d/priv/a", Path: "d/pub/a"},
+			types.DriveEvent{Type: types.DriveEventCreate, Path: "d/pub/a"}, true},
+		{types.DriveEvent{Type: types.DriveEventMove, From: "d/priv/a", Path: "d/priv/b"}, types.DriveEvent{}, false},
+	} {
+		event, ok := readableEvent(drive, c.event)
+		if ok != c.ok {
+			t.Errorf("%v: expect readable %v, but it's %v", c.event, c.ok, ok)
+			continue
+		}
+		if ok && event != c.expect {
+			t.Errorf("%v: expect %v, but it's %v", c.event, c.expect, event)
+		}
+	}
+}
+
+func TestRevalidateSession(t *testing.T) {
+	db, _, cleanup := newTestDB(t)
+	defer cleanup()
+	userDAO := storage.NewUserDAO(db)
+	accessTokenDAO := storage.NewAccessTokenDAO(db)
+	tokenStore := NewMemTokenStore(time.Hour, false, time.Hour)
+	defer func() { _ = tokenStore.Dispose() }()
+
+	user, e := userDAO.AddUser(types.User{Username: "alice", Password: "123456"})
+	if e != nil {
+		t.Fatal(e)
+	}
+	token, e := tokenStore.Create(types.Session{User: user})
+	if e != nil {
+		t.Fatal(e)
+	}
+	if _, _, e := revalidateSession(tokenStore, accessTokenDAO, userDAO, token.Token); e != nil {
+		t.Errorf("expect session valid, but it's %v", e)
+	}
+
+	if e := userDAO.DeleteUser("alice"); e != nil {
+		t.Fatal(e)
+	}
+	if _, _, e := revalidateSession(tokenStore, accessTokenDAO, userDAO, token.Token); !isUnauthorized(e) {
+		t.Errorf("expect UnauthorizedError of the deleted user, but it's %v", e)
+	}
+
+	token, e = tokenStore.Create(types.Session{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	if e := tokenStore.Revoke(token.Token); e != nil {
+		t.Fatal(e)
+	}
+	if _, _, e := revalidateSession(tokenStore, accessTokenDAO, userDAO, token.Token); e == nil {
+		t.Errorf("expect the revoked session invalid")
+	}
+}
+
+func TestIsSameSessionUser(t *testing.T) {
+	alice := types.Session{User: types.User{Username: "alice", Groups: []types.Group{{Name: "dev"}, {Name: "ops"}}}}
+	same := types.Session{User: types.User{Username: "alice", Groups: []types.Group{{Name: "ops"}, {Name: "dev"}}}}
+	if !isSameSessionUser(alice, same) {
+		t.Errorf("expect the same user of the same groups")
+	}
+	if isSameSessionUser(alice, types.Session{}) {
+		t.Errorf("expect the logged out session changed")
+	}
+	changed := types.Session{User: types.User{Username: "alice", Groups: []types.Group{{Name: "dev"}, {Name: "admin"}}}}
+	if isSameSessionUser(alice, changed) {
+		t.Errorf("expect the session of changed groups changed")
+	}
+}
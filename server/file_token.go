@@ -10,10 +10,10 @@ import (
 	"go-drive/common/registry"
 	"go-drive/common/types"
 	"go-drive/common/utils"
-	"log"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -24,6 +24,9 @@ type FileTokenStore struct {
 	validity    time.Duration
 	autoRefresh bool
 	stopCleaner func()
+
+	// mux guards the writing of session files
+	mux *sync.Mutex
 }
 
 // NewFileTokenStore creates a FileTokenStore
@@ -36,6 +39,7 @@ func NewFileTokenStore(config common.Config, ch *registry.ComponentsHolder) (*Fi
 		root:        root,
 		autoRefresh: config.TokenRefresh,
 		validity:    config.TokenValidity,
+		mux:         &sync.Mutex{},
 	}
 	ft.stopCleaner = utils.TimeTick(ft.clean, 2*config.TokenValidity)
 	ch.Add("tokenStore", ft)
@@ -44,10 +48,13 @@ func NewFileTokenStore(config common.Config, ch *registry.ComponentsHolder) (*Fi
 
 func (f *FileTokenStore) Create(value types.Session) (types.Token, error) {
 	token := uuid.New().String()
+	value.Touch(time.Now())
 	return f.writeFile(token, &value, os.O_CREATE|os.O_WRONLY)
 }
 
 func (f *FileTokenStore) Update(token string, value types.Session) (types.Token, error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
 	if _, e := f.readFile(token, false); e != nil {
 		return types.Token{}, e
 	}
@@ -59,12 +66,56 @@ func (f *FileTokenStore) Validate(token string) (types.Token, error) {
 	if e != nil {
 		return types.Token{}, e
 	}
+	if t.Value.Touch(time.Now()) {
+		if e := f.touch(token); e != nil {
+			return types.Token{}, e
+		}
+	}
 	if f.autoRefresh {
 		_ = os.Chtimes(f.getSessionFile(token), time.Now(), time.Now())
 	}
 	return *t, nil
 }
 
+// touch updates the last access time of the session, and keeps the modification time of the file
+func (f *FileTokenStore) touch(token string) error {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	t, e := f.readFile(token, true)
+	if e != nil {
+		return e
+	}
+	if !t.Value.Touch(time.Now()) {
+		return nil
+	}
+	stat, e := os.Stat(f.getSessionFile(token))
+	if e != nil {
+		return e
+	}
+	if _, e := f.writeFile(token, &t.Value, os.O_TRUNC|os.O_WRONLY); e != nil {
+		return e
+	}
+	return os.Chtimes(f.getSessionFile(token), time.Now(), stat.ModTime())
+}
+
+func (f *FileTokenStore) List(username string) ([]types.Token, error) {
+	tokens := make([]types.Token, 0)
+	e := f.forEachSession(func(path string, info os.FileInfo) {
+		if f.isExpired(info.ModTime()) {
+			return
+		}
+		t, e := f.readFile(strings.TrimPrefix(filepath.Base(path), sessionPrefix), true)
+		if e != nil {
+			// the session may be revoked or expired while walking
+			return
+		}
+		if t.Value.BelongsTo(username) {
+			tokens = append(tokens, *t)
+		}
+	})
+	return tokens, e
+}
+
 func (f *FileTokenStore) Revoke(token string) error {
 	_ = os.Remove(f.getSessionFile(token))
 	return nil
@@ -142,16 +193,16 @@ func (f *FileTokenStore) clean() {
 	e := f.forEachSession(func(path string, info os.FileInfo) {
 		if info.ModTime().Before(notBefore) {
 			if e := os.Remove(path); e != nil {
-				log.Println("failed to delete file", e)
+				tokenLogger.Warn("failed to delete file", "path", path, "error", e)
 			}
 			n++
 		}
 	})
 	if n > 0 {
-		log.Println(fmt.Sprintf("%d expired sessions cleaned", n))
+		tokenLogger.Debug("expired sessions cleaned", "count", n)
 	}
 	if e != nil {
-		log.Println("error when cleaning expired sessions", e)
+		tokenLogger.Warn("error when cleaning expired sessions", "error", e)
 	}
 }
 
@@ -0,0 +1,294 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"go-drive/common"
+	"go-drive/common/errors"
+	"go-drive/common/i18n"
+	"go-drive/common/registry"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"go-drive/storage"
+	"time"
+)
+
+const (
+	jwtTokenCleanInterval = time.Hour
+	// max length of the replacement chain
+	jwtTokenMaxReplaced  = 8
+	userRevocationPrefix = "u:"
+	// the token with the exemption is not revoked by the user revocation at the same time
+	revocationExemptionPrefix = "x:"
+)
+
+type jwtSessionClaims struct {
+	Jti     string        `json:"jti"`
+	Iat     int64         `json:"iat"`
+	Exp     int64         `json:"exp"`
+	Session types.Session `json:"session"`
+	// IatNano is the issuing time in nanoseconds, to compare with the user revocations
+	IatNano int64 `json:"iat_ns,omitempty"`
+}
+
+func (c jwtSessionClaims) issuedAt() int64 {
+	if c.IatNano > 0 {
+		return c.IatNano
+	}
+	return c.Iat * int64(time.Second)
+}
+
+// JwtTokenStore is a stateless TokenStore, sessions are stored in HMAC signed tokens,
+// so that it can be shared by multiple instances with the same secret.
+//
+// Since a token cannot be changed, updating the session issues a new token,
+// the old one is revoked and replaced by the new one in the revocation list,
+// clients will get the new token by the response header when using the old token.
+type JwtTokenStore struct {
+	secret      []byte
+	validity    time.Duration
+	autoRefresh bool
+
+	revocationDAO *storage.TokenRevocationDAO
+
+	stopCleaner func()
+}
+
+func NewJwtTokenStore(config common.Config, ch *registry.ComponentsHolder,
+	revocationDAO *storage.TokenRevocationDAO) (*JwtTokenStore, error) {
+	if config.TokenSecret == "" {
+		return nil, fmt.Errorf("token-secret is required by the jwt token store")
+	}
+	if config.TokenValidity <= 0 {
+		return nil, fmt.Errorf("token-validity must be positive for the jwt token store")
+	}
+	j := &JwtTokenStore{
+		secret:        []byte(config.TokenSecret),
+		validity:      config.TokenValidity,
+		autoRefresh:   config.TokenRefresh,
+		revocationDAO: revocationDAO,
+	}
+	j.stopCleaner = utils.TimeTick(j.clean, jwtTokenCleanInterval)
+	ch.Add("tokenStore", j)
+	return j, nil
+}
+
+func (j *JwtTokenStore) Create(value types.Session) (types.Token, error) {
+	value.Touch(time.Now())
+	return j.issue(value)
+}
+
+func (j *JwtTokenStore) Update(token string, value types.Session) (types.Token, error) {
+	_, claims, e := j.validate(token, 0)
+	if e != nil {
+		return types.Token{}, e
+	}
+	return j.replace(claims, value)
+}
+
+// Validate returns the token, the returned token may be different from the requested one
+// if it's replaced or refreshed
+func (j *JwtTokenStore) Validate(token string) (types.Token, error) {
+	t, claims, e := j.validate(token, 0)
+	if e != nil {
+		return types.Token{}, e
+	}
+	// reissue the token after half of the validity passed
+	if j.autoRefresh && time.Now().Unix()-claims.Iat > int64(j.validity/time.Second/2) {
+		return j.replace(claims, claims.Session)
+	}
+	return t, nil
+}
+
+func (j *JwtTokenStore) Revoke(token string) error {
+	_, claims, e := j.parse(token)
+	if e != nil {
+		return nil
+	}
+	return j.revocationDAO.Revoke(types.TokenRevocation{
+		Id:        claims.Jti,
+		RevokedAt: time.Now().UnixNano(),
+		ExpiresAt: claims.Exp,
+	})
+}
+
+// List is not supported by the stateless store
+func (j *JwtTokenStore) List(string) ([]types.Token, error) {
+	return nil, err.NewUnsupportedMessageError(i18n.T("api.jwt_token.list_not_supported"))
+}
+
+// RevokeUser revokes all tokens of the user issued before now.
+// The exceptToken is kept by an exemption of this revocation.
+func (j *JwtTokenStore) RevokeUser(username, exceptToken string) error {
+	now := time.Now()
+	if exceptToken != "" {
+		// the final token of the replacement chain is the one in use
+		_, claims, e := j.validate(exceptToken, 0)
+		if e == nil && (claims.Session.User.Username == username || claims.Session.PendingUsername == username) {
+			if e := j.revocationDAO.Revoke(types.TokenRevocation{
+				Id:        revocationExemptionPrefix + claims.Jti,
+				RevokedAt: now.UnixNano(),
+				ExpiresAt: claims.Exp,
+			}); e != nil {
+				return e
+			}
+		}
+	}
+	return j.revocationDAO.Revoke(types.TokenRevocation{
+		Id:        userRevocationPrefix + username,
+		RevokedAt: now.UnixNano(),
+		ExpiresAt: now.Add(j.validity).Unix(),
+	})
+}
+
+// replace issues a new token with the session, and revokes the old one.
+// The old token is kept usable by replacing it with the new one,
+// so the requests that are in flight or the clients haven't got the new token will not fail.
+func (j *JwtTokenStore) replace(old jwtSessionClaims, value types.Session) (types.Token, error) {
+	claims := j.newClaims(value)
+	t, e := j.sign(claims)
+	if e != nil {
+		return types.Token{}, e
+	}
+	replacement, e := json.Marshal(claims)
+	if e != nil {
+		return types.Token{}, e
+	}
+	if e := j.revocationDAO.Revoke(types.TokenRevocation{
+		Id:          old.Jti,
+		RevokedAt:   time.Now().UnixNano(),
+		ExpiresAt:   old.Exp,
+		ReplacedBy:  claims.Jti,
+		Replacement: string(replacement),
+	}); e != nil {
+		return types.Token{}, e
+	}
+	return t, nil
+}
+
+func (j *JwtTokenStore) issue(value types.Session) (types.Token, error) {
+	return j.sign(j.newClaims(value))
+}
+
+func (j *JwtTokenStore) newClaims(value types.Session) jwtSessionClaims {
+	now := time.Now()
+	value.User.Password = ""
+	return jwtSessionClaims{
+		Jti:     uuid.New().String(),
+		Iat:     now.Unix(),
+		Exp:     now.Add(j.validity).Unix(),
+		Session: value,
+		IatNano: now.UnixNano(),
+	}
+}
+
+func (j *JwtTokenStore) sign(claims jwtSessionClaims) (types.Token, error) {
+	token, e := utils.SignJwtHS256(claims, j.secret)
+	if e != nil {
+		return types.Token{}, e
+	}
+	return types.Token{Token: token, Value: claims.Session, ExpiredAt: claims.Exp}, nil
+}
+
+// replacementOf signs the new token of the replaced token again
+func (j *JwtTokenStore) replacementOf(r types.TokenRevocation) (string, error) {
+	claims := jwtSessionClaims{}
+	if e := json.Unmarshal([]byte(r.Replacement), &claims); e != nil || claims.Jti != r.ReplacedBy {
+		return "", err.NewUnauthorizedError(i18n.T("api.jwt_token.invalid_token"))
+	}
+	t, e := j.sign(claims)
+	return t.Token, e
+}
+
+func (j *JwtTokenStore) parse(token string) (types.Token, jwtSessionClaims, error) {
+	claims := jwtSessionClaims{}
+	_, e := utils.ParseJwt(token, func(h utils.JwtHeader) (interface{}, error) {
+		if h.Alg != utils.JwtHS256 {
+			return nil, utils.ErrJwtUnsupportedAlg
+		}
+		return j.secret, nil
+	}, &claims)
+	if e == nil {
+		e = utils.ValidateJwtTime(claims.Exp, 0, 0)
+	}
+	if e != nil || claims.Jti == "" {
+		return types.Token{}, claims, err.NewUnauthorizedError(i18n.T("api.jwt_token.invalid_token"))
+	}
+	return types.Token{Token: token, Value: claims.Session, ExpiredAt: claims.Exp}, claims, nil
+}
+
+// validate parses the token and checks the revocation list, follows the replacement
+func (j *JwtTokenStore) validate(token string, depth int) (types.Token, jwtSessionClaims, error) {
+	t, claims, e := j.parse(token)
+	if e != nil {
+		return t, claims, e
+	}
+	ids := []string{claims.Jti, revocationExemptionPrefix + claims.Jti}
+	for _, u := range []string{claims.Session.User.Username, claims.Session.PendingUsername} {
+		if u != "" {
+			ids = append(ids, userRevocationPrefix+u)
+		}
+	}
+	rs, e := j.revocationDAO.GetRevocations(ids...)
+	if e != nil {
+		return t, claims, e
+	}
+	var revoked, exemption *types.TokenRevocation
+	for i, r := range rs {
+		if r.Id == revocationExemptionPrefix+claims.Jti {
+			exemption = &rs[i]
+		}
+	}
+	for i, r := range rs {
+		if r.Id == claims.Jti {
+			revoked = &rs[i]
+			continue
+		}
+		if r.Id == revocationExemptionPrefix+claims.Jti {
+			continue
+		}
+		// all tokens of the user issued before are revoked, except the one exempted from this revocation
+		if claims.issuedAt() <= r.RevokedAt && (exemption == nil || exemption.RevokedAt != r.RevokedAt) {
+			return t, claims, err.NewUnauthorizedError(i18n.T("api.jwt_token.invalid_token"))
+		}
+	}
+	if revoked == nil {
+		return t, claims, nil
+	}
+	if revoked.ReplacedBy == "" || depth >= jwtTokenMaxReplaced {
+		return t, claims, err.NewUnauthorizedError(i18n.T("api.jwt_token.invalid_token"))
+	}
+	replacement, e := j.replacementOf(*revoked)
+	if e != nil {
+		return t, claims, e
+	}
+	return j.validate(replacement, depth+1)
+}
+
+func (j *JwtTokenStore) clean() {
+	n, e := j.revocationDAO.CleanExpired(time.Now().Unix())
+	if e != nil {
+		tokenLogger.Warn("error when cleaning expired token revocations", "error", e)
+		return
+	}
+	if n > 0 {
+		tokenLogger.Debug("expired token revocations cleaned", "count", n)
+	}
+}
+
+func (j *JwtTokenStore) Status() (string, types.SM, error) {
+	n, e := j.revocationDAO.Count()
+	if e != nil {
+		return "", nil, e
+	}
+	return "Session", types.SM{
+		"Store":       "jwt",
+		"Revocations": fmt.Sprintf("%d", n),
+	}, nil
+}
+
+func (j *JwtTokenStore) Dispose() error {
+	j.stopCleaner()
+	return nil
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"go-drive/common/registry"
+	"go-drive/common/types"
+	"go-drive/storage"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestJwtTokenStore(t *testing.T) (*JwtTokenStore, func()) {
+	db, config, cleanup := newTestDB(t)
+	config.TokenSecret = "secret"
+	config.TokenValidity = time.Hour
+	store, e := NewJwtTokenStore(config, registry.NewComponentHolder(), storage.NewTokenRevocationDAO(db))
+	if e != nil {
+		cleanup()
+		t.Fatal(e)
+	}
+	return store, func() {
+		_ = store.Dispose()
+		cleanup()
+	}
+}
+
+func TestJwtTokenStoreRevokeUser(t *testing.T) {
+	store, cleanup := newTestJwtTokenStore(t)
+	defer cleanup()
+
+	session := types.Session{User: types.User{Username: "alice"}}
+	current, e := store.Create(session)
+	if e != nil {
+		t.Fatal(e)
+	}
+	other, e := store.Create(session)
+	if e != nil {
+		t.Fatal(e)
+	}
+	otherUser, e := store.Create(types.Session{User: types.User{Username: "bob"}})
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	if e := store.RevokeUser("alice", current.Token); e != nil {
+		t.Fatal(e)
+	}
+	if _, e := store.Validate(current.Token); e != nil {
+		t.Errorf("expect the except token valid, but it's %v", e)
+	}
+	if _, e := store.Validate(other.Token); e == nil {
+		t.Errorf("expect the other token revoked")
+	}
+	if _, e := store.Validate(otherUser.Token); e != nil {
+		t.Errorf("expect the token of other users valid, but it's %v", e)
+	}
+
+	// issued in the same second of the revocation
+	issued, e := store.Create(session)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if _, e := store.Validate(issued.Token); e != nil {
+		t.Errorf("expect the token issued after the revocation valid, but it's %v", e)
+	}
+
+	// the exemption is only for the revocation it's created with
+	if e := store.RevokeUser("alice", ""); e != nil {
+		t.Fatal(e)
+	}
+	if _, e := store.Validate(current.Token); e == nil {
+		t.Errorf("expect the except token revoked by the next revocation")
+	}
+}
+
+func TestListSessionsOfStatelessStore(t *testing.T) {
+	store, cleanup := newTestJwtTokenStore(t)
+	defer cleanup()
+
+	current, e := store.Create(types.Session{User: types.User{Username: "alice"}})
+	if e != nil {
+		t.Fatal(e)
+	}
+	sessions, e := listSessions(store, "alice", current.Token)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(sessions) != 1 || !sessions[0].Current || sessions[0].Username != "alice" {
+		t.Errorf("expect the current session listed, but it's %v", sessions)
+	}
+	sessions, e = listSessions(store, "bob", current.Token)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(sessions) != 0 {
+		t.Errorf("expect no sessions of bob, but it's %v", sessions)
+	}
+}
+
+func TestRevokeSessionOfStatelessStore(t *testing.T) {
+	store, cleanup := newTestJwtTokenStore(t)
+	defer cleanup()
+
+	current, e := store.Create(types.Session{User: types.User{Username: "alice"}})
+	if e != nil {
+		t.Fatal(e)
+	}
+	other, e := store.Create(types.Session{User: types.User{Username: "alice"}})
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	// only the current session can be revoked
+	if e := revokeSession(store, "alice", sessionID(other.Token), current.Token); e == nil {
+		t.Errorf("expect the other session not found")
+	}
+	if e := revokeSession(store, "alice", sessionID(current.Token), current.Token); e != nil {
+		t.Fatal(e)
+	}
+	if _, e := store.Validate(current.Token); e == nil {
+		t.Errorf("expect the current session revoked")
+	}
+}
+
+func TestJwtTokenStoreReplace(t *testing.T) {
+	store, cleanup := newTestJwtTokenStore(t)
+	defer cleanup()
+
+	old, e := store.Create(types.Session{User: types.User{Username: "alice"}})
+	if e != nil {
+		t.Fatal(e)
+	}
+	updated, e := store.Update(old.Token, types.Session{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	_, claims, _ := store.parse(old.Token)
+	rs, e := store.revocationDAO.GetRevocations(claims.Jti)
+	if e != nil || len(rs) != 1 {
+		t.Fatalf("expect the old token revoked, but it's %v, %v", rs, e)
+	}
+	if strings.Contains(rs[0].ReplacedBy+rs[0].Replacement, updated.Token) {
+		t.Errorf("expect the new token not stored")
+	}
+
+	replaced, e := store.Validate(old.Token)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if replaced.Token != updated.Token || !replaced.Value.IsAnonymous() {
+		t.Errorf("expect the old token replaced by the new one, but it's %v", replaced)
+	}
+
+	if e := store.Revoke(updated.Token); e != nil {
+		t.Fatal(e)
+	}
+	if _, e := store.Validate(old.Token); e == nil {
+		t.Errorf("expect the old token invalid after the new one revoked")
+	}
+}
@@ -0,0 +1,362 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"github.com/go-ldap/ldap/v3"
+	"go-drive/common/errors"
+	"go-drive/common/i18n"
+	"go-drive/common/registry"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"go-drive/storage"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	optLDAPEnabled       = "ldap.enabled"
+	optLDAPURL           = "ldap.url"
+	optLDAPStartTLS      = "ldap.start_tls"
+	optLDAPSkipVerify    = "ldap.skip_verify"
+	optLDAPBindDN        = "ldap.bind_dn"
+	optLDAPBindPassword  = "ldap.bind_password"
+	optLDAPBaseDN        = "ldap.base_dn"
+	optLDAPUserFilter    = "ldap.user_filter"
+	optLDAPGroupBaseDN   = "ldap.group_base_dn"
+	optLDAPGroupFilter   = "ldap.group_filter"
+	optLDAPGroupNameAttr = "ldap.group_name_attr"
+	// optLDAPGroupMapping maps directory groups to go-drive groups, see mapExternalGroups
+	optLDAPGroupMapping = "ldap.group_mapping"
+	// optLDAPSyncInterval is the interval of group membership sync, '0' means disabled
+	optLDAPSyncInterval = "ldap.sync_interval"
+
+	defaultLDAPUserFilter    = "(uid={username})"
+	defaultLDAPGroupFilter   = "(&(objectClass=groupOfNames)(member={dn}))"
+	defaultLDAPGroupNameAttr = "cn"
+	defaultLDAPSyncInterval  = time.Hour
+
+	ldapSyncCheckInterval = time.Minute
+
+	// ldapIdentityIssuer is the issuer of the user identities bound to the directory users
+	ldapIdentityIssuer = "ldap"
+)
+
+var ldapOptionKeys = []string{
+	optLDAPEnabled, optLDAPURL, optLDAPStartTLS, optLDAPSkipVerify, optLDAPBindDN, optLDAPBindPassword,
+	optLDAPBaseDN, optLDAPUserFilter, optLDAPGroupBaseDN, optLDAPGroupFilter, optLDAPGroupNameAttr,
+	optLDAPGroupMapping, optLDAPSyncInterval,
+}
+
+// LDAPAuth authenticates users by the LDAP directory,
+// and synchronizes the group membership of the users created by LDAP periodically.
+type LDAPAuth struct {
+	optionsDAO  *storage.OptionsDAO
+	userDAO     *storage.UserDAO
+	groupDAO    *storage.GroupDAO
+	identityDAO *storage.UserIdentityDAO
+
+	lastSync      time.Time
+	lastSyncError error
+	syncedUsers   int
+	mux           *sync.Mutex
+
+	tickerStop func()
+}
+
+func NewLDAPAuth(ch *registry.ComponentsHolder, optionsDAO *storage.OptionsDAO,
+	userDAO *storage.UserDAO, groupDAO *storage.GroupDAO, identityDAO *storage.UserIdentityDAO) *LDAPAuth {
+	l := &LDAPAuth{
+		optionsDAO:  optionsDAO,
+		userDAO:     userDAO,
+		groupDAO:    groupDAO,
+		identityDAO: identityDAO,
+		mux:         &sync.Mutex{},
+	}
+	l.tickerStop = utils.TimeTick(l.syncIfNeeded, ldapSyncCheckInterval)
+	ch.Add("ldapAuth", l)
+	return l
+}
+
+// Login authenticates the user by the directory.
+// It returns nil if LDAP is disabled or the user is not found in the directory,
+// then the local password should be checked.
+func (l *LDAPAuth) Login(username, password string) (*types.User, error) {
+	opts, e := l.getOptions()
+	if e != nil || opts == nil {
+		return nil, e
+	}
+	conn, e := l.connect(opts)
+	if e != nil {
+		// fallback to local users, so that the local admin can still login when the directory is down
+		authLogger.Warn("error when connecting to LDAP server", "error", e)
+		return nil, nil
+	}
+	defer conn.Close()
+
+	entry, e := l.searchUser(conn, opts, username)
+	if e != nil || entry == nil {
+		return nil, e
+	}
+	// the local user with the same name is not taken over by the directory user unless admins link them
+	identity, e := l.identityDAO.Get(ldapIdentityIssuer, username)
+	if e != nil {
+		return nil, e
+	}
+	if conflict, e := isUnlinkedLocalUser(l.userDAO, identity, username); e != nil || conflict {
+		if conflict {
+			authLogger.Warn("LDAP user is not linked to the local user with the same name", "username", username)
+		}
+		return nil, e
+	}
+	// empty password will be an unauthenticated bind, which always succeeds
+	if password == "" {
+		return nil, err.NewBadRequestError(i18n.T("api.auth.invalid_username_or_password"))
+	}
+	if e := conn.Bind(entry.DN, password); e != nil {
+		if ldap.IsErrorWithCode(e, ldap.LDAPResultInvalidCredentials) {
+			return nil, err.NewBadRequestError(i18n.T("api.auth.invalid_username_or_password"))
+		}
+		return nil, e
+	}
+	// rebind with the service account to search groups
+	if e := l.bind(conn, opts); e != nil {
+		return nil, e
+	}
+	groups, e := l.searchGroups(conn, opts, entry.DN, username)
+	if e != nil {
+		return nil, e
+	}
+	user, e := provisionUser(l.userDAO, l.groupDAO, l.identityDAO, ldapIdentity(username, groups))
+	if e != nil {
+		return nil, e
+	}
+	return &user, nil
+}
+
+// Sync synchronizes the groups of the users created by LDAP, and records the result in the status
+func (l *LDAPAuth) Sync() error {
+	e := l.sync()
+	if e != nil {
+		authLogger.Warn("error when syncing LDAP groups", "error", e)
+	}
+	l.mux.Lock()
+	l.lastSync = time.Now()
+	l.lastSyncError = e
+	l.mux.Unlock()
+	return e
+}
+
+func (l *LDAPAuth) sync() error {
+	opts, e := l.getOptions()
+	if e != nil || opts == nil {
+		return e
+	}
+	conn, e := l.connect(opts)
+	if e != nil {
+		return e
+	}
+	defer conn.Close()
+
+	n, e := l.syncIdentities(func(username string) ([]string, bool, error) {
+		entry, e := l.searchUser(conn, opts, username)
+		if e != nil || entry == nil {
+			return nil, false, e
+		}
+		groups, e := l.searchGroups(conn, opts, entry.DN, username)
+		return groups, true, e
+	})
+	l.mux.Lock()
+	l.syncedUsers = n
+	l.mux.Unlock()
+	return e
+}
+
+// syncIdentities synchronizes the groups of the users created by LDAP with the groups returned by lookup.
+// The groups assigned by LDAP are removed from the users no longer found in the directory.
+// The user failed to be synchronized is skipped, so that it doesn't block others.
+func (l *LDAPAuth) syncIdentities(lookup func(username string) ([]string, bool, error)) (int, error) {
+	identities, e := l.identityDAO.ListByIssuer(ldapIdentityIssuer)
+	if e != nil {
+		return 0, e
+	}
+	n, failed := 0, 0
+	for _, identity := range identities {
+		// the local users linked by admins are synchronized when they login
+		if !identity.Provisioned {
+			continue
+		}
+		groups, found, e := lookup(identity.Subject)
+		if e != nil {
+			return n, e
+		}
+		if !found {
+			authLogger.Info("LDAP user not found, removing the groups assigned by LDAP", "username", identity.Subject)
+			groups = []string{}
+		}
+		if _, e := provisionUser(l.userDAO, l.groupDAO, l.identityDAO, ldapIdentity(identity.Subject, groups)); e != nil {
+			authLogger.Warn("error when syncing LDAP user", "username", identity.Subject, "error", e)
+			failed++
+			continue
+		}
+		n++
+	}
+	if failed > 0 {
+		return n, fmt.Errorf("failed to sync %d user(s)", failed)
+	}
+	return n, nil
+}
+
+// ldapIdentity is the identity of the directory user, the subject is the username
+func ldapIdentity(username string, groups []string) externalIdentity {
+	return externalIdentity{issuer: ldapIdentityIssuer, subject: username, username: username, groups: groups}
+}
+
+func (l *LDAPAuth) syncIfNeeded() {
+	opts, e := l.getOptions()
+	if e != nil || opts == nil {
+		return
+	}
+	interval := defaultLDAPSyncInterval
+	if v := opts[optLDAPSyncInterval]; v != "" {
+		interval, e = time.ParseDuration(v)
+		if e != nil || interval <= 0 {
+			return
+		}
+	}
+	l.mux.Lock()
+	needSync := time.Since(l.lastSync) >= interval
+	l.mux.Unlock()
+	if !needSync {
+		return
+	}
+	_ = l.Sync()
+}
+
+// getOptions returns nil if LDAP is disabled
+func (l *LDAPAuth) getOptions() (types.SM, error) {
+	opts, e := l.optionsDAO.Gets(ldapOptionKeys...)
+	if e != nil {
+		return nil, e
+	}
+	if opts[optLDAPEnabled] != "true" || opts[optLDAPURL] == "" {
+		return nil, nil
+	}
+	return opts, nil
+}
+
+func (l *LDAPAuth) connect(opts types.SM) (*ldap.Conn, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: opts[optLDAPSkipVerify] == "true"}
+	conn, e := ldap.DialURL(opts[optLDAPURL], ldap.DialWithTLSConfig(tlsConfig))
+	if e != nil {
+		return nil, e
+	}
+	if opts[optLDAPStartTLS] == "true" {
+		if e := conn.StartTLS(tlsConfig); e != nil {
+			conn.Close()
+			return nil, e
+		}
+	}
+	if e := l.bind(conn, opts); e != nil {
+		conn.Close()
+		return nil, e
+	}
+	return conn, nil
+}
+
+func (l *LDAPAuth) bind(conn *ldap.Conn, opts types.SM) error {
+	if opts[optLDAPBindDN] == "" {
+		return conn.UnauthenticatedBind("")
+	}
+	return conn.Bind(opts[optLDAPBindDN], opts[optLDAPBindPassword])
+}
+
+// searchUser returns nil if the user is not found
+func (l *LDAPAuth) searchUser(conn *ldap.Conn, opts types.SM, username string) (*ldap.Entry, error) {
+	filter := opts[optLDAPUserFilter]
+	if filter == "" {
+		filter = defaultLDAPUserFilter
+	}
+	filter = strings.ReplaceAll(filter, "{username}", ldap.EscapeFilter(username))
+	r, e := conn.Search(ldap.NewSearchRequest(
+		opts[optLDAPBaseDN], ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, 0, false, filter, []string{"dn"}, nil,
+	))
+	if e != nil {
+		if ldap.IsErrorWithCode(e, ldap.LDAPResultNoSuchObject) {
+			return nil, nil
+		}
+		return nil, e
+	}
+	if len(r.Entries) == 0 {
+		return nil, nil
+	}
+	if len(r.Entries) > 1 {
+		return nil, fmt.Errorf("multiple entries found for user '%s'", username)
+	}
+	return r.Entries[0], nil
+}
+
+// searchGroups returns the go-drive groups of the user
+func (l *LDAPAuth) searchGroups(conn *ldap.Conn, opts types.SM, dn, username string) ([]string, error) {
+	baseDN := opts[optLDAPGroupBaseDN]
+	if baseDN == "" {
+		baseDN = opts[optLDAPBaseDN]
+	}
+	filter := opts[optLDAPGroupFilter]
+	if filter == "" {
+		filter = defaultLDAPGroupFilter
+	}
+	nameAttr := opts[optLDAPGroupNameAttr]
+	if nameAttr == "" {
+		nameAttr = defaultLDAPGroupNameAttr
+	}
+	filter = strings.ReplaceAll(filter, "{dn}", ldap.EscapeFilter(dn))
+	filter = strings.ReplaceAll(filter, "{username}", ldap.EscapeFilter(username))
+	r, e := conn.Search(ldap.NewSearchRequest(
+		baseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		0, 0, false, filter, []string{nameAttr}, nil,
+	))
+	if e != nil {
+		return nil, e
+	}
+	groups := make([]string, 0, len(r.Entries))
+	for _, entry := range r.Entries {
+		if name := entry.GetAttributeValue(nameAttr); name != "" {
+			groups = append(groups, name)
+		}
+	}
+	return mapExternalGroups(l.groupDAO, groups, opts[optLDAPGroupMapping])
+}
+
+func (l *LDAPAuth) Status() (string, types.SM, error) {
+	opts, e := l.getOptions()
+	if e != nil {
+		return "", nil, e
+	}
+	if opts == nil {
+		return "LDAP", types.SM{"Enabled": "false"}, nil
+	}
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	lastSync := "-"
+	if !l.lastSync.IsZero() {
+		lastSync = l.lastSync.Format(time.RubyDate)
+	}
+	lastError := "-"
+	if l.lastSyncError != nil {
+		lastError = l.lastSyncError.Error()
+	}
+	return "LDAP", types.SM{
+		"Enabled":       "true",
+		"LastSync":      lastSync,
+		"LastSyncError": lastError,
+		"SyncedUsers":   fmt.Sprintf("%d", l.syncedUsers),
+	}, nil
+}
+
+func (l *LDAPAuth) Dispose() error {
+	l.tickerStop()
+	return nil
+}
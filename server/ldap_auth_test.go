@@ -0,0 +1,57 @@
+package server
+
+import (
+	"go-drive/common/types"
+	"go-drive/storage"
+	"sync"
+	"testing"
+)
+
+func TestLDAPSyncIdentities(t *testing.T) {
+	db, _, cleanup := newTestDB(t)
+	defer cleanup()
+	userDAO := storage.NewUserDAO(db)
+	groupDAO := storage.NewGroupDAO(db)
+	identityDAO := storage.NewUserIdentityDAO(db)
+	l := &LDAPAuth{userDAO: userDAO, groupDAO: groupDAO, identityDAO: identityDAO, mux: &sync.Mutex{}}
+
+	for _, u := range []struct {
+		name   string
+		groups []string
+	}{{"bob", []string{"admin"}}, {"carol", []string{"dev"}}, {"dave", []string{"dev"}}} {
+		if _, e := provisionUser(userDAO, groupDAO, identityDAO, ldapIdentity(u.name, u.groups)); e != nil {
+			t.Fatal(e)
+		}
+	}
+	// the identity of dave is left without the user, which fails to be synchronized
+	if e := db.C().Delete(types.User{}, "username = ?", "dave").Error; e != nil {
+		t.Fatal(e)
+	}
+
+	directory := map[string][]string{"carol": {"ops"}}
+	n, e := l.syncIdentities(func(username string) ([]string, bool, error) {
+		groups, ok := directory[username]
+		return groups, ok, nil
+	})
+	if e == nil {
+		t.Errorf("expect error of the failed user")
+	}
+	if n != 2 {
+		t.Errorf("expect 2 users synced, but it's %d", n)
+	}
+
+	bob, e := userDAO.GetUser("bob")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if groupNames(bob) != "" {
+		t.Errorf("expect groups of the removed user cleared, but it's '%s'", groupNames(bob))
+	}
+	carol, e := userDAO.GetUser("carol")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if groupNames(carol) != "ops" {
+		t.Errorf("expect groups 'ops', but it's '%s'", groupNames(carol))
+	}
+}
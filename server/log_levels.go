@@ -0,0 +1,69 @@
+package server
+
+import (
+	"go-drive/common/errors"
+	"go-drive/common/i18n"
+	"go-drive/common/logging"
+)
+
+type logLevels struct {
+	// Default is the level of the subsystems that are not set
+	Default string `json:"default"`
+	// Levels are the effective levels of all subsystems
+	Levels map[string]string `json:"levels"`
+	// Overrides are the levels set explicitly
+	Overrides map[string]string `json:"overrides"`
+}
+
+type logLevelsRequest struct {
+	Default string `json:"default"`
+	// Levels sets the levels of the subsystems, empty level resets the subsystem to the default level
+	Levels map[string]string `json:"levels"`
+}
+
+func getLogLevels() logLevels {
+	def, levels, overrides := logging.Levels()
+	result := logLevels{
+		Default:   def.String(),
+		Levels:    make(map[string]string, len(levels)),
+		Overrides: make(map[string]string, len(overrides)),
+	}
+	for k, v := range levels {
+		result.Levels[k] = v.String()
+	}
+	for k, v := range overrides {
+		result.Overrides[k] = v.String()
+	}
+	return result
+}
+
+// setLogLevels validates all the levels before applying them
+func setLogLevels(req logLevelsRequest) error {
+	var def *logging.Level
+	if req.Default != "" {
+		l, e := logging.ParseLevel(req.Default)
+		if e != nil {
+			return err.NewBadRequestError(i18n.T("api.admin.invalid_log_level", req.Default))
+		}
+		def = &l
+	}
+	levels := make(map[string]*logging.Level, len(req.Levels))
+	for subsystem, level := range req.Levels {
+		if level == "" {
+			levels[subsystem] = nil
+			continue
+		}
+		l, e := logging.ParseLevel(level)
+		if e != nil {
+			return err.NewBadRequestError(i18n.T("api.admin.invalid_log_level", level))
+		}
+		levels[subsystem] = &l
+	}
+	if def != nil {
+		logging.SetDefaultLevel(*def)
+	}
+	for subsystem, level := range levels {
+		logging.SetLevel(subsystem, level)
+	}
+	return nil
+}
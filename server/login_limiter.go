@@ -0,0 +1,248 @@
+package server
+
+import (
+	"fmt"
+	"go-drive/common/errors"
+	"go-drive/common/i18n"
+	"go-drive/common/registry"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	LockoutTypeUser = "user"
+	LockoutTypeIP   = "ip"
+
+	// failures of an username before locked
+	loginMaxUserFailures = 5
+	// failures of a client ip before locked, it's larger because users may share the same ip
+	loginMaxIPFailures = 20
+
+	// the lockout duration is doubled for each failure after locked
+	loginLockoutBase = time.Minute
+	loginLockoutMax  = time.Hour
+	// failures are forgotten after this duration since the last failure
+	loginFailureWindow = 24 * time.Hour
+
+	loginLimiterCleanInterval = 5 * time.Minute
+	// maximum tracked usernames and ips, the oldest unlocked record is evicted when exceeded,
+	// so that the failures of random usernames and ips can't exhaust the memory
+	loginLimiterMaxRecords = 10000
+)
+
+type LoginLockout struct {
+	Type        string `json:"type"`
+	Value       string `json:"value"`
+	Failures    int    `json:"failures"`
+	LastFailure int64  `json:"last_failure"`
+	// LockedUntil is 0 if not locked
+	LockedUntil int64 `json:"locked_until"`
+}
+
+type loginFailure struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+type lockoutKey struct {
+	t string
+	v string
+}
+
+// LoginLimiter tracks the failed login attempts by username and client ip,
+// and locks them out temporarily with exponential backoff.
+type LoginLimiter struct {
+	records map[lockoutKey]*loginFailure
+	mux     *sync.Mutex
+
+	lockoutEvents int64
+	lastLockout   time.Time
+
+	tickerStop func()
+}
+
+func NewLoginLimiter(ch *registry.ComponentsHolder) *LoginLimiter {
+	l := &LoginLimiter{
+		records: make(map[lockoutKey]*loginFailure),
+		mux:     &sync.Mutex{},
+	}
+	l.tickerStop = utils.TimeTick(l.clean, loginLimiterCleanInterval)
+	ch.Add("loginLimiter", l)
+	return l
+}
+
+// Check returns error if the username or the ip is locked
+func (l *LoginLimiter) Check(username, ip string) error {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	now := time.Now()
+	var lockedUntil time.Time
+	for _, k := range loginKeys(username, ip) {
+		r, ok := l.records[k]
+		if ok && r.lockedUntil.After(lockedUntil) {
+			lockedUntil = r.lockedUntil
+		}
+	}
+	if !lockedUntil.After(now) {
+		return nil
+	}
+	retryAfter := int(math.Ceil(lockedUntil.Sub(now).Seconds()))
+	return err.NewTooManyRequestsError(i18n.T("api.auth.too_many_attempts", fmt.Sprintf("%d", retryAfter)), retryAfter)
+}
+
+// Fail records a failed attempt
+func (l *LoginLimiter) Fail(username, ip string) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	now := time.Now()
+	for _, k := range loginKeys(username, ip) {
+		r, ok := l.records[k]
+		if !ok || now.Sub(r.lastFailure) > loginFailureWindow {
+			if !ok && len(l.records) >= loginLimiterMaxRecords {
+				l.evict(now)
+			}
+			r = &loginFailure{}
+			l.records[k] = r
+		}
+		r.failures++
+		r.lastFailure = now
+		max := loginMaxUserFailures
+		if k.t == LockoutTypeIP {
+			max = loginMaxIPFailures
+		}
+		if r.failures < max {
+			continue
+		}
+		r.lockedUntil = now.Add(lockoutDuration(r.failures - max))
+		l.lockoutEvents++
+		l.lastLockout = now
+		authLogger.Warn("login locked", "type", k.t, "value", k.v,
+			"until", r.lockedUntil.Format(time.RFC3339), "failures", r.failures)
+	}
+}
+
+// Succeed clears the failures of the username
+func (l *LoginLimiter) Succeed(username string) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	delete(l.records, lockoutKey{LockoutTypeUser, username})
+}
+
+// List returns the tracked usernames and ips
+func (l *LoginLimiter) List() []LoginLockout {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	now := time.Now()
+	result := make([]LoginLockout, 0, len(l.records))
+	for k, r := range l.records {
+		item := LoginLockout{
+			Type:        k.t,
+			Value:       k.v,
+			Failures:    r.failures,
+			LastFailure: utils.Millisecond(r.lastFailure),
+		}
+		if r.lockedUntil.After(now) {
+			item.LockedUntil = utils.Millisecond(r.lockedUntil)
+		}
+		result = append(result, item)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].LastFailure > result[j].LastFailure
+	})
+	return result
+}
+
+// Clear removes the record of the username or ip, all records will be removed if t is empty
+func (l *LoginLimiter) Clear(t, value string) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if t == "" {
+		l.records = make(map[lockoutKey]*loginFailure)
+		return
+	}
+	delete(l.records, lockoutKey{t, value})
+}
+
+func (l *LoginLimiter) clean() {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	l.removeExpired(time.Now())
+}
+
+func (l *LoginLimiter) removeExpired(now time.Time) {
+	for k, r := range l.records {
+		if now.Sub(r.lastFailure) > loginFailureWindow && !r.lockedUntil.After(now) {
+			delete(l.records, k)
+		}
+	}
+}
+
+// evict removes the expired records, and then a tenth of the oldest records if it's still full.
+// The unlocked records are evicted before the locked ones.
+func (l *LoginLimiter) evict(now time.Time) {
+	l.removeExpired(now)
+	if len(l.records) < loginLimiterMaxRecords {
+		return
+	}
+	keys := make([]lockoutKey, 0, len(l.records))
+	for k := range l.records {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := l.records[keys[i]], l.records[keys[j]]
+		if aLocked, bLocked := a.lockedUntil.After(now), b.lockedUntil.After(now); aLocked != bLocked {
+			return bLocked
+		}
+		return a.lastFailure.Before(b.lastFailure)
+	})
+	for _, k := range keys[:len(keys)/10+1] {
+		delete(l.records, k)
+	}
+}
+
+func (l *LoginLimiter) Status() (string, types.SM, error) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	now := time.Now()
+	locked := 0
+	for _, r := range l.records {
+		if r.lockedUntil.After(now) {
+			locked++
+		}
+	}
+	lastLockout := "-"
+	if !l.lastLockout.IsZero() {
+		lastLockout = l.lastLockout.Format(time.RubyDate)
+	}
+	return "Login", types.SM{
+		"Tracked":       fmt.Sprintf("%d", len(l.records)),
+		"Locked":        fmt.Sprintf("%d", locked),
+		"LockoutEvents": fmt.Sprintf("%d", l.lockoutEvents),
+		"LastLockout":   lastLockout,
+	}, nil
+}
+
+func (l *LoginLimiter) Dispose() error {
+	l.tickerStop()
+	return nil
+}
+
+func loginKeys(username, ip string) []lockoutKey {
+	return []lockoutKey{{LockoutTypeUser, username}, {LockoutTypeIP, ip}}
+}
+
+func lockoutDuration(n int) time.Duration {
+	if n >= 6 {
+		return loginLockoutMax
+	}
+	d := loginLockoutBase << uint(n)
+	if d > loginLockoutMax {
+		d = loginLockoutMax
+	}
+	return d
+}
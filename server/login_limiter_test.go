@@ -0,0 +1,47 @@
+package server
+
+import (
+	"fmt"
+	"go-drive/common/registry"
+	"testing"
+)
+
+func TestLoginLimiterLockout(t *testing.T) {
+	l := NewLoginLimiter(registry.NewComponentHolder())
+	defer func() { _ = l.Dispose() }()
+
+	for i := 0; i < loginMaxUserFailures; i++ {
+		if e := l.Check("alice", "1.2.3.4"); e != nil {
+			t.Fatalf("expect not locked before %d failures, but it's %v", loginMaxUserFailures, e)
+		}
+		l.Fail("alice", "1.2.3.4")
+	}
+	if l.Check("alice", "5.6.7.8") == nil {
+		t.Errorf("expect the username locked")
+	}
+	if e := l.Check("bob", "1.2.3.4"); e != nil {
+		t.Errorf("expect the ip not locked, but it's %v", e)
+	}
+	l.Clear(LockoutTypeUser, "alice")
+	if e := l.Check("alice", "1.2.3.4"); e != nil {
+		t.Errorf("expect the username unlocked, but it's %v", e)
+	}
+}
+
+func TestLoginLimiterMaxRecords(t *testing.T) {
+	l := NewLoginLimiter(registry.NewComponentHolder())
+	defer func() { _ = l.Dispose() }()
+
+	for i := 0; i < loginMaxUserFailures; i++ {
+		l.Fail("alice", "1.2.3.4")
+	}
+	for i := 0; i < loginLimiterMaxRecords; i++ {
+		l.Fail(fmt.Sprintf("user%d", i), fmt.Sprintf("10.0.%d.%d", i/256, i%256))
+	}
+	if n := len(l.List()); n > loginLimiterMaxRecords {
+		t.Errorf("expect at most %d records, but it's %d", loginLimiterMaxRecords, n)
+	}
+	if l.Check("alice", "5.6.7.8") == nil {
+		t.Errorf("expect the locked username not evicted")
+	}
+}
@@ -7,7 +7,6 @@ import (
 	"go-drive/common/i18n"
 	"go-drive/common/types"
 	"go-drive/common/utils"
-	"log"
 	"sync"
 	"time"
 )
@@ -46,6 +45,7 @@ func NewMemTokenStore(validity time.Duration, autoRefresh bool, cleanupDuration
 
 func (m *MemTokenStore) Create(value types.Session) (types.Token, error) {
 	key := uuid.New().String()
+	value.Touch(time.Now())
 	var expiredAt int64 = -1
 	if m.validity > 0 {
 		expiredAt = time.Now().Add(m.validity).Unix()
@@ -72,10 +72,8 @@ func (m *MemTokenStore) Update(token string, value types.Session) (types.Token,
 }
 
 func (m *MemTokenStore) Validate(token string) (types.Token, error) {
-	if m.refreshEnabled() {
-		m.mux.Lock()
-		defer m.mux.Unlock()
-	}
+	m.mux.Lock()
+	defer m.mux.Unlock()
 	t, ok := m.store.Get(token)
 	if !ok {
 		return types.Token{}, err.NewUnauthorizedError(i18n.T("api.mem_token.invalid_token"))
@@ -84,8 +82,11 @@ func (m *MemTokenStore) Validate(token string) (types.Token, error) {
 	if !m.isValid(tt) {
 		return types.Token{}, err.NewUnauthorizedError(i18n.T("api.mem_token.invalid_token"))
 	}
+	touched := tt.Value.Touch(time.Now())
 	if m.refreshEnabled() {
 		tt.ExpiredAt = time.Now().Add(m.validity).Unix()
+	}
+	if touched || m.refreshEnabled() {
 		m.store.Set(token, tt)
 	}
 	return tt, nil
@@ -96,6 +97,17 @@ func (m *MemTokenStore) Revoke(token string) error {
 	return nil
 }
 
+func (m *MemTokenStore) List(username string) ([]types.Token, error) {
+	tokens := make([]types.Token, 0)
+	m.store.IterCb(func(key string, v interface{}) {
+		t := v.(types.Token)
+		if m.isValid(t) && t.Value.BelongsTo(username) {
+			tokens = append(tokens, t)
+		}
+	})
+	return tokens, nil
+}
+
 func (m *MemTokenStore) isValid(token types.Token) bool {
 	return token.ExpiredAt <= 0 || token.ExpiredAt > time.Now().Unix()
 }
@@ -114,7 +126,7 @@ func (m *MemTokenStore) clean() {
 	for _, key := range keys {
 		_ = m.Revoke(key)
 	}
-	log.Printf("%d expired tokens cleaned", len(keys))
+	tokenLogger.Debug("expired tokens cleaned", "count", len(keys))
 }
 
 func (m *MemTokenStore) Dispose() error {
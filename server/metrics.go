@@ -0,0 +1,61 @@
+package server
+
+import (
+	"crypto/subtle"
+	"github.com/gin-gonic/gin"
+	"go-drive/common/metrics"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Metrics records the count, latency and transferred bytes of requests by route
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if route == "" {
+			// NoRoute static files
+			c.Next()
+			return
+		}
+		start := time.Now()
+		body := &countingBody{ReadCloser: c.Request.Body}
+		if c.Request.Body != nil {
+			c.Request.Body = body
+		}
+		c.Next()
+		metrics.ObserveHttpRequest(c.Request.Method, route, c.Writer.Status(), start,
+			body.n, int64(c.Writer.Size()))
+	}
+}
+
+// metricsHandler serves the metrics
+func metricsHandler() gin.HandlerFunc {
+	h := metrics.Handler()
+	return func(c *gin.Context) {
+		h.ServeHTTP(c.Writer, c.Request)
+	}
+}
+
+// metricsTokenRequired requires the bearer token configured for the scrapers
+func metricsTokenRequired(token string) gin.HandlerFunc {
+	expected := []byte("Bearer " + token)
+	return func(c *gin.Context) {
+		if subtle.ConstantTimeCompare([]byte(c.GetHeader("Authorization")), expected) != 1 {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		c.Next()
+	}
+}
+
+type countingBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, e := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	return n, e
+}
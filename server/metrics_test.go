@@ -0,0 +1,52 @@
+package server
+
+import (
+	"github.com/gin-gonic/gin"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	engine := gin.New()
+	engine.Use(Metrics())
+	engine.POST("/metrics-test/:id", func(c *gin.Context) {
+		// the request bytes are counted when they are read
+		_, _ = ioutil.ReadAll(c.Request.Body)
+		c.String(http.StatusOK, "hello")
+	})
+	engine.GET("/metrics", metricsTokenRequired("secret"), metricsHandler())
+
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest("POST", "/metrics-test/1", strings.NewReader("body")))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expect 200, but it's %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expect 401 without the token, but it's %d", w.Code)
+	}
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expect 200 with the token, but it's %d", w.Code)
+	}
+	body := w.Body.String()
+	for _, expected := range []string{
+		// recorded by route rather than the path
+		`go_drive_http_requests_total{code="200",method="POST",route="/metrics-test/:id"} 1`,
+		`go_drive_http_bytes_total{direction="upload",route="/metrics-test/:id"} 4`,
+		`go_drive_http_bytes_total{direction="download",route="/metrics-test/:id"} 5`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("expect '%s' in the metrics", expected)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package server
+
+import (
+	"errors"
+	"go-drive/common"
+	"go-drive/common/errors"
+	"go-drive/common/i18n"
+	"go-drive/common/logging"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"go-drive/storage"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// optOfflineDownloadAllowedNetworks is the comma separated CIDRs,
+	// which are allowed to be downloaded from even if they are private networks
+	optOfflineDownloadAllowedNetworks = "offline_download.allowed_networks"
+	// optOfflineDownloadMaxSize is the maximum size in bytes of the downloaded file, '0' or empty means unlimited
+	optOfflineDownloadMaxSize = "offline_download.max_size"
+
+	offlineDownloadDialTimeout   = 30 * time.Second
+	offlineDownloadHeaderTimeout = time.Minute
+	offlineDownloadIdleTimeout   = 90 * time.Second
+	offlineDownloadMaxRedirects  = 10
+)
+
+var offlineDownloadLogger = logging.For("offline_download")
+
+// OfflineDownloader downloads the files from the URLs supplied by users.
+// The requests to the loopback, private and other special-purpose networks are refused,
+// unless they are in the allowed networks configured by admins.
+type OfflineDownloader struct {
+	tempDir    string
+	optionsDAO *storage.OptionsDAO
+
+	// client is reused until the allowed networks are changed
+	client          *http.Client
+	allowedNetworks string
+	mux             *sync.Mutex
+}
+
+type offlineDownloadRequest struct {
+	URL      string   `json:"url" binding:"required"`
+	Path     string   `json:"path" binding:"required"`
+	Override bool     `json:"override"`
+	Headers  types.SM `json:"headers"`
+}
+
+// offlineDownloadResponse is the body of the response,
+// reading fails if the response is truncated or exceeds the max size
+type offlineDownloadResponse struct {
+	url  string
+	body io.ReadCloser
+	// size is -1 if it's unknown
+	size    int64
+	maxSize int64
+	read    int64
+}
+
+func NewOfflineDownloader(config common.Config, optionsDAO *storage.OptionsDAO) *OfflineDownloader {
+	return &OfflineDownloader{tempDir: config.TempDir, optionsDAO: optionsDAO, mux: &sync.Mutex{}}
+}
+
+// Open requests the url, the response should be closed by the caller.
+// The response can be streamed to the drive if its size is known, the truncated response fails the reading.
+func (o *OfflineDownloader) Open(ctx types.TaskCtx, u string, header types.SM) (*offlineDownloadResponse, error) {
+	if e := checkOfflineDownloadURL(u); e != nil {
+		return nil, e
+	}
+	opts, e := o.optionsDAO.Gets(optOfflineDownloadAllowedNetworks, optOfflineDownloadMaxSize)
+	if e != nil {
+		return nil, e
+	}
+	client, e := o.getClient(opts[optOfflineDownloadAllowedNetworks])
+	if e != nil {
+		return nil, e
+	}
+	maxSize := utils.ToInt64(opts[optOfflineDownloadMaxSize], 0)
+
+	req, e := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if e != nil {
+		return nil, err.NewBadRequestError(i18n.T("api.offline_download.invalid_url"))
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, e := client.Do(req)
+	if e != nil {
+		if errors.Is(e, utils.ErrAddressNotAllowed) {
+			return nil, err.NewNotAllowedMessageError(i18n.T("api.offline_download.address_not_allowed"))
+		}
+		// the error returned by CheckRedirect
+		if ue, ok := e.(*url.Error); ok {
+			if re, ok := ue.Err.(err.RequestError); ok {
+				return nil, re
+			}
+		}
+		return nil, e
+	}
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		// not RemoteApiError, whose status code prefix breaks the translation of the task error
+		return nil, err.NewBadRequestError(i18n.T("util.request_failed", strconv.Itoa(resp.StatusCode)))
+	}
+	if maxSize > 0 && resp.ContentLength > maxSize {
+		_ = resp.Body.Close()
+		return nil, sizeExceededError(maxSize)
+	}
+	if resp.ContentLength >= 0 {
+		ctx.Total(resp.ContentLength, true)
+	}
+	return &offlineDownloadResponse{url: u, body: resp.Body, size: resp.ContentLength, maxSize: maxSize}, nil
+}
+
+// Download downloads the response to a temp file, which should be removed by the caller.
+// The response of unknown size can only be downloaded if the max size is configured,
+// so that the temp file is limited.
+func (o *OfflineDownloader) Download(ctx types.TaskCtx, resp *offlineDownloadResponse) (*os.File, error) {
+	if resp.size < 0 && resp.maxSize <= 0 {
+		return nil, err.NewNotAllowedMessageError(i18n.T("api.offline_download.size_unknown"))
+	}
+	file, e := ioutil.TempFile(o.tempDir, "offline-download")
+	if e != nil {
+		return nil, e
+	}
+	written, e := io.Copy(file, &taskProgressReader{ctx: ctx, r: resp})
+	if e != nil {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+		return nil, e
+	}
+	offlineDownloadLogger.Ctx(ctx).Info("file downloaded", "url", resp.url, "size", written)
+	return file, nil
+}
+
+func (r *offlineDownloadResponse) Read(p []byte) (int, error) {
+	n, e := r.body.Read(p)
+	r.read += int64(n)
+	if r.maxSize > 0 && r.read > r.maxSize {
+		return n, sizeExceededError(r.maxSize)
+	}
+	if e == io.EOF && r.size >= 0 && r.read != r.size {
+		return n, io.ErrUnexpectedEOF
+	}
+	return n, e
+}
+
+func (r *offlineDownloadResponse) Close() error {
+	return r.body.Close()
+}
+
+func sizeExceededError(maxSize int64) error {
+	return err.NewNotAllowedMessageError(i18n.T("api.offline_download.size_exceeded", utils.FormatBytes(uint64(maxSize), 2)))
+}
+
+// getClient returns the client which only connects to the public or allowed networks.
+// The client is reused, so that the idle connections are closed by its transport.
+func (o *OfflineDownloader) getClient(allowedNetworks string) (*http.Client, error) {
+	o.mux.Lock()
+	defer o.mux.Unlock()
+	if o.client != nil && o.allowedNetworks == allowedNetworks {
+		return o.client, nil
+	}
+	allowed, e := utils.ParseCIDRs(allowedNetworks)
+	if e != nil {
+		return nil, e
+	}
+	if o.client != nil {
+		o.client.CloseIdleConnections()
+	}
+	o.client = newOfflineDownloadClient(allowed)
+	o.allowedNetworks = allowedNetworks
+	return o.client, nil
+}
+
+func newOfflineDownloadClient(allowed []*net.IPNet) *http.Client {
+	dialer := utils.GuardedDialer(&net.Dialer{Timeout: offlineDownloadDialTimeout}, allowed)
+	return &http.Client{
+		Transport: &http.Transport{
+			// the proxy is not used, or the address of the proxy is checked rather than the target
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   offlineDownloadDialTimeout,
+			ResponseHeaderTimeout: offlineDownloadHeaderTimeout,
+			IdleConnTimeout:       offlineDownloadIdleTimeout,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= offlineDownloadMaxRedirects {
+				return err.NewNotAllowedMessageError(i18n.T("api.offline_download.too_many_redirects"))
+			}
+			return checkOfflineDownloadURL(req.URL.String())
+		},
+	}
+}
+
+func checkOfflineDownloadURL(u string) error {
+	parsed, e := url.Parse(u)
+	if e != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return err.NewBadRequestError(i18n.T("api.offline_download.invalid_url"))
+	}
+	return nil
+}
+
+// taskProgressReader reports the progress of reading to the task
+type taskProgressReader struct {
+	ctx types.TaskCtx
+	r   io.Reader
+}
+
+func (t *taskProgressReader) Read(p []byte) (int, error) {
+	n, e := t.r.Read(p)
+	if n > 0 {
+		t.ctx.Progress(int64(n), false)
+	}
+	return n, e
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"go-drive/common/task"
+	"go-drive/common/types"
+	"go-drive/storage"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestOfflineDownload(t *testing.T) {
+	db, config, cleanup := newTestDB(t)
+	defer cleanup()
+	optionsDAO := storage.NewOptionsDAO(db)
+	o := NewOfflineDownloader(config, optionsDAO)
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/file":
+			w.Header().Set("Content-Length", "5")
+			_, _ = w.Write([]byte("hello"))
+		case "/truncated":
+			w.Header().Set("Content-Length", "10")
+			_, _ = w.Write([]byte("hello"))
+		case "/chunked":
+			_, _ = w.Write([]byte("hello"))
+			w.(http.Flusher).Flush()
+			_, _ = w.Write([]byte(" world"))
+		}
+	}))
+	defer s.Close()
+
+	if _, e := o.Open(task.DummyContext(), s.URL+"/file", nil); e == nil {
+		t.Errorf("expect the loopback address refused")
+	}
+	if e := optionsDAO.Sets(types.SM{optOfflineDownloadAllowedNetworks: "127.0.0.0/8"}); e != nil {
+		t.Fatal(e)
+	}
+
+	// streamed
+	read := func(path string) (string, error) {
+		resp, e := o.Open(task.DummyContext(), s.URL+path, nil)
+		if e != nil {
+			return "", e
+		}
+		defer func() { _ = resp.Close() }()
+		b, e := ioutil.ReadAll(resp)
+		return string(b), e
+	}
+	if content, e := read("/file"); e != nil || content != "hello" {
+		t.Errorf("expect 'hello', but it's '%s', %v", content, e)
+	}
+	if _, e := read("/truncated"); e == nil {
+		t.Errorf("expect error of the truncated response")
+	}
+	client := o.client
+	if _, e := read("/file"); e != nil {
+		t.Fatal(e)
+	}
+	if o.client != client {
+		t.Errorf("expect the client reused")
+	}
+
+	// the response of unknown size requires the max size to be downloaded
+	resp, e := o.Open(task.DummyContext(), s.URL+"/chunked", nil)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if resp.size >= 0 {
+		t.Errorf("expect unknown size, but it's %d", resp.size)
+	}
+	if _, e := o.Download(task.DummyContext(), resp); e == nil {
+		t.Errorf("expect the response of unknown size refused")
+	}
+	_ = resp.Close()
+
+	if e := optionsDAO.Sets(types.SM{optOfflineDownloadMaxSize: "5"}); e != nil {
+		t.Fatal(e)
+	}
+	resp, e = o.Open(task.DummyContext(), s.URL+"/chunked", nil)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if _, e := o.Download(task.DummyContext(), resp); e == nil || !strings.Contains(e.Error(), "size") {
+		t.Errorf("expect the size exceeded, but it's %v", e)
+	}
+	_ = resp.Close()
+
+	if e := optionsDAO.Sets(types.SM{optOfflineDownloadMaxSize: "100"}); e != nil {
+		t.Fatal(e)
+	}
+	resp, e = o.Open(task.DummyContext(), s.URL+"/chunked", nil)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() { _ = resp.Close() }()
+	file, e := o.Download(task.DummyContext(), resp)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+	}()
+	if b, e := ioutil.ReadFile(file.Name()); e != nil || string(b) != "hello world" {
+		t.Errorf("expect 'hello world' downloaded, but it's '%s', %v", b, e)
+	}
+}
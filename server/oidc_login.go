@@ -0,0 +1,264 @@
+package server
+
+import (
+	"context"
+	cmap "github.com/orcaman/concurrent-map"
+	"go-drive/common/errors"
+	"go-drive/common/i18n"
+	"go-drive/common/oidc"
+	"go-drive/common/registry"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"go-drive/storage"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	optOIDCEnabled       = "oidc.enabled"
+	optOIDCIssuer        = "oidc.issuer"
+	optOIDCClientID      = "oidc.client_id"
+	optOIDCClientSecret  = "oidc.client_secret"
+	optOIDCRedirectURI   = "oidc.redirect_uri"
+	optOIDCScopes        = "oidc.scopes"
+	optOIDCUsernameClaim = "oidc.username_claim"
+	optOIDCGroupsClaim   = "oidc.groups_claim"
+	// optOIDCGroupMapping maps IdP groups to go-drive groups, see mapExternalGroups
+	optOIDCGroupMapping = "oidc.group_mapping"
+
+	oidcLoginValidity  = 10 * time.Minute
+	oidcProviderMaxAge = time.Hour
+)
+
+var oidcOptionKeys = []string{
+	optOIDCEnabled, optOIDCIssuer, optOIDCClientID, optOIDCClientSecret, optOIDCRedirectURI,
+	optOIDCScopes, optOIDCUsernameClaim, optOIDCGroupsClaim, optOIDCGroupMapping,
+}
+
+// OIDCLogin implements the OpenID Connect authorization code flow with PKCE.
+// The authenticated user is created just-in-time and bound to the IdP account by the issuer and subject,
+// and the IdP groups are mapped to go-drive groups.
+type OIDCLogin struct {
+	optionsDAO  *storage.OptionsDAO
+	userDAO     *storage.UserDAO
+	groupDAO    *storage.GroupDAO
+	identityDAO *storage.UserIdentityDAO
+	tokenStore  types.TokenStore
+	twoFactor   *TwoFactorAuth
+
+	// pending maps state to *oidcPendingLogin
+	pending cmap.ConcurrentMap
+
+	provider    *oidc.Provider
+	providerKey string
+	providerAt  time.Time
+	mux         *sync.Mutex
+
+	tickerStop func()
+}
+
+type oidcPendingLogin struct {
+	// token is the session token that will be logged in
+	token        string
+	nonce        string
+	codeVerifier string
+	redirect     string
+	expiresAt    time.Time
+}
+
+func NewOIDCLogin(ch *registry.ComponentsHolder, optionsDAO *storage.OptionsDAO,
+	userDAO *storage.UserDAO, groupDAO *storage.GroupDAO, identityDAO *storage.UserIdentityDAO,
+	tokenStore types.TokenStore, twoFactor *TwoFactorAuth) *OIDCLogin {
+	o := &OIDCLogin{
+		optionsDAO:  optionsDAO,
+		userDAO:     userDAO,
+		groupDAO:    groupDAO,
+		identityDAO: identityDAO,
+		tokenStore:  tokenStore,
+		twoFactor:   twoFactor,
+		pending:     cmap.New(),
+		mux:         &sync.Mutex{},
+	}
+	o.tickerStop = utils.TimeTick(o.clean, oidcLoginValidity)
+	ch.Add("oidcLogin", o)
+	return o
+}
+
+func (o *OIDCLogin) Enabled() (bool, error) {
+	v, e := o.optionsDAO.Get(optOIDCEnabled)
+	return v == "true", e
+}
+
+// Start starts the login flow of the session token, returns the URL of the IdP login page.
+// defaultRedirectURI is used when option 'oidc.redirect_uri' is not set,
+// redirect is the page to redirect to after logged in.
+func (o *OIDCLogin) Start(ctx context.Context, token, defaultRedirectURI, redirect string) (string, error) {
+	p, _, e := o.getProvider(ctx, defaultRedirectURI)
+	if e != nil {
+		return "", e
+	}
+	state, e := oidc.NewRandomValue()
+	if e != nil {
+		return "", e
+	}
+	nonce, e := oidc.NewRandomValue()
+	if e != nil {
+		return "", e
+	}
+	codeVerifier, e := oidc.NewRandomValue()
+	if e != nil {
+		return "", e
+	}
+	o.pending.Set(state, &oidcPendingLogin{
+		token:        token,
+		nonce:        nonce,
+		codeVerifier: codeVerifier,
+		redirect:     redirect,
+		expiresAt:    time.Now().Add(oidcLoginValidity),
+	})
+	return p.AuthCodeURL(state, nonce, codeVerifier), nil
+}
+
+// Callback completes the login flow, returns the page to redirect to
+func (o *OIDCLogin) Callback(ctx context.Context, state, code, defaultRedirectURI string) (string, error) {
+	v, ok := o.pending.Pop(state)
+	if !ok {
+		return "", err.NewBadRequestError(i18n.T("oauth.state_mismatch"))
+	}
+	pl := v.(*oidcPendingLogin)
+	if pl.expiresAt.Before(time.Now()) {
+		return "", err.NewBadRequestError(i18n.T("oauth.state_mismatch"))
+	}
+	p, opts, e := o.getProvider(ctx, defaultRedirectURI)
+	if e != nil {
+		return "", e
+	}
+	idToken, e := p.Exchange(ctx, code, pl.codeVerifier, pl.nonce)
+	if e != nil {
+		authLogger.Ctx(ctx).Warn("error when exchanging OIDC code", "error", e)
+		return "", err.NewUnauthorizedError(i18n.T("api.oidc.login_failed"))
+	}
+
+	usernameClaim := opts[optOIDCUsernameClaim]
+	if usernameClaim == "" {
+		usernameClaim = "preferred_username"
+	}
+	username := idToken.StringClaim(usernameClaim)
+	if username == "" {
+		return "", err.NewUnauthorizedError(i18n.T("api.oidc.missing_username_claim", usernameClaim))
+	}
+	groups, e := o.mapGroups(idToken, opts)
+	if e != nil {
+		return "", e
+	}
+	user, e := provisionUser(o.userDAO, o.groupDAO, o.identityDAO, externalIdentity{
+		issuer:   idToken.StringClaim("iss"),
+		subject:  idToken.Subject,
+		username: username,
+		groups:   groups,
+	})
+	if e != nil {
+		return "", e
+	}
+
+	t, e := o.tokenStore.Validate(pl.token)
+	if e != nil {
+		return "", e
+	}
+	session, _, e := loginSession(o.twoFactor, t.Value, user)
+	if e != nil {
+		return "", e
+	}
+	if _, e := o.tokenStore.Update(t.Token, session); e != nil {
+		return "", e
+	}
+	return pl.redirect, nil
+}
+
+// mapGroups maps the groups claim to go-drive groups, nil means the groups claim is absent
+func (o *OIDCLogin) mapGroups(idToken *oidc.IDToken, opts types.SM) ([]string, error) {
+	groupsClaim := opts[optOIDCGroupsClaim]
+	if groupsClaim == "" {
+		groupsClaim = "groups"
+	}
+	if _, ok := idToken.Claims[groupsClaim]; !ok {
+		return nil, nil
+	}
+	groups := idToken.StringsClaim(groupsClaim)
+	for i, g := range groups {
+		// keycloak group path starts with '/'
+		groups[i] = strings.TrimPrefix(g, "/")
+	}
+	return mapExternalGroups(o.groupDAO, groups, opts[optOIDCGroupMapping])
+}
+
+func (o *OIDCLogin) getProvider(ctx context.Context, defaultRedirectURI string) (*oidc.Provider, types.SM, error) {
+	opts, e := o.optionsDAO.Gets(oidcOptionKeys...)
+	if e != nil {
+		return nil, nil, e
+	}
+	if opts[optOIDCEnabled] != "true" || opts[optOIDCIssuer] == "" || opts[optOIDCClientID] == "" {
+		return nil, nil, err.NewNotAllowedMessageError(i18n.T("api.oidc.not_enabled"))
+	}
+	redirectURI := opts[optOIDCRedirectURI]
+	if redirectURI == "" {
+		redirectURI = defaultRedirectURI
+	}
+	scopes := strings.Fields(strings.ReplaceAll(opts[optOIDCScopes], ",", " "))
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "profile", "email"}
+	}
+	key := strings.Join([]string{opts[optOIDCIssuer], opts[optOIDCClientID],
+		opts[optOIDCClientSecret], redirectURI, strings.Join(scopes, " ")}, "\n")
+
+	o.mux.Lock()
+	defer o.mux.Unlock()
+	if o.provider != nil && o.providerKey == key && time.Since(o.providerAt) < oidcProviderMaxAge {
+		return o.provider, opts, nil
+	}
+	p, e := oidc.NewProvider(ctx, oidc.Config{
+		Issuer:       opts[optOIDCIssuer],
+		ClientID:     opts[optOIDCClientID],
+		ClientSecret: opts[optOIDCClientSecret],
+		RedirectURL:  redirectURI,
+		Scopes:       scopes,
+	}, nil)
+	if e != nil {
+		authLogger.Ctx(ctx).Warn("error when discovering OIDC provider", "error", e)
+		return nil, nil, err.NewRemoteApiError(500, i18n.T("api.oidc.discovery_failed"))
+	}
+	o.provider = p
+	o.providerKey = key
+	o.providerAt = time.Now()
+	return p, opts, nil
+}
+
+func (o *OIDCLogin) clean() {
+	now := time.Now()
+	keys := make([]string, 0)
+	o.pending.IterCb(func(key string, v interface{}) {
+		if v.(*oidcPendingLogin).expiresAt.Before(now) {
+			keys = append(keys, key)
+		}
+	})
+	for _, key := range keys {
+		o.pending.Remove(key)
+	}
+}
+
+func (o *OIDCLogin) Dispose() error {
+	o.tickerStop()
+	return nil
+}
+
+// isSameHostURL checks if u is a relative URL or an URL with the host
+func isSameHostURL(u, host string) bool {
+	parsed, e := url.Parse(u)
+	if e != nil {
+		return false
+	}
+	return (parsed.Scheme == "" && parsed.Host == "" && strings.HasPrefix(u, "/") && !strings.HasPrefix(u, "//")) ||
+		((parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host == host)
+}
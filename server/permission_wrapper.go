@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"go-drive/common/drive_util"
 	"go-drive/common/errors"
 	"go-drive/common/i18n"
 	"go-drive/common/types"
@@ -12,10 +13,6 @@ import (
 	"time"
 )
 
-const (
-	accessKeyValidity = 12 * time.Hour
-)
-
 // PermissionWrapperDrive intercept the request
 // based on the permission information in the database.
 // The permissions of a child path inherit from the parent path,
@@ -28,11 +25,20 @@ type PermissionWrapperDrive struct {
 	request           *http.Request
 	permissionStorage *storage.PathPermissionDAO
 	signer            *utils.Signer
+	accessKeyValidity time.Duration
+	// scope is not nil when the request is authenticated by a personal access token
+	scope *accessTokenScope
+
+	auditor *Auditor
+	actor   auditActor
+	// scanner provides the verdicts of the files
+	scanner *VirusScanner
 }
 
 func NewPermissionWrapperDrive(
 	request *http.Request, session types.Session, drive types.IDrive,
-	permissionStorage *storage.PathPermissionDAO, signer *utils.Signer) *PermissionWrapperDrive {
+	permissionStorage *storage.PathPermissionDAO, signer *utils.Signer,
+	accessKeyValidity time.Duration, auditor *Auditor, scanner *VirusScanner) *PermissionWrapperDrive {
 
 	subjects := make([]string, 0, 3)
 	subjects = append(subjects, types.AnySubject) // Anonymous
@@ -51,6 +57,11 @@ func NewPermissionWrapperDrive(
 		request:           request,
 		permissionStorage: permissionStorage,
 		signer:            signer,
+		accessKeyValidity: accessKeyValidity,
+		scope:             newAccessTokenScope(session),
+		auditor:           auditor,
+		actor:             newAuditActor(request, session),
+		scanner:           scanner,
 	}
 }
 
@@ -72,28 +83,37 @@ func (p *PermissionWrapperDrive) Get(ctx context.Context, path string) (types.IE
 	if e != nil {
 		return nil, e
 	}
+	var scan types.M
+	if p.scanner != nil && entry.Type().IsFile() {
+		scan = scanMeta(p.scanner.ScanOf(path), entry)
+	}
 	return &permissionWrapperEntry{
 		p:          p,
 		entry:      entry,
 		permission: permission,
-		accessKey:  signPathRequest(p.signer, p.request, path, time.Now().Add(accessKeyValidity)),
+		accessKey:  signPathRequest(p.signer, p.request, path, time.Now().Add(p.accessKeyValidity)),
+		scan:       scan,
 	}, nil
 }
 
 func (p *PermissionWrapperDrive) Save(ctx types.TaskCtx, path string, size int64,
-	override bool, reader io.Reader) (types.IEntry, error) {
+	override bool, reader io.Reader) (_ types.IEntry, e error) {
+	defer func() { p.audit(ctx, "save", path, "", e) }()
 	permission, e := p.requirePermission(path, types.PermissionReadWrite)
 	if e != nil {
 		return nil, e
 	}
-	entry, e := p.drive.Save(ctx, path, size, override, reader)
+	entry, e := p.scanner.Save(ctx, path, reader, func(reader io.Reader) (types.IEntry, error) {
+		return p.drive.Save(ctx, path, size, override, reader)
+	})
 	if e != nil {
 		return nil, e
 	}
 	return &permissionWrapperEntry{p: p, entry: entry, permission: permission}, nil
 }
 
-func (p *PermissionWrapperDrive) MakeDir(ctx context.Context, path string) (types.IEntry, error) {
+func (p *PermissionWrapperDrive) MakeDir(ctx context.Context, path string) (_ types.IEntry, e error) {
+	defer func() { p.audit(ctx, "make_dir", path, "", e) }()
 	permission, e := p.requirePermission(path, types.PermissionReadWrite)
 	if e != nil {
 		return nil, e
@@ -105,7 +125,9 @@ func (p *PermissionWrapperDrive) MakeDir(ctx context.Context, path string) (type
 	return &permissionWrapperEntry{p: p, entry: entry, permission: permission}, nil
 }
 
-func (p *PermissionWrapperDrive) Copy(ctx types.TaskCtx, from types.IEntry, to string, override bool) (types.IEntry, error) {
+func (p *PermissionWrapperDrive) Copy(ctx types.TaskCtx, from types.IEntry, to string,
+	override bool) (_ types.IEntry, e error) {
+	defer func() { p.audit(ctx, "copy", from.Path(), to, e) }()
 	toPermission, e := p.requirePathAndParentWritable(to)
 	if e != nil {
 		return nil, e
@@ -116,14 +138,48 @@ func (p *PermissionWrapperDrive) Copy(ctx types.TaskCtx, from types.IEntry, to s
 	if e := p.requireDescendantPermission(to, types.PermissionReadWrite); e != nil {
 		return nil, e
 	}
-	entry, e := p.drive.Copy(ctx, from, to, override)
+	var entry types.IEntry
+	if p.scanner.Enabled() {
+		entry, e = p.copyScanned(ctx, from, to, override)
+	} else {
+		entry, e = p.drive.Copy(ctx, from, to, override)
+	}
 	if e != nil {
 		return nil, e
 	}
 	return &permissionWrapperEntry{p: p, entry: entry, permission: toPermission}, nil
 }
 
-func (p *PermissionWrapperDrive) Move(ctx types.TaskCtx, from types.IEntry, to string, override bool) (types.IEntry, error) {
+// copyScanned copies the files by saving their contents, so that they are scanned before saving
+func (p *PermissionWrapperDrive) copyScanned(ctx types.TaskCtx, from types.IEntry, to string,
+	override bool) (types.IEntry, error) {
+	e := drive_util.CopyAll(ctx, from, p.drive, to, override,
+		func(from types.IEntry, driveTo types.IDrive, to string, ctx types.TaskCtx) error {
+			content, ok := from.(types.IContent)
+			if !ok {
+				return err.NewNotAllowedMessageError(i18n.T("drive.file_not_readable", from.Path()))
+			}
+			reader, e := drive_util.GetIContentReader(ctx, content)
+			if e != nil {
+				return e
+			}
+			defer func() { _ = reader.Close() }()
+			_, e = p.scanner.Save(ctx, to, reader, func(reader io.Reader) (types.IEntry, error) {
+				return driveTo.Save(ctx, to, from.Size(), true, reader)
+			})
+			return e
+		},
+		nil,
+	)
+	if e != nil {
+		return nil, e
+	}
+	return p.drive.Get(ctx, to)
+}
+
+func (p *PermissionWrapperDrive) Move(ctx types.TaskCtx, from types.IEntry, to string,
+	override bool) (_ types.IEntry, e error) {
+	defer func() { p.audit(ctx, "move", from.Path(), to, e) }()
 	toPermission, e := p.requirePathAndParentWritable(to)
 	if e != nil {
 		return nil, e
@@ -145,24 +201,82 @@ func (p *PermissionWrapperDrive) Move(ctx types.TaskCtx, from types.IEntry, to s
 }
 
 func (p *PermissionWrapperDrive) List(ctx context.Context, path string) ([]types.IEntry, error) {
-	permission, e := p.permissionStorage.ResolvePathPermission(p.subjects, path)
+	permission, e := p.requireListable(path)
+	if e != nil {
+		return nil, e
+	}
+	entries, e := p.drive.List(ctx, path)
+	if e != nil {
+		return nil, e
+	}
+	return p.wrapChildren(path, permission, entries)
+}
+
+// ListPage filters the unreadable entries of each page,
+// and keeps listing the next pages for the remaining entries until the page is full or it's the last page
+func (p *PermissionWrapperDrive) ListPage(ctx context.Context, path string,
+	opts types.ListOptions) (*types.EntryPage, error) {
+	permission, e := p.requireListable(path)
 	if e != nil {
 		return nil, e
 	}
+	result := &types.EntryPage{Entries: make([]types.IEntry, 0, opts.Limit)}
+	limit := opts.Limit
+	for {
+		if limit > 0 {
+			opts.Limit = limit - len(result.Entries)
+		}
+		page, e := drive_util.ListPage(ctx, p.drive, path, opts)
+		if e != nil {
+			return nil, e
+		}
+		entries, e := p.wrapChildren(path, permission, page.Entries)
+		if e != nil {
+			return nil, e
+		}
+		result.Entries = append(result.Entries, entries...)
+		result.Cursor = page.Cursor
+		if page.Cursor == "" || limit <= 0 || len(result.Entries) >= limit {
+			return result, nil
+		}
+		opts.Cursor = page.Cursor
+	}
+}
+
+func (p *PermissionWrapperDrive) requireListable(path string) (types.Permission, error) {
+	permission, e := p.permissionStorage.ResolvePathPermission(p.subjects, path)
+	if e != nil {
+		return permission, e
+	}
+	permission = p.scope.apply(path, permission)
 	if !utils.IsRootPath(path) {
 		if !permission.CanRead() {
-			return nil, err.NewNotFoundError()
+			return permission, err.NewNotFoundError()
 		}
 	}
-	entries, e := p.drive.List(ctx, path)
+	return permission, nil
+}
+
+// canRead returns true if the path is readable, the entry of path may not exist
+func (p *PermissionWrapperDrive) canRead(path string) bool {
+	permission, e := p.permissionStorage.ResolvePathPermission(p.subjects, path)
 	if e != nil {
-		return nil, e
+		return false
 	}
+	return p.scope.apply(path, permission).CanRead()
+}
 
+// wrapChildren filters the readable children and wraps them with their permissions
+func (p *PermissionWrapperDrive) wrapChildren(path string, permission types.Permission,
+	entries []types.IEntry) ([]types.IEntry, error) {
 	pMap, e := p.permissionStorage.ResolvePathChildrenPermission(p.subjects, path)
 	if e != nil {
 		return nil, e
 	}
+	var scans map[string]types.EntryScan
+	if p.scanner != nil {
+		scans = p.scanner.ScansOf(path)
+	}
 	result := make([]types.IEntry, 0, len(entries))
 	for _, e := range entries {
 		if !e.Meta().CanRead {
@@ -172,10 +286,15 @@ func (p *PermissionWrapperDrive) List(ctx context.Context, path string) ([]types
 		if temp, ok := pMap[e.Path()]; ok {
 			per = temp
 		}
+		per = p.scope.apply(e.Path(), per)
 		if per.CanRead() {
 			accessKey := ""
+			var scan types.M
 			if e.Type().IsFile() {
-				accessKey = signPathRequest(p.signer, p.request, e.Path(), time.Now().Add(accessKeyValidity))
+				accessKey = signPathRequest(p.signer, p.request, e.Path(), time.Now().Add(p.accessKeyValidity))
+				if s, ok := scans[e.Path()]; ok {
+					scan = scanMeta(&s, e)
+				}
 			}
 			result = append(
 				result,
@@ -184,6 +303,7 @@ func (p *PermissionWrapperDrive) List(ctx context.Context, path string) ([]types
 					entry:      e,
 					permission: per,
 					accessKey:  accessKey,
+					scan:       scan,
 				},
 			)
 		}
@@ -191,22 +311,43 @@ func (p *PermissionWrapperDrive) List(ctx context.Context, path string) ([]types
 	return result, nil
 }
 
-func (p *PermissionWrapperDrive) Delete(ctx types.TaskCtx, path string) error {
+func (p *PermissionWrapperDrive) Delete(ctx types.TaskCtx, path string) (e error) {
+	defer func() { p.audit(ctx, "delete", path, "", e) }()
 	if _, e := p.requirePathAndParentWritable(path); e != nil {
 		return e
 	}
 	return p.drive.Delete(ctx, path)
 }
 
+// Upload is audited, because the file may be uploaded to the storage directly without Save
 func (p *PermissionWrapperDrive) Upload(ctx context.Context, path string, size int64,
-	override bool, config types.SM) (*types.DriveUploadConfig, error) {
-	_, e := p.requirePermission(path, types.PermissionReadWrite)
-	if e != nil {
+	override bool, config types.SM) (_ *types.DriveUploadConfig, e error) {
+	defer func() { p.audit(ctx, "upload", path, "", e) }()
+	if _, e := p.requirePermission(path, types.PermissionReadWrite); e != nil {
 		return nil, e
 	}
 	return p.drive.Upload(ctx, path, size, override, config)
 }
 
+// UploadLocally is the Upload that requires the file uploaded to go-drive rather than the storage directly,
+// so that it can be processed before saving. It's audited as Upload.
+func (p *PermissionWrapperDrive) UploadLocally(ctx context.Context, path string,
+	size int64) (_ *types.DriveUploadConfig, e error) {
+	defer func() { p.audit(ctx, "upload", path, "", e) }()
+	if _, e := p.requirePermission(path, types.PermissionReadWrite); e != nil {
+		return nil, e
+	}
+	return types.UseLocalProvider(size), nil
+}
+
+// audit records the mutating operation
+func (p *PermissionWrapperDrive) audit(ctx context.Context, operation, path, target string, e error) {
+	if p.auditor == nil {
+		return
+	}
+	p.auditor.Record(ctx, p.actor, "drive."+operation, path, target, e)
+}
+
 func (p *PermissionWrapperDrive) requirePathAndParentWritable(path string) (types.Permission, error) {
 	if !utils.IsRootPath(path) {
 		perm, e := p.requirePermission(utils.PathParent(path), types.PermissionReadWrite)
@@ -222,6 +363,7 @@ func (p *PermissionWrapperDrive) requirePermission(path string, require types.Pe
 	if e != nil {
 		return types.PermissionEmpty, e
 	}
+	resolved = p.scope.apply(path, resolved)
 	if resolved&require != require {
 		return resolved, err.NewNotFoundMessageError(i18n.T("error.permission_denied"))
 	}
@@ -233,8 +375,8 @@ func (p *PermissionWrapperDrive) requireDescendantPermission(path string, requir
 	if e != nil {
 		return e
 	}
-	for _, p := range permission {
-		if p&require != require {
+	for path, per := range permission {
+		if p.scope.apply(path, per)&require != require {
 			return err.NewNotAllowedMessageError(i18n.T("api.permission_wrapper.no_subfolder_permission"))
 		}
 	}
@@ -246,6 +388,8 @@ type permissionWrapperEntry struct {
 	entry      types.IEntry
 	permission types.Permission
 	accessKey  string
+	// scan is the verdict of the virus scanner
+	scan types.M
 }
 
 func (p *permissionWrapperEntry) Path() string {
@@ -264,10 +408,15 @@ func (p *permissionWrapperEntry) Meta() types.EntryMeta {
 	meta := p.entry.Meta()
 	meta.CanRead = meta.CanRead && p.permission.CanRead()
 	meta.CanWrite = meta.CanWrite && p.permission.CanWrite()
-	if p.accessKey != "" {
+	if p.accessKey != "" || p.scan != nil {
 		meta.Props = utils.CopyMap(meta.Props)
+	}
+	if p.accessKey != "" {
 		meta.Props["access_key"] = p.accessKey
 	}
+	if p.scan != nil {
+		meta.Props["scan"] = p.scan
+	}
 	return meta
 }
 
@@ -290,6 +439,13 @@ func (p *permissionWrapperEntry) GetReader(ctx context.Context) (io.ReadCloser,
 	return nil, err.NewUnsupportedError()
 }
 
+func (p *permissionWrapperEntry) GetRangeReader(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+	if c, ok := p.entry.(types.IRangeContent); ok {
+		return c.GetRangeReader(ctx, offset, length)
+	}
+	return nil, err.NewUnsupportedError()
+}
+
 func (p *permissionWrapperEntry) GetURL(ctx context.Context) (*types.ContentURL, error) {
 	if c, ok := p.entry.(types.IContent); ok {
 		return c.GetURL(ctx)
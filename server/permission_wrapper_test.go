@@ -0,0 +1,115 @@
+package server
+
+import (
+	"context"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"io/ioutil"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type signTestDrive struct {
+	types.IDrive
+}
+
+func (d *signTestDrive) Get(_ context.Context, path string) (types.IEntry, error) {
+	return &signTestEntry{path: path}, nil
+}
+
+type signTestEntry struct {
+	types.IEntry
+	path string
+}
+
+func (e *signTestEntry) Path() string { return e.path }
+
+func TestSignPathRequest(t *testing.T) {
+	signer := utils.NewSigner()
+	req := httptest.NewRequest("GET", "/content/d/a.txt", nil)
+	key := signPathRequest(signer, req, "d/a.txt", time.Now().Add(time.Hour))
+
+	signed := httptest.NewRequest("GET", "/content/d/a.txt?"+signatureQueryKey+"="+url.QueryEscape(key), nil)
+	if !checkSignature(signer, signed, "d/a.txt") {
+		t.Errorf("expect signature to be valid")
+	}
+	if checkSignature(signer, signed, "d/b.txt") {
+		t.Errorf("expect signature of another path to be invalid")
+	}
+
+	expired := signPathRequest(signer, req, "d/a.txt", time.Now().Add(-time.Second))
+	signed = httptest.NewRequest("GET", "/content/d/a.txt?"+signatureQueryKey+"="+url.QueryEscape(expired), nil)
+	if checkSignature(signer, signed, "d/a.txt") {
+		t.Errorf("expect expired signature to be invalid")
+	}
+}
+
+func TestPermissionWrapperAccessKey(t *testing.T) {
+	signer := utils.NewSigner()
+	path := "d/a.txt"
+	req := httptest.NewRequest("GET", "/entry/"+path, nil)
+	req.URL.RawQuery = signatureQueryKey + "=" + url.QueryEscape(
+		signPathRequest(signer, req, path, time.Now().Add(time.Minute)))
+
+	p := NewPermissionWrapperDrive(req, types.Session{}, &signTestDrive{},
+		nil, signer, time.Hour, nil, nil)
+	entry, e := p.Get(context.Background(), path)
+	if e != nil {
+		t.Fatal(e)
+	}
+	accessKey := entry.(*permissionWrapperEntry).accessKey
+	if accessKey == "" {
+		t.Fatal("expect access key to be generated")
+	}
+
+	content := httptest.NewRequest("GET", "/content/"+path+"?"+signatureQueryKey+"="+url.QueryEscape(accessKey), nil)
+	if !checkSignature(signer, content, path) {
+		t.Errorf("expect access key '%s' to be valid", accessKey)
+	}
+}
+
+func TestPermissionWrapperListPage(t *testing.T) {
+	dr, dir, cleanup := newTestDriveRoute(t)
+	defer cleanup()
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		if e := ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644); e != nil {
+			t.Fatal(e)
+		}
+	}
+	for _, path := range []string{"d/b", "d/c"} {
+		if e := dr.permissionDAO.SavePathPermissions(path, []types.PathPermission{
+			{Subject: types.AnySubject, Permission: types.PermissionRead, Policy: types.PolicyReject},
+		}); e != nil {
+			t.Fatal(e)
+		}
+	}
+	p := NewPermissionWrapperDrive(httptest.NewRequest("GET", "/entries/d", nil), types.Session{},
+		dr.rootDrive.Get(), dr.permissionDAO, utils.NewSigner(), time.Hour, nil, nil)
+
+	names := func(page *types.EntryPage) string {
+		s := make([]string, 0, len(page.Entries))
+		for _, e := range page.Entries {
+			s = append(s, utils.PathBase(e.Path()))
+		}
+		return strings.Join(s, ",")
+	}
+	page, e := p.ListPage(context.Background(), "d", types.ListOptions{Limit: 2})
+	if e != nil {
+		t.Fatal(e)
+	}
+	// the hidden entries don't make the page short
+	if names(page) != "a,d" || page.Cursor == "" {
+		t.Errorf("expect 'a,d' and the next page, but it's '%s' '%s'", names(page), page.Cursor)
+	}
+	page, e = p.ListPage(context.Background(), "d", types.ListOptions{Limit: 2, Cursor: page.Cursor})
+	if e != nil {
+		t.Fatal(e)
+	}
+	if names(page) != "e" || page.Cursor != "" {
+		t.Errorf("expect the last page 'e', but it's '%s' '%s'", names(page), page.Cursor)
+	}
+}
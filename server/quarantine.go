@@ -0,0 +1,42 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"go-drive/common/utils"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// quarantineDirName is the dir in the data dir to keep the rejected files for inspection
+const quarantineDirName = "quarantine"
+
+// quarantineFile copies the file uploaded to path into the quarantine dir, returns the path of the copy
+func quarantineFile(dir, path, file string) (string, error) {
+	b := make([]byte, 4)
+	if _, e := rand.Read(b); e != nil {
+		return "", e
+	}
+	name := time.Now().Format("20060102150405") + "_" + hex.EncodeToString(b) + "_" + utils.PathBase(path)
+	dest := filepath.Join(dir, name)
+	src, e := os.Open(file)
+	if e != nil {
+		return "", e
+	}
+	defer func() { _ = src.Close() }()
+	f, e := os.OpenFile(dest, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if e != nil {
+		return "", e
+	}
+	_, e = io.Copy(f, src)
+	if ce := f.Close(); e == nil {
+		e = ce
+	}
+	if e != nil {
+		_ = os.Remove(dest)
+		return "", e
+	}
+	return dest, nil
+}
@@ -1,23 +1,32 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"go-drive/common"
 	"go-drive/common/errors"
 	"go-drive/common/i18n"
+	"go-drive/common/logging"
 	"go-drive/common/registry"
 	"go-drive/common/task"
 	"go-drive/common/types"
 	"go-drive/common/utils"
 	"go-drive/drive"
 	"go-drive/storage"
+	"net"
 	"net/http"
 	"reflect"
+	"regexp"
 	"runtime"
 	"time"
 )
 
+const headerRequestID = "X-Request-ID"
+
+var requestIDPattern = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,64}$`)
+
 func InitServer(config common.Config,
 	ch *registry.ComponentsHolder,
 	rootDrive *drive.RootDrive,
@@ -25,14 +34,31 @@ func InitServer(config common.Config,
 	thumbnail *Thumbnail,
 	signer *utils.Signer,
 	chunkUploader *ChunkUploader,
+	tusUploader *TusUploader,
+	offlineDownloader *OfflineDownloader,
 	runner task.Runner,
 	userDAO *storage.UserDAO,
+	accessTokenDAO *storage.AccessTokenDAO,
+	optionsDAO *storage.OptionsDAO,
+	oidcLogin *OIDCLogin,
+	ldapAuth *LDAPAuth,
+	twoFactor *TwoFactorAuth,
+	loginLimiter *LoginLimiter,
+	signerKeys *SignerKeyManager,
 	groupDAO *storage.GroupDAO,
+	identityDAO *storage.UserIdentityDAO,
 	driveDAO *storage.DriveDAO,
 	driveCacheDAO *storage.DriveCacheDAO,
 	driveDataDAO *storage.DriveDataDAO,
 	permissionDAO *storage.PathPermissionDAO,
 	pathMountDAO *storage.PathMountDAO,
+	auditor *Auditor,
+	auditLogDAO *storage.AuditLogDAO,
+	webhooks *Webhooks,
+	webhookDAO *storage.WebhookDAO,
+	uploadHooks *UploadHooks,
+	uploadHookDAO *storage.UploadHookDAO,
+	scanner *VirusScanner,
 	messageSource i18n.MessageSource) *gin.Engine {
 
 	if utils.IsDebugOn() {
@@ -44,16 +70,28 @@ func InitServer(config common.Config,
 	engine := gin.New()
 
 	engine.Use(gin.Recovery())
+	engine.Use(RequestID())
+	engine.Use(ClientIP(config.GetTrustedProxies()))
 	engine.Use(Logger())
+	engine.Use(Metrics())
 	engine.Use(apiResultHandler(messageSource))
 
-	InitAuthRoutes(engine, tokenStore, userDAO)
+	if config.MetricsToken != "" {
+		engine.GET("/metrics", metricsTokenRequired(config.MetricsToken), metricsHandler())
+	} else {
+		// the metrics contain the drive names and paths, which are not for anonymous users
+		engine.GET("/metrics", Auth(tokenStore, accessTokenDAO, userDAO),
+			UserGroupRequired("admin"), AdminTwoFactorRequired(twoFactor), metricsHandler())
+	}
+
+	InitAuthRoutes(engine, tokenStore, userDAO, accessTokenDAO, oidcLogin, ldapAuth, twoFactor, loginLimiter)
 
-	InitAdminRoutes(engine, ch, rootDrive, tokenStore, userDAO, groupDAO,
-		driveDAO, driveCacheDAO, driveDataDAO, permissionDAO, pathMountDAO)
+	InitAdminRoutes(engine, ch, rootDrive, tokenStore, accessTokenDAO, optionsDAO, ldapAuth, twoFactor, loginLimiter,
+		signerKeys, userDAO, groupDAO, identityDAO, driveDAO, driveCacheDAO, driveDataDAO, permissionDAO, pathMountDAO,
+		auditor, auditLogDAO, webhooks, webhookDAO, uploadHooks, uploadHookDAO, messageSource)
 
 	InitDriveRoutes(engine, config, rootDrive, permissionDAO, thumbnail,
-		signer, chunkUploader, runner, tokenStore)
+		signer, chunkUploader, tusUploader, offlineDownloader, runner, tokenStore, accessTokenDAO, userDAO, auditor, uploadHooks, scanner)
 
 	if config.GetResDir() != "" {
 		engine.NoRoute(Static("/", config.GetResDir()))
@@ -105,15 +143,61 @@ func Static(prefix, root string) gin.HandlerFunc {
 	}
 }
 
+// RequestID uses the X-Request-ID header of the request or generates one,
+// the id is put into the context of the request, so that it will be logged in the subsequent calls
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(headerRequestID)
+		if !requestIDPattern.MatchString(id) {
+			id = uuid.New().String()
+		}
+		c.Header(headerRequestID, id)
+		c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), id))
+		c.Next()
+	}
+}
+
+// ClientIP resolves the ip of the client by the trusted proxies, and puts it into the context of the request.
+// The X-Forwarded-* headers are trusted only if the request comes from the trusted proxies.
+func ClientIP(trustedProxies []*net.IPNet) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		client := requestClient{
+			ip:           utils.ClientIP(c.Request, trustedProxies),
+			trustedProxy: utils.IsFromTrustedProxy(c.Request, trustedProxies),
+		}
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), requestClientKey{}, client))
+		c.Next()
+	}
+}
+
+// Logger logs the requests, server errors are logged at error level
 func Logger() gin.HandlerFunc {
-	logger := gin.Logger()
+	logger := logging.For("http")
 	return func(c *gin.Context) {
 		if c.FullPath() == "" {
 			// NoRoute static files
 			c.Next()
 			return
 		}
-		logger(c)
+		start := time.Now()
+		c.Next()
+		status := c.Writer.Status()
+		level := logging.LevelInfo
+		fields := []interface{}{
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"status", status,
+			"latency", time.Since(start),
+			"client_ip", GetClientIP(c.Request),
+			"size", c.Writer.Size(),
+		}
+		if status >= http.StatusInternalServerError {
+			level = logging.LevelError
+			if len(c.Errors) > 0 {
+				fields = append(fields, "error", c.Errors[0].Err)
+			}
+		}
+		logger.Ctx(c.Request.Context()).Log(level, "request", fields...)
 	}
 }
 
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/gin-gonic/gin"
+	"go-drive/common/errors"
+	"go-drive/common/types"
+	"sort"
+)
+
+// SessionInfo is the session exposed to users, the token itself is never exposed
+type SessionInfo struct {
+	ID         string `json:"id"`
+	Username   string `json:"username"`
+	Pending    bool   `json:"pending"`
+	CreatedAt  int64  `json:"created_at"`
+	LastAccess int64  `json:"last_access"`
+	ExpiresAt  int64  `json:"expires_at"`
+	ClientIP   string `json:"client_ip"`
+	UserAgent  string `json:"user_agent"`
+	// Current is true if it's the session of the request
+	Current bool `json:"current"`
+}
+
+func sessionID(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:16])
+}
+
+// listSessions lists the logged-in sessions of the user, or all users if username is empty
+// The stateless token store can't list the sessions, then only the current session is listed.
+func listSessions(tokenStore types.TokenStore, username, currentToken string) ([]SessionInfo, error) {
+	tokens, e := tokenStore.List(username)
+	if err.IsUnsupportedError(e) {
+		tokens, e = currentSessionTokens(tokenStore, username, currentToken)
+	}
+	if e != nil {
+		return nil, e
+	}
+	result := make([]SessionInfo, 0, len(tokens))
+	for _, t := range tokens {
+		s := t.Value
+		if s.IsAnonymous() && s.PendingUsername == "" {
+			continue
+		}
+		info := SessionInfo{
+			ID:         sessionID(t.Token),
+			Username:   s.User.Username,
+			CreatedAt:  s.CreatedAt,
+			LastAccess: s.LastAccess,
+			ExpiresAt:  t.ExpiredAt,
+			ClientIP:   s.ClientIP,
+			UserAgent:  s.UserAgent,
+			Current:    t.Token == currentToken,
+		}
+		if s.IsAnonymous() {
+			info.Username = s.PendingUsername
+			info.Pending = true
+		}
+		result = append(result, info)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].LastAccess > result[j].LastAccess
+	})
+	return result, nil
+}
+
+func currentSessionTokens(tokenStore types.TokenStore, username, currentToken string) ([]types.Token, error) {
+	t, e := tokenStore.Validate(currentToken)
+	if e != nil {
+		return nil, e
+	}
+	if username != "" && t.Value.User.Username != username && t.Value.PendingUsername != username {
+		return []types.Token{}, nil
+	}
+	// the token may be refreshed, the current one is listed
+	return []types.Token{{Token: currentToken, Value: t.Value, ExpiredAt: t.ExpiredAt}}, nil
+}
+
+// revokeSession revokes the session of the user by id, any user if username is empty.
+// Only the current session can be revoked if the token store can't list the sessions, the same as listSessions.
+func revokeSession(tokenStore types.TokenStore, username, id, currentToken string) error {
+	tokens, e := tokenStore.List(username)
+	if err.IsUnsupportedError(e) {
+		tokens, e = currentSessionTokens(tokenStore, username, currentToken)
+	}
+	if e != nil {
+		return e
+	}
+	for _, t := range tokens {
+		if sessionID(t.Token) == id {
+			return tokenStore.Revoke(t.Token)
+		}
+	}
+	return err.NewNotFoundError()
+}
+
+// revokeUserSessions revokes all sessions of the user except the exceptToken
+func revokeUserSessions(tokenStore types.TokenStore, username, exceptToken string) error {
+	if username == "" {
+		return nil
+	}
+	if r, ok := tokenStore.(types.UserTokenRevoker); ok {
+		return r.RevokeUser(username, exceptToken)
+	}
+	tokens, e := tokenStore.List(username)
+	if e != nil {
+		return e
+	}
+	for _, t := range tokens {
+		if t.Token == exceptToken {
+			continue
+		}
+		if e := tokenStore.Revoke(t.Token); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// recordSessionClient records the ip and user agent of the request to the session
+func recordSessionClient(c *gin.Context, session *types.Session) {
+	session.ClientIP = GetClientIP(c.Request)
+	session.UserAgent = c.Request.UserAgent()
+}
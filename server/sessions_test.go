@@ -0,0 +1,72 @@
+package server
+
+import (
+	"go-drive/common/types"
+	"testing"
+	"time"
+)
+
+func TestListAndRevokeSessions(t *testing.T) {
+	store := NewMemTokenStore(time.Hour, false, time.Hour)
+	defer func() { _ = store.Dispose() }()
+
+	current, e := store.Create(types.Session{User: types.User{Username: "alice"}})
+	if e != nil {
+		t.Fatal(e)
+	}
+	other, e := store.Create(types.Session{User: types.User{Username: "alice"}})
+	if e != nil {
+		t.Fatal(e)
+	}
+	bob, e := store.Create(types.Session{User: types.User{Username: "bob"}})
+	if e != nil {
+		t.Fatal(e)
+	}
+	pending, e := store.Create(types.Session{PendingUsername: "alice"})
+	if e != nil {
+		t.Fatal(e)
+	}
+	// anonymous sessions are not listed
+	if _, e := store.Create(types.Session{}); e != nil {
+		t.Fatal(e)
+	}
+
+	sessions, e := listSessions(store, "alice", current.Token)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(sessions) != 3 {
+		t.Fatalf("expect 3 sessions, but it's %v", sessions)
+	}
+	listed := make(map[string]SessionInfo, len(sessions))
+	for _, s := range sessions {
+		listed[s.ID] = s
+	}
+	if s, ok := listed[sessionID(current.Token)]; !ok || !s.Current {
+		t.Errorf("expect the current session listed, but it's %v", sessions)
+	}
+	if s, ok := listed[sessionID(other.Token)]; !ok || s.Current {
+		t.Errorf("expect the other session listed, but it's %v", sessions)
+	}
+	if s, ok := listed[sessionID(pending.Token)]; !ok || !s.Pending {
+		t.Errorf("expect the pending session listed, but it's %v", sessions)
+	}
+
+	// the session of other users can't be revoked by the user
+	if e := revokeSession(store, "alice", sessionID(bob.Token), current.Token); e == nil {
+		t.Errorf("expect the session of bob not found")
+	}
+	if e := revokeSession(store, "alice", sessionID(other.Token), current.Token); e != nil {
+		t.Fatal(e)
+	}
+	if _, e := store.Validate(other.Token); e == nil {
+		t.Errorf("expect the session revoked")
+	}
+	// by admins
+	if e := revokeSession(store, "", sessionID(bob.Token), current.Token); e != nil {
+		t.Fatal(e)
+	}
+	if _, e := store.Validate(bob.Token); e == nil {
+		t.Errorf("expect the session of bob revoked")
+	}
+}
@@ -0,0 +1,173 @@
+package server
+
+import (
+	"encoding/hex"
+	"fmt"
+	"go-drive/common"
+	"go-drive/common/logging"
+	"go-drive/common/registry"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"go-drive/storage"
+	"sync"
+	"time"
+)
+
+const (
+	signerKeyCheckInterval = time.Minute
+	// minimum interval of reloading keys when a signature of an unknown key is validated
+	signerKeyReloadInterval = 10 * time.Second
+)
+
+var signerLogger = logging.For("signer")
+
+// SignerKeyManager persists the keys of the url signer in the database,
+// so that the signed urls are still valid after restarting or in other instances.
+// The active key is rotated periodically, the retired keys are still valid in the grace period.
+type SignerKeyManager struct {
+	dao      *storage.SignerKeyDAO
+	signer   *utils.Signer
+	rotation time.Duration
+	grace    time.Duration
+
+	keys       []types.SignerKey
+	lastReload time.Time
+	mux        *sync.Mutex
+
+	tickerStop func()
+}
+
+func NewSignerKeyManager(config common.Config, ch *registry.ComponentsHolder,
+	dao *storage.SignerKeyDAO) (*SignerKeyManager, error) {
+	grace := config.SignerKeyGrace
+	// the signed urls must be valid until they expire
+	if grace < config.AccessKeyValidity {
+		grace = config.AccessKeyValidity
+	}
+	m := &SignerKeyManager{
+		dao:      dao,
+		rotation: config.SignerKeyRotation,
+		grace:    grace,
+		mux:      &sync.Mutex{},
+	}
+	m.signer = utils.NewKeysSigner(m.onKeyMissing)
+	if e := m.reload(); e != nil {
+		return nil, e
+	}
+	if m.activeKey() == nil {
+		if e := m.Rotate(); e != nil {
+			return nil, e
+		}
+	}
+	m.tickerStop = utils.TimeTick(m.check, signerKeyCheckInterval)
+	ch.Add("signerKeyManager", m)
+	return m, nil
+}
+
+// GetSigner provides the signer of the SignerKeyManager
+func GetSigner(m *SignerKeyManager) *utils.Signer {
+	return m.signer
+}
+
+// Rotate creates a new active key and retires the current one
+func (m *SignerKeyManager) Rotate() error {
+	key, e := utils.NewSignerKey()
+	if e != nil {
+		return e
+	}
+	now := time.Now()
+	if e := m.dao.Rotate(types.SignerKey{
+		Id:        key.ID,
+		Secret:    hex.EncodeToString(key.Secret),
+		CreatedAt: now.Unix(),
+	}, now.Add(m.grace).Unix()); e != nil {
+		return e
+	}
+	signerLogger.Info("key rotated", "key", key.ID)
+	return m.reload()
+}
+
+func (m *SignerKeyManager) reload() error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	keys, e := m.dao.ListKeys(time.Now().Unix())
+	if e != nil {
+		return e
+	}
+	signerKeys := make([]utils.SignerKey, 0, len(keys))
+	for _, k := range keys {
+		secret, e := hex.DecodeString(k.Secret)
+		if e != nil {
+			return e
+		}
+		signerKeys = append(signerKeys, utils.SignerKey{ID: k.Id, Secret: secret, ExpiresAt: k.ExpiresAt})
+	}
+	m.signer.SetKeys(signerKeys)
+	m.keys = keys
+	m.lastReload = time.Now()
+	return nil
+}
+
+// onKeyMissing reloads the keys, the key may be created by another instance
+func (m *SignerKeyManager) onKeyMissing(string) {
+	m.mux.Lock()
+	reload := time.Since(m.lastReload) >= signerKeyReloadInterval
+	m.mux.Unlock()
+	if !reload {
+		return
+	}
+	if e := m.reload(); e != nil {
+		signerLogger.Warn("error when reloading keys", "error", e)
+	}
+}
+
+// check reloads the keys and rotates the active key if it's too old
+func (m *SignerKeyManager) check() {
+	if e := m.reload(); e != nil {
+		signerLogger.Warn("error when reloading keys", "error", e)
+		return
+	}
+	if m.rotation <= 0 {
+		return
+	}
+	active := m.activeKey()
+	if active != nil && time.Since(time.Unix(active.CreatedAt, 0)) < m.rotation {
+		return
+	}
+	if e := m.Rotate(); e != nil {
+		signerLogger.Warn("error when rotating key", "error", e)
+	}
+}
+
+func (m *SignerKeyManager) activeKey() *types.SignerKey {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	var active *types.SignerKey
+	for i, k := range m.keys {
+		if k.ExpiresAt == 0 {
+			active = &m.keys[i]
+		}
+	}
+	return active
+}
+
+func (m *SignerKeyManager) Status() (string, types.SM, error) {
+	active := m.activeKey()
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	data := types.SM{
+		"Keys":     fmt.Sprintf("%d", len(m.keys)),
+		"Rotation": m.rotation.String(),
+		"Grace":    m.grace.String(),
+	}
+	if active != nil {
+		data["ActiveKey"] = active.Id
+		data["ActiveKeyCreatedAt"] = time.Unix(active.CreatedAt, 0).Format(time.RubyDate)
+	}
+	return "Signer", data, nil
+}
+
+func (m *SignerKeyManager) Dispose() error {
+	m.tickerStop()
+	return nil
+}
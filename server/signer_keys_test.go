@@ -0,0 +1,83 @@
+package server
+
+import (
+	"go-drive/common"
+	"go-drive/common/registry"
+	"go-drive/common/types"
+	"go-drive/storage"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestSignerKeyManager(t *testing.T, db *storage.DB, config common.Config) *SignerKeyManager {
+	m, e := NewSignerKeyManager(config, registry.NewComponentHolder(), storage.NewSignerKeyDAO(db))
+	if e != nil {
+		t.Fatal(e)
+	}
+	return m
+}
+
+func signerKeyId(signature string) string {
+	return signature[:strings.IndexByte(signature, '.')]
+}
+
+func TestSignerKeyManagerPersistence(t *testing.T) {
+	db, config, cleanup := newTestDB(t)
+	defer cleanup()
+
+	m := newTestSignerKeyManager(t, db, config)
+	signature := GetSigner(m).Sign("d/a.txt", time.Now().Add(time.Hour))
+	_ = m.Dispose()
+
+	// restarted
+	m = newTestSignerKeyManager(t, db, config)
+	defer func() { _ = m.Dispose() }()
+	signer := GetSigner(m)
+	if !signer.Validate("d/a.txt", signature) {
+		t.Errorf("expect the signature valid after restarting")
+	}
+	if id := signerKeyId(signer.Sign("d/a.txt", time.Now().Add(time.Hour))); id != signerKeyId(signature) {
+		t.Errorf("expect the active key %s kept after restarting, but it's %s", signerKeyId(signature), id)
+	}
+}
+
+func TestSignerKeyManagerRotate(t *testing.T) {
+	db, config, cleanup := newTestDB(t)
+	defer cleanup()
+	config.SignerKeyGrace = time.Hour
+
+	m := newTestSignerKeyManager(t, db, config)
+	defer func() { _ = m.Dispose() }()
+	signer := GetSigner(m)
+	old := signer.Sign("d/a.txt", time.Now().Add(time.Hour))
+
+	if e := m.Rotate(); e != nil {
+		t.Fatal(e)
+	}
+	signature := signer.Sign("d/a.txt", time.Now().Add(time.Hour))
+	if signerKeyId(signature) == signerKeyId(old) {
+		t.Errorf("expect signing with the new key after rotating")
+	}
+	if !signer.Validate("d/a.txt", signature) {
+		t.Errorf("expect the signature of the new key valid")
+	}
+	if !signer.Validate("d/a.txt", old) {
+		t.Errorf("expect the signature of the previous key valid in the grace period")
+	}
+
+	// the grace period of the previous key passed
+	if e := db.C().Model(&types.SignerKey{}).Where("id = ?", signerKeyId(old)).
+		Update("expires_at", time.Now().Add(-time.Second).Unix()).Error; e != nil {
+		t.Fatal(e)
+	}
+	if e := m.reload(); e != nil {
+		t.Fatal(e)
+	}
+	if signer.Validate("d/a.txt", old) {
+		t.Errorf("expect the signature of the key past the grace period invalid")
+	}
+	if !signer.Validate("d/a.txt", signature) {
+		t.Errorf("expect the signature of the active key valid")
+	}
+}
@@ -9,6 +9,8 @@ import (
 	"go-drive/common/drive_util"
 	"go-drive/common/errors"
 	"go-drive/common/i18n"
+	"go-drive/common/logging"
+	"go-drive/common/metrics"
 	"go-drive/common/registry"
 	"go-drive/common/task"
 	"go-drive/common/types"
@@ -18,11 +20,11 @@ import (
 	"image/jpeg"
 	_ "image/png"
 	"io/ioutil"
-	"log"
 	"os"
 	path2 "path"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -32,6 +34,8 @@ const (
 	thumbnailTimeout = 30 * time.Second
 )
 
+var thumbnailLogger = logging.For("thumbnail")
+
 var supportedExtensions = make(map[string]bool)
 
 func init() {
@@ -47,8 +51,12 @@ type Thumbnail struct {
 	maxPixels int
 	maxSize   int64
 
-	pool        *tunny.Pool
+	pool *tunny.Pool
+	// number of the busy workers of the pool
+	busy int64
+
 	stopCleaner func()
+	stopMetrics []func()
 }
 
 func NewThumbnail(config common.Config, ch *registry.ComponentsHolder) (*Thumbnail, error) {
@@ -64,6 +72,21 @@ func NewThumbnail(config common.Config, ch *registry.ComponentsHolder) (*Thumbna
 	}
 	t.pool = tunny.NewFunc(config.ThumbnailConcurrent, t.createThumbnail_)
 	t.stopCleaner = utils.TimeTick(t.clean, 12*time.Hour)
+	t.stopMetrics = []func(){
+		metrics.RegisterGaugeFunc("thumbnail", "pool_size", "Number of the thumbnail workers.",
+			func() float64 { return float64(t.pool.GetSize()) }),
+		metrics.RegisterGaugeFunc("thumbnail", "pool_busy", "Number of the busy thumbnail workers.",
+			func() float64 { return float64(atomic.LoadInt64(&t.busy)) }),
+		metrics.RegisterGaugeFunc("thumbnail", "queue_length", "Number of the thumbnails waiting for a worker.",
+			func() float64 {
+				// the queue length of the pool includes the jobs being processed
+				n := t.pool.QueueLength() - atomic.LoadInt64(&t.busy)
+				if n < 0 {
+					n = 0
+				}
+				return float64(n)
+			}),
+	}
 	ch.Add("thumbnail", t)
 	return t, nil
 }
@@ -77,6 +100,7 @@ func (t *Thumbnail) Create(entry types.IEntry) (*os.File, error) {
 	if e != nil {
 		return nil, e
 	}
+	metrics.ObserveCache("thumbnail", file != nil)
 	if file != nil {
 		return file, nil
 	}
@@ -105,6 +129,8 @@ func (t *Thumbnail) Remove(path string) error {
 
 func (t *Thumbnail) createThumbnail_(payload interface{}) interface{} {
 	tTask := payload.(thumbnailTask)
+	atomic.AddInt64(&t.busy, 1)
+	defer atomic.AddInt64(&t.busy, -1)
 	return t.createThumbnail(tTask.content, tTask.path)
 }
 
@@ -184,22 +210,25 @@ func (t *Thumbnail) clean() {
 		}
 		if info.ModTime().Before(notBefore) {
 			if e := os.Remove(path); e != nil {
-				log.Println("failed to delete file", e)
+				thumbnailLogger.Warn("failed to delete file", "path", path, "error", e)
 			}
 			n++
 		}
 		return nil
 	})
 	if n > 0 {
-		log.Println(fmt.Sprintf("%d expired thumbnails cleaned", n))
+		thumbnailLogger.Debug("expired thumbnails cleaned", "count", n)
 	}
 	if e != nil {
-		log.Println("error when cleaning expired thumbnails", e)
+		thumbnailLogger.Warn("error when cleaning expired thumbnails", "error", e)
 	}
 }
 
 func (t *Thumbnail) Dispose() error {
 	t.stopCleaner()
+	for _, stop := range t.stopMetrics {
+		stop()
+	}
 	t.pool.Close()
 	return nil
 }
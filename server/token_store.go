@@ -0,0 +1,33 @@
+package server
+
+import (
+	"fmt"
+	"go-drive/common"
+	"go-drive/common/logging"
+	"go-drive/common/registry"
+	"go-drive/common/types"
+	"go-drive/storage"
+	"time"
+)
+
+const memTokenCleanInterval = 10 * time.Minute
+
+var tokenLogger = logging.For("token")
+
+// NewTokenStore creates the TokenStore by config
+func NewTokenStore(config common.Config, ch *registry.ComponentsHolder,
+	revocationDAO *storage.TokenRevocationDAO, sessionDAO *storage.SessionDAO) (types.TokenStore, error) {
+	switch config.TokenStore {
+	case common.TokenStoreFile:
+		return NewFileTokenStore(config, ch)
+	case common.TokenStoreMem:
+		m := NewMemTokenStore(config.TokenValidity, config.TokenRefresh, memTokenCleanInterval)
+		ch.Add("tokenStore", m)
+		return m, nil
+	case common.TokenStoreDb:
+		return NewDbTokenStore(config, ch, sessionDAO), nil
+	case common.TokenStoreJwt:
+		return NewJwtTokenStore(config, ch, revocationDAO)
+	}
+	return nil, fmt.Errorf("unknown token store '%s'", config.TokenStore)
+}
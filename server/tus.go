@@ -0,0 +1,520 @@
+package server
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go-drive/common"
+	"go-drive/common/errors"
+	"go-drive/common/i18n"
+	"go-drive/common/logging"
+	"go-drive/common/registry"
+	"go-drive/common/task"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	path2 "path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,termination,checksum"
+	tusChecksums  = "md5,sha1,sha256"
+
+	headerTusResumable      = "Tus-Resumable"
+	headerTusVersion        = "Tus-Version"
+	headerTusExtension      = "Tus-Extension"
+	headerTusChecksumAlgo   = "Tus-Checksum-Algorithm"
+	headerTusUploadLength   = "Upload-Length"
+	headerTusUploadOffset   = "Upload-Offset"
+	headerTusUploadMetadata = "Upload-Metadata"
+	headerTusUploadChecksum = "Upload-Checksum"
+
+	tusContentType = "application/offset+octet-stream"
+	// tusStatusChecksumMismatch is the status code defined by the checksum extension
+	tusStatusChecksumMismatch = 460
+
+	// tusUploadSuffix distinguishes the tus uploads from the chunk uploads in upload_temp
+	tusUploadSuffix = ".tus"
+	// tusSaveWait is how long the last PATCH waits for the saving task,
+	// the task keeps running in background if it takes longer
+	tusSaveWait = 30 * time.Second
+)
+
+var tusLogger = logging.For("tus")
+
+// TusUploader stores the uploads of the tus resumable upload protocol in upload_temp,
+// the uploaded file is saved to the drive when the last byte is received.
+// The uploads idle longer than the UploadTempTTL are removed.
+// See https://tus.io/protocols/resumable-upload.html
+type TusUploader struct {
+	dir   string
+	locks *sync.Map
+	// saving contains the ids of the uploads being saved to the drive
+	saving      *sync.Map
+	ttl         time.Duration
+	stopCleaner func()
+}
+
+type tusUpload struct {
+	Id       string `json:"-"`
+	Path     string `json:"path"`
+	Length   int64  `json:"length"`
+	Override bool   `json:"override"`
+	// Owner is the username who created the upload, empty for anonymous
+	Owner     string `json:"owner"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+type tusError struct {
+	code int
+	msg  string
+}
+
+func (t tusError) Error() string {
+	return t.msg
+}
+
+func (t tusError) Code() int {
+	return t.code
+}
+
+func NewTusUploader(config common.Config, ch *registry.ComponentsHolder) (*TusUploader, error) {
+	dir, e := config.GetDir("upload_temp", true)
+	if e != nil {
+		return nil, e
+	}
+	t := &TusUploader{dir: dir, locks: &sync.Map{}, saving: &sync.Map{}, ttl: config.UploadTempTTL}
+	if t.ttl > 0 {
+		t.stopCleaner = utils.TimeTick(t.clean, uploadTempCleanIntervalOf(t.ttl))
+	}
+	ch.Add("tusUploader", t)
+	return t, nil
+}
+
+func (t *TusUploader) CreateUpload(upload tusUpload) (tusUpload, error) {
+	upload.Id = uuid.New().String()
+	upload.CreatedAt = time.Now().Unix()
+	if e := os.Mkdir(t.getDir(upload.Id), 0755); e != nil {
+		return upload, e
+	}
+	info, e := json.Marshal(upload)
+	if e == nil {
+		e = ioutil.WriteFile(t.getInfo(upload.Id), info, 0644)
+	}
+	if e == nil {
+		e = ioutil.WriteFile(t.getFile(upload.Id), nil, 0644)
+	}
+	if e != nil {
+		_ = os.RemoveAll(t.getDir(upload.Id))
+		return upload, e
+	}
+	return upload, nil
+}
+
+// GetUpload returns the upload and its offset, NotFoundError if it doesn't exist or is not owned by the owner
+func (t *TusUploader) GetUpload(id, owner string) (tusUpload, int64, error) {
+	upload := tusUpload{}
+	if _, e := uuid.Parse(id); e != nil {
+		return upload, 0, err.NewNotFoundError()
+	}
+	info, e := ioutil.ReadFile(t.getInfo(id))
+	if os.IsNotExist(e) {
+		return upload, 0, err.NewNotFoundError()
+	}
+	if e != nil {
+		return upload, 0, e
+	}
+	if e := json.Unmarshal(info, &upload); e != nil {
+		return upload, 0, e
+	}
+	if upload.Owner != owner {
+		return upload, 0, err.NewNotFoundError()
+	}
+	upload.Id = id
+	stat, e := os.Stat(t.getFile(id))
+	if e != nil {
+		return upload, 0, e
+	}
+	return upload, stat.Size(), nil
+}
+
+// Write appends the content of reader at offset, returns the new offset.
+// The content is discarded if the checksum does not match.
+func (t *TusUploader) Write(upload tusUpload, offset int64, reader io.Reader, checksum string) (int64, error) {
+	var h hash.Hash
+	var expected []byte
+	if checksum != "" {
+		var e error
+		h, expected, e = parseTusChecksum(checksum)
+		if e != nil {
+			return offset, e
+		}
+		reader = io.TeeReader(reader, h)
+	}
+	file, e := os.OpenFile(t.getFile(upload.Id), os.O_WRONLY, 0644)
+	if e != nil {
+		return offset, e
+	}
+	defer func() { _ = file.Close() }()
+	if _, e := file.Seek(offset, io.SeekStart); e != nil {
+		return offset, e
+	}
+	remaining := upload.Length - offset
+	written, e := io.Copy(file, io.LimitReader(reader, remaining+1))
+	if written > remaining {
+		_ = file.Truncate(offset)
+		return offset, tusError{http.StatusRequestEntityTooLarge, i18n.T("api.tus.size_exceeded")}
+	}
+	if h != nil {
+		if e != nil {
+			// the partial content can't be verified
+			_ = file.Truncate(offset)
+			return offset, e
+		}
+		if string(h.Sum(nil)) != string(expected) {
+			_ = file.Truncate(offset)
+			return offset, tusError{tusStatusChecksumMismatch, i18n.T("api.tus.checksum_mismatch")}
+		}
+	}
+	// the received content is kept when the connection is broken, the client can resume from the new offset
+	return offset + written, e
+}
+
+// Lock prevents the concurrent writing of the upload, returns the function to unlock
+func (t *TusUploader) Lock(id string) func() {
+	l, _ := t.locks.LoadOrStore(id, &sync.Mutex{})
+	l.(*sync.Mutex).Lock()
+	return l.(*sync.Mutex).Unlock
+}
+
+// startSaving marks the upload as being saved, it returns false if the upload is already being saved
+func (t *TusUploader) startSaving(id string) bool {
+	_, saving := t.saving.LoadOrStore(id, true)
+	return !saving
+}
+
+func (t *TusUploader) finishSaving(id string) {
+	t.saving.Delete(id)
+}
+
+func (t *TusUploader) isSaving(id string) bool {
+	_, saving := t.saving.Load(id)
+	return saving
+}
+
+func (t *TusUploader) DeleteUpload(id string) error {
+	defer t.locks.Delete(id)
+	return os.RemoveAll(t.getDir(id))
+}
+
+// clean removes the idle uploads, and the locks of the uploads not existing
+func (t *TusUploader) clean() {
+	files, e := ioutil.ReadDir(t.dir)
+	if e != nil {
+		tusLogger.Warn("error when cleaning idle tus uploads", "error", e)
+		return
+	}
+	n := 0
+	notBefore := time.Now().Add(-t.ttl)
+	for _, f := range files {
+		if !f.IsDir() || !strings.HasSuffix(f.Name(), tusUploadSuffix) {
+			continue
+		}
+		id := strings.TrimSuffix(f.Name(), tusUploadSuffix)
+		if t.cleanIfIdle(id, notBefore) {
+			n++
+		}
+	}
+	t.locks.Range(func(key, _ interface{}) bool {
+		if exists, _ := utils.FileExists(t.getDir(key.(string))); !exists {
+			t.locks.Delete(key)
+		}
+		return true
+	})
+	if n > 0 {
+		tusLogger.Info("idle tus uploads cleaned", "count", n)
+	}
+}
+
+func (t *TusUploader) cleanIfIdle(id string, notBefore time.Time) bool {
+	unlock := t.Lock(id)
+	defer unlock()
+	if t.isSaving(id) {
+		return false
+	}
+	idle, e := uploadIdleSince(t.getDir(id))
+	if e != nil {
+		tusLogger.Warn("error when cleaning idle tus uploads", "id", id, "error", e)
+		return false
+	}
+	if idle.After(notBefore) {
+		return false
+	}
+	if e := t.DeleteUpload(id); e != nil {
+		tusLogger.Warn("failed to delete tus upload", "id", id, "error", e)
+		return false
+	}
+	return true
+}
+
+func (t *TusUploader) Dispose() error {
+	if t.stopCleaner != nil {
+		t.stopCleaner()
+	}
+	return nil
+}
+
+func (t *TusUploader) getDir(id string) string {
+	return path2.Join(t.dir, id+tusUploadSuffix)
+}
+
+func (t *TusUploader) getInfo(id string) string {
+	return path2.Join(t.getDir(id), "info")
+}
+
+func (t *TusUploader) getFile(id string) string {
+	return path2.Join(t.getDir(id), "file")
+}
+
+// parseTusChecksum parses the Upload-Checksum header: '<algorithm> <base64 encoded checksum>'
+func parseTusChecksum(checksum string) (hash.Hash, []byte, error) {
+	parts := strings.SplitN(checksum, " ", 2)
+	if len(parts) != 2 {
+		return nil, nil, err.NewBadRequestError(i18n.T("api.tus.invalid_checksum"))
+	}
+	var h hash.Hash
+	switch parts[0] {
+	case "md5":
+		h = md5.New()
+	case "sha1":
+		h = sha1.New()
+	case "sha256":
+		h = sha256.New()
+	default:
+		return nil, nil, err.NewBadRequestError(i18n.T("api.tus.invalid_checksum"))
+	}
+	expected, e := base64.StdEncoding.DecodeString(parts[1])
+	if e != nil {
+		return nil, nil, err.NewBadRequestError(i18n.T("api.tus.invalid_checksum"))
+	}
+	return h, expected, nil
+}
+
+// parseTusMetadata parses the Upload-Metadata header: comma separated '<key> <base64 encoded value>'
+func parseTusMetadata(metadata string) (types.SM, error) {
+	m := types.SM{}
+	for _, pair := range strings.Split(metadata, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, " ", 2)
+		value := ""
+		if len(kv) == 2 {
+			v, e := base64.StdEncoding.DecodeString(kv[1])
+			if e != nil {
+				return nil, err.NewBadRequestError(i18n.T("api.tus.invalid_metadata"))
+			}
+			value = string(v)
+		}
+		m[kv[0]] = value
+	}
+	return m, nil
+}
+
+// tusOptions responds the capabilities of the server
+func tusOptions(c *gin.Context) {
+	c.Header(headerTusResumable, tusVersion)
+	c.Header(headerTusVersion, tusVersion)
+	c.Header(headerTusExtension, tusExtensions)
+	c.Header(headerTusChecksumAlgo, tusChecksums)
+	c.Status(http.StatusNoContent)
+}
+
+// tusResumable checks the protocol version of the requests
+func tusResumable(c *gin.Context) {
+	c.Header(headerTusResumable, tusVersion)
+	c.Header("Cache-Control", "no-store")
+	if c.GetHeader(headerTusResumable) != tusVersion {
+		c.Header(headerTusVersion, tusVersion)
+		_ = c.Error(tusError{http.StatusPreconditionFailed, i18n.T("api.tus.unsupported_version")})
+		c.Abort()
+	}
+}
+
+// tusCreate creates the upload, the target is specified by the 'path' metadata,
+// or the 'dir' and 'filename' metadata. The 'override' metadata allows overriding the existing file.
+func (dr *driveRoute) tusCreate(c *gin.Context) {
+	length, e := strconv.ParseInt(c.GetHeader(headerTusUploadLength), 10, 64)
+	if e != nil || length < 0 {
+		_ = c.Error(err.NewBadRequestError(i18n.T("api.tus.invalid_upload_length")))
+		return
+	}
+	metadata, e := parseTusMetadata(c.GetHeader(headerTusUploadMetadata))
+	if e != nil {
+		_ = c.Error(e)
+		return
+	}
+	path := metadata["path"]
+	if path == "" && metadata["filename"] != "" {
+		path = path2.Join(metadata["dir"], metadata["filename"])
+	}
+	path = utils.CleanPath(path)
+	if path == "" || utils.PathParent(path) == "" {
+		_ = c.Error(err.NewBadRequestError(i18n.T("api.tus.invalid_path")))
+		return
+	}
+	// same as the permission check of /upload
+	if _, e := dr.getDrive(c).requirePermission(path, types.PermissionReadWrite); e != nil {
+		_ = c.Error(e)
+		return
+	}
+	override := metadata["override"]
+	upload, e := dr.tusUploader.CreateUpload(tusUpload{
+		Path:     path,
+		Length:   length,
+		Override: override != "" && override != "0" && override != "false",
+		Owner:    GetSession(c).User.Username,
+	})
+	if e != nil {
+		_ = c.Error(e)
+		return
+	}
+	// relative to the request URL, so that it works behind the reverse proxies
+	location := upload.Id
+	if !strings.HasSuffix(c.Request.URL.Path, "/") {
+		location = utils.PathBase(c.Request.URL.Path) + "/" + upload.Id
+	}
+	c.Header("Location", location)
+	if length == 0 {
+		if e := dr.tusFinish(c, upload); e != nil {
+			_ = c.Error(e)
+			return
+		}
+	}
+	c.Status(http.StatusCreated)
+}
+
+func (dr *driveRoute) tusHead(c *gin.Context) {
+	upload, offset, e := dr.tusUploader.GetUpload(c.Param("id"), GetSession(c).User.Username)
+	if e != nil {
+		_ = c.Error(e)
+		return
+	}
+	c.Header(headerTusUploadOffset, strconv.FormatInt(offset, 10))
+	c.Header(headerTusUploadLength, strconv.FormatInt(upload.Length, 10))
+	c.Status(http.StatusOK)
+}
+
+// tusPatch appends the content, the file is saved when all the content is received.
+// A PATCH with an empty body at the end retries the saving.
+func (dr *driveRoute) tusPatch(c *gin.Context) {
+	if c.ContentType() != tusContentType {
+		_ = c.Error(tusError{http.StatusUnsupportedMediaType, i18n.T("api.tus.invalid_content_type")})
+		return
+	}
+	id := c.Param("id")
+	unlock := dr.tusUploader.Lock(id)
+	defer unlock()
+	upload, offset, e := dr.tusUploader.GetUpload(id, GetSession(c).User.Username)
+	if e != nil {
+		_ = c.Error(e)
+		return
+	}
+	if dr.tusUploader.isSaving(id) {
+		_ = c.Error(err.NewTimeoutError(i18n.T("api.tus.save_timeout")))
+		return
+	}
+	if c.GetHeader(headerTusUploadOffset) != strconv.FormatInt(offset, 10) {
+		_ = c.Error(tusError{http.StatusConflict, i18n.T("api.tus.offset_mismatch")})
+		return
+	}
+	offset, e = dr.tusUploader.Write(upload, offset, c.Request.Body, c.GetHeader(headerTusUploadChecksum))
+	if e != nil {
+		_ = c.Error(e)
+		return
+	}
+	if offset == upload.Length {
+		if e := dr.tusFinish(c, upload); e != nil {
+			_ = c.Error(e)
+			return
+		}
+	}
+	c.Header(headerTusUploadOffset, strconv.FormatInt(offset, 10))
+	c.Status(http.StatusNoContent)
+}
+
+// tusFinish saves the uploaded file to the drive, the upload is kept for retrying unless it's rejected.
+// The task may outlive the request, so it must not use the gin.Context.
+func (dr *driveRoute) tusFinish(c *gin.Context, upload tusUpload) error {
+	if !dr.tusUploader.startSaving(upload.Id) {
+		return err.NewTimeoutError(i18n.T("api.tus.save_timeout"))
+	}
+	drive := dr.getDrive(c)
+	// the error is sent before the task returns, it's buffered for the task may finish after the handler returns
+	result := make(chan error, 1)
+	t, e := dr.runner.ExecuteAndWait(c.Request.Context(), func(ctx types.TaskCtx) (_ interface{}, e error) {
+		defer func() {
+			dr.tusUploader.finishSaving(upload.Id)
+			result <- e
+		}()
+		file, e := os.Open(dr.tusUploader.getFile(upload.Id))
+		if e != nil {
+			return nil, e
+		}
+		_, e = dr.saveUpload(ctx, drive, upload.Path, upload.Override, file)
+		_ = file.Close()
+		if e == nil || err.IsNotAllowedError(e) {
+			// the other requests to the upload are refused while saving
+			_ = dr.tusUploader.DeleteUpload(upload.Id)
+		}
+		return nil, e
+	}, tusSaveWait)
+	if e != nil {
+		dr.tusUploader.finishSaving(upload.Id)
+		return e
+	}
+	if !t.Finished() {
+		return err.NewTimeoutError(i18n.T("api.tus.save_timeout"))
+	}
+	select {
+	case e := <-result:
+		return e
+	default:
+		// canceled before running
+		dr.tusUploader.finishSaving(upload.Id)
+		return task.ErrorCanceled
+	}
+}
+
+func (dr *driveRoute) tusDelete(c *gin.Context) {
+	id := c.Param("id")
+	unlock := dr.tusUploader.Lock(id)
+	defer unlock()
+	if _, _, e := dr.tusUploader.GetUpload(id, GetSession(c).User.Username); e != nil {
+		_ = c.Error(e)
+		return
+	}
+	if dr.tusUploader.isSaving(id) {
+		_ = c.Error(err.NewTimeoutError(i18n.T("api.tus.save_timeout")))
+		return
+	}
+	if e := dr.tusUploader.DeleteUpload(id); e != nil {
+		_ = c.Error(e)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,186 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"github.com/gin-gonic/gin"
+	"go-drive/common/registry"
+	"go-drive/common/task"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"go-drive/drive"
+	"go-drive/storage"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestDriveRoute creates the route of the fs drive 'd', which is writable by anyone.
+// The returned func disposes them.
+func newTestDriveRoute(t *testing.T) (*driveRoute, string, func()) {
+	db, config, cleanup := newTestDB(t)
+	config.UploadTempTTL = time.Hour
+	config.MaxConcurrentTask = 2
+	fsRoot, e := config.GetLocalFsDir()
+	if e != nil {
+		cleanup()
+		t.Fatal(e)
+	}
+	if e := os.Mkdir(filepath.Join(fsRoot, "d"), 0755); e != nil {
+		cleanup()
+		t.Fatal(e)
+	}
+	driveDAO := storage.NewDriveDAO(db)
+	if _, e := driveDAO.AddDrive(types.Drive{Name: "d", Enabled: true, Type: "fs", Config: `{"path":"d"}`}); e != nil {
+		cleanup()
+		t.Fatal(e)
+	}
+	permissionDAO := storage.NewPathPermissionDAO(db)
+	e = permissionDAO.SavePathPermissions("d", []types.PathPermission{
+		{Subject: types.AnySubject, Permission: types.PermissionReadWrite, Policy: types.PolicyAccept},
+	})
+	if e != nil {
+		cleanup()
+		t.Fatal(e)
+	}
+	ch := registry.NewComponentHolder()
+	rootDrive, e := drive.NewRootDrive(context.Background(), config, driveDAO,
+		storage.NewPathMountDAO(db), storage.NewDriveDataDAO(db), storage.NewDriveCacheDAO(db, ch))
+	if e != nil {
+		cleanup()
+		t.Fatal(e)
+	}
+	uploadHooks, e := NewUploadHooks(config, ch, storage.NewUploadHookDAO(db))
+	if e != nil {
+		cleanup()
+		t.Fatal(e)
+	}
+	tusUploader, e := NewTusUploader(config, ch)
+	if e != nil {
+		cleanup()
+		t.Fatal(e)
+	}
+	runner := task.NewTunnyRunner(config, ch)
+	dr := &driveRoute{
+		config:        config,
+		rootDrive:     rootDrive,
+		permissionDAO: permissionDAO,
+		tusUploader:   tusUploader,
+		runner:        runner,
+		uploadHooks:   uploadHooks,
+	}
+	return dr, filepath.Join(fsRoot, "d"), func() {
+		_ = tusUploader.Dispose()
+		_ = runner.Dispose()
+		cleanup()
+	}
+}
+
+func newTestTusEngine(dr *driveRoute) *gin.Engine {
+	engine := gin.New()
+	engine.Use(apiResultHandler(keyMessageSource{}))
+	tus := engine.Group("/tus", tusResumable)
+	tus.POST("", dr.tusCreate)
+	tus.HEAD("/:id", dr.tusHead)
+	tus.PATCH("/:id", dr.tusPatch)
+	tus.DELETE("/:id", dr.tusDelete)
+	return engine
+}
+
+func tusRequest(engine *gin.Engine, method, url string, body io.Reader, header types.SM) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, body)
+	req.Header.Set(headerTusResumable, tusVersion)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	return w
+}
+
+func TestTusUpload(t *testing.T) {
+	dr, dir, cleanup := newTestDriveRoute(t)
+	defer cleanup()
+	engine := newTestTusEngine(dr)
+
+	w := tusRequest(engine, "POST", "/tus", nil, types.SM{
+		headerTusUploadLength:   "11",
+		headerTusUploadMetadata: "path " + base64.StdEncoding.EncodeToString([]byte("d/a.txt")),
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expect 201, but it's %d: %s", w.Code, w.Body.String())
+	}
+	location := "/" + w.Header().Get("Location")
+	if !strings.HasPrefix(location, "/tus/") {
+		t.Fatalf("expect location of the upload, but it's '%s'", location)
+	}
+
+	patch := func(offset, content string) *httptest.ResponseRecorder {
+		return tusRequest(engine, "PATCH", location, strings.NewReader(content), types.SM{
+			"Content-Type": tusContentType, headerTusUploadOffset: offset,
+		})
+	}
+	w = patch("0", "hello")
+	if w.Code != http.StatusNoContent || w.Header().Get(headerTusUploadOffset) != "5" {
+		t.Fatalf("expect 204 at offset 5, but it's %d at '%s'", w.Code, w.Header().Get(headerTusUploadOffset))
+	}
+	w = tusRequest(engine, "HEAD", location, nil, nil)
+	if w.Code != http.StatusOK || w.Header().Get(headerTusUploadOffset) != "5" ||
+		w.Header().Get(headerTusUploadLength) != "11" {
+		t.Errorf("expect offset 5 of 11, but it's %d, '%s' of '%s'", w.Code,
+			w.Header().Get(headerTusUploadOffset), w.Header().Get(headerTusUploadLength))
+	}
+
+	if w := patch("3", " world"); w.Code != http.StatusConflict {
+		t.Errorf("expect 409 of the wrong offset, but it's %d", w.Code)
+	}
+
+	w = patch("5", " world")
+	if w.Code != http.StatusNoContent || w.Header().Get(headerTusUploadOffset) != "11" {
+		t.Fatalf("expect 204 at offset 11, but it's %d: %s", w.Code, w.Body.String())
+	}
+	content, e := ioutil.ReadFile(filepath.Join(dir, "a.txt"))
+	if e != nil {
+		t.Fatal(e)
+	}
+	if string(content) != "hello world" {
+		t.Errorf("expect 'hello world' saved, but it's '%s'", content)
+	}
+	if w := tusRequest(engine, "HEAD", location, nil, nil); w.Code != http.StatusNotFound {
+		t.Errorf("expect the saved upload removed, but it's %d", w.Code)
+	}
+}
+
+func TestTusUploaderClean(t *testing.T) {
+	dr, _, cleanup := newTestDriveRoute(t)
+	defer cleanup()
+	u := dr.tusUploader
+
+	idle, e := u.CreateUpload(tusUpload{Path: "d/a.txt", Length: 10})
+	if e != nil {
+		t.Fatal(e)
+	}
+	active, e := u.CreateUpload(tusUpload{Path: "d/b.txt", Length: 10})
+	if e != nil {
+		t.Fatal(e)
+	}
+	past := time.Now().Add(-2 * time.Hour)
+	for _, p := range []string{u.getInfo(idle.Id), u.getFile(idle.Id), u.getDir(idle.Id)} {
+		if e := os.Chtimes(p, past, past); e != nil {
+			t.Fatal(e)
+		}
+	}
+	u.clean()
+	if exists, _ := utils.FileExists(u.getDir(idle.Id)); exists {
+		t.Errorf("expect the idle upload cleaned")
+	}
+	if exists, _ := utils.FileExists(u.getDir(active.Id)); !exists {
+		t.Errorf("expect the active upload kept")
+	}
+}
@@ -0,0 +1,215 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"go-drive/common/errors"
+	"go-drive/common/i18n"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"go-drive/storage"
+	"strings"
+	"time"
+)
+
+const (
+	// optTOTPRequireForAdmin requires members of the admin group to pass 2FA before accessing admin APIs
+	optTOTPRequireForAdmin = "totp.require_for_admin"
+
+	totpIssuer         = "go-drive"
+	recoveryCodesCount = 10
+)
+
+// TwoFactorAuth manages the TOTP two-factor authentication of users
+type TwoFactorAuth struct {
+	totpDAO    *storage.UserTOTPDAO
+	optionsDAO *storage.OptionsDAO
+}
+
+func NewTwoFactorAuth(totpDAO *storage.UserTOTPDAO, optionsDAO *storage.OptionsDAO) *TwoFactorAuth {
+	return &TwoFactorAuth{totpDAO: totpDAO, optionsDAO: optionsDAO}
+}
+
+func (t *TwoFactorAuth) IsEnabled(username string) (bool, error) {
+	totp, e := t.totpDAO.Get(username)
+	if e != nil {
+		return false, e
+	}
+	return totp != nil && totp.Enabled, nil
+}
+
+// IsRequiredForAdmin returns if the admin policy requires 2FA
+func (t *TwoFactorAuth) IsRequiredForAdmin() (bool, error) {
+	v, e := t.optionsDAO.Get(optTOTPRequireForAdmin)
+	return v == "true", e
+}
+
+// Enroll generates a new secret for the user, it takes effect after Enable
+func (t *TwoFactorAuth) Enroll(username string) (string, string, error) {
+	enabled, e := t.IsEnabled(username)
+	if e != nil {
+		return "", "", e
+	}
+	if enabled {
+		return "", "", err.NewNotAllowedMessageError(i18n.T("api.two_factor.already_enabled"))
+	}
+	secret, e := utils.NewTOTPSecret()
+	if e != nil {
+		return "", "", e
+	}
+	if e := t.totpDAO.Save(types.UserTOTP{Username: username, Secret: secret}); e != nil {
+		return "", "", e
+	}
+	return secret, utils.TOTPURI(totpIssuer, username, secret), nil
+}
+
+// Enable confirms the enrollment by the code, returns the recovery codes
+func (t *TwoFactorAuth) Enable(username, code string) ([]string, error) {
+	totp, e := t.totpDAO.Get(username)
+	if e != nil {
+		return nil, e
+	}
+	if totp == nil {
+		return nil, err.NewNotAllowedMessageError(i18n.T("api.two_factor.not_enrolled"))
+	}
+	if totp.Enabled {
+		return nil, err.NewNotAllowedMessageError(i18n.T("api.two_factor.already_enabled"))
+	}
+	counter := utils.ValidateTOTP(totp.Secret, code, time.Now(), totp.LastCounter)
+	if counter < 0 {
+		return nil, err.NewBadRequestError(i18n.T("api.two_factor.invalid_code"))
+	}
+	codes, hashed, e := newRecoveryCodes()
+	if e != nil {
+		return nil, e
+	}
+	totp.Enabled = true
+	totp.LastCounter = counter
+	totp.RecoveryCodes = hashed
+	if e := t.totpDAO.Save(*totp); e != nil {
+		return nil, e
+	}
+	return codes, nil
+}
+
+// Disable disables 2FA of the user after verifying the code
+func (t *TwoFactorAuth) Disable(username, code string) error {
+	if e := t.Verify(username, code); e != nil {
+		return e
+	}
+	return t.totpDAO.Delete(username)
+}
+
+// Reset removes 2FA of the user without verification, used by admin
+func (t *TwoFactorAuth) Reset(username string) error {
+	return t.totpDAO.Delete(username)
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes after verifying the code
+func (t *TwoFactorAuth) RegenerateRecoveryCodes(username, code string) ([]string, error) {
+	if e := t.Verify(username, code); e != nil {
+		return nil, e
+	}
+	totp, e := t.totpDAO.Get(username)
+	if e != nil {
+		return nil, e
+	}
+	codes, hashed, e := newRecoveryCodes()
+	if e != nil {
+		return nil, e
+	}
+	ok, e := t.totpDAO.UpdateRecoveryCodes(username, totp.RecoveryCodes, hashed)
+	if e != nil {
+		return nil, e
+	}
+	if !ok {
+		return nil, err.NewBadRequestError(i18n.T("api.two_factor.invalid_code"))
+	}
+	return codes, nil
+}
+
+// Verify checks the TOTP code or recovery code, the recovery code can only be used once
+func (t *TwoFactorAuth) Verify(username, code string) error {
+	totp, e := t.totpDAO.Get(username)
+	if e != nil {
+		return e
+	}
+	if totp == nil || !totp.Enabled {
+		return err.NewNotAllowedMessageError(i18n.T("api.two_factor.not_enrolled"))
+	}
+	code = strings.TrimSpace(code)
+	if counter := utils.ValidateTOTP(totp.Secret, code, time.Now(), totp.LastCounter); counter >= 0 {
+		ok, e := t.totpDAO.UpdateLastCounter(username, counter)
+		if e != nil {
+			return e
+		}
+		if ok {
+			return nil
+		}
+		return err.NewBadRequestError(i18n.T("api.two_factor.invalid_code"))
+	}
+	hashedCode := hashRecoveryCode(code)
+	remaining := make([]string, 0)
+	found := false
+	for _, h := range strings.Split(totp.RecoveryCodes, ",") {
+		if h == "" {
+			continue
+		}
+		if !found && subtle.ConstantTimeCompare([]byte(h), []byte(hashedCode)) == 1 {
+			found = true
+			continue
+		}
+		remaining = append(remaining, h)
+	}
+	if !found {
+		return err.NewBadRequestError(i18n.T("api.two_factor.invalid_code"))
+	}
+	ok, e := t.totpDAO.UpdateRecoveryCodes(username, totp.RecoveryCodes, strings.Join(remaining, ","))
+	if e != nil {
+		return e
+	}
+	if !ok {
+		return err.NewBadRequestError(i18n.T("api.two_factor.invalid_code"))
+	}
+	return nil
+}
+
+// loginSession sets the user to the session, returns the session to be saved and if 2FA is required.
+// If the user enabled 2FA, the session will be pending until the 2FA verification passed.
+func loginSession(twoFactor *TwoFactorAuth, session types.Session, user types.User) (types.Session, bool, error) {
+	enabled, e := twoFactor.IsEnabled(user.Username)
+	if e != nil {
+		return session, false, e
+	}
+	session.TwoFactorVerified = false
+	if enabled {
+		session.User = types.User{}
+		session.PendingUsername = user.Username
+	} else {
+		session.User = user
+		session.PendingUsername = ""
+	}
+	return session, enabled, nil
+}
+
+func newRecoveryCodes() ([]string, string, error) {
+	codes := make([]string, recoveryCodesCount)
+	hashed := make([]string, recoveryCodesCount)
+	b := make([]byte, 5)
+	for i := range codes {
+		if _, e := rand.Read(b); e != nil {
+			return nil, "", e
+		}
+		s := hex.EncodeToString(b)
+		codes[i] = s[:5] + "-" + s[5:]
+		hashed[i] = hashRecoveryCode(codes[i])
+	}
+	return codes, strings.Join(hashed, ","), nil
+}
+
+func hashRecoveryCode(code string) string {
+	h := sha256.Sum256([]byte(strings.ToLower(strings.ReplaceAll(code, "-", ""))))
+	return hex.EncodeToString(h[:])
+}
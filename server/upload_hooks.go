@@ -0,0 +1,233 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"go-drive/common"
+	"go-drive/common/errors"
+	"go-drive/common/i18n"
+	"go-drive/common/logging"
+	"go-drive/common/registry"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"go-drive/storage"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	path2 "path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// UploadHookAccept is the exit code of the hook to accept the upload
+	UploadHookAccept = 0
+	// UploadHookQuarantine is the exit code of the hook to move the file to the quarantine dir,
+	// all the other exit codes reject the upload
+	UploadHookQuarantine = 2
+
+	uploadHookDefaultTimeout = time.Minute
+	uploadHookMaxOutputSize  = 1024
+
+	envUploadHookPath = "GO_DRIVE_PATH"
+	envUploadHookFile = "GO_DRIVE_FILE"
+)
+
+var uploadHookLogger = logging.For("upload_hook")
+
+// UploadHooks runs the commands of the hooks matching the path on the uploaded files before saving them.
+// The hooks run in the upload task of task.Runner, the command is killed when it times out or the task is canceled.
+// A hook that fails to start, times out, or exits with a code
+// other than UploadHookAccept and UploadHookQuarantine rejects the upload.
+// Commands are only run if it's enabled by the config.
+type UploadHooks struct {
+	enabled       bool
+	tempDir       string
+	quarantineDir string
+	dao           *storage.UploadHookDAO
+
+	// hooks are the enabled hooks
+	hooks []types.UploadHook
+	mux   *sync.RWMutex
+}
+
+func NewUploadHooks(config common.Config, ch *registry.ComponentsHolder,
+	dao *storage.UploadHookDAO) (*UploadHooks, error) {
+	u := &UploadHooks{
+		enabled: config.UploadHooks,
+		tempDir: config.TempDir,
+		dao:     dao,
+		mux:     &sync.RWMutex{},
+	}
+	if u.enabled {
+		dir, e := config.GetDir(quarantineDirName, true)
+		if e != nil {
+			return nil, e
+		}
+		u.quarantineDir = dir
+	}
+	if e := u.Reload(); e != nil {
+		return nil, e
+	}
+	ch.Add("uploadHooks", u)
+	return u, nil
+}
+
+// Enabled returns true if the commands of the hooks can be run
+func (u *UploadHooks) Enabled() bool {
+	return u.enabled
+}
+
+// Reload loads the enabled hooks
+func (u *UploadHooks) Reload() error {
+	hooks, e := u.dao.GetHooks()
+	if e != nil {
+		return e
+	}
+	enabled := make([]types.UploadHook, 0, len(hooks))
+	for _, h := range hooks {
+		if h.Enabled {
+			enabled = append(enabled, h)
+		}
+	}
+	u.mux.Lock()
+	defer u.mux.Unlock()
+	u.hooks = enabled
+	return nil
+}
+
+func (u *UploadHooks) match(path string) []types.UploadHook {
+	u.mux.RLock()
+	defer u.mux.RUnlock()
+	result := make([]types.UploadHook, 0)
+	for _, h := range u.hooks {
+		if ok, _ := utils.MatchPath(h.Pattern, path); ok {
+			result = append(result, h)
+		}
+	}
+	return result
+}
+
+// Matches returns true if any hook will run on the file uploaded to path
+func (u *UploadHooks) Matches(path string) bool {
+	return u.enabled && len(u.match(path)) > 0
+}
+
+// Run runs the hooks matching the path in order,
+// returns NotAllowedError if the file is rejected or quarantined by any of them.
+// The hooks may modify the file, so the caller should stat it again after running.
+func (u *UploadHooks) Run(ctx types.TaskCtx, path string, file *os.File) error {
+	if !u.enabled {
+		return nil
+	}
+	for _, h := range u.match(path) {
+		code, e := u.exec(ctx, h, path, file.Name())
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log := uploadHookLogger.Ctx(ctx)
+		switch {
+		case e == nil && code == UploadHookAccept:
+			continue
+		case e == nil && code == UploadHookQuarantine:
+			dest, qe := quarantineFile(u.quarantineDir, path, file.Name())
+			if qe != nil {
+				log.Error("error when quarantining file", "hook", h.Name, "path", path, "error", qe)
+				return qe
+			}
+			log.Warn("file quarantined by upload hook", "hook", h.Name, "path", path, "quarantine", dest)
+			return err.NewNotAllowedMessageError(i18n.T("api.upload_hook.quarantined", h.Name))
+		default:
+			log.Warn("file rejected by upload hook", "hook", h.Name, "path", path, "exit_code", code, "error", e)
+			return err.NewNotAllowedMessageError(i18n.T("api.upload_hook.rejected", h.Name))
+		}
+	}
+	return nil
+}
+
+// exec runs the command of the hook, returns the exit code, or the error if the command didn't exit normally
+func (u *UploadHooks) exec(ctx types.TaskCtx, h types.UploadHook, path, file string) (int, error) {
+	args := strings.Fields(h.Command)
+	if len(args) == 0 {
+		return -1, fmt.Errorf("empty command")
+	}
+	timeout := uploadHookDefaultTimeout
+	if h.Timeout > 0 {
+		timeout = time.Duration(h.Timeout) * time.Second
+	}
+	cmdCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// the output is written to a file rather than a pipe,
+	// or Wait would not return until the children of the killed command exit
+	output, e := ioutil.TempFile(u.tempDir, "hook-output-")
+	if e != nil {
+		return -1, e
+	}
+	defer func() {
+		_ = output.Close()
+		_ = os.Remove(output.Name())
+	}()
+
+	cmd := exec.CommandContext(cmdCtx, args[0], append(args[1:], path, file)...)
+	cmd.Env = append(os.Environ(), envUploadHookPath+"="+path, envUploadHookFile+"="+file)
+	cmd.Stdout = output
+	cmd.Stderr = output
+	e = cmd.Run()
+	if cmdCtx.Err() == context.DeadlineExceeded {
+		e = fmt.Errorf("timeout after %s", timeout)
+	}
+	code := -1
+	if cmd.ProcessState != nil {
+		code = cmd.ProcessState.ExitCode()
+	}
+	if _, ok := e.(*exec.ExitError); ok {
+		e = nil
+	}
+	if code != UploadHookAccept {
+		uploadHookLogger.Ctx(ctx).Debug("upload hook exited", "hook", h.Name, "path", path,
+			"exit_code", code, "output", tailOfFile(output, uploadHookMaxOutputSize))
+	}
+	return code, e
+}
+
+func (u *UploadHooks) Status() (string, types.SM, error) {
+	u.mux.RLock()
+	defer u.mux.RUnlock()
+	return "Upload hooks", types.SM{
+		"Enabled": strconv.FormatBool(u.enabled),
+		"Hooks":   strconv.Itoa(len(u.hooks)),
+	}, nil
+}
+
+// tailOfFile reads at most n bytes at the end of the file
+func tailOfFile(file *os.File, n int64) string {
+	stat, e := file.Stat()
+	if e != nil {
+		return ""
+	}
+	offset := stat.Size() - n
+	if offset < 0 {
+		offset = 0
+	}
+	b := make([]byte, stat.Size()-offset)
+	read, _ := file.ReadAt(b, offset)
+	return strings.TrimSpace(string(b[:read]))
+}
+
+// checkUploadHook validates the pattern and the command of the hook
+func checkUploadHook(h *types.UploadHook) error {
+	h.Pattern = utils.CleanPath(h.Pattern)
+	for _, segment := range strings.Split(h.Pattern, "/") {
+		if _, e := path2.Match(segment, ""); e != nil {
+			return err.NewBadRequestError(i18n.T("api.admin.invalid_upload_hook_pattern", h.Pattern))
+		}
+	}
+	h.Command = strings.TrimSpace(h.Command)
+	if h.Command == "" || h.Timeout < 0 {
+		return err.NewBadRequestError(i18n.T("api.admin.invalid_upload_hook_command"))
+	}
+	return nil
+}
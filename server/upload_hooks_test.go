@@ -0,0 +1,77 @@
+package server
+
+import (
+	"go-drive/common/errors"
+	"go-drive/common/registry"
+	"go-drive/common/task"
+	"go-drive/common/types"
+	"go-drive/storage"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// uploadHookScript exits with the code by the name of the uploaded path
+const uploadHookScript = `case "$1" in
+*accept*) exit 0 ;;
+*quarantine*) exit 2 ;;
+*slow*) sleep 10 ;;
+*) exit 1 ;;
+esac
+`
+
+func TestUploadHooksRun(t *testing.T) {
+	db, config, cleanup := newTestDB(t)
+	defer cleanup()
+	config.UploadHooks = true
+	script := filepath.Join(config.TempDir, "hook.sh")
+	if e := ioutil.WriteFile(script, []byte(uploadHookScript), 0644); e != nil {
+		t.Fatal(e)
+	}
+	dao := storage.NewUploadHookDAO(db)
+	if _, e := dao.AddHook(types.UploadHook{
+		Name: "test", Pattern: "d/**", Command: "sh " + script, Timeout: 1, Enabled: true,
+	}); e != nil {
+		t.Fatal(e)
+	}
+	hooks, e := NewUploadHooks(config, registry.NewComponentHolder(), dao)
+	if e != nil {
+		t.Fatal(e)
+	}
+	file, e := ioutil.TempFile(config.TempDir, "upload-")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() { _ = file.Close() }()
+
+	if e := hooks.Run(task.DummyContext(), "d/accept.txt", file); e != nil {
+		t.Errorf("expect accepted by exit code 0, but it's %v", e)
+	}
+	if e := hooks.Run(task.DummyContext(), "e/rejected.txt", file); e != nil {
+		t.Errorf("expect the hook not run on the path not matched, but it's %v", e)
+	}
+	if e := hooks.Run(task.DummyContext(), "d/rejected.txt", file); !err.IsNotAllowedError(e) {
+		t.Errorf("expect rejected by exit code 1, but it's %v", e)
+	}
+	if e := hooks.Run(task.DummyContext(), "d/slow.txt", file); !err.IsNotAllowedError(e) {
+		t.Errorf("expect rejected by timeout, but it's %v", e)
+	}
+	if files, _ := ioutil.ReadDir(hooks.quarantineDir); len(files) != 0 {
+		t.Errorf("expect no file quarantined, but it's %d", len(files))
+	}
+
+	if e := hooks.Run(task.DummyContext(), "d/quarantine.txt", file); !err.IsNotAllowedError(e) {
+		t.Errorf("expect rejected by exit code 2, but it's %v", e)
+	}
+	files, e := ioutil.ReadDir(hooks.quarantineDir)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(files) != 1 {
+		t.Fatalf("expect the file quarantined, but it's %d files", len(files))
+	}
+	if _, e := os.Stat(file.Name()); e != nil {
+		t.Errorf("expect the uploaded file kept for the caller, but it's %v", e)
+	}
+}
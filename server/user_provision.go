@@ -0,0 +1,186 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"go-drive/common/errors"
+	"go-drive/common/i18n"
+	"go-drive/common/types"
+	"go-drive/storage"
+	"strings"
+)
+
+// externalIdentity is the account authenticated by the external identity provider
+type externalIdentity struct {
+	issuer  string
+	subject string
+	// username is the name of the user created for the identity
+	username string
+	// groups is nil if the provider doesn't supply the groups
+	groups []string
+}
+
+// provisionUser gets or creates(just-in-time) the user bound to the external identity.
+// The existing local user can only be logged in by the identity linked by admins,
+// the unlinked identity with the same name as a local user is refused rather than taking over it.
+// If groups is not nil, the groups assigned by the provider last time are replaced by them,
+// the groups assigned locally are kept, and the missing groups will be created.
+func provisionUser(userDAO *storage.UserDAO, groupDAO *storage.GroupDAO,
+	identityDAO *storage.UserIdentityDAO, ei externalIdentity) (types.User, error) {
+	identity, e := identityDAO.Get(ei.issuer, ei.subject)
+	if e != nil {
+		return types.User{}, e
+	}
+	conflict, e := isUnlinkedLocalUser(userDAO, identity, ei.username)
+	if e != nil {
+		return types.User{}, e
+	}
+	if conflict {
+		return types.User{}, err.NewUnauthorizedError(i18n.T("api.auth.identity_not_linked", ei.username))
+	}
+	if identity == nil {
+		// the password is never used, the user can only login via the external provider
+		password, e := randomPassword()
+		if e != nil {
+			return types.User{}, e
+		}
+		if _, e := userDAO.AddUser(types.User{Username: ei.username, Password: password}); e != nil {
+			return types.User{}, e
+		}
+		added, e := identityDAO.Add(types.UserIdentity{
+			Issuer: ei.issuer, Subject: ei.subject, Username: ei.username, Provisioned: true,
+		})
+		if e != nil {
+			return types.User{}, e
+		}
+		identity = &added
+	}
+	user, e := userDAO.GetUser(identity.Username)
+	if e != nil {
+		return types.User{}, e
+	}
+	if ei.groups != nil {
+		if e := syncAssignedGroups(userDAO, groupDAO, identityDAO, user, *identity, ei.groups); e != nil {
+			return types.User{}, e
+		}
+		return userDAO.GetUser(identity.Username)
+	}
+	return user, nil
+}
+
+// isUnlinkedLocalUser checks if the identity is not bound, but the local user with the same name exists.
+// identity is the bound identity got by the caller, nil if it's not bound.
+func isUnlinkedLocalUser(userDAO *storage.UserDAO, identity *types.UserIdentity, username string) (bool, error) {
+	if identity != nil {
+		return false, nil
+	}
+	_, e := userDAO.GetUser(username)
+	if e == nil {
+		return true, nil
+	}
+	if err.IsNotFoundError(e) {
+		return false, nil
+	}
+	return false, e
+}
+
+// syncAssignedGroups replaces the groups assigned by the provider, the groups assigned locally are never removed
+func syncAssignedGroups(userDAO *storage.UserDAO, groupDAO *storage.GroupDAO, identityDAO *storage.UserIdentityDAO,
+	user types.User, identity types.UserIdentity, groups []string) error {
+	previous := make(map[string]bool)
+	for _, g := range strings.Split(identity.AssignedGroups, ",") {
+		if g != "" {
+			previous[g] = true
+		}
+	}
+	local := make(map[string]bool)
+	userGroups := make([]types.Group, 0, len(user.Groups)+len(groups))
+	for _, g := range user.Groups {
+		if !previous[g.Name] {
+			local[g.Name] = true
+			userGroups = append(userGroups, types.Group{Name: g.Name})
+		}
+	}
+	assigned := make([]string, 0, len(groups))
+	for _, g := range groups {
+		if local[g] {
+			continue
+		}
+		if e := ensureGroup(groupDAO, g); e != nil {
+			return e
+		}
+		userGroups = append(userGroups, types.Group{Name: g})
+		assigned = append(assigned, g)
+	}
+	if e := userDAO.UpdateUser(user.Username, types.User{Groups: userGroups}); e != nil {
+		return e
+	}
+	return identityDAO.UpdateAssignedGroups(identity.Issuer, identity.Subject, strings.Join(assigned, ","))
+}
+
+// mapExternalGroups maps the groups of external providers to go-drive groups.
+// mapping is in the form of 'externalGroup:group,externalGroup2:group2',
+// if it's empty, external groups are mapped to the existing groups with the same name except 'admin',
+// which can only be mapped explicitly.
+func mapExternalGroups(groupDAO *storage.GroupDAO, groups []string, mapping string) ([]string, error) {
+	m := parseGroupMapping(mapping)
+	if m == nil {
+		all, e := groupDAO.ListGroup()
+		if e != nil {
+			return nil, e
+		}
+		m = make(map[string]string, len(all))
+		for _, g := range all {
+			if g.Name != "admin" {
+				m[g.Name] = g.Name
+			}
+		}
+	}
+	added := make(map[string]bool)
+	result := make([]string, 0)
+	for _, g := range groups {
+		g = m[g]
+		if g != "" && !added[g] {
+			added[g] = true
+			result = append(result, g)
+		}
+	}
+	return result, nil
+}
+
+func parseGroupMapping(s string) map[string]string {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil
+	}
+	m := make(map[string]string)
+	for _, item := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == '\n' }) {
+		kv := strings.SplitN(item, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		// keycloak group path starts with '/'
+		m[strings.TrimPrefix(strings.TrimSpace(kv[0]), "/")] = strings.TrimSpace(kv[1])
+	}
+	return m
+}
+
+func ensureGroup(groupDAO *storage.GroupDAO, name string) error {
+	_, e := groupDAO.GetGroup(name)
+	if e == nil {
+		return nil
+	}
+	if !err.IsNotFoundError(e) {
+		return e
+	}
+	_, e = groupDAO.AddGroup(storage.GroupWithUsers{Group: types.Group{Name: name}})
+	return e
+}
+
+func randomPassword() (string, error) {
+	b := make([]byte, 24)
+	if _, e := rand.Read(b); e != nil {
+		return "", e
+	}
+	return hex.EncodeToString(b), nil
+}
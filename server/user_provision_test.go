@@ -0,0 +1,129 @@
+package server
+
+import (
+	"go-drive/common/errors"
+	"go-drive/common/types"
+	"go-drive/storage"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func groupNames(u types.User) string {
+	names := make([]string, 0, len(u.Groups))
+	for _, g := range u.Groups {
+		names = append(names, g.Name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+func TestProvisionUser(t *testing.T) {
+	db, _, cleanup := newTestDB(t)
+	defer cleanup()
+	userDAO := storage.NewUserDAO(db)
+	groupDAO := storage.NewGroupDAO(db)
+	identityDAO := storage.NewUserIdentityDAO(db)
+
+	ei := externalIdentity{issuer: "https://idp", subject: "s1", username: "alice", groups: []string{"dev"}}
+	user, e := provisionUser(userDAO, groupDAO, identityDAO, ei)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if user.Username != "alice" || groupNames(user) != "dev" {
+		t.Errorf("expect user 'alice' of group 'dev', but it's '%s' of '%s'", user.Username, groupNames(user))
+	}
+
+	// the username supplied by the IdP is changed, but the bound user is logged in
+	ei.username = "alice2"
+	user, e = provisionUser(userDAO, groupDAO, identityDAO, ei)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if user.Username != "alice" {
+		t.Errorf("expect the bound user 'alice', but it's '%s'", user.Username)
+	}
+}
+
+func TestProvisionUserRefuseLocalUser(t *testing.T) {
+	db, _, cleanup := newTestDB(t)
+	defer cleanup()
+	userDAO := storage.NewUserDAO(db)
+	groupDAO := storage.NewGroupDAO(db)
+	identityDAO := storage.NewUserIdentityDAO(db)
+
+	ei := externalIdentity{issuer: "https://idp", subject: "s1", username: "admin", groups: []string{}}
+	if _, e := provisionUser(userDAO, groupDAO, identityDAO, ei); !isUnauthorized(e) {
+		t.Errorf("expect UnauthorizedError, but it's %v", e)
+	}
+	admin, e := userDAO.GetUser("admin")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if groupNames(admin) != "admin" {
+		t.Errorf("expect groups of admin not changed, but it's '%s'", groupNames(admin))
+	}
+
+	// linked by admins
+	if _, e := identityDAO.Add(types.UserIdentity{Issuer: "https://idp", Subject: "s1", Username: "admin"}); e != nil {
+		t.Fatal(e)
+	}
+	ei.groups = []string{"dev"}
+	user, e := provisionUser(userDAO, groupDAO, identityDAO, ei)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if groupNames(user) != "admin,dev" {
+		t.Errorf("expect the local groups kept, but it's '%s'", groupNames(user))
+	}
+
+	// only the groups assigned by the provider are removed
+	ei.groups = []string{}
+	user, e = provisionUser(userDAO, groupDAO, identityDAO, ei)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if groupNames(user) != "admin" {
+		t.Errorf("expect groups 'admin', but it's '%s'", groupNames(user))
+	}
+}
+
+func TestMapExternalGroups(t *testing.T) {
+	db, _, cleanup := newTestDB(t)
+	defer cleanup()
+	groupDAO := storage.NewGroupDAO(db)
+	if e := ensureGroup(groupDAO, "dev"); e != nil {
+		t.Fatal(e)
+	}
+
+	groups, e := mapExternalGroups(groupDAO, []string{"admin", "dev", "unknown"}, "")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if strings.Join(groups, ",") != "dev" {
+		t.Errorf("expect 'admin' not mapped implicitly, but it's '%s'", strings.Join(groups, ","))
+	}
+
+	groups, e = mapExternalGroups(groupDAO, []string{"ops", "dev"}, "ops:admin")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if strings.Join(groups, ",") != "admin" {
+		t.Errorf("expect 'admin' mapped explicitly, but it's '%s'", strings.Join(groups, ","))
+	}
+}
+
+func isUnauthorized(e error) bool {
+	_, ok := e.(err.UnauthorizedError)
+	return ok
+}
+
+func TestParseGroupMapping(t *testing.T) {
+	m := parseGroupMapping(" /ops : admin ,\ndev:developers,invalid")
+	if len(m) != 2 || m["ops"] != "admin" || m["dev"] != "developers" {
+		t.Errorf("expect {ops:admin, dev:developers}, but it's %v", m)
+	}
+	if parseGroupMapping("  ") != nil {
+		t.Errorf("expect nil of empty mapping")
+	}
+}
@@ -2,10 +2,12 @@ package server
 
 import (
 	"github.com/gin-gonic/gin"
+	"go-drive/common/errors"
 	"go-drive/common/i18n"
 	"go-drive/common/types"
 	"go-drive/common/utils"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -48,12 +50,57 @@ func SetSession(c *gin.Context, session types.Session) {
 func UpdateSessionUser(c *gin.Context, tokenStore types.TokenStore, user types.User) error {
 	session := GetSession(c)
 	session.User = user
-	_, e := tokenStore.Update(GetToken(c), session)
-	return e
+	session.PendingUsername = ""
+	session.TwoFactorVerified = false
+	return UpdateSession(c, tokenStore, session)
+}
+
+// UpdateSession saves the session of the request,
+// the client will be notified if the token store issued a new token
+func UpdateSession(c *gin.Context, tokenStore types.TokenStore, session types.Session) error {
+	t, e := tokenStore.Update(GetToken(c), session)
+	if e != nil {
+		return e
+	}
+	SetSession(c, t.Value)
+	renewToken(c, t.Token)
+	return nil
+}
+
+func renewToken(c *gin.Context, token string) {
+	if token == GetToken(c) {
+		return
+	}
+	SetToken(c, token)
+	c.Header(headerRenewedToken, token)
+}
+
+type requestClientKey struct{}
+
+// requestClient is the client of the request resolved by the ClientIP middleware
+type requestClient struct {
+	ip string
+	// trustedProxy is true if the request comes from the trusted proxies
+	trustedProxy bool
+}
+
+// GetClientIP returns the ip of the client resolved by the ClientIP middleware,
+// or the ip of the peer if the request is not handled by it
+func GetClientIP(req *http.Request) string {
+	if client, ok := req.Context().Value(requestClientKey{}).(requestClient); ok {
+		return client.ip
+	}
+	return utils.ClientIP(req, nil)
+}
+
+// isFromTrustedProxy returns true if the X-Forwarded-* headers of the request can be trusted
+func isFromTrustedProxy(req *http.Request) bool {
+	client, _ := req.Context().Value(requestClientKey{}).(requestClient)
+	return client.trustedProxy
 }
 
 func getSignPayload(req *http.Request, path string) string {
-	return req.Host + "." + path + "." + utils.GetRealIP(req)
+	return req.Host + "." + path + "." + GetClientIP(req)
 }
 
 func checkSignature(signer *utils.Signer, req *http.Request, path string) bool {
@@ -72,3 +119,12 @@ func TranslateV(c *gin.Context, ms i18n.MessageSource, v interface{}) interface{
 	}
 	return i18n.TranslateV(lang, ms, v)
 }
+
+// getIdParam parses the 'id' param of the route
+func getIdParam(c *gin.Context) (uint, error) {
+	id, e := strconv.ParseUint(c.Param("id"), 10, 32)
+	if e != nil {
+		return 0, err.NewNotFoundError()
+	}
+	return uint(id), nil
+}
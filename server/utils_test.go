@@ -0,0 +1,68 @@
+package server
+
+import (
+	"github.com/gin-gonic/gin"
+	"go-drive/common"
+	"go-drive/common/registry"
+	"go-drive/common/utils"
+	"go-drive/storage"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+// newTestDB creates the database in a temp dir, the returned func removes them
+func newTestDB(t *testing.T) (*storage.DB, common.Config, func()) {
+	dir, e := ioutil.TempDir("", "go-drive-test")
+	if e != nil {
+		t.Fatal(e)
+	}
+	config := common.NewSqliteConfig(dir)
+	config.TempDir = dir
+	db, e := storage.NewDB(config, registry.NewComponentHolder())
+	if e != nil {
+		_ = os.RemoveAll(dir)
+		t.Fatal(e)
+	}
+	return db, config, func() {
+		_ = db.Dispose()
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func TestGetClientIP(t *testing.T) {
+	trusted, e := utils.ParseCIDRs("10.0.0.1")
+	if e != nil {
+		t.Fatal(e)
+	}
+	engine := gin.New()
+	engine.Use(ClientIP(trusted))
+	engine.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, GetClientIP(c.Request))
+	})
+	for _, c := range []struct {
+		remoteAddr, forwarded, expect string
+	}{
+		{"192.0.2.1:1234", "198.51.100.1", "192.0.2.1"},
+		{"10.0.0.1:1234", "198.51.100.1", "198.51.100.1"},
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = c.remoteAddr
+		req.Header.Set("X-Forwarded-For", c.forwarded)
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		if w.Body.String() != c.expect {
+			t.Errorf("%s of %s: expect '%s', but it's '%s'", c.forwarded, c.remoteAddr, c.expect, w.Body.String())
+		}
+	}
+
+	// not resolved by the middleware
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+	if ip := GetClientIP(req); ip != "192.0.2.1" {
+		t.Errorf("expect the peer ip, but it's '%s'", ip)
+	}
+}
@@ -0,0 +1,218 @@
+package server
+
+import (
+	"context"
+	"go-drive/common"
+	"go-drive/common/clamd"
+	"go-drive/common/drive_util"
+	"go-drive/common/errors"
+	"go-drive/common/i18n"
+	"go-drive/common/logging"
+	"go-drive/common/registry"
+	"go-drive/common/task"
+	"go-drive/common/types"
+	"go-drive/drive"
+	"go-drive/storage"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+var scanLogger = logging.For("virus_scanner")
+
+// VirusScanner scans the files by clamd before saving them,
+// the infected files are rejected, and copied to the quarantine dir if it's enabled.
+// The files are also rejected if they can't be scanned.
+// The verdicts of the saved files are recorded, and follow the moves and deletions of the entries.
+// The files changed outside go-drive have no verdicts.
+type VirusScanner struct {
+	client        *clamd.Client
+	address       string
+	quarantineDir string
+	tempDir       string
+	dao           *storage.EntryScanDAO
+	unsubscribe   func()
+}
+
+func NewVirusScanner(config common.Config, ch *registry.ComponentsHolder,
+	rootDrive *drive.RootDrive, dao *storage.EntryScanDAO) (*VirusScanner, error) {
+	v := &VirusScanner{address: config.ClamdAddress, tempDir: config.TempDir, dao: dao}
+	if config.ClamdAddress != "" {
+		client, e := clamd.NewClient(config.ClamdAddress, config.ClamdTimeout)
+		if e != nil {
+			return nil, e
+		}
+		v.client = client
+		if config.ClamdQuarantine {
+			dir, e := config.GetDir(quarantineDirName, true)
+			if e != nil {
+				return nil, e
+			}
+			v.quarantineDir = dir
+		}
+		if e := client.Ping(context.Background()); e != nil {
+			scanLogger.Warn("clamd is not available", "address", config.ClamdAddress, "error", e)
+		}
+	}
+	// the recorded verdicts are kept up to date even if scanning is disabled
+	v.unsubscribe = rootDrive.Events().Subscribe(v.onEvent)
+	ch.Add("virusScanner", v)
+	return v, nil
+}
+
+// Enabled returns true if the saved files are scanned
+func (v *VirusScanner) Enabled() bool {
+	return v != nil && v.client != nil
+}
+
+// Save scans the content which will be saved to path, then saves it by save if it's accepted,
+// and records the verdict. The content is copied to a temp file to be scanned if it's not a file.
+func (v *VirusScanner) Save(ctx types.TaskCtx, path string, reader io.Reader,
+	save func(reader io.Reader) (types.IEntry, error)) (types.IEntry, error) {
+	if !v.Enabled() {
+		return save(reader)
+	}
+	file, ok := reader.(*os.File)
+	if !ok {
+		// the progress is reported by save
+		temp, e := drive_util.CopyReaderToTempFile(task.NewCtxWrapper(ctx, false, false), reader, v.tempDir)
+		if e != nil {
+			return nil, e
+		}
+		defer func() {
+			_ = temp.Close()
+			_ = os.Remove(temp.Name())
+		}()
+		file = temp
+	}
+	scan, e := v.Scan(ctx, path, file)
+	if e != nil {
+		return nil, e
+	}
+	if _, e := file.Seek(0, io.SeekStart); e != nil {
+		return nil, e
+	}
+	entry, e := save(file)
+	if e != nil {
+		return nil, e
+	}
+	v.Record(ctx, *scan)
+	return entry, nil
+}
+
+// Scan scans the file which will be saved to path,
+// returns the verdict to be recorded after saving, or NotAllowedError if it's rejected
+func (v *VirusScanner) Scan(ctx types.TaskCtx, path string, file *os.File) (*types.EntryScan, error) {
+	if v.client == nil {
+		return nil, nil
+	}
+	log := scanLogger.Ctx(ctx)
+	if _, e := file.Seek(0, io.SeekStart); e != nil {
+		return nil, e
+	}
+	r, e := v.client.Scan(ctx, file)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if e != nil {
+		log.Error("error when scanning file", "path", path, "error", e)
+		return nil, err.NewNotAllowedMessageError(i18n.T("api.virus_scanner.scan_failed"))
+	}
+	if r.Infected {
+		if v.quarantineDir != "" {
+			dest, e := quarantineFile(v.quarantineDir, path, file.Name())
+			if e != nil {
+				log.Error("error when quarantining file", "path", path, "error", e)
+				return nil, e
+			}
+			log.Warn("infected file quarantined", "path", path, "signature", r.Signature, "quarantine", dest)
+		} else {
+			log.Warn("infected file rejected", "path", path, "signature", r.Signature)
+		}
+		return nil, err.NewNotAllowedMessageError(i18n.T("api.virus_scanner.infected", r.Signature))
+	}
+	stat, e := file.Stat()
+	if e != nil {
+		return nil, e
+	}
+	return &types.EntryScan{
+		Path:      path,
+		Verdict:   types.ScanClean,
+		Size:      stat.Size(),
+		ScannedAt: time.Now().Unix(),
+	}, nil
+}
+
+// Record records the verdict of the saved file
+func (v *VirusScanner) Record(ctx context.Context, scan types.EntryScan) {
+	if e := v.dao.SaveScan(scan); e != nil {
+		scanLogger.Ctx(ctx).Error("error when recording verdict", "path", scan.Path, "error", e)
+	}
+}
+
+// ScanOf returns the verdict of the file, nil if it's not scanned
+func (v *VirusScanner) ScanOf(path string) *types.EntryScan {
+	scan, e := v.dao.GetScan(path)
+	if e != nil {
+		scanLogger.Warn("error when getting verdict", "path", path, "error", e)
+		return nil
+	}
+	return scan
+}
+
+// ScansOf returns the verdicts of the children of dir
+func (v *VirusScanner) ScansOf(dir string) map[string]types.EntryScan {
+	scans, e := v.dao.GetScansByDir(dir)
+	if e != nil {
+		scanLogger.Warn("error when getting verdicts", "dir", dir, "error", e)
+		return nil
+	}
+	m := make(map[string]types.EntryScan, len(scans))
+	for _, s := range scans {
+		m[s.Path] = s
+	}
+	return m
+}
+
+// onEvent removes the verdicts of the changed entries, the verdict of the upload is recorded after the create event.
+// The create and modify events detected by watching are skipped,
+// they may be the delayed events of the uploads, the size check of scanMeta covers the outside changes.
+func (v *VirusScanner) onEvent(event types.DriveEvent) {
+	var e error
+	switch event.Type {
+	case types.DriveEventCreate, types.DriveEventModify:
+		if !event.Watched {
+			e = v.dao.DeleteScans(event.Path)
+		}
+	case types.DriveEventDelete, types.DriveEventRename:
+		e = v.dao.DeleteScans(event.Path)
+	case types.DriveEventMove:
+		e = v.dao.MoveScans(event.From, event.Path)
+	}
+	if e != nil {
+		scanLogger.Warn("error when updating verdicts", "event", event.Type, "path", event.Path, "error", e)
+	}
+}
+
+func (v *VirusScanner) Dispose() error {
+	v.unsubscribe()
+	return nil
+}
+
+func (v *VirusScanner) Status() (string, types.SM, error) {
+	status := types.SM{"Enabled": strconv.FormatBool(v.Enabled())}
+	if v.client != nil {
+		status["Address"] = v.address
+		status["Available"] = strconv.FormatBool(v.client.Ping(context.Background()) == nil)
+	}
+	return "Virus scanner", status, nil
+}
+
+// scanMeta returns the verdict in entry meta, nil if it's not scanned or the file has been changed
+func scanMeta(scan *types.EntryScan, entry types.IEntry) types.M {
+	if scan == nil || !entry.Type().IsFile() || scan.Size != entry.Size() {
+		return nil
+	}
+	return types.M{"verdict": scan.Verdict, "scanned_at": scan.ScannedAt}
+}
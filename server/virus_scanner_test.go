@@ -0,0 +1,104 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"go-drive/common/clamd"
+	"go-drive/common/task"
+	"go-drive/common/types"
+	"go-drive/storage"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClamd replies 'FOUND' to INSTREAM if the stream contains 'EICAR'
+func fakeClamd(t *testing.T) net.Listener {
+	l, e := net.Listen("tcp", "127.0.0.1:0")
+	if e != nil {
+		t.Fatal(e)
+	}
+	go func() {
+		for {
+			conn, e := l.Accept()
+			if e != nil {
+				return
+			}
+			go func() {
+				defer func() { _ = conn.Close() }()
+				r := bufio.NewReader(conn)
+				if _, e := r.ReadString(0); e != nil {
+					return
+				}
+				content := bytes.Buffer{}
+				size := make([]byte, 4)
+				for {
+					if _, e := io.ReadFull(r, size); e != nil {
+						return
+					}
+					n := binary.BigEndian.Uint32(size)
+					if n == 0 {
+						break
+					}
+					if _, e := io.CopyN(&content, r, int64(n)); e != nil {
+						return
+					}
+				}
+				reply := "stream: OK\x00"
+				if strings.Contains(content.String(), "EICAR") {
+					reply = "stream: Eicar-Test-Signature FOUND\x00"
+				}
+				_, _ = conn.Write([]byte(reply))
+			}()
+		}
+	}()
+	return l
+}
+
+func TestVirusScannerSave(t *testing.T) {
+	db, config, cleanup := newTestDB(t)
+	defer cleanup()
+	l := fakeClamd(t)
+	defer func() { _ = l.Close() }()
+	client, e := clamd.NewClient("tcp://"+l.Addr().String(), 5*time.Second)
+	if e != nil {
+		t.Fatal(e)
+	}
+	dao := storage.NewEntryScanDAO(db)
+	v := &VirusScanner{client: client, tempDir: config.TempDir, dao: dao}
+
+	// the content which is not a file is scanned
+	saved := ""
+	_, e = v.Save(task.DummyContext(), "d/a.txt", strings.NewReader("hello"),
+		func(reader io.Reader) (types.IEntry, error) {
+			b, e := ioutil.ReadAll(reader)
+			saved = string(b)
+			return nil, e
+		})
+	if e != nil {
+		t.Fatal(e)
+	}
+	if saved != "hello" {
+		t.Errorf("expect 'hello' saved, but it's '%s'", saved)
+	}
+	scan, e := dao.GetScan("d/a.txt")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if scan == nil || scan.Verdict != types.ScanClean || scan.Size != 5 {
+		t.Errorf("expect clean verdict of size 5 recorded, but it's %v", scan)
+	}
+
+	_, e = v.Save(task.DummyContext(), "d/b.txt", strings.NewReader("EICAR"),
+		func(reader io.Reader) (types.IEntry, error) {
+			t.Errorf("expect the infected file not saved")
+			return nil, nil
+		})
+	if e == nil {
+		t.Errorf("expect the infected file rejected")
+	}
+}
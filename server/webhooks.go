@@ -0,0 +1,379 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"go-drive/common/errors"
+	"go-drive/common/i18n"
+	"go-drive/common/logging"
+	"go-drive/common/registry"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+	"go-drive/drive"
+	"go-drive/storage"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	webhookQueueSize   = 1024
+	webhookTimeout     = 10 * time.Second
+	webhookMaxAttempts = 5
+	// webhookRetryBackoff is the delay before the first retry, it's doubled for each retry
+	webhookRetryBackoff = 10 * time.Second
+	webhookMaxErrorSize = 1024
+	webhookSecretBytes  = 32
+
+	webhookDeliveryRetention = 30 * 24 * time.Hour
+	webhookCleanInterval     = time.Hour
+
+	headerWebhookEvent     = "X-Go-Drive-Event"
+	headerWebhookDelivery  = "X-Go-Drive-Delivery"
+	headerWebhookSignature = "X-Go-Drive-Signature"
+)
+
+var webhookLogger = logging.For("webhook")
+
+// webhookEvents maps the drive events to the webhook events
+var webhookEvents = map[string]string{
+	types.DriveEventCreate: types.WebhookEventCreated,
+	types.DriveEventModify: types.WebhookEventUpdated,
+	types.DriveEventDelete: types.WebhookEventDeleted,
+	types.DriveEventRename: types.WebhookEventDeleted,
+	types.DriveEventMove:   types.WebhookEventMoved,
+}
+
+type webhookPayload struct {
+	Event string `json:"event"`
+	Path  string `json:"path"`
+	// From is the old path of moved event
+	From string `json:"from,omitempty"`
+	// Timestamp is unix timestamp
+	Timestamp int64  `json:"timestamp"`
+	Webhook   string `json:"webhook"`
+}
+
+// Webhooks posts the HMAC-SHA256 signed events of the changes made through the dispatcher to the webhooks,
+// so all drive types are covered, the changes detected by watching drives are skipped.
+// The failed deliveries are retried with exponential backoff,
+// the pending deliveries interrupted by shutting down are resumed on start.
+type Webhooks struct {
+	dao    *storage.WebhookDAO
+	client *http.Client
+
+	// webhooks are the enabled webhooks
+	webhooks []types.Webhook
+	mux      *sync.RWMutex
+
+	queue       chan types.DriveEvent
+	done        chan struct{}
+	unsubscribe func()
+	stopCleaner func()
+}
+
+func NewWebhooks(ch *registry.ComponentsHolder, rootDrive *drive.RootDrive,
+	dao *storage.WebhookDAO) (*Webhooks, error) {
+	w := &Webhooks{
+		dao:    dao,
+		client: &http.Client{Timeout: webhookTimeout},
+		mux:    &sync.RWMutex{},
+		queue:  make(chan types.DriveEvent, webhookQueueSize),
+		done:   make(chan struct{}),
+	}
+	if e := w.Reload(); e != nil {
+		return nil, e
+	}
+	if e := w.resume(); e != nil {
+		return nil, e
+	}
+	w.unsubscribe = rootDrive.Events().Subscribe(w.onEvent)
+	go w.run()
+	w.stopCleaner = utils.TimeTick(w.clean, webhookCleanInterval)
+	ch.Add("webhooks", w)
+	return w, nil
+}
+
+// Reload loads the enabled webhooks
+func (w *Webhooks) Reload() error {
+	webhooks, e := w.dao.GetWebhooks()
+	if e != nil {
+		return e
+	}
+	enabled := make([]types.Webhook, 0, len(webhooks))
+	for _, h := range webhooks {
+		if h.Enabled {
+			enabled = append(enabled, h)
+		}
+	}
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	w.webhooks = enabled
+	return nil
+}
+
+// resume sends the pending deliveries again,
+// the deliveries of the deleted or disabled webhooks are marked as failed
+func (w *Webhooks) resume() error {
+	deliveries, e := w.dao.GetPendingDeliveries()
+	if e != nil {
+		return e
+	}
+	w.mux.RLock()
+	webhooks := make(map[uint]types.Webhook, len(w.webhooks))
+	for _, h := range w.webhooks {
+		webhooks[h.Id] = h
+	}
+	w.mux.RUnlock()
+	resumed := 0
+	for _, d := range deliveries {
+		h, ok := webhooks[d.WebhookId]
+		if ok {
+			go w.send(h, d)
+			resumed++
+			continue
+		}
+		d.Status = types.DeliveryFailure
+		d.Error = "webhook is deleted or disabled"
+		d.UpdatedAt = time.Now().Unix()
+		if e := w.dao.UpdateDeliveryResult(d); e != nil {
+			return e
+		}
+	}
+	if len(deliveries) > 0 {
+		webhookLogger.Info("pending webhook deliveries resumed", "resumed", resumed,
+			"failed", len(deliveries)-resumed)
+	}
+	return nil
+}
+
+func (w *Webhooks) onEvent(event types.DriveEvent) {
+	if event.Watched {
+		return
+	}
+	select {
+	case w.queue <- event:
+	default:
+		webhookLogger.Warn("webhook queue is full, event dropped", "event", event.Type, "path", event.Path)
+	}
+}
+
+func (w *Webhooks) run() {
+	for {
+		select {
+		case event := <-w.queue:
+			for _, h := range w.match(event) {
+				w.deliver(h, event)
+			}
+		case <-w.done:
+			return
+		}
+	}
+}
+
+func (w *Webhooks) match(event types.DriveEvent) []types.Webhook {
+	w.mux.RLock()
+	defer w.mux.RUnlock()
+	result := make([]types.Webhook, 0)
+	for _, h := range w.webhooks {
+		if !webhookEventMatches(h.Events, webhookEvents[event.Type]) {
+			continue
+		}
+		if pathHasPrefix(event.Path, h.PathPrefix) ||
+			(event.From != "" && pathHasPrefix(event.From, h.PathPrefix)) {
+			result = append(result, h)
+		}
+	}
+	return result
+}
+
+func (w *Webhooks) deliver(h types.Webhook, event types.DriveEvent) {
+	eventType := webhookEvents[event.Type]
+	payload, e := json.Marshal(webhookPayload{
+		Event:     eventType,
+		Path:      event.Path,
+		From:      event.From,
+		Timestamp: time.Now().Unix(),
+		Webhook:   h.Name,
+	})
+	if e != nil {
+		webhookLogger.Error("error when encoding webhook payload", "webhook", h.Name, "error", e)
+		return
+	}
+	now := time.Now().Unix()
+	d, e := w.dao.AddDelivery(types.WebhookDelivery{
+		WebhookId: h.Id,
+		Event:     eventType,
+		Path:      event.Path,
+		Payload:   string(payload),
+		Status:    types.DeliveryPending,
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+	if e != nil {
+		webhookLogger.Error("error when recording webhook delivery", "webhook", h.Name, "error", e)
+		return
+	}
+	go w.send(h, d)
+}
+
+// send posts the delivery until succeeded or reaching the max attempts
+func (w *Webhooks) send(h types.Webhook, d types.WebhookDelivery) {
+	backoff := webhookRetryBackoff
+	for {
+		d.Attempts++
+		code, e := w.post(h, d)
+		d.ResponseCode = code
+		d.UpdatedAt = time.Now().Unix()
+		d.Error = ""
+		switch {
+		case e == nil:
+			d.Status = types.DeliverySuccess
+		case d.Attempts >= webhookMaxAttempts:
+			d.Status = types.DeliveryFailure
+		}
+		if e != nil {
+			d.Error = e.Error()
+			if len(d.Error) > webhookMaxErrorSize {
+				d.Error = d.Error[:webhookMaxErrorSize]
+			}
+			webhookLogger.Warn("webhook delivery failed", "webhook", h.Name, "delivery", d.Id,
+				"attempts", d.Attempts, "error", e)
+		}
+		if ue := w.dao.UpdateDeliveryResult(d); ue != nil {
+			webhookLogger.Error("error when recording webhook delivery", "webhook", h.Name, "error", ue)
+		}
+		if d.Status != types.DeliveryPending {
+			return
+		}
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-w.done:
+			return
+		}
+	}
+}
+
+func (w *Webhooks) post(h types.Webhook, d types.WebhookDelivery) (int, error) {
+	req, e := http.NewRequest(http.MethodPost, h.URL, strings.NewReader(d.Payload))
+	if e != nil {
+		return 0, e
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "go-drive-webhook")
+	req.Header.Set(headerWebhookEvent, d.Event)
+	req.Header.Set(headerWebhookDelivery, strconv.FormatUint(uint64(d.Id), 10))
+	req.Header.Set(headerWebhookSignature, signWebhookPayload(h.Secret, []byte(d.Payload)))
+	resp, e := w.client.Do(req)
+	if e != nil {
+		return 0, e
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+func (w *Webhooks) clean() {
+	n, e := w.dao.CleanDeliveriesBefore(time.Now().Add(-webhookDeliveryRetention).Unix())
+	if e != nil {
+		webhookLogger.Warn("error when cleaning webhook deliveries", "error", e)
+		return
+	}
+	if n > 0 {
+		webhookLogger.Info("expired webhook deliveries cleaned", "count", n)
+	}
+}
+
+func (w *Webhooks) Dispose() error {
+	w.unsubscribe()
+	w.stopCleaner()
+	close(w.done)
+	return nil
+}
+
+func (w *Webhooks) Status() (string, types.SM, error) {
+	w.mux.RLock()
+	defer w.mux.RUnlock()
+	return "Webhooks", types.SM{
+		"Enabled": strconv.Itoa(len(w.webhooks)),
+		"Queued":  strconv.Itoa(len(w.queue)),
+	}, nil
+}
+
+// signWebhookPayload returns 'sha256=<hex of HMAC-SHA256 of the payload>'
+func signWebhookPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func newWebhookSecret() (string, error) {
+	b := make([]byte, webhookSecretBytes)
+	if _, e := rand.Read(b); e != nil {
+		return "", e
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func webhookEventMatches(events, event string) bool {
+	if events == "" {
+		return true
+	}
+	for _, e := range strings.Split(events, ",") {
+		if strings.TrimSpace(e) == event {
+			return true
+		}
+	}
+	return false
+}
+
+// pathHasPrefix returns true if path is prefix itself or its descendant
+func pathHasPrefix(path, prefix string) bool {
+	prefix = utils.CleanPath(prefix)
+	return prefix == "" || path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// checkWebhook validates the webhook, generates the secret if it's empty
+func checkWebhook(h *types.Webhook) error {
+	u, e := url.Parse(h.URL)
+	if e != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return err.NewBadRequestError(i18n.T("api.admin.invalid_webhook_url", h.URL))
+	}
+	events := make([]string, 0)
+	for _, event := range strings.Split(h.Events, ",") {
+		event = strings.TrimSpace(event)
+		if event == "" {
+			continue
+		}
+		switch event {
+		case types.WebhookEventCreated, types.WebhookEventUpdated,
+			types.WebhookEventDeleted, types.WebhookEventMoved:
+			events = append(events, event)
+		default:
+			return err.NewBadRequestError(i18n.T("api.admin.invalid_webhook_event", event))
+		}
+	}
+	h.Events = strings.Join(events, ",")
+	h.PathPrefix = utils.CleanPath(h.PathPrefix)
+	if h.Secret == "" {
+		secret, e := newWebhookSecret()
+		if e != nil {
+			return e
+		}
+		h.Secret = secret
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"go-drive/common/types"
+	"go-drive/storage"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSignWebhookPayload(t *testing.T) {
+	sign := signWebhookPayload("key", []byte("The quick brown fox jumps over the lazy dog"))
+	expect := "sha256=f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8"
+	if sign != expect {
+		t.Errorf("expect '%s', but it's '%s'", expect, sign)
+	}
+}
+
+func TestPathHasPrefix(t *testing.T) {
+	for _, c := range []struct {
+		path, prefix string
+		expect       bool
+	}{
+		{"a/b", "", true},
+		{"a/b", "a", true},
+		{"a/b", "/a/", true},
+		{"a", "a", true},
+		{"ab/c", "a", false},
+		{"a", "a/b", false},
+	} {
+		if pathHasPrefix(c.path, c.prefix) != c.expect {
+			t.Errorf("'%s' of '%s': expect %v, but it's %v", c.path, c.prefix, c.expect, !c.expect)
+		}
+	}
+}
+
+func TestWebhooksMatch(t *testing.T) {
+	w := &Webhooks{mux: &sync.RWMutex{}, webhooks: []types.Webhook{
+		{Id: 1, PathPrefix: "d/ci", Events: types.WebhookEventCreated},
+		{Id: 2, PathPrefix: "d/ci"},
+		{Id: 3, PathPrefix: "d/other", Events: "created, moved"},
+	}}
+	ids := func(webhooks []types.Webhook) []uint {
+		r := make([]uint, 0, len(webhooks))
+		for _, h := range webhooks {
+			r = append(r, h.Id)
+		}
+		return r
+	}
+	for _, c := range []struct {
+		event  types.DriveEvent
+		expect []uint
+	}{
+		{types.DriveEvent{Type: types.DriveEventCreate, Path: "d/ci/a"}, []uint{1, 2}},
+		{types.DriveEvent{Type: types.DriveEventModify, Path: "d/ci/a"}, []uint{2}},
+		{types.DriveEvent{Type: types.DriveEventCreate, Path: "d/cix/a"}, []uint{}},
+		// the source of the move matches
+		{types.DriveEvent{Type: types.DriveEventMove, From: "d/other/a", Path: "d/a"}, []uint{3}},
+		{types.DriveEvent{Type: types.DriveEventDelete, Path: "d/other/a"}, []uint{}},
+	} {
+		matched := ids(w.match(c.event))
+		if len(matched) != len(c.expect) {
+			t.Errorf("%v: expect %v, but it's %v", c.event, c.expect, matched)
+			continue
+		}
+		for i := range matched {
+			if matched[i] != c.expect[i] {
+				t.Errorf("%v: expect %v, but it's %v", c.event, c.expect, matched)
+				break
+			}
+		}
+	}
+}
+
+func TestWebhooksResume(t *testing.T) {
+	db, _, cleanup := newTestDB(t)
+	defer cleanup()
+	dao := storage.NewWebhookDAO(db)
+
+	received := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Get(headerWebhookSignature)
+	}))
+	defer server.Close()
+
+	enabled, e := dao.AddWebhook(types.Webhook{Name: "enabled", URL: server.URL, Secret: "s", Enabled: true})
+	if e != nil {
+		t.Fatal(e)
+	}
+	disabled, e := dao.AddWebhook(types.Webhook{Name: "disabled", URL: server.URL, Secret: "s"})
+	if e != nil {
+		t.Fatal(e)
+	}
+	pending := make([]types.WebhookDelivery, 0, 2)
+	for _, h := range []types.Webhook{enabled, disabled} {
+		d, e := dao.AddDelivery(types.WebhookDelivery{WebhookId: h.Id, Event: types.WebhookEventCreated,
+			Path: "a", Payload: "{}", Status: types.DeliveryPending, Attempts: 1})
+		if e != nil {
+			t.Fatal(e)
+		}
+		pending = append(pending, d)
+	}
+
+	w := &Webhooks{dao: dao, client: &http.Client{Timeout: webhookTimeout},
+		mux: &sync.RWMutex{}, done: make(chan struct{})}
+	defer close(w.done)
+	if e := w.Reload(); e != nil {
+		t.Fatal(e)
+	}
+	if e := w.resume(); e != nil {
+		t.Fatal(e)
+	}
+
+	select {
+	case sign := <-received:
+		if sign != signWebhookPayload("s", []byte("{}")) {
+			t.Errorf("expect the payload signed, but it's '%s'", sign)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expect the pending delivery resumed")
+	}
+
+	status := func(h types.Webhook) string {
+		deliveries, _, e := dao.GetDeliveries(h.Id, 0, 1)
+		if e != nil {
+			t.Fatal(e)
+		}
+		return deliveries[0].Status
+	}
+	for i := 0; i < 50 && status(enabled) == types.DeliveryPending; i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if s := status(enabled); s != types.DeliverySuccess {
+		t.Errorf("expect the resumed delivery succeeded, but it's '%s'", s)
+	}
+	if s := status(disabled); s != types.DeliveryFailure {
+		t.Errorf("expect the delivery of the disabled webhook failed, but it's '%s'", s)
+	}
+}
@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"github.com/jinzhu/gorm"
+	"go-drive/common/errors"
+	"go-drive/common/i18n"
+	"go-drive/common/types"
+)
+
+type AccessTokenDAO struct {
+	db *DB
+}
+
+func NewAccessTokenDAO(db *DB) *AccessTokenDAO {
+	return &AccessTokenDAO{db}
+}
+
+func (a *AccessTokenDAO) ListTokens(username string) ([]types.AccessToken, error) {
+	tokens := make([]types.AccessToken, 0)
+	e := a.db.C().Where("username = ?", username).Order("created_at").Find(&tokens).Error
+	return tokens, e
+}
+
+func (a *AccessTokenDAO) GetByHash(tokenHash string) (types.AccessToken, error) {
+	token := types.AccessToken{}
+	e := a.db.C().First(&token, "token_hash = ?", tokenHash).Error
+	if gorm.IsRecordNotFoundError(e) {
+		return token, err.NewNotFoundMessageError(i18n.T("storage.access_tokens.token_not_exists"))
+	}
+	return token, e
+}
+
+func (a *AccessTokenDAO) AddToken(token types.AccessToken) (types.AccessToken, error) {
+	e := a.db.C().Create(&token).Error
+	return token, e
+}
+
+func (a *AccessTokenDAO) UpdateLastUsed(id string, lastUsedAt int64) error {
+	return a.db.C().Model(&types.AccessToken{}).
+		Where("id = ?", id).Update("last_used_at", lastUsedAt).Error
+}
+
+func (a *AccessTokenDAO) DeleteToken(username, id string) error {
+	s := a.db.C().Delete(&types.AccessToken{}, "username = ? AND id = ?", username, id)
+	if s.Error != nil {
+		return s.Error
+	}
+	if s.RowsAffected != 1 {
+		return err.NewNotFoundMessageError(i18n.T("storage.access_tokens.token_not_exists"))
+	}
+	return nil
+}
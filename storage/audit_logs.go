@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"github.com/jinzhu/gorm"
+	"go-drive/common/types"
+)
+
+// AuditLogQuery filters the audit logs, zero values are ignored
+type AuditLogQuery struct {
+	Username string
+	// Action matches the prefix of the action
+	Action string
+	// Path matches the prefix of the path or the target
+	Path   string
+	Result string
+	// From and To are unix timestamps
+	From int64
+	To   int64
+}
+
+type AuditLogDAO struct {
+	db *DB
+}
+
+func NewAuditLogDAO(db *DB) *AuditLogDAO {
+	return &AuditLogDAO{db}
+}
+
+func (a *AuditLogDAO) AddLog(l types.AuditLog) error {
+	return a.db.C().Create(&l).Error
+}
+
+// Query returns the logs in reverse chronological order and the total count
+func (a *AuditLogDAO) Query(q AuditLogQuery, offset, limit int) ([]types.AuditLog, int, error) {
+	db := a.where(q)
+	total := 0
+	if e := db.Count(&total).Error; e != nil {
+		return nil, 0, e
+	}
+	logs := make([]types.AuditLog, 0)
+	e := db.Order("id DESC").Offset(offset).Limit(limit).Find(&logs).Error
+	return logs, total, e
+}
+
+// QueryBefore returns the logs whose id is less than beforeID in reverse chronological order
+func (a *AuditLogDAO) QueryBefore(q AuditLogQuery, beforeID uint, limit int) ([]types.AuditLog, error) {
+	logs := make([]types.AuditLog, 0)
+	e := a.where(q).Where("id < ?", beforeID).Order("id DESC").Limit(limit).Find(&logs).Error
+	return logs, e
+}
+
+func (a *AuditLogDAO) where(q AuditLogQuery) *gorm.DB {
+	db := a.db.C().Model(&types.AuditLog{})
+	if q.Username != "" {
+		db = db.Where("username = ?", q.Username)
+	}
+	if q.Action != "" {
+		db = db.Where("action LIKE ? ESCAPE '!'", likePrefix(q.Action))
+	}
+	if q.Path != "" {
+		p := likePrefix(q.Path)
+		db = db.Where("(path LIKE ? ESCAPE '!' OR target LIKE ? ESCAPE '!')", p, p)
+	}
+	if q.Result != "" {
+		db = db.Where("result = ?", q.Result)
+	}
+	if q.From > 0 {
+		db = db.Where("created_at >= ?", q.From)
+	}
+	if q.To > 0 {
+		db = db.Where("created_at < ?", q.To)
+	}
+	return db
+}
+
+// CleanBefore deletes the logs created before the unix timestamp
+func (a *AuditLogDAO) CleanBefore(before int64) (int64, error) {
+	s := a.db.C().Delete(&types.AuditLog{}, "created_at < ?", before)
+	return s.RowsAffected, s.Error
+}
@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"go-drive/common/types"
+	"testing"
+)
+
+func TestAuditLogQuery(t *testing.T) {
+	db, _, cleanup := newTestDB(t)
+	defer cleanup()
+	dao := NewAuditLogDAO(db)
+	for _, l := range []types.AuditLog{
+		{CreatedAt: 100, Username: "alice", Action: "drive.save", Path: "d/a", Result: types.AuditSuccess},
+		{CreatedAt: 200, Username: "bob", Action: "drive.move", Path: "d/b", Target: "e/b", Result: types.AuditSuccess},
+		{CreatedAt: 300, Username: "alice", Action: "drive_save", Path: "d_x/a", Result: types.AuditFailure},
+		{CreatedAt: 400, Username: "admin", Action: "POST /admin/user", Path: "/admin/user", Result: types.AuditSuccess},
+	} {
+		if e := dao.AddLog(l); e != nil {
+			t.Fatal(e)
+		}
+	}
+
+	for _, c := range []struct {
+		name   string
+		q      AuditLogQuery
+		expect []int64
+	}{
+		{"all", AuditLogQuery{}, []int64{400, 300, 200, 100}},
+		{"username", AuditLogQuery{Username: "alice"}, []int64{300, 100}},
+		// the wildcards of LIKE are escaped
+		{"action prefix", AuditLogQuery{Action: "drive."}, []int64{200, 100}},
+		{"path prefix", AuditLogQuery{Path: "d_"}, []int64{300}},
+		{"target prefix", AuditLogQuery{Path: "e/"}, []int64{200}},
+		{"result", AuditLogQuery{Result: types.AuditFailure}, []int64{300}},
+		{"time range", AuditLogQuery{From: 200, To: 400}, []int64{300, 200}},
+	} {
+		logs, total, e := dao.Query(c.q, 0, 10)
+		if e != nil {
+			t.Fatal(e)
+		}
+		if total != len(c.expect) || len(logs) != len(c.expect) {
+			t.Errorf("%s: expect %d logs, but it's %d of total %d", c.name, len(c.expect), len(logs), total)
+			continue
+		}
+		for i, l := range logs {
+			if l.CreatedAt != c.expect[i] {
+				t.Errorf("%s: expect log %d at %d, but it's %d", c.name, i, c.expect[i], l.CreatedAt)
+			}
+		}
+	}
+
+	logs, e := dao.QueryBefore(AuditLogQuery{Username: "alice"}, 3, 10)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(logs) != 1 || logs[0].CreatedAt != 100 {
+		t.Errorf("expect the log at 100 before id 3, but it's %v", logs)
+	}
+}
@@ -1,20 +1,42 @@
 package storage
 
 import (
+	"errors"
+	"fmt"
 	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/mysql"
+	_ "github.com/jinzhu/gorm/dialects/postgres"
 	_ "github.com/mattn/go-sqlite3"
 	"go-drive/common"
+	"go-drive/common/errors"
+	"go-drive/common/i18n"
+	"go-drive/common/logging"
 	"go-drive/common/registry"
 	"go-drive/common/types"
 	"go-drive/common/utils"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 )
 
-var initSQL = []string{
-	"INSERT INTO users(username, password) VALUES ('admin', '$2y$10$Xqn8qV2D2KY2ceI5esM/JOiKTPKJFbkSzzuhce89BxygvCqnhyk3m')", // 123456
-	"INSERT INTO groups(name) VALUES ('admin')",
-	"INSERT INTO user_groups(username, group_name) VALUES ('admin', 'admin')",
-	"INSERT INTO path_permissions(path, subject, permission, policy, depth) VALUES ('', 'ANY', 1, 1, 0)",
-	"INSERT INTO path_permissions(path, subject, permission, policy, depth) VALUES ('', 'g:admin', 3, 1, 0)",
+var dbLogger = logging.For("db")
+
+// ErrMigrated is returned by NewDB when the database is migrated with MigrateOnly, then the program should exit
+var ErrMigrated = errors.New("database migrated")
+
+// initData is created by gorm instead of raw SQL,
+// so that the identifiers are quoted by the dialect('groups' is reserved in MySQL 8)
+func initData() []interface{} {
+	rootPath := ""
+	return []interface{}{
+		&types.User{Username: "admin", Password: "$2y$10$Xqn8qV2D2KY2ceI5esM/JOiKTPKJFbkSzzuhce89BxygvCqnhyk3m"}, // 123456
+		&types.Group{Name: "admin"},
+		&types.UserGroup{Username: "admin", GroupName: "admin"},
+		&types.PathPermission{Path: &rootPath, Subject: types.AnySubject,
+			Permission: types.PermissionRead, Policy: types.PolicyAccept, Depth: 0},
+		&types.PathPermission{Path: &rootPath, Subject: types.GroupSubject("admin"),
+			Permission: types.PermissionReadWrite, Policy: types.PolicyAccept, Depth: 0},
+	}
 }
 
 func NewDB(config common.Config, ch *registry.ComponentsHolder) (*DB, error) {
@@ -29,16 +51,16 @@ func NewDB(config common.Config, ch *registry.ComponentsHolder) (*DB, error) {
 		db.LogMode(true)
 	}
 
-	if e := db.AutoMigrate(
-		&types.User{},
-		&types.Group{},
-		&types.UserGroup{},
-		&types.Drive{},
-		&types.PathPermission{},
-		&types.PathMount{},
-		&types.DriveData{},
-		&types.DriveCache{},
-	).Error; e != nil {
+	pending, e := checkSchemaVersion(db)
+	if e != nil {
+		_ = db.Close()
+		return nil, e
+	}
+	if len(pending) > 0 && !config.AutoMigrate && !config.MigrateOnly {
+		_ = db.Close()
+		return nil, fmt.Errorf("%d pending migrations, run with -migrate to apply them", len(pending))
+	}
+	if e := migrate(db, pending); e != nil {
 		_ = db.Close()
 		return nil, e
 	}
@@ -48,6 +70,12 @@ func NewDB(config common.Config, ch *registry.ComponentsHolder) (*DB, error) {
 		return nil, e
 	}
 
+	if config.MigrateOnly {
+		_ = db.Close()
+		dbLogger.Info("database migrated", "version", LatestSchemaVersion())
+		return nil, ErrMigrated
+	}
+
 	d := &DB{db: db}
 	ch.Add("db", d)
 	return d, nil
@@ -62,8 +90,8 @@ func tryInitDbData(db *gorm.DB) error {
 		return nil
 	}
 	return db.Transaction(func(tx *gorm.DB) error {
-		for _, initSQL := range initSQL {
-			if e := tx.Exec(initSQL).Error; e != nil {
+		for _, item := range initData() {
+			if e := tx.Create(item).Error; e != nil {
 				return e
 			}
 		}
@@ -71,6 +99,22 @@ func tryInitDbData(db *gorm.DB) error {
 	})
 }
 
+// checkPathKey returns BadRequestError if the path is longer than the column of the primary key
+func checkPathKey(path string) error {
+	if utf8.RuneCountInString(path) > types.PathKeyMaxLength {
+		return err.NewBadRequestError(i18n.T("storage.path_too_long", strconv.Itoa(types.PathKeyMaxLength)))
+	}
+	return nil
+}
+
+// likePrefix returns the value of `LIKE ? ESCAPE '!'` that matches strings starting with prefix.
+// String concatenation(||) is not supported by MySQL, so the pattern is built here.
+func likePrefix(prefix string) string {
+	return likeEscaper.Replace(prefix) + "%"
+}
+
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
 type DB struct {
 	db *gorm.DB
 }
@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"go-drive/common/errors"
+	"go-drive/common/types"
+	"strings"
+	"testing"
+)
+
+func TestPathKeyMaxLength(t *testing.T) {
+	db, _, cleanup := newTestDB(t)
+	defer cleanup()
+	isBadRequest := func(e error) bool {
+		_, ok := e.(err.BadRequestError)
+		return ok
+	}
+	// multi-byte characters are counted as one
+	maxPath := strings.Repeat("路", types.PathKeyMaxLength)
+	longPath := maxPath + "a"
+
+	permissionDAO := NewPathPermissionDAO(db)
+	permissions := []types.PathPermission{{Subject: types.AnySubject, Permission: types.PermissionRead}}
+	if e := permissionDAO.SavePathPermissions(maxPath, permissions); e != nil {
+		t.Errorf("expect the permission of the max length saved, but it's %v", e)
+	}
+	if e := permissionDAO.SavePathPermissions(longPath, permissions); !isBadRequest(e) {
+		t.Errorf("expect BadRequestError of the long permission path, but it's %v", e)
+	}
+
+	mountDAO := NewPathMountDAO(db)
+	e := mountDAO.SaveMounts([]types.PathMount{{Path: &longPath, Name: "m", MountAt: "d"}}, true)
+	if !isBadRequest(e) {
+		t.Errorf("expect BadRequestError of the long mount path, but it's %v", e)
+	}
+
+	scanDAO := NewEntryScanDAO(db)
+	if e := scanDAO.SaveScan(types.EntryScan{Path: longPath, Verdict: types.ScanClean}); !isBadRequest(e) {
+		t.Errorf("expect BadRequestError of the long scan path, but it's %v", e)
+	}
+	for _, path := range []string{"d/a", "d/" + strings.Repeat("a", types.PathKeyMaxLength-2)} {
+		if e := scanDAO.SaveScan(types.EntryScan{Path: path, Verdict: types.ScanClean}); e != nil {
+			t.Fatal(e)
+		}
+	}
+	// the scan whose new path is too long is dropped
+	if e := scanDAO.MoveScans("d", "dd"); e != nil {
+		t.Fatal(e)
+	}
+	scans, e := scanDAO.GetScansByDir("dd")
+	if e != nil {
+		t.Fatal(e)
+	}
+	if len(scans) != 1 || scans[0].Path != "dd/a" {
+		t.Errorf("expect only 'dd/a' moved, but it's %v", scans)
+	}
+}
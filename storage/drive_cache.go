@@ -4,10 +4,10 @@ import (
 	"encoding/json"
 	"github.com/jinzhu/gorm"
 	"go-drive/common/drive_util"
+	"go-drive/common/metrics"
 	"go-drive/common/registry"
 	"go-drive/common/types"
 	"go-drive/common/utils"
-	"log"
 	"time"
 )
 
@@ -26,8 +26,8 @@ func NewDriveCacheDAO(db *DB, ch *registry.ComponentsHolder) *DriveCacheDAO {
 func (d *DriveCacheDAO) cleanExpired() {
 	now := time.Now().Unix()
 	rows := d.db.C().Delete(&types.DriveCache{}, "expires_at > 0 AND expires_at < ?", now).RowsAffected
-	if utils.IsDebugOn() && rows > 0 {
-		log.Printf("%d expired caches item cleaned", rows)
+	if rows > 0 {
+		dbLogger.Debug("expired cache items cleaned", "count", rows)
 	}
 }
 
@@ -104,7 +104,7 @@ func (d *dbDriveNamespacedCacheStore) delete(db *gorm.DB, path string, descendan
 	depth := utils.PathDepth(path)
 	if descendants {
 		return db.Delete(&types.DriveCache{},
-			"drive = ? AND depth >= ? AND path LIKE (? || '%')", d.ns, depth, pathLike(path)).Error
+			"drive = ? AND depth >= ? AND path LIKE ? ESCAPE '!'", d.ns, depth, likePrefix(pathLike(path))).Error
 	} else {
 		return db.Delete(&types.DriveCache{},
 			"drive = ? AND path = ? AND depth = ?", d.ns, path+"/", depth).Error
@@ -153,13 +153,15 @@ func (d *dbDriveNamespacedCacheStore) GetEntry(path string) (types.IEntry, error
 	if e != nil {
 		return nil, e
 	}
+	metrics.ObserveCache("drive_entry", v != "")
 	if v == "" {
 		return nil, nil
 	}
 	return d.d(v)
 }
 
-func (d *dbDriveNamespacedCacheStore) GetChildren(path string) ([]types.IEntry, error) {
+func (d *dbDriveNamespacedCacheStore) GetChildren(path string) (entries []types.IEntry, e error) {
+	defer func() { metrics.ObserveCache("drive_children", entries != nil) }()
 	depth := utils.PathDepth(path)
 	v, e := d.get(path, types.CacheChildren)
 	if e != nil {
@@ -175,8 +177,8 @@ func (d *dbDriveNamespacedCacheStore) GetChildren(path string) ([]types.IEntry,
 
 	items := make([]types.DriveCache, 0)
 	if e := d.db.C().Find(&items,
-		"drive = ? AND type = ? AND depth = ? AND path LIKE (? || '%')",
-		d.ns, types.CacheEntry, depth+1, pathLike(path),
+		"drive = ? AND type = ? AND depth = ? AND path LIKE ? ESCAPE '!'",
+		d.ns, types.CacheEntry, depth+1, likePrefix(pathLike(path)),
 	).Error; e != nil {
 		return nil, e
 	}
@@ -185,7 +187,7 @@ func (d *dbDriveNamespacedCacheStore) GetChildren(path string) ([]types.IEntry,
 		itemsMap[c.Path] = c
 	}
 
-	entries := make([]types.IEntry, len(childrenPath))
+	entries = make([]types.IEntry, len(childrenPath))
 	for i, path := range childrenPath {
 		item, ok := itemsMap[path+"/"]
 		if !ok || item.ExpiresAt > 0 && item.ExpiresAt < time.Now().Unix() {
@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"github.com/jinzhu/gorm"
+	"go-drive/common/types"
+	"go-drive/common/utils"
+)
+
+type EntryScanDAO struct {
+	db *DB
+}
+
+func NewEntryScanDAO(db *DB) *EntryScanDAO {
+	return &EntryScanDAO{db}
+}
+
+// GetScan returns nil if the path is not scanned
+func (s *EntryScanDAO) GetScan(path string) (*types.EntryScan, error) {
+	scan := types.EntryScan{}
+	e := s.db.C().Where("path = ?", path).First(&scan).Error
+	if gorm.IsRecordNotFoundError(e) {
+		return nil, nil
+	}
+	if e != nil {
+		return nil, e
+	}
+	return &scan, nil
+}
+
+// GetScansByDir returns the scans of the children of the dir
+func (s *EntryScanDAO) GetScansByDir(dir string) ([]types.EntryScan, error) {
+	scans := make([]types.EntryScan, 0)
+	e := s.db.C().Where("dir = ?", dir).Find(&scans).Error
+	return scans, e
+}
+
+func (s *EntryScanDAO) SaveScan(scan types.EntryScan) error {
+	if e := checkPathKey(scan.Path); e != nil {
+		return e
+	}
+	scan.Dir = utils.PathParent(scan.Path)
+	return s.db.C().Transaction(func(tx *gorm.DB) error {
+		if e := tx.Delete(&types.EntryScan{}, "path = ?", scan.Path).Error; e != nil {
+			return e
+		}
+		return tx.Create(&scan).Error
+	})
+}
+
+// DeleteScans deletes the scans of the path and its descendants
+func (s *EntryScanDAO) DeleteScans(path string) error {
+	return descendantScans(s.db.C(), path).Delete(&types.EntryScan{}).Error
+}
+
+// MoveScans moves the scans of the path and its descendants to the new path,
+// the scans whose new path is too long are dropped
+func (s *EntryScanDAO) MoveScans(from, to string) error {
+	return s.db.C().Transaction(func(tx *gorm.DB) error {
+		scans := make([]types.EntryScan, 0)
+		if e := descendantScans(tx, from).Find(&scans).Error; e != nil {
+			return e
+		}
+		if e := descendantScans(tx, from).Delete(&types.EntryScan{}).Error; e != nil {
+			return e
+		}
+		if e := descendantScans(tx, to).Delete(&types.EntryScan{}).Error; e != nil {
+			return e
+		}
+		for _, scan := range scans {
+			scan.Path = to + scan.Path[len(from):]
+			if checkPathKey(scan.Path) != nil {
+				continue
+			}
+			scan.Dir = utils.PathParent(scan.Path)
+			if e := tx.Create(&scan).Error; e != nil {
+				return e
+			}
+		}
+		return nil
+	})
+}
+
+// descendantScans queries the path and its descendants
+func descendantScans(db *gorm.DB, path string) *gorm.DB {
+	return db.Where("path = ? OR path LIKE ? ESCAPE '!'", path, likePrefix(path+"/"))
+}
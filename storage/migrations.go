@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"go-drive/common/types"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+type migration struct {
+	version     int
+	description string
+	up          func(tx *gorm.DB) error
+}
+
+// migrations are applied in order, each of them is applied in a transaction with its version record.
+// Note that DDL is not transactional in MySQL.
+//
+// The tables are created from the snapshots of the models in schema.go,
+// so that the fresh databases are the same as the upgraded ones.
+// Each feature adds its tables in its own migration, the initial schema is the one before the migrations,
+// which is also applied to the existing databases without schema_version.
+var migrations = []migration{
+	{1, "initial schema", func(tx *gorm.DB) error {
+		if e := checkPathKeys(tx, "path_permissions", "path_mount"); e != nil {
+			return e
+		}
+		return tx.AutoMigrate(
+			&schemaV1SchemaVersion{},
+			&schemaV1User{},
+			&schemaV1Group{},
+			&schemaV1UserGroup{},
+			&schemaV1Drive{},
+			&schemaV1PathPermission{},
+			&schemaV1PathMount{},
+			&schemaV1DriveData{},
+			&schemaV1DriveCache{},
+		).Error
+	}},
+	{2, "access tokens", func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&schemaV2AccessToken{}).Error
+	}},
+	{3, "options", func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&schemaV3Option{}).Error
+	}},
+	{4, "two-factor authentication", func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&schemaV4UserTOTP{}).Error
+	}},
+	{5, "token revocations", func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&schemaV5TokenRevocation{}).Error
+	}},
+	{6, "sessions", func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&schemaV6SessionRecord{}).Error
+	}},
+	{7, "signer keys", func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&schemaV7SignerKey{}).Error
+	}},
+	{8, "audit logs", func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&schemaV8AuditLog{}).Error
+	}},
+	{9, "webhooks", func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&schemaV9Webhook{}, &schemaV9WebhookDelivery{}).Error
+	}},
+	{10, "upload hooks", func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&schemaV10UploadHook{}).Error
+	}},
+	{11, "entry scans", func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&schemaV11EntryScan{}).Error
+	}},
+	{12, "user identities", func(tx *gorm.DB) error {
+		return tx.AutoMigrate(&schemaV12UserIdentity{}).Error
+	}},
+}
+
+// checkPathKeys checks the paths of the existing tables before they are limited to types.PathKeyMaxLength,
+// the paths were up to 4096 characters before the version 1.
+// The longer paths can't be stored in the narrowed columns, so they must be shortened or removed before migrating.
+func checkPathKeys(tx *gorm.DB, tables ...string) error {
+	for _, table := range tables {
+		if !tx.HasTable(table) {
+			continue
+		}
+		var paths []string
+		if e := tx.Table(table).Pluck("path", &paths).Error; e != nil {
+			return e
+		}
+		tooLong := make([]string, 0)
+		for _, p := range paths {
+			if utf8.RuneCountInString(p) > types.PathKeyMaxLength {
+				tooLong = append(tooLong, p)
+			}
+		}
+		if len(tooLong) > 0 {
+			return fmt.Errorf("%d paths in table '%s' are longer than %d characters, "+
+				"please shorten or remove them by the previous version before upgrading: %s",
+				len(tooLong), table, types.PathKeyMaxLength, strings.Join(tooLong, ", "))
+		}
+	}
+	return nil
+}
+
+// LatestSchemaVersion is the schema version supported by this binary
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// SchemaVersion returns the current version of the database, 0 means no migration applied.
+// The schema_version table is created by the migration 1, so the database is never changed here.
+func SchemaVersion(db *gorm.DB) (int, error) {
+	if !db.HasTable(&types.SchemaVersion{}) {
+		return 0, nil
+	}
+	v := types.SchemaVersion{}
+	e := db.Order("version DESC").First(&v).Error
+	if gorm.IsRecordNotFoundError(e) {
+		return 0, nil
+	}
+	return v.Version, e
+}
+
+// checkSchemaVersion returns the pending migrations,
+// or error if the database is newer than this binary
+func checkSchemaVersion(db *gorm.DB) ([]migration, error) {
+	current, e := SchemaVersion(db)
+	if e != nil {
+		return nil, e
+	}
+	if latest := LatestSchemaVersion(); current > latest {
+		return nil, fmt.Errorf("database schema version %d is newer than the supported version %d, "+
+			"please upgrade go-drive", current, latest)
+	}
+	pending := make([]migration, 0)
+	for _, m := range migrations {
+		if m.version > current {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+func migrate(db *gorm.DB, pending []migration) error {
+	for _, m := range pending {
+		dbLogger.Info("applying migration", "version", m.version, "description", m.description)
+		if e := db.Transaction(func(tx *gorm.DB) error {
+			if e := m.up(tx); e != nil {
+				return e
+			}
+			return tx.Create(&types.SchemaVersion{
+				Version:     m.version,
+				Description: m.description,
+				AppliedAt:   time.Now().Unix(),
+			}).Error
+		}); e != nil {
+			return fmt.Errorf("error when applying migration %d: %v", m.version, e)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"github.com/jinzhu/gorm"
+	"go-drive/common"
+	"go-drive/common/registry"
+	"go-drive/common/types"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func newTestDB(t *testing.T) (*DB, common.Config, func()) {
+	dir, e := ioutil.TempDir("", "go-drive-storage")
+	if e != nil {
+		t.Fatal(e)
+	}
+	config := common.NewSqliteConfig(dir)
+	db, e := NewDB(config, registry.NewComponentHolder())
+	if e != nil {
+		_ = os.RemoveAll(dir)
+		t.Fatal(e)
+	}
+	return db, config, func() {
+		_ = db.Dispose()
+		_ = os.RemoveAll(dir)
+	}
+}
+
+// TestMigrationsCoverModels checks that the migrated tables have the columns of the latest models,
+// a changed model must come with a new migration
+func TestMigrationsCoverModels(t *testing.T) {
+	db, _, cleanup := newTestDB(t)
+	defer cleanup()
+
+	models := []interface{}{
+		&types.User{}, &types.Group{}, &types.UserGroup{}, &types.Drive{}, &types.PathPermission{},
+		&types.PathMount{}, &types.DriveData{}, &types.DriveCache{}, &types.AccessToken{}, &types.Option{},
+		&types.UserTOTP{}, &types.TokenRevocation{}, &types.SessionRecord{}, &types.SignerKey{},
+		&types.AuditLog{}, &types.Webhook{}, &types.WebhookDelivery{}, &types.UploadHook{},
+		&types.EntryScan{}, &types.UserIdentity{}, &types.SchemaVersion{},
+	}
+	for _, m := range models {
+		scope := db.C().NewScope(m)
+		table := scope.TableName()
+		if !db.C().HasTable(table) {
+			t.Errorf("expect table '%s' created by migrations", table)
+			continue
+		}
+		for _, f := range scope.GetModelStruct().StructFields {
+			if f.IsIgnored || !f.IsNormal {
+				continue
+			}
+			if !db.C().Dialect().HasColumn(table, f.DBName) {
+				t.Errorf("expect column '%s.%s' created by migrations", table, f.DBName)
+			}
+		}
+	}
+}
+
+func TestMigrateOnly(t *testing.T) {
+	dir, e := ioutil.TempDir("", "go-drive-storage")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	config := common.NewSqliteConfig(dir)
+	config.MigrateOnly = true
+	if _, e := NewDB(config, registry.NewComponentHolder()); e != ErrMigrated {
+		t.Fatalf("expect ErrMigrated, but it's %v", e)
+	}
+
+	config.MigrateOnly = false
+	config.AutoMigrate = false
+	db, e := NewDB(config, registry.NewComponentHolder())
+	if e != nil {
+		t.Fatalf("expect no pending migrations, but it's %v", e)
+	}
+	defer func() { _ = db.Dispose() }()
+	v, e := SchemaVersion(db.C())
+	if e != nil {
+		t.Fatal(e)
+	}
+	if v != LatestSchemaVersion() {
+		t.Errorf("expect version %d, but it's %d", LatestSchemaVersion(), v)
+	}
+}
+
+func TestPendingMigrationsWithoutAutoMigrate(t *testing.T) {
+	dir, e := ioutil.TempDir("", "go-drive-storage")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	config := common.NewSqliteConfig(dir)
+	config.AutoMigrate = false
+	if _, e := NewDB(config, registry.NewComponentHolder()); e == nil {
+		t.Fatalf("expect error of the pending migrations")
+	}
+
+	dialect, args := config.GetDB()
+	db, e := gorm.Open(dialect, args)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() { _ = db.Close() }()
+	if db.HasTable(&types.SchemaVersion{}) {
+		t.Errorf("expect the database not changed when the migrations are not applied")
+	}
+}
+
+func TestMigrateLongPathKeys(t *testing.T) {
+	dir, e := ioutil.TempDir("", "go-drive-storage")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	config := common.NewSqliteConfig(dir)
+
+	// the database created before the migrations, sqlite doesn't limit the length
+	dialect, args := config.GetDB()
+	db, e := gorm.Open(dialect, args)
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer func() { _ = db.Close() }()
+	long := strings.Repeat("a/", types.PathKeyMaxLength)
+	if e := db.AutoMigrate(&schemaV1PathPermission{}).Error; e != nil {
+		t.Fatal(e)
+	}
+	if e := db.Create(&schemaV1PathPermission{Path: long, Subject: types.AnySubject}).Error; e != nil {
+		t.Fatal(e)
+	}
+
+	if _, e := NewDB(config, registry.NewComponentHolder()); e == nil || !strings.Contains(e.Error(), "path_permissions") {
+		t.Fatalf("expect the migration rejected by the long path, but it's %v", e)
+	}
+	if v, e := SchemaVersion(db); e != nil || v != 0 {
+		t.Errorf("expect no migration applied, but it's %d, %v", v, e)
+	}
+
+	if e := db.Delete(&schemaV1PathPermission{}, "path = ?", long).Error; e != nil {
+		t.Fatal(e)
+	}
+	migrated, e := NewDB(config, registry.NewComponentHolder())
+	if e != nil {
+		t.Fatalf("expect migrated after the long path removed, but it's %v", e)
+	}
+	_ = migrated.Dispose()
+}
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"github.com/jinzhu/gorm"
+	"go-drive/common/types"
+)
+
+// OptionsDAO stores the options that can be changed by admin at runtime
+type OptionsDAO struct {
+	db *DB
+}
+
+func NewOptionsDAO(db *DB) *OptionsDAO {
+	return &OptionsDAO{db}
+}
+
+// Get returns the option value, or empty string if not set
+func (o *OptionsDAO) Get(key string) (string, error) {
+	opt := types.Option{}
+	e := o.db.C().First(&opt, "opt_key = ?", key).Error
+	if gorm.IsRecordNotFoundError(e) {
+		return "", nil
+	}
+	return opt.Value, e
+}
+
+// Gets returns the values of keys, keys not set are absent from the result
+func (o *OptionsDAO) Gets(keys ...string) (types.SM, error) {
+	opts := make([]types.Option, 0)
+	e := o.db.C().Where("opt_key IN (?)", keys).Find(&opts).Error
+	if e != nil {
+		return nil, e
+	}
+	r := make(types.SM, len(opts))
+	for _, opt := range opts {
+		r[opt.Key] = opt.Value
+	}
+	return r, nil
+}
+
+// Sets saves the options, empty value deletes the option
+func (o *OptionsDAO) Sets(options types.SM) error {
+	return o.db.C().Transaction(func(tx *gorm.DB) error {
+		for key, value := range options {
+			if e := tx.Delete(&types.Option{}, "opt_key = ?", key).Error; e != nil {
+				return e
+			}
+			if value == "" {
+				continue
+			}
+			if e := tx.Create(&types.Option{Key: key, Value: value}).Error; e != nil {
+				return e
+			}
+		}
+		return nil
+	})
+}
@@ -36,6 +36,11 @@ func saveMount(db *gorm.DB, mount types.PathMount, override bool) error {
 
 func saveMounts(db *gorm.DB, mounts []types.PathMount, override bool) error {
 	for _, m := range mounts {
+		if m.Path != nil {
+			if e := checkPathKey(*m.Path); e != nil {
+				return e
+			}
+		}
 		e := saveMount(db, m, override)
 		if e != nil {
 			return e
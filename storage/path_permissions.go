@@ -40,9 +40,10 @@ func (p *PathPermissionDAO) GetChildrenByPath(subjects []string, path string, de
 	}
 	var e error = nil
 	if depth == -1 {
-		e = p.db.C().Find(&r, "path LIKE (? || '%') AND subject IN (?)", path, subjects).Error
+		e = p.db.C().Find(&r, "path LIKE ? ESCAPE '!' AND subject IN (?)", likePrefix(path), subjects).Error
 	} else {
-		e = p.db.C().Find(&r, "depth = ? AND path LIKE (? || '%') AND subject IN (?)", depth, path, subjects).Error
+		e = p.db.C().Find(&r, "depth = ? AND path LIKE ? ESCAPE '!' AND subject IN (?)",
+			depth, likePrefix(path), subjects).Error
 	}
 	return r, e
 }
@@ -56,6 +57,9 @@ func (p *PathPermissionDAO) GetByPath(path string) ([]types.PathPermission, erro
 }
 
 func (p *PathPermissionDAO) SavePathPermissions(path string, permissions []types.PathPermission) error {
+	if e := checkPathKey(path); e != nil {
+		return e
+	}
 	return p.db.C().Transaction(func(tx *gorm.DB) error {
 		if e := tx.Delete(&types.PathPermission{}, "path = ?", path).Error; e != nil {
 			return e
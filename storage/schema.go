@@ -0,0 +1,307 @@
+package storage
+
+// The models below are the snapshots of the tables created by the migrations.
+// A migration must never use the latest models in types,
+// otherwise the fresh databases and the upgraded ones will differ when the models are changed.
+// Changing a model requires a new migration with the new snapshot of it.
+
+// region version 1
+
+type schemaV1User struct {
+	Username string `gorm:"COLUMN:username;PRIMARY_KEY;NOT NULL;SIZE:32"`
+	Password string `gorm:"COLUMN:password;NOT NULL;SIZE:64"`
+}
+
+func (schemaV1User) TableName() string {
+	return "users"
+}
+
+type schemaV1Group struct {
+	Name string `gorm:"COLUMN:name;PRIMARY_KEY;NOT NULL;SIZE:32"`
+}
+
+func (schemaV1Group) TableName() string {
+	return "groups"
+}
+
+type schemaV1UserGroup struct {
+	Username  string `gorm:"COLUMN:username;PRIMARY_KEY;NOT NULL;SIZE:32"`
+	GroupName string `gorm:"COLUMN:group_name;PRIMARY_KEY;NOT NULL;SIZE:32"`
+}
+
+func (schemaV1UserGroup) TableName() string {
+	return "user_groups"
+}
+
+type schemaV1Drive struct {
+	Name    string `gorm:"COLUMN:name;PRIMARY_KEY;NOT NULL;SIZE:255"`
+	Enabled bool   `gorm:"COLUMN:enabled;NOT NULL"`
+	Type    string `gorm:"COLUMN:type;NOT NULL;SIZE:32"`
+	Config  string `gorm:"COLUMN:config;NOT NULL;SIZE:4096"`
+}
+
+func (schemaV1Drive) TableName() string {
+	return "drives"
+}
+
+type schemaV1PathPermission struct {
+	Path       string `gorm:"COLUMN:path;PRIMARY_KEY;NOT NULL;SIZE:512"`
+	Subject    string `gorm:"COLUMN:subject;PRIMARY_KEY;NOT NULL;SIZE:34"`
+	Permission uint8  `gorm:"COLUMN:permission;NOT NULL;TYPE:INTEGER"`
+	Policy     uint8  `gorm:"COLUMN:policy;NOT NULL;TYPE:INTEGER"`
+	Depth      uint8  `gorm:"COLUMN:depth;NOT NULL;TYPE:INTEGER"`
+}
+
+func (schemaV1PathPermission) TableName() string {
+	return "path_permissions"
+}
+
+type schemaV1PathMount struct {
+	Path    string `gorm:"COLUMN:path;PRIMARY_KEY;NOT NULL;SIZE:512"`
+	Name    string `gorm:"COLUMN:name;PRIMARY_KEY;NOT NULL;SIZE:255"`
+	MountAt string `gorm:"COLUMN:mount_at;NOT NULL;SIZE:4096"`
+}
+
+func (schemaV1PathMount) TableName() string {
+	return "path_mount"
+}
+
+type schemaV1DriveData struct {
+	Drive string `gorm:"COLUMN:drive;PRIMARY_KEY;NOT NULL;SIZE:255"`
+	Key   string `gorm:"COLUMN:data_key;PRIMARY_KEY;NOT NULL;SIZE:255"`
+	Value string `gorm:"COLUMN:data_value;NOT NULL;SIZE:4096"`
+}
+
+func (schemaV1DriveData) TableName() string {
+	return "drive_data"
+}
+
+type schemaV1DriveCache struct {
+	Drive     string `gorm:"COLUMN:drive;PRIMARY_KEY;NOT NULL;SIZE:255"`
+	Path      string `gorm:"COLUMN:path;PRIMARY_KEY;NOT NULL;SIZE:255"`
+	Depth     *uint8 `gorm:"COLUMN:depth;PRIMARY_KEY;NOT NULL;TYPE:INTEGER"`
+	Type      uint8  `gorm:"COLUMN:type;PRIMARY_KEY;NOT NULL;TYPE:INTEGER"`
+	Value     string `gorm:"COLUMN:cache_value;NOT NULL;TYPE:TEXT"`
+	ExpiresAt int64  `gorm:"COLUMN:expires_at;NOT NULL"`
+}
+
+func (schemaV1DriveCache) TableName() string {
+	return "drive_cache"
+}
+
+type schemaV1SchemaVersion struct {
+	Version     int    `gorm:"COLUMN:version;PRIMARY_KEY;NOT NULL;AUTO_INCREMENT:false"`
+	Description string `gorm:"COLUMN:description;NOT NULL;SIZE:255"`
+	AppliedAt   int64  `gorm:"COLUMN:applied_at;NOT NULL"`
+}
+
+func (schemaV1SchemaVersion) TableName() string {
+	return "schema_version"
+}
+
+// endregion
+
+// region version 2
+
+type schemaV2AccessToken struct {
+	Id         string `gorm:"COLUMN:id;PRIMARY_KEY;NOT NULL;SIZE:36"`
+	Username   string `gorm:"COLUMN:username;NOT NULL;SIZE:32;INDEX"`
+	Name       string `gorm:"COLUMN:name;NOT NULL;SIZE:255"`
+	TokenHash  string `gorm:"COLUMN:token_hash;NOT NULL;SIZE:64;UNIQUE_INDEX"`
+	ReadOnly   bool   `gorm:"COLUMN:read_only;NOT NULL"`
+	PathPrefix string `gorm:"COLUMN:path_prefix;NOT NULL;SIZE:4096"`
+	ExpiresAt  int64  `gorm:"COLUMN:expires_at;NOT NULL"`
+	CreatedAt  int64  `gorm:"COLUMN:created_at;NOT NULL"`
+	LastUsedAt int64  `gorm:"COLUMN:last_used_at;NOT NULL"`
+}
+
+func (schemaV2AccessToken) TableName() string {
+	return "access_tokens"
+}
+
+// endregion
+
+// region version 3
+
+type schemaV3Option struct {
+	Key   string `gorm:"COLUMN:opt_key;PRIMARY_KEY;NOT NULL;SIZE:255"`
+	Value string `gorm:"COLUMN:opt_value;NOT NULL;SIZE:4096"`
+}
+
+func (schemaV3Option) TableName() string {
+	return "options"
+}
+
+// endregion
+
+// region version 4
+
+type schemaV4UserTOTP struct {
+	Username      string `gorm:"COLUMN:username;PRIMARY_KEY;NOT NULL;SIZE:32"`
+	Secret        string `gorm:"COLUMN:secret;NOT NULL;SIZE:64"`
+	Enabled       bool   `gorm:"COLUMN:enabled;NOT NULL"`
+	RecoveryCodes string `gorm:"COLUMN:recovery_codes;NOT NULL;SIZE:1024"`
+	LastCounter   int64  `gorm:"COLUMN:last_counter;NOT NULL"`
+}
+
+func (schemaV4UserTOTP) TableName() string {
+	return "user_totp"
+}
+
+// endregion
+
+// region version 5
+
+type schemaV5TokenRevocation struct {
+	Id          string `gorm:"COLUMN:id;PRIMARY_KEY;NOT NULL;SIZE:64"`
+	RevokedAt   int64  `gorm:"COLUMN:revoked_at;NOT NULL"`
+	ExpiresAt   int64  `gorm:"COLUMN:expires_at;NOT NULL;INDEX"`
+	ReplacedBy  string `gorm:"COLUMN:replaced_by;NOT NULL;SIZE:64"`
+	Replacement string `gorm:"COLUMN:replacement;NOT NULL;TYPE:TEXT"`
+}
+
+func (schemaV5TokenRevocation) TableName() string {
+	return "token_revocations"
+}
+
+// endregion
+
+// region version 6
+
+type schemaV6SessionRecord struct {
+	Token      string `gorm:"COLUMN:token;PRIMARY_KEY;NOT NULL;SIZE:36"`
+	Username   string `gorm:"COLUMN:username;NOT NULL;SIZE:32;INDEX"`
+	Data       string `gorm:"COLUMN:data;NOT NULL;TYPE:TEXT"`
+	LastAccess int64  `gorm:"COLUMN:last_access;NOT NULL"`
+	ExpiresAt  int64  `gorm:"COLUMN:expires_at;NOT NULL;INDEX"`
+}
+
+func (schemaV6SessionRecord) TableName() string {
+	return "sessions"
+}
+
+// endregion
+
+// region version 7
+
+type schemaV7SignerKey struct {
+	Id        string `gorm:"COLUMN:id;PRIMARY_KEY;NOT NULL;SIZE:16"`
+	Secret    string `gorm:"COLUMN:secret;NOT NULL;SIZE:64"`
+	CreatedAt int64  `gorm:"COLUMN:created_at;NOT NULL"`
+	ExpiresAt int64  `gorm:"COLUMN:expires_at;NOT NULL"`
+}
+
+func (schemaV7SignerKey) TableName() string {
+	return "signer_keys"
+}
+
+// endregion
+
+// region version 8
+
+type schemaV8AuditLog struct {
+	Id        uint   `gorm:"COLUMN:id;PRIMARY_KEY;AUTO_INCREMENT"`
+	CreatedAt int64  `gorm:"COLUMN:created_at;NOT NULL;INDEX"`
+	Username  string `gorm:"COLUMN:username;NOT NULL;SIZE:32;INDEX"`
+	ClientIP  string `gorm:"COLUMN:client_ip;NOT NULL;SIZE:64"`
+	Action    string `gorm:"COLUMN:action;NOT NULL;SIZE:128;INDEX"`
+	Path      string `gorm:"COLUMN:path;NOT NULL;SIZE:4096"`
+	Target    string `gorm:"COLUMN:target;NOT NULL;SIZE:4096"`
+	Result    string `gorm:"COLUMN:result;NOT NULL;SIZE:16"`
+	Error     string `gorm:"COLUMN:error;NOT NULL;SIZE:1024"`
+	RequestID string `gorm:"COLUMN:request_id;NOT NULL;SIZE:64"`
+}
+
+func (schemaV8AuditLog) TableName() string {
+	return "audit_logs"
+}
+
+// endregion
+
+// region version 9
+
+type schemaV9Webhook struct {
+	Id         uint   `gorm:"COLUMN:id;PRIMARY_KEY;AUTO_INCREMENT"`
+	Name       string `gorm:"COLUMN:name;NOT NULL;SIZE:255"`
+	URL        string `gorm:"COLUMN:url;NOT NULL;SIZE:1024"`
+	Secret     string `gorm:"COLUMN:secret;NOT NULL;SIZE:255"`
+	Enabled    bool   `gorm:"COLUMN:enabled;NOT NULL"`
+	PathPrefix string `gorm:"COLUMN:path_prefix;NOT NULL;SIZE:4096"`
+	Events     string `gorm:"COLUMN:events;NOT NULL;SIZE:255"`
+	CreatedAt  int64  `gorm:"COLUMN:created_at;NOT NULL"`
+}
+
+func (schemaV9Webhook) TableName() string {
+	return "webhooks"
+}
+
+type schemaV9WebhookDelivery struct {
+	Id           uint   `gorm:"COLUMN:id;PRIMARY_KEY;AUTO_INCREMENT"`
+	WebhookId    uint   `gorm:"COLUMN:webhook_id;NOT NULL;INDEX"`
+	Event        string `gorm:"COLUMN:event;NOT NULL;SIZE:32"`
+	Path         string `gorm:"COLUMN:path;NOT NULL;SIZE:4096"`
+	Payload      string `gorm:"COLUMN:payload;NOT NULL;TYPE:TEXT"`
+	Status       string `gorm:"COLUMN:status;NOT NULL;SIZE:16"`
+	Attempts     int    `gorm:"COLUMN:attempts;NOT NULL"`
+	ResponseCode int    `gorm:"COLUMN:response_code;NOT NULL"`
+	Error        string `gorm:"COLUMN:error;NOT NULL;SIZE:1024"`
+	CreatedAt    int64  `gorm:"COLUMN:created_at;NOT NULL;INDEX"`
+	UpdatedAt    int64  `gorm:"COLUMN:updated_at;NOT NULL"`
+}
+
+func (schemaV9WebhookDelivery) TableName() string {
+	return "webhook_deliveries"
+}
+
+// endregion
+
+// region version 10
+
+type schemaV10UploadHook struct {
+	Id        uint   `gorm:"COLUMN:id;PRIMARY_KEY;AUTO_INCREMENT"`
+	Name      string `gorm:"COLUMN:name;NOT NULL;SIZE:255"`
+	Pattern   string `gorm:"COLUMN:pattern;NOT NULL;SIZE:4096"`
+	Command   string `gorm:"COLUMN:command;NOT NULL;SIZE:4096"`
+	Timeout   int    `gorm:"COLUMN:timeout;NOT NULL"`
+	Enabled   bool   `gorm:"COLUMN:enabled;NOT NULL"`
+	CreatedAt int64  `gorm:"COLUMN:created_at;NOT NULL"`
+}
+
+func (schemaV10UploadHook) TableName() string {
+	return "upload_hooks"
+}
+
+// endregion
+
+// region version 11
+
+type schemaV11EntryScan struct {
+	Path      string `gorm:"COLUMN:path;PRIMARY_KEY;NOT NULL;SIZE:512"`
+	Dir       string `gorm:"COLUMN:dir;NOT NULL;SIZE:512;INDEX"`
+	Verdict   string `gorm:"COLUMN:verdict;NOT NULL;SIZE:16"`
+	Size      int64  `gorm:"COLUMN:size;NOT NULL"`
+	ScannedAt int64  `gorm:"COLUMN:scanned_at;NOT NULL"`
+}
+
+func (schemaV11EntryScan) TableName() string {
+	return "entry_scans"
+}
+
+// endregion
+
+// region version 12
+
+type schemaV12UserIdentity struct {
+	Issuer         string `gorm:"COLUMN:issuer;PRIMARY_KEY;NOT NULL;SIZE:255"`
+	Subject        string `gorm:"COLUMN:subject;PRIMARY_KEY;NOT NULL;SIZE:255"`
+	Username       string `gorm:"COLUMN:username;NOT NULL;SIZE:32;INDEX"`
+	Provisioned    bool   `gorm:"COLUMN:provisioned;NOT NULL"`
+	AssignedGroups string `gorm:"COLUMN:assigned_groups;NOT NULL;SIZE:1024"`
+	CreatedAt      int64  `gorm:"COLUMN:created_at;NOT NULL"`
+}
+
+func (schemaV12UserIdentity) TableName() string {
+	return "user_identities"
+}
+
+// endregion
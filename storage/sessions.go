@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"github.com/jinzhu/gorm"
+	"go-drive/common/types"
+)
+
+type SessionDAO struct {
+	db *DB
+}
+
+func NewSessionDAO(db *DB) *SessionDAO {
+	return &SessionDAO{db}
+}
+
+// GetSession returns nil if the session does not exist or is expired
+func (s *SessionDAO) GetSession(token string, now int64) (*types.SessionRecord, error) {
+	r := types.SessionRecord{}
+	e := s.db.C().First(&r, "token = ? AND (expires_at = 0 OR expires_at > ?)", token, now).Error
+	if gorm.IsRecordNotFoundError(e) {
+		return nil, nil
+	}
+	if e != nil {
+		return nil, e
+	}
+	return &r, nil
+}
+
+// ListSessions lists the valid sessions of the user, or all users if username is empty
+func (s *SessionDAO) ListSessions(username string, now int64) ([]types.SessionRecord, error) {
+	rs := make([]types.SessionRecord, 0)
+	db := s.db.C().Where("expires_at = 0 OR expires_at > ?", now)
+	if username != "" {
+		db = db.Where("username = ?", username)
+	}
+	e := db.Find(&rs).Error
+	return rs, e
+}
+
+func (s *SessionDAO) AddSession(r types.SessionRecord) error {
+	return s.db.C().Create(&r).Error
+}
+
+// UpdateSession updates the data of the session, returns false if the session does not exist or is expired
+func (s *SessionDAO) UpdateSession(r types.SessionRecord, now int64) (bool, error) {
+	db := s.db.C().Model(&types.SessionRecord{}).
+		Where("token = ? AND (expires_at = 0 OR expires_at > ?)", r.Token, now).
+		Updates(map[string]interface{}{
+			"username":    r.Username,
+			"data":        r.Data,
+			"last_access": r.LastAccess,
+			"expires_at":  r.ExpiresAt,
+		})
+	if db.Error != nil || db.RowsAffected == 1 {
+		return db.Error == nil, db.Error
+	}
+	// MySQL reports 0 affected rows if the values are not changed
+	exists, e := s.GetSession(r.Token, now)
+	return exists != nil, e
+}
+
+// TouchSession updates the last access time, and the expiration time if expiresAt is not 0
+func (s *SessionDAO) TouchSession(token string, lastAccess, expiresAt int64) error {
+	data := map[string]interface{}{"last_access": lastAccess}
+	if expiresAt != 0 {
+		data["expires_at"] = expiresAt
+	}
+	return s.db.C().Model(&types.SessionRecord{}).Where("token = ?", token).Updates(data).Error
+}
+
+func (s *SessionDAO) DeleteSession(token string) error {
+	return s.db.C().Delete(&types.SessionRecord{}, "token = ?", token).Error
+}
+
+// CleanExpired deletes the sessions expired before now
+func (s *SessionDAO) CleanExpired(now int64) (int64, error) {
+	db := s.db.C().Delete(&types.SessionRecord{}, "expires_at <> 0 AND expires_at <= ?", now)
+	return db.RowsAffected, db.Error
+}
+
+// CountSessions returns the number of total and active sessions
+func (s *SessionDAO) CountSessions(now int64) (int, int, error) {
+	total, active := 0, 0
+	if e := s.db.C().Model(&types.SessionRecord{}).Count(&total).Error; e != nil {
+		return 0, 0, e
+	}
+	e := s.db.C().Model(&types.SessionRecord{}).
+		Where("expires_at = 0 OR expires_at > ?", now).Count(&active).Error
+	return total, active, e
+}
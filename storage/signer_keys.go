@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"github.com/jinzhu/gorm"
+	"go-drive/common/types"
+)
+
+type SignerKeyDAO struct {
+	db *DB
+}
+
+func NewSignerKeyDAO(db *DB) *SignerKeyDAO {
+	return &SignerKeyDAO{db}
+}
+
+// ListKeys returns the keys not expired at now, ordered by created_at
+func (s *SignerKeyDAO) ListKeys(now int64) ([]types.SignerKey, error) {
+	keys := make([]types.SignerKey, 0)
+	e := s.db.C().Where("expires_at = 0 OR expires_at > ?", now).Order("created_at").Find(&keys).Error
+	return keys, e
+}
+
+// Rotate retires the active keys at retireAt, deletes expired keys and adds the new key
+func (s *SignerKeyDAO) Rotate(key types.SignerKey, retireAt int64) error {
+	return s.db.C().Transaction(func(tx *gorm.DB) error {
+		if e := tx.Model(&types.SignerKey{}).Where("expires_at = 0").
+			Update("expires_at", retireAt).Error; e != nil {
+			return e
+		}
+		if e := tx.Delete(&types.SignerKey{}, "expires_at <> 0 AND expires_at <= ?", key.CreatedAt).Error; e != nil {
+			return e
+		}
+		return tx.Create(&key).Error
+	})
+}
@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"go-drive/common/types"
+)
+
+type TokenRevocationDAO struct {
+	db *DB
+}
+
+func NewTokenRevocationDAO(db *DB) *TokenRevocationDAO {
+	return &TokenRevocationDAO{db}
+}
+
+// GetRevocations returns the revocations of the ids
+func (t *TokenRevocationDAO) GetRevocations(ids ...string) ([]types.TokenRevocation, error) {
+	rs := make([]types.TokenRevocation, 0)
+	e := t.db.C().Where("id IN (?)", ids).Find(&rs).Error
+	return rs, e
+}
+
+// Revoke adds or replaces the revocation
+func (t *TokenRevocationDAO) Revoke(r types.TokenRevocation) error {
+	return t.db.C().Save(&r).Error
+}
+
+// CleanExpired deletes revocations expired before the unix timestamp
+func (t *TokenRevocationDAO) CleanExpired(before int64) (int64, error) {
+	s := t.db.C().Delete(&types.TokenRevocation{}, "expires_at < ?", before)
+	return s.RowsAffected, s.Error
+}
+
+func (t *TokenRevocationDAO) Count() (int, error) {
+	n := 0
+	e := t.db.C().Model(&types.TokenRevocation{}).Count(&n).Error
+	return n, e
+}
@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"github.com/jinzhu/gorm"
+	"go-drive/common/errors"
+	"go-drive/common/types"
+)
+
+type UploadHookDAO struct {
+	db *DB
+}
+
+func NewUploadHookDAO(db *DB) *UploadHookDAO {
+	return &UploadHookDAO{db}
+}
+
+func (u *UploadHookDAO) GetHooks() ([]types.UploadHook, error) {
+	hooks := make([]types.UploadHook, 0)
+	e := u.db.C().Order("id").Find(&hooks).Error
+	return hooks, e
+}
+
+func (u *UploadHookDAO) GetHook(id uint) (types.UploadHook, error) {
+	hook := types.UploadHook{}
+	e := u.db.C().Where("id = ?", id).First(&hook).Error
+	if gorm.IsRecordNotFoundError(e) {
+		return hook, err.NewNotFoundError()
+	}
+	return hook, e
+}
+
+func (u *UploadHookDAO) AddHook(hook types.UploadHook) (types.UploadHook, error) {
+	hook.Id = 0
+	e := u.db.C().Create(&hook).Error
+	return hook, e
+}
+
+func (u *UploadHookDAO) UpdateHook(id uint, hook types.UploadHook) error {
+	hook.Id = id
+	return u.db.C().Save(&hook).Error
+}
+
+func (u *UploadHookDAO) DeleteHook(id uint) error {
+	return u.db.C().Delete(&types.UploadHook{}, "id = ?", id).Error
+}
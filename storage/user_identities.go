@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"github.com/jinzhu/gorm"
+	"go-drive/common/errors"
+	"go-drive/common/i18n"
+	"go-drive/common/types"
+	"time"
+)
+
+type UserIdentityDAO struct {
+	db *DB
+}
+
+func NewUserIdentityDAO(db *DB) *UserIdentityDAO {
+	return &UserIdentityDAO{db}
+}
+
+// Get returns nil if the identity is not bound to any user
+func (u *UserIdentityDAO) Get(issuer, subject string) (*types.UserIdentity, error) {
+	i := types.UserIdentity{}
+	e := u.db.C().First(&i, "issuer = ? AND subject = ?", issuer, subject).Error
+	if gorm.IsRecordNotFoundError(e) {
+		return nil, nil
+	}
+	if e != nil {
+		return nil, e
+	}
+	return &i, nil
+}
+
+func (u *UserIdentityDAO) ListByUser(username string) ([]types.UserIdentity, error) {
+	identities := make([]types.UserIdentity, 0)
+	e := u.db.C().Where("username = ?", username).Find(&identities).Error
+	return identities, e
+}
+
+func (u *UserIdentityDAO) ListByIssuer(issuer string) ([]types.UserIdentity, error) {
+	identities := make([]types.UserIdentity, 0)
+	e := u.db.C().Where("issuer = ?", issuer).Find(&identities).Error
+	return identities, e
+}
+
+// Add binds the identity to the user, it fails if the identity is bound to any user
+func (u *UserIdentityDAO) Add(identity types.UserIdentity) (types.UserIdentity, error) {
+	exists, e := u.Get(identity.Issuer, identity.Subject)
+	if e != nil {
+		return types.UserIdentity{}, e
+	}
+	if exists != nil {
+		return types.UserIdentity{}, err.NewNotAllowedMessageError(
+			i18n.T("storage.user_identities.identity_exists", exists.Username))
+	}
+	identity.CreatedAt = time.Now().Unix()
+	e = u.db.C().Create(&identity).Error
+	return identity, e
+}
+
+func (u *UserIdentityDAO) UpdateAssignedGroups(issuer, subject, groups string) error {
+	return u.db.C().Model(&types.UserIdentity{}).
+		Where("issuer = ? AND subject = ?", issuer, subject).
+		UpdateColumn("assigned_groups", groups).Error
+}
+
+func (u *UserIdentityDAO) Delete(issuer, subject string) error {
+	return u.db.C().Delete(&types.UserIdentity{}, "issuer = ? AND subject = ?", issuer, subject).Error
+}
@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"github.com/jinzhu/gorm"
+	"go-drive/common/types"
+)
+
+type UserTOTPDAO struct {
+	db *DB
+}
+
+func NewUserTOTPDAO(db *DB) *UserTOTPDAO {
+	return &UserTOTPDAO{db}
+}
+
+// Get returns nil if the user has no TOTP
+func (u *UserTOTPDAO) Get(username string) (*types.UserTOTP, error) {
+	t := types.UserTOTP{}
+	e := u.db.C().First(&t, "username = ?", username).Error
+	if gorm.IsRecordNotFoundError(e) {
+		return nil, nil
+	}
+	if e != nil {
+		return nil, e
+	}
+	return &t, nil
+}
+
+func (u *UserTOTPDAO) Save(t types.UserTOTP) error {
+	return u.db.C().Transaction(func(tx *gorm.DB) error {
+		if e := tx.Delete(&types.UserTOTP{}, "username = ?", t.Username).Error; e != nil {
+			return e
+		}
+		return tx.Create(&t).Error
+	})
+}
+
+// UpdateLastCounter updates the last used counter, returns false if the counter is used
+func (u *UserTOTPDAO) UpdateLastCounter(username string, counter int64) (bool, error) {
+	s := u.db.C().Model(&types.UserTOTP{}).
+		Where("username = ? AND last_counter < ?", username, counter).
+		Update("last_counter", counter)
+	return s.RowsAffected == 1, s.Error
+}
+
+// UpdateRecoveryCodes replaces the recovery codes if they are not changed by others
+func (u *UserTOTPDAO) UpdateRecoveryCodes(username, old, codes string) (bool, error) {
+	s := u.db.C().Model(&types.UserTOTP{}).
+		Where("username = ? AND recovery_codes = ?", username, old).
+		Update("recovery_codes", codes)
+	return s.RowsAffected == 1, s.Error
+}
+
+func (u *UserTOTPDAO) Delete(username string) error {
+	return u.db.C().Delete(&types.UserTOTP{}, "username = ?", username).Error
+}
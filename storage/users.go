@@ -90,6 +90,15 @@ func (u *UserDAO) DeleteUser(username string) error {
 		if e := tx.Where("username = ?", username).Delete(&types.UserGroup{}).Error; e != nil {
 			return e
 		}
+		if e := tx.Where("username = ?", username).Delete(&types.AccessToken{}).Error; e != nil {
+			return e
+		}
+		if e := tx.Where("username = ?", username).Delete(&types.UserTOTP{}).Error; e != nil {
+			return e
+		}
+		if e := tx.Where("username = ?", username).Delete(&types.UserIdentity{}).Error; e != nil {
+			return e
+		}
 		return tx.Where("subject = ?", types.UserSubject(username)).Delete(&types.PathPermission{}).Error
 	})
 }
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"github.com/jinzhu/gorm"
+	"go-drive/common/errors"
+	"go-drive/common/types"
+)
+
+type WebhookDAO struct {
+	db *DB
+}
+
+func NewWebhookDAO(db *DB) *WebhookDAO {
+	return &WebhookDAO{db}
+}
+
+func (w *WebhookDAO) GetWebhooks() ([]types.Webhook, error) {
+	webhooks := make([]types.Webhook, 0)
+	e := w.db.C().Order("id").Find(&webhooks).Error
+	return webhooks, e
+}
+
+func (w *WebhookDAO) GetWebhook(id uint) (types.Webhook, error) {
+	webhook := types.Webhook{}
+	e := w.db.C().Where("id = ?", id).First(&webhook).Error
+	if gorm.IsRecordNotFoundError(e) {
+		return webhook, err.NewNotFoundError()
+	}
+	return webhook, e
+}
+
+func (w *WebhookDAO) AddWebhook(webhook types.Webhook) (types.Webhook, error) {
+	webhook.Id = 0
+	e := w.db.C().Create(&webhook).Error
+	return webhook, e
+}
+
+func (w *WebhookDAO) UpdateWebhook(id uint, webhook types.Webhook) error {
+	webhook.Id = id
+	return w.db.C().Save(&webhook).Error
+}
+
+// DeleteWebhook deletes the webhook and its deliveries
+func (w *WebhookDAO) DeleteWebhook(id uint) error {
+	return w.db.C().Transaction(func(tx *gorm.DB) error {
+		if e := tx.Delete(&types.WebhookDelivery{}, "webhook_id = ?", id).Error; e != nil {
+			return e
+		}
+		return tx.Delete(&types.Webhook{}, "id = ?", id).Error
+	})
+}
+
+func (w *WebhookDAO) AddDelivery(d types.WebhookDelivery) (types.WebhookDelivery, error) {
+	e := w.db.C().Create(&d).Error
+	return d, e
+}
+
+// UpdateDeliveryResult updates the result of the last attempt,
+// UpdateColumns is used to keep the unix timestamp UpdatedAt from being set by gorm
+func (w *WebhookDAO) UpdateDeliveryResult(d types.WebhookDelivery) error {
+	return w.db.C().Model(&types.WebhookDelivery{}).Where("id = ?", d.Id).UpdateColumns(map[string]interface{}{
+		"status":        d.Status,
+		"attempts":      d.Attempts,
+		"response_code": d.ResponseCode,
+		"error":         d.Error,
+		"updated_at":    d.UpdatedAt,
+	}).Error
+}
+
+// GetPendingDeliveries returns the deliveries that are not finished
+func (w *WebhookDAO) GetPendingDeliveries() ([]types.WebhookDelivery, error) {
+	deliveries := make([]types.WebhookDelivery, 0)
+	e := w.db.C().Where("status = ?", types.DeliveryPending).Order("id").Find(&deliveries).Error
+	return deliveries, e
+}
+
+// GetDeliveries returns the deliveries of the webhook in reverse chronological order and the total count
+func (w *WebhookDAO) GetDeliveries(webhookId uint, offset, limit int) ([]types.WebhookDelivery, int, error) {
+	db := w.db.C().Model(&types.WebhookDelivery{}).Where("webhook_id = ?", webhookId)
+	total := 0
+	if e := db.Count(&total).Error; e != nil {
+		return nil, 0, e
+	}
+	deliveries := make([]types.WebhookDelivery, 0)
+	e := db.Order("id DESC").Offset(offset).Limit(limit).Find(&deliveries).Error
+	return deliveries, total, e
+}
+
+// CleanDeliveriesBefore deletes the deliveries created before the unix timestamp
+func (w *WebhookDAO) CleanDeliveriesBefore(before int64) (int64, error) {
+	r := w.db.C().Delete(&types.WebhookDelivery{}, "created_at < ?", before)
+	return r.RowsAffected, r.Error
+}
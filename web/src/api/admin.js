@@ -92,6 +92,106 @@ export function cleanDriveCache (name) {
   return axios.delete(`/admin/drive-cache/${name}`)
 }
 
+export function getAuditLogs (params) {
+  return axios.get('/admin/audit-logs', { params })
+}
+
+export function exportAuditLogs (params) {
+  return axios.get('/admin/audit-logs/export', { params, responseType: 'blob' })
+}
+
+export function getWebhooks () {
+  return axios.get('/admin/webhooks')
+}
+
+export function addWebhook (webhook) {
+  return axios.post('/admin/webhook', webhook)
+}
+
+export function updateWebhook (id, webhook) {
+  return axios.put(`/admin/webhook/${id}`, webhook)
+}
+
+export function deleteWebhook (id) {
+  return axios.delete(`/admin/webhook/${id}`)
+}
+
+export function getWebhookDeliveries (id, params) {
+  return axios.get(`/admin/webhook/${id}/deliveries`, { params })
+}
+
+export function getUploadHooks () {
+  return axios.get('/admin/upload-hooks')
+}
+
+export function addUploadHook (hook) {
+  return axios.post('/admin/upload-hook', hook)
+}
+
+export function updateUploadHook (id, hook) {
+  return axios.put(`/admin/upload-hook/${id}`, hook)
+}
+
+export function deleteUploadHook (id) {
+  return axios.delete(`/admin/upload-hook/${id}`)
+}
+
+export function getLogLevels () {
+  return axios.get('/admin/log-levels')
+}
+
+export function setLogLevels (levels) {
+  return axios.put('/admin/log-levels', levels)
+}
+
+export function getOptions (keys) {
+  return axios.get(`/admin/options/${keys.join(',')}`)
+}
+
+export function saveOptions (options) {
+  return axios.put('/admin/options', options)
+}
+
+export function resetUserTwoFactor (username) {
+  return axios.delete(`/admin/user/${username}/2fa`)
+}
+
+export function getAllSessions (username) {
+  return axios.get('/admin/sessions', { params: { username } })
+}
+
+export function revokeUserSession (id) {
+  return axios.delete(`/admin/session/${id}`)
+}
+
+export function revokeUserSessions (username) {
+  return axios.delete(`/admin/user/${username}/sessions`)
+}
+
+export function getLoginLockouts () {
+  return axios.get('/admin/lockouts')
+}
+
+/**
+ * @param {string} type 'user' or 'ip'
+ * @param {string} value username or ip
+ */
+export function clearLoginLockout (type, value) {
+  return axios.delete(`/admin/lockout/${type}/${encodeURIComponent(value)}`)
+}
+
+export function clearLoginLockouts () {
+  return axios.delete('/admin/lockouts')
+}
+
+export function rotateSignerKey () {
+  return axios.post('/admin/signer/rotate')
+}
+
+export function syncLDAPGroups () {
+  return axios.post('/admin/ldap/sync')
+}
+
 export function loadStats () {
   return axios.get('/admin/stats')
 }
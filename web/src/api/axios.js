@@ -3,6 +3,7 @@ import Axios from 'axios'
 import { getLang } from '@/i18n'
 
 const AUTH_HEADER = 'Authorization'
+const RENEWED_TOKEN_HEADER = 'x-renewed-token'
 const TOKEN_KEY = 'token'
 const MAX_RETRY = 1
 
@@ -209,7 +210,7 @@ function setToken (token) {
   return localStorage.setItem(TOKEN_KEY, token)
 }
 
-function getToken () {
+export function getToken () {
   return localStorage.getItem(TOKEN_KEY)
 }
 
@@ -239,7 +240,20 @@ async function processConfig (config) {
   return config
 }
 
+/**
+ * replace the token if the server issued a new one for the session
+ * @param {import('axios').AxiosResponse} resp
+ */
+function renewToken (resp) {
+  const token = resp && resp.headers[RENEWED_TOKEN_HEADER]
+  if (token && getToken() === resp.config._tokenUsing) {
+    setToken(token)
+  }
+}
+
 async function handlerError (e) {
+  renewToken(e.response)
+
   if (Axios.isCancel(e)) {
     throw new ApiError(-1, e.message || 'canceled', null, true)
   }
@@ -260,7 +274,10 @@ async function handlerError (e) {
 }
 
 axios.interceptors.request.use(processConfig)
-axios.interceptors.response.use(resp => resp.data, handlerError)
+axios.interceptors.response.use(resp => {
+  renewToken(resp)
+  return resp.data
+}, handlerError)
 
 export default axios
 export const axiosWrapper = wrapAxios(axios)
@@ -1,5 +1,5 @@
 
-import axios, { API_PATH, axiosWrapper } from './axios'
+import axios, { API_PATH, axiosWrapper, getToken } from './axios'
 
 const ACCESS_KEY = '_k'
 
@@ -7,6 +7,48 @@ export function listEntries (path) {
   return axiosWrapper.get(`/entries/${path}`)
 }
 
+/**
+ * list a page of entries
+ * @param {string} path
+ * @param {{cursor?: string, limit?: number, sort?: string, order?: string, filter?: string}} params
+ */
+export function listEntriesPage (path, params) {
+  return axiosWrapper.get(`/entries/${path}`, { params })
+}
+
+/**
+ * subscribe the changes of the dir and its children, returns the function to unsubscribe
+ * @param {string} path
+ * @param {(event: {type: string, path: string, from?: string}) => void} onChange
+ * @param {() => void} [onOverflow] called when some changes are dropped, the dir should be reloaded
+ */
+export function subscribeEntries (path, onChange, onOverflow) {
+  const controller = new AbortController()
+  fetch(`${API_PATH}/events/${path}`, {
+    headers: { Authorization: getToken() },
+    signal: controller.signal
+  }).then(async resp => {
+    const reader = resp.body.getReader()
+    const decoder = new TextDecoder()
+    let buf = ''
+    for (;;) {
+      const { done, value } = await reader.read()
+      if (done) break
+      buf += decoder.decode(value, { stream: true })
+      let i
+      while ((i = buf.indexOf('\n\n')) >= 0) {
+        const lines = buf.substr(0, i).split('\n')
+        buf = buf.substr(i + 2)
+        const event = (lines.find(l => l.startsWith('event:')) || '').substr(6)
+        const data = (lines.find(l => l.startsWith('data:')) || '').substr(5)
+        if (event === 'change') onChange(JSON.parse(data))
+        else if (event === 'overflow' && onOverflow) onOverflow()
+      }
+    }
+  }).catch(() => { })
+  return () => controller.abort()
+}
+
 export function getEntry (path) {
   return axiosWrapper.get(`/entry/${path}`)
 }
@@ -43,6 +85,10 @@ export function moveEntry (from, to, override) {
   })
 }
 
+export function offlineDownload (url, path, override, headers) {
+  return axios.post('/offline-download', { url, path, override: !!override, headers })
+}
+
 export function getTask (id) {
   return axiosWrapper.get(`/task/${id}`)
 }
@@ -78,3 +124,75 @@ export function logout () {
 export function getUser () {
   return axiosWrapper.get('/auth/user')
 }
+
+export function getOIDCConfig () {
+  return axios.get('/auth/oidc')
+}
+
+/**
+ * start OpenID Connect login, the browser should be redirected to the returned url
+ */
+export function startOIDCLogin (redirect) {
+  return axios.post('/auth/oidc/login', { redirect })
+}
+
+export function getTwoFactorStatus () {
+  return axios.get('/auth/2fa')
+}
+
+/**
+ * complete the login when the login result requires 2FA
+ * @param {string} code TOTP code or recovery code
+ */
+export function verifyTwoFactor (code) {
+  return axios.post('/auth/2fa/verify', { code })
+}
+
+/**
+ * returns the secret and the otpauth uri(QR code payload)
+ */
+export function enrollTwoFactor () {
+  return axios.post('/auth/2fa/enroll')
+}
+
+/**
+ * returns the recovery codes
+ */
+export function enableTwoFactor (code) {
+  return axios.post('/auth/2fa/enable', { code })
+}
+
+export function disableTwoFactor (code) {
+  return axios.post('/auth/2fa/disable', { code })
+}
+
+export function regenerateRecoveryCodes (code) {
+  return axios.post('/auth/2fa/recovery-codes', { code })
+}
+
+export function getSessions () {
+  return axios.get('/auth/sessions')
+}
+
+export function revokeSession (id) {
+  return axios.delete(`/auth/session/${id}`)
+}
+
+/**
+ * revoke all sessions except the current one
+ */
+export function revokeOtherSessions () {
+  return axios.delete('/auth/sessions')
+}
+
+export function getAccessTokens () {
+  return axios.get('/auth/tokens')
+}
+
+export function createAccessToken (token) {
+  return axios.post('/auth/token', token)
+}
+
+export function deleteAccessToken (id) {
+  return axios.delete(`/auth/token/${id}`)
+}
@@ -10,8 +10,6 @@ import (
 	"go-drive/common/i18n"
 	"go-drive/common/registry"
 	"go-drive/common/task"
-	"go-drive/common/types"
-	"go-drive/common/utils"
 	"go-drive/drive"
 	"go-drive/server"
 	"go-drive/storage"
@@ -28,12 +26,33 @@ func Initialize(ctx context.Context, ch *registry.ComponentsHolder) (*gin.Engine
 		storage.NewPathMountDAO,
 		storage.NewDriveDAO,
 		storage.NewDriveDataDAO,
+		storage.NewAccessTokenDAO,
+		storage.NewOptionsDAO,
+		storage.NewUserTOTPDAO,
+		storage.NewUserIdentityDAO,
+		storage.NewTokenRevocationDAO,
+		storage.NewSessionDAO,
+		storage.NewAuditLogDAO,
+		storage.NewWebhookDAO,
+		storage.NewUploadHookDAO,
+		storage.NewEntryScanDAO,
 		wire.Bind(new(task.Runner), new(*task.TunnyRunner)),
 		task.NewTunnyRunner,
-		utils.NewSigner,
-		wire.Bind(new(types.TokenStore), new(*server.FileTokenStore)),
-		server.NewFileTokenStore,
+		storage.NewSignerKeyDAO,
+		server.NewSignerKeyManager,
+		server.GetSigner,
+		server.NewTokenStore,
+		server.NewTwoFactorAuth,
+		server.NewLoginLimiter,
+		server.NewAuditor,
+		server.NewWebhooks,
+		server.NewUploadHooks,
+		server.NewVirusScanner,
+		server.NewOIDCLogin,
+		server.NewLDAPAuth,
 		server.NewChunkUploader,
+		server.NewTusUploader,
+		server.NewOfflineDownloader,
 		server.NewThumbnail,
 		drive.NewRootDrive,
 		wire.Bind(new(i18n.MessageSource), new(*i18n.FileMessageSource)),
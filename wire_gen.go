@@ -12,7 +12,6 @@ import (
 	"go-drive/common/i18n"
 	"go-drive/common/registry"
 	"go-drive/common/task"
-	"go-drive/common/utils"
 	"go-drive/drive"
 	"go-drive/server"
 	"go-drive/storage"
@@ -37,7 +36,9 @@ func Initialize(ctx context.Context, ch *registry.ComponentsHolder) (*gin.Engine
 	if err != nil {
 		return nil, err
 	}
-	fileTokenStore, err := server.NewFileTokenStore(config, ch)
+	tokenRevocationDAO := storage.NewTokenRevocationDAO(db)
+	sessionDAO := storage.NewSessionDAO(db)
+	tokenStore, err := server.NewTokenStore(config, ch, tokenRevocationDAO, sessionDAO)
 	if err != nil {
 		return nil, err
 	}
@@ -45,19 +46,54 @@ func Initialize(ctx context.Context, ch *registry.ComponentsHolder) (*gin.Engine
 	if err != nil {
 		return nil, err
 	}
-	signer := utils.NewSigner()
-	chunkUploader, err := server.NewChunkUploader(config)
+	signerKeyDAO := storage.NewSignerKeyDAO(db)
+	signerKeyManager, err := server.NewSignerKeyManager(config, ch, signerKeyDAO)
+	if err != nil {
+		return nil, err
+	}
+	signer := server.GetSigner(signerKeyManager)
+	chunkUploader, err := server.NewChunkUploader(config, ch)
+	if err != nil {
+		return nil, err
+	}
+	tusUploader, err := server.NewTusUploader(config, ch)
 	if err != nil {
 		return nil, err
 	}
 	tunnyRunner := task.NewTunnyRunner(config, ch)
 	userDAO := storage.NewUserDAO(db)
+	accessTokenDAO := storage.NewAccessTokenDAO(db)
+	optionsDAO := storage.NewOptionsDAO(db)
+	offlineDownloader := server.NewOfflineDownloader(config, optionsDAO)
 	groupDAO := storage.NewGroupDAO(db)
+	userTOTPDAO := storage.NewUserTOTPDAO(db)
+	userIdentityDAO := storage.NewUserIdentityDAO(db)
+	twoFactorAuth := server.NewTwoFactorAuth(userTOTPDAO, optionsDAO)
+	loginLimiter := server.NewLoginLimiter(ch)
+	oidcLogin := server.NewOIDCLogin(ch, optionsDAO, userDAO, groupDAO, userIdentityDAO, tokenStore, twoFactorAuth)
+	ldapAuth := server.NewLDAPAuth(ch, optionsDAO, userDAO, groupDAO, userIdentityDAO)
 	pathPermissionDAO := storage.NewPathPermissionDAO(db)
+	auditLogDAO := storage.NewAuditLogDAO(db)
+	auditor := server.NewAuditor(config, ch, auditLogDAO)
+	webhookDAO := storage.NewWebhookDAO(db)
+	webhooks, err := server.NewWebhooks(ch, rootDrive, webhookDAO)
+	if err != nil {
+		return nil, err
+	}
+	uploadHookDAO := storage.NewUploadHookDAO(db)
+	uploadHooks, err := server.NewUploadHooks(config, ch, uploadHookDAO)
+	if err != nil {
+		return nil, err
+	}
+	entryScanDAO := storage.NewEntryScanDAO(db)
+	virusScanner, err := server.NewVirusScanner(config, ch, rootDrive, entryScanDAO)
+	if err != nil {
+		return nil, err
+	}
 	fileMessageSource, err := i18n.NewFileMessageSource(config)
 	if err != nil {
 		return nil, err
 	}
-	engine := server.InitServer(config, ch, rootDrive, fileTokenStore, thumbnail, signer, chunkUploader, tunnyRunner, userDAO, groupDAO, driveDAO, driveCacheDAO, driveDataDAO, pathPermissionDAO, pathMountDAO, fileMessageSource)
+	engine := server.InitServer(config, ch, rootDrive, tokenStore, thumbnail, signer, chunkUploader, tusUploader, offlineDownloader, tunnyRunner, userDAO, accessTokenDAO, optionsDAO, oidcLogin, ldapAuth, twoFactorAuth, loginLimiter, signerKeyManager, groupDAO, userIdentityDAO, driveDAO, driveCacheDAO, driveDataDAO, pathPermissionDAO, pathMountDAO, auditor, auditLogDAO, webhooks, webhookDAO, uploadHooks, uploadHookDAO, virusScanner, fileMessageSource)
 	return engine, nil
 }